@@ -1,6 +1,5 @@
 package go_toolbox
 
-import "C"
 import (
 	"context"
 	"errors"
@@ -30,6 +29,7 @@ type CKHandler struct {
 	ClickhouseConf
 	clickHouseConnect *sqlx.DB
 	InsertSql         string
+	ready             *readiness
 }
 
 func (c *CKHandler) QueryData(items interface{}, query string) error {
@@ -119,7 +119,16 @@ func (c *CKHandler) BatchInsertData(query string, dataArrays [][]interface{}) (b
 	return true, nil
 }
 
-func (c *CKHandler) InitClickHouse() {
+func (c *CKHandler) ping(ctx context.Context) error {
+	pingErr := c.clickHouseConnect.PingContext(ctx)
+	if exception, ok := pingErr.(*clickhouse.Exception); ok {
+		return fmt.Errorf("%w; [%d] %s; %s", pingErr, exception.Code, exception.Message, exception.StackTrace)
+	}
+	return pingErr
+}
+
+func (c *CKHandler) initClickHouse(o connectOptions) error {
+	c.ready = newReadiness("ClickHouse")
 	// &debug=true
 	ckConnect, connectErr := sqlx.Open(
 		"clickhouse",
@@ -127,18 +136,56 @@ func (c *CKHandler) InitClickHouse() {
 			"tcp://%s:%d?username=%s&password=%s&database=%s&block_size=%d&read_timeout=%d",
 			c.Host, c.Port, c.Username, url.QueryEscape(c.Password), c.Database, ClientMaxBlockSize, ClientReadTimeout))
 	if connectErr != nil {
-		Logger.Fatal(GetLogPrefix("") + fmt.Sprintf("ClickHouse 创建连接对象失败! 错误原因: %v", connectErr))
-	}
-	if pingErr := ckConnect.Ping(); pingErr != nil {
-		if exception, ok := pingErr.(*clickhouse.Exception); ok {
-			Logger.Fatal(GetLogPrefix("") + fmt.Sprintf("ClickHouse 连接失败! 错误原因: %v; [%d] %s; %s\n", connectErr, exception.Code, exception.Message, exception.StackTrace))
-		} else {
-			Logger.Fatal(GetLogPrefix("") + fmt.Sprintf("ClickHouse 连接失败! 错误原因: %v", pingErr))
-		}
+		return fmt.Errorf("ClickHouse 创建连接对象失败! 错误原因: %w", connectErr)
 	}
 	c.clickHouseConnect = ckConnect
+	if o.background {
+		c.ready.startBackground(c.ping, o)
+		Logger.Info(GetLogPrefix("") + "ClickHouse 后台连接中!")
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), o.pingTimeout)
+	defer cancel()
+	if pingErr := c.ping(ctx); pingErr != nil {
+		_ = c.ShutdownCKHandler()
+		return fmt.Errorf("ClickHouse 连接失败! 错误原因: %w", pingErr)
+	}
+	c.ready.setReady()
 	Logger.Info(GetLogPrefix("") + fmt.Sprintf("ClickHouse 连接成功!"))
+	return nil
+}
+
+// InitClickHouse 初始化 ClickHouse 连接, 连接失败时退出进程
+func (c *CKHandler) InitClickHouse() {
+	if err := c.initClickHouse(newConnectOptions(nil)); err != nil {
+		Logger.Fatal(GetLogPrefix("") + err.Error())
+	}
+}
+
+// Ready ClickHouse 是否已连接就绪
+func (c *CKHandler) Ready() bool {
+	return c.ready.State() == ConnReady
+}
+
+// ConnState 当前连接状态
+func (c *CKHandler) ConnState() ConnState {
+	return c.ready.State()
+}
+
+// WaitReady 阻塞直到 ClickHouse 连接就绪或 ctx 结束
+func (c *CKHandler) WaitReady(ctx context.Context) error {
+	return c.ready.WaitReady(ctx)
+}
+
+// ShutdownCKHandler 关闭 ClickHouse 连接
+func (c *CKHandler) ShutdownCKHandler() error {
+	c.ready.close()
+	if c.clickHouseConnect == nil {
+		return nil
+	}
+	return c.clickHouseConnect.Close()
 }
+
 func (c *CKHandler) InitInsertSQL() {
 	keys := ""
 	values := ""
@@ -152,7 +199,7 @@ func (c *CKHandler) InitInsertSQL() {
 		}
 	}
 	c.InsertSql = fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES (%s)",
-		C.Database,
+		c.Database,
 		c.Table, keys, values)
 	//c.InsertSql = fmt.Sprintf("INSERT INTO %s.%s (*) VALUES (%s)",
 	//	utils.ConfigJson.ClickHouseConfig.Database,
@@ -161,9 +208,11 @@ func (c *CKHandler) InitInsertSQL() {
 	//)
 }
 
-func NewCKHandler(ckConf *ClickhouseConf) *CKHandler {
+// OpenCKHandler 创建 ClickHouse Handler, 连接失败时返回错误而不是退出进程
+// 传入 WithBackgroundConnect 时立即返回 connecting 状态的 Handler, 并在后台重试连接
+func OpenCKHandler(ckConf *ClickhouseConf, opts ...ConnectOption) (*CKHandler, error) {
 	client := &CKHandler{
-		ClickhouseConf{
+		ClickhouseConf: ClickhouseConf{
 			Host:       ckConf.Host,
 			Port:       ckConf.Port,
 			Username:   ckConf.Username,
@@ -172,10 +221,20 @@ func NewCKHandler(ckConf *ClickhouseConf) *CKHandler {
 			Table:      ckConf.Table,
 			DataSchema: ckConf.DataSchema,
 		},
-		nil,
-		"",
 	}
-	client.InitClickHouse()
+	if err := client.initClickHouse(newConnectOptions(opts)); err != nil {
+		return nil, err
+	}
 	client.InitInsertSQL()
+	return client, nil
+}
+
+// NewCKHandler 创建 ClickHouse Handler, 连接失败时退出进程
+// 兼容旧版本保留, 新代码请使用 OpenCKHandler
+func NewCKHandler(ckConf *ClickhouseConf) *CKHandler {
+	client, err := OpenCKHandler(ckConf)
+	if err != nil {
+		Logger.Fatal(GetLogPrefix("") + err.Error())
+	}
 	return client
 }
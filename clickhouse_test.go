@@ -1,10 +1,16 @@
 package go_toolbox
 
 import (
-	"fmt"
+	"errors"
 	"testing"
 )
 
+type userGeo struct {
+	Id       int64   `db:"id"`
+	Username string  `db:"username"`
+	Geo      float64 `db:"geo"`
+}
+
 func TestClickhouse(t *testing.T) {
 
 	dataSchema := []string{
@@ -21,22 +27,43 @@ func TestClickhouse(t *testing.T) {
 		Table:      "user_geo",
 		DataSchema: dataSchema,
 	}
-	clickhouseHandler := NewCKHandler(&config)
-	keys := ""
-	values := ""
-	for i, v := range clickhouseHandler.DataSchema {
-		if i < len(clickhouseHandler.DataSchema)-1 {
-			keys += v + ","
-			values += "?,"
-		} else {
-			keys += v
-			values += "?"
-		}
-	}
-	sql := fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES (%s)",
-		config.Database,
-		config.Table, keys, values)
-
-	fmt.Println(keys)
-	fmt.Println(sql)
+	clickhouseHandler := &CKHandler{ClickhouseConf: config}
+	clickhouseHandler.InitInsertSQL()
+	sql := "INSERT INTO group.user_geo (id,username,geo) VALUES (?,?,?)"
+	if clickhouseHandler.InsertSql != sql {
+		t.Fatalf("unexpected insert sql: %s", clickhouseHandler.InsertSql)
+	}
+
+	var store ClickHouseStore = NewFakeClickHouse()
+	if ok, err := store.InsertData(sql, 1, "elvis", 113.2); !ok || err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if ok, err := store.BatchInsertData(sql, [][]interface{}{{2, "a", 1.0}, {3, "b", 2.0}}); !ok || err != nil {
+		t.Fatalf("batch insert failed: %v", err)
+	}
+	if rows := store.(*FakeClickHouse).InsertedRows(sql); len(rows) != 3 || rows[0][1] != "elvis" {
+		t.Fatalf("unexpected recorded rows: %v", rows)
+	}
+}
+
+func TestFakeClickHouseQuery(t *testing.T) {
+	fake := NewFakeClickHouse()
+	query := "SELECT id, username, geo FROM group.user_geo"
+	fake.SetQueryResult(query, []userGeo{{Id: 1, Username: "elvis", Geo: 113.2}})
+
+	var items []userGeo
+	if err := fake.QueryData(&items, query); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(items) != 1 || items[0].Username != "elvis" {
+		t.Fatalf("unexpected rows: %v", items)
+	}
+	if err := fake.QueryData(&items, "SELECT 1"); err != nil || len(items) != 0 {
+		t.Fatalf("expected empty result for unknown query, got %v %v", items, err)
+	}
+
+	fake.SetError(errors.New("boom"))
+	if _, err := fake.InsertData(query, 1); err == nil {
+		t.Fatal("expected injected error")
+	}
 }
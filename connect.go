@@ -0,0 +1,260 @@
+package go_toolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConnState 连接状态
+type ConnState int32
+
+const (
+	ConnConnecting ConnState = iota
+	ConnReady
+	ConnClosed
+)
+
+const (
+	DefaultConnectInitialBackoff = 500 * time.Millisecond
+	DefaultConnectMaxBackoff     = 30 * time.Second
+	DefaultConnectCheckInterval  = 5 * time.Second
+	DefaultConnectPingTimeout    = 3 * time.Second
+)
+
+// ErrHandlerClosed Handler 已关闭
+var ErrHandlerClosed = errors.New("Handler 已关闭")
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnConnecting:
+		return "connecting"
+	case ConnReady:
+		return "ready"
+	case ConnClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("unknown(%d)", int32(s))
+	}
+}
+
+type connectOptions struct {
+	background     bool
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	checkInterval  time.Duration
+	pingTimeout    time.Duration
+}
+
+// ConnectOption Open* 构造函数的可选参数
+type ConnectOption func(*connectOptions)
+
+// WithBackgroundConnect 以 connecting 状态启动, 在后台按指数退避重试连接,
+// 连接成功后继续按 checkInterval 检测, 断开时回到 connecting 状态并重新退避重试
+func WithBackgroundConnect() ConnectOption {
+	return func(o *connectOptions) {
+		o.background = true
+	}
+}
+
+// WithConnectBackoff 设置后台重连的初始与最大退避时间
+func WithConnectBackoff(initial, max time.Duration) ConnectOption {
+	return func(o *connectOptions) {
+		o.initialBackoff = initial
+		o.maxBackoff = max
+	}
+}
+
+// WithConnectCheckInterval 设置连接成功后的后台检测间隔
+func WithConnectCheckInterval(interval time.Duration) ConnectOption {
+	return func(o *connectOptions) {
+		o.checkInterval = interval
+	}
+}
+
+// WithPingTimeout 设置单次 Ping 的超时时间
+func WithPingTimeout(timeout time.Duration) ConnectOption {
+	return func(o *connectOptions) {
+		o.pingTimeout = timeout
+	}
+}
+
+func newConnectOptions(opts []ConnectOption) connectOptions {
+	o := connectOptions{
+		initialBackoff: DefaultConnectInitialBackoff,
+		maxBackoff:     DefaultConnectMaxBackoff,
+		checkInterval:  DefaultConnectCheckInterval,
+		pingTimeout:    DefaultConnectPingTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.initialBackoff <= 0 {
+		o.initialBackoff = DefaultConnectInitialBackoff
+	}
+	if o.maxBackoff < o.initialBackoff {
+		o.maxBackoff = o.initialBackoff
+	}
+	if o.checkInterval <= 0 {
+		o.checkInterval = DefaultConnectCheckInterval
+	}
+	if o.pingTimeout <= 0 {
+		o.pingTimeout = DefaultConnectPingTimeout
+	}
+	return o
+}
+
+// readiness 记录 Handler 的连接状态, 并负责后台重连
+// 为 nil 时 (直接构造的 Handler) 视为已就绪
+type readiness struct {
+	name    string
+	mu      sync.Mutex
+	state   ConnState
+	lastErr error
+	readyCh chan struct{}
+	stop    context.CancelFunc
+	done    chan struct{}
+}
+
+func newReadiness(name string) *readiness {
+	return &readiness{
+		name:    name,
+		state:   ConnConnecting,
+		readyCh: make(chan struct{}),
+	}
+}
+
+func (rd *readiness) State() ConnState {
+	if rd == nil {
+		return ConnReady
+	}
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	return rd.state
+}
+
+func (rd *readiness) LastError() error {
+	if rd == nil {
+		return nil
+	}
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	return rd.lastErr
+}
+
+// WaitReady 阻塞直到连接就绪, ctx 结束或 Handler 关闭
+func (rd *readiness) WaitReady(ctx context.Context) error {
+	if rd == nil {
+		return nil
+	}
+	for {
+		rd.mu.Lock()
+		state, readyCh := rd.state, rd.readyCh
+		rd.mu.Unlock()
+		switch state {
+		case ConnReady:
+			return nil
+		case ConnClosed:
+			return ErrHandlerClosed
+		}
+		select {
+		case <-readyCh:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// setReady 标记为就绪, 状态发生变化时返回 true
+func (rd *readiness) setReady() bool {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	if rd.state != ConnConnecting {
+		return false
+	}
+	rd.state = ConnReady
+	rd.lastErr = nil
+	close(rd.readyCh)
+	return true
+}
+
+func (rd *readiness) setConnecting(err error) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	rd.lastErr = err
+	if rd.state != ConnReady {
+		return
+	}
+	rd.state = ConnConnecting
+	rd.readyCh = make(chan struct{})
+	Logger.Warn(GetLogPrefix("") + rd.name + " 连接断开, 后台重连中! 错误原因: " + err.Error())
+}
+
+// close 停止后台重连并标记为关闭状态
+func (rd *readiness) close() {
+	if rd == nil {
+		return
+	}
+	rd.mu.Lock()
+	if rd.state == ConnClosed {
+		rd.mu.Unlock()
+		return
+	}
+	if rd.state == ConnConnecting {
+		close(rd.readyCh)
+	}
+	rd.state = ConnClosed
+	stop, done := rd.stop, rd.done
+	rd.mu.Unlock()
+	if stop != nil {
+		stop()
+		<-done
+	}
+}
+
+// startBackground 在后台循环 ping, 失败时按指数退避重试
+func (rd *readiness) startBackground(ping func(ctx context.Context) error, o connectOptions) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rd.mu.Lock()
+	rd.stop = cancel
+	rd.done = make(chan struct{})
+	rd.mu.Unlock()
+	go func() {
+		defer close(rd.done)
+		backoff := o.initialBackoff
+		for {
+			pingCtx, pingCancel := context.WithTimeout(ctx, o.pingTimeout)
+			err := ping(pingCtx)
+			pingCancel()
+			if ctx.Err() != nil {
+				return
+			}
+			wait := o.checkInterval
+			if err != nil {
+				if rd.State() == ConnConnecting {
+					Logger.Warn(GetLogPrefix("") + fmt.Sprintf("%s 连接失败, %v 后重试! 错误原因: %v", rd.name, backoff, err))
+				}
+				rd.setConnecting(err)
+				wait = backoff
+				backoff *= 2
+				if backoff > o.maxBackoff {
+					backoff = o.maxBackoff
+				}
+			} else {
+				if rd.setReady() {
+					Logger.Info(GetLogPrefix("") + rd.name + " 连接成功!")
+				}
+				backoff = o.initialBackoff
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
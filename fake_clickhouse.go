@@ -0,0 +1,143 @@
+package go_toolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// FakeInsert FakeClickHouse 记录的一次写入
+type FakeInsert struct {
+	Query string
+	Rows  [][]interface{}
+}
+
+// FakeClickHouse 进程内的 ClickHouse 替身, 用于不依赖真实 ClickHouse 的单元测试
+// 写入只做记录, 查询返回通过 SetQueryResult 预设的结果
+type FakeClickHouse struct {
+	mu      sync.Mutex
+	inserts []FakeInsert
+	results map[string]interface{}
+	err     error
+	closed  bool
+}
+
+// NewFakeClickHouse 创建 FakeClickHouse
+func NewFakeClickHouse() *FakeClickHouse {
+	return &FakeClickHouse{results: make(map[string]interface{})}
+}
+
+// SetQueryResult 预设 query 的查询结果, rows 必须是与 QueryData 入参元素类型相同的切片
+func (f *FakeClickHouse) SetQueryResult(query string, rows interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[query] = rows
+}
+
+// SetError 之后的所有操作都返回 err, 传入 nil 恢复正常
+func (f *FakeClickHouse) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Inserts 已记录的全部写入
+func (f *FakeClickHouse) Inserts() []FakeInsert {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeInsert(nil), f.inserts...)
+}
+
+// InsertedRows query 对应的全部写入行
+func (f *FakeClickHouse) InsertedRows(query string) [][]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var rows [][]interface{}
+	for _, insert := range f.inserts {
+		if insert.Query == query {
+			rows = append(rows, insert.Rows...)
+		}
+	}
+	return rows
+}
+
+// Reset 清空记录的写入与预设的查询结果
+func (f *FakeClickHouse) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inserts = nil
+	f.results = make(map[string]interface{})
+	f.err = nil
+}
+
+func (f *FakeClickHouse) check() error {
+	if f.closed {
+		return ErrHandlerClosed
+	}
+	return f.err
+}
+
+func (f *FakeClickHouse) QueryData(items interface{}, query string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(); err != nil {
+		return err
+	}
+	target := reflect.ValueOf(items)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Slice {
+		return errors.New("FakeClickHouse QueryData 需要传入切片指针")
+	}
+	slice := reflect.MakeSlice(target.Elem().Type(), 0, 0)
+	if rows, ok := f.results[query]; ok {
+		value := reflect.ValueOf(rows)
+		if value.Type() != target.Elem().Type() {
+			return fmt.Errorf("FakeClickHouse 预设结果类型 %s 与查询目标类型 %s 不一致", value.Type(), target.Elem().Type())
+		}
+		slice = reflect.AppendSlice(slice, value)
+	}
+	target.Elem().Set(slice)
+	return nil
+}
+
+func (f *FakeClickHouse) InsertData(query string, data ...interface{}) (bool, error) {
+	return f.BatchInsertData(query, [][]interface{}{data})
+}
+
+func (f *FakeClickHouse) BatchInsertData(query string, dataArrays [][]interface{}) (bool, error) {
+	if dataArrays == nil {
+		return false, errors.New("ClickHouse 写入方法缺少参数")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(); err != nil {
+		return false, err
+	}
+	rows := make([][]interface{}, 0, len(dataArrays))
+	for _, data := range dataArrays {
+		rows = append(rows, append([]interface{}(nil), data...))
+	}
+	f.inserts = append(f.inserts, FakeInsert{Query: query, Rows: rows})
+	return true, nil
+}
+
+func (f *FakeClickHouse) Ready() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.closed
+}
+
+func (f *FakeClickHouse) WaitReady(ctx context.Context) error {
+	if !f.Ready() {
+		return ErrHandlerClosed
+	}
+	return nil
+}
+
+func (f *FakeClickHouse) ShutdownCKHandler() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
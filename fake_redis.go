@@ -0,0 +1,73 @@
+package go_toolbox
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ElvisWai/go-toolbox/redistest"
+)
+
+// FakeRedis 连接到进程内 redistest.Server 的 ModelRedisHandler, 用于不依赖真实 Redis 的单元测试
+// 同时可直接调用 Server 的 FastForward/DropConnections/SetDown/FailNext 等方法模拟过期, 断线与故障
+type FakeRedis struct {
+	*ModelRedisHandler
+	*redistest.Server
+}
+
+// NewFakeRedis 创建 FakeRedis
+func NewFakeRedis() *FakeRedis {
+	server := redistest.NewServer()
+	return &FakeRedis{
+		ModelRedisHandler: &ModelRedisHandler{
+			RedisConf:   RedisConf{Host: "fake-redis:6379", Enable: true},
+			RedisClient: server.NewClient("fake-redis:6379"),
+		},
+		Server: server,
+	}
+}
+
+// FakeRedisRing 由多个 FakeRedis 组成的分片模式替身, Shards 为分片名到各分片 FakeRedis 的映射, 可用于检查 key 的分布或模拟分片宕机
+type FakeRedisRing struct {
+	*ModelRedisHandler
+	Shards map[string]*FakeRedis
+}
+
+// NewFakeRedisRing 创建 FakeRedisRing, hash 为 RingHash, heartbeat 为分片心跳间隔 (0 使用默认值)
+func NewFakeRedisRing(hash string, heartbeat time.Duration, names ...string) (*FakeRedisRing, error) {
+	ring := &FakeRedisRing{Shards: make(map[string]*FakeRedis, len(names))}
+	addrs := make(map[string]string, len(names))
+	servers := make(map[string]*redistest.Server, len(names))
+	for _, name := range names {
+		shard := NewFakeRedis()
+		addr := fmt.Sprintf("fake-redis-%s:6379", name)
+		ring.Shards[name] = shard
+		addrs[name] = addr
+		servers[addr] = shard.Server
+	}
+	ring.ModelRedisHandler = &ModelRedisHandler{
+		RedisConf: RedisConf{
+			Enable:          true,
+			Shards:          addrs,
+			RingHash:        hash,
+			RingHeartbeatMs: int(heartbeat / time.Millisecond),
+		},
+	}
+	err := ring.initRedisRingClient(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return servers[addr].Dial(ctx, network, addr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// ShutdownRedisHandler 关闭分片客户端与全部分片
+func (f *FakeRedisRing) ShutdownRedisHandler() error {
+	err := f.ModelRedisHandler.ShutdownRedisHandler()
+	for _, shard := range f.Shards {
+		_ = shard.ShutdownRedisHandler()
+	}
+	return err
+}
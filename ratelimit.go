@@ -0,0 +1,45 @@
+package go_toolbox
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter 按每秒 perSecond 个的速率为批量操作预留时间片, 多个 goroutine 共享同一速率, perSecond<=0 表示不限速
+type rateLimiter struct {
+	perSecond int
+
+	mu       sync.Mutex
+	nextSlot time.Time
+}
+
+func newRateLimiter(perSecond int) *rateLimiter {
+	return &rateLimiter{perSecond: perSecond}
+}
+
+// wait 为 n 个操作预留时间片并等待到时间片开始, ctx 取消时返回 ctx.Err()
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l.perSecond <= 0 || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.nextSlot.Before(now) {
+		l.nextSlot = now
+	}
+	wait := l.nextSlot.Sub(now)
+	l.nextSlot = l.nextSlot.Add(time.Duration(n) * time.Second / time.Duration(l.perSecond))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,30 @@
+package go_toolbox
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	if err := newRateLimiter(0).wait(ctx, 1000); err != nil {
+		t.Fatal(err)
+	}
+	limiter := newRateLimiter(100)
+	start := time.Now()
+	// 第一批立即开始, 之后的每批等待前面各批预留的时间片
+	for i := 0; i < 3; i++ {
+		if err := limiter.wait(ctx, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("three batches of 5 at 100/s should take at least 100ms, took %v", elapsed)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := limiter.wait(cancelled, 100); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
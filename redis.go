@@ -1,9 +1,12 @@
 package go_toolbox
 
 import (
+	"errors"
+	"fmt"
 	"github.com/redis/go-redis/v9"
 	"golang.org/x/net/context"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -11,14 +14,46 @@ type ModelRedisHandler struct {
 	RedisConf
 	RedisClient        *redis.Client
 	RedisClusterClient *redis.ClusterClient
+	RedisRingClient    *redis.Ring
+	ring               *redisRing
+	breakers           *nodeBreakers
+	ready              *readiness
+	monitorMu          sync.Mutex
+	monitor            *healthMonitor
+	keyringMu          sync.RWMutex
+	keyring            *RedisKeyring
+	retryOnce          sync.Once
+	retrier            *redisRetrier
+	hotKeyOnce         sync.Once
+	hotKeys            *hotKeySampler
 }
 
+// RedisConf Redis 配置
+// Enable 为 false 时 Handler 不会连接 Redis, 所有操作均为空操作: 写入直接返回成功, 读取按未命中处理
+// BreakerThreshold 为连续失败多少次后熔断, 0 使用默认值, 小于 0 关闭熔断器; 集群与分片模式下每个节点单独计数与熔断
+// Compression 不为空或 MaxValueSize 大于 0 时 Set/HashSet/HashMSet 写入的值使用带头部的信封:
+// 超过 CompressThreshold (默认 1024) 字节的值按 Compression (gzip/zstd/snappy/lz4) 压缩, 压缩后超过 MaxValueSize 字节的值拆分为多个分片
+// 读取时按头部自动解压与拼接, 未使用信封的旧值原样返回
+// Shards 不为空时使用分片模式: 客户端按一致性哈希将 key 分布到多个独立的 Redis 节点 (分片名 => 地址), 此时忽略 Host
+// RingHash 为分片模式的哈希算法 (rendezvous/ketama, 默认 rendezvous), 分片名参与哈希计算, 更换分片地址不影响 key 的分布
+// RingHeartbeatMs 为分片心跳间隔 (默认 500 毫秒), 连续 3 次心跳失败的分片从哈希环中移除, 恢复后重新加入
+// RetryMaxAttempts 大于 0 时开启临时错误的重试, 为包含首次的最多尝试次数; 默认 0 不开启, 沿用 go-redis 内置的重试
+// 开启后只重试幂等命令, 更多选项见 SetRetryPolicy, 集群模式不支持
 type RedisConf struct {
-	Host      string `json:"Host"`
-	Password  string `json:"Password"`
-	Database  int    `json:"Database"`
-	IsCluster bool   `json:"IsCluster"`
-	Enable    bool   `json:"Enable"`
+	Host               string            `json:"Host"`
+	Password           string            `json:"Password"`
+	Database           int               `json:"Database"`
+	IsCluster          bool              `json:"IsCluster"`
+	Enable             bool              `json:"Enable"`
+	BreakerThreshold   int               `json:"BreakerThreshold"`
+	BreakerOpenSeconds int               `json:"BreakerOpenSeconds"`
+	Compression        string            `json:"Compression"`
+	CompressThreshold  int               `json:"CompressThreshold"`
+	MaxValueSize       int               `json:"MaxValueSize"`
+	RetryMaxAttempts   int               `json:"RetryMaxAttempts"`
+	Shards             map[string]string `json:"Shards"`
+	RingHash           string            `json:"RingHash"`
+	RingHeartbeatMs    int               `json:"RingHeartbeatMs"`
 }
 
 const (
@@ -28,6 +63,12 @@ const (
 )
 
 func (r *ModelRedisHandler) Set(key string, value interface{}, ex time.Duration) bool {
+	if !r.Enable {
+		return true
+	}
+	if r.envelopeEnabled() {
+		return r.setEnveloped(key, value, ex)
+	}
 	if r.IsCluster {
 		_, setErr := r.RedisClusterClient.Set(context.Background(), key, value, ex).Result()
 		if setErr != nil && setErr != redis.Nil {
@@ -36,7 +77,7 @@ func (r *ModelRedisHandler) Set(key string, value interface{}, ex time.Duration)
 		}
 		return true
 	} else {
-		_, setErr := r.RedisClient.Set(context.Background(), key, value, ex).Result()
+		_, setErr := r.universalClient().Set(context.Background(), key, value, ex).Result()
 		if setErr != nil && setErr != redis.Nil {
 			Logger.Error("Redis Set 写入错误! 错误原因: " + setErr.Error())
 			return false
@@ -46,20 +87,23 @@ func (r *ModelRedisHandler) Set(key string, value interface{}, ex time.Duration)
 }
 
 func (r *ModelRedisHandler) Get(key string) (string, bool) {
+	if !r.Enable {
+		return "", true
+	}
 	if r.IsCluster {
 		result, getErr := r.RedisClusterClient.Get(context.Background(), key).Result()
 		if getErr != nil && getErr != redis.Nil {
 			Logger.Error("Redis 集群 Get 读取错误! 错误原因: " + getErr.Error())
 			return "", false
 		}
-		return result, true
+		return r.openValue(key, result)
 	} else {
-		result, getErr := r.RedisClient.Get(context.Background(), key).Result()
+		result, getErr := r.universalClient().Get(context.Background(), key).Result()
 		if getErr != nil && getErr != redis.Nil {
 			Logger.Error("Redis Get 读取错误! 错误原因: " + getErr.Error())
 			return "", false
 		}
-		return result, true
+		return r.openValue(key, result)
 	}
 }
 
@@ -70,6 +114,12 @@ func (r *ModelRedisHandler) Get(key string) (string, bool) {
 //
 // Note that it requires Redis v4 for multiple field/value pairs support.
 func (r *ModelRedisHandler) HashSet(key string, values ...interface{}) bool {
+	if !r.Enable {
+		return true
+	}
+	if r.envelopeEnabled() {
+		return r.hashSetEnveloped(key, values)
+	}
 	if r.IsCluster {
 		_, hSetErr := r.RedisClusterClient.HSet(context.Background(), key, values...).Result()
 		if hSetErr != nil {
@@ -78,7 +128,7 @@ func (r *ModelRedisHandler) HashSet(key string, values ...interface{}) bool {
 		}
 		return true
 	} else {
-		_, hSetErr := r.RedisClient.HSet(context.Background(), key, values).Result()
+		_, hSetErr := r.universalClient().HSet(context.Background(), key, values).Result()
 		if hSetErr != nil {
 			Logger.Error("Redis HSet 写入错误! 错误原因: " + hSetErr.Error())
 			return false
@@ -88,24 +138,33 @@ func (r *ModelRedisHandler) HashSet(key string, values ...interface{}) bool {
 }
 
 func (r *ModelRedisHandler) HashGet(key, field string) (string, bool) {
+	if !r.Enable {
+		return "", true
+	}
 	if r.IsCluster {
 		result, hGetErr := r.RedisClusterClient.HGet(context.Background(), key, field).Result()
 		if hGetErr != nil && hGetErr != redis.Nil {
 			Logger.Error("Redis 集群 HGet 读取错误! 错误原因: " + hGetErr.Error())
 			return "", false
 		}
-		return result, true
+		return r.openHashValue(key, field, result)
 	} else {
-		result, hGetErr := r.RedisClient.HGet(context.Background(), key, field).Result()
+		result, hGetErr := r.universalClient().HGet(context.Background(), key, field).Result()
 		if hGetErr != nil && hGetErr != redis.Nil {
 			Logger.Error("Redis HGet 读取错误! 错误原因: " + hGetErr.Error())
 			return "", false
 		}
-		return result, true
+		return r.openHashValue(key, field, result)
 	}
 }
 
 func (r *ModelRedisHandler) HashMSet(key string, values ...interface{}) bool {
+	if !r.Enable {
+		return true
+	}
+	if r.envelopeEnabled() {
+		return r.hashSetEnveloped(key, values)
+	}
 	if r.IsCluster {
 		_, hMSetErr := r.RedisClusterClient.HMSet(context.Background(), key, values...).Result()
 		if hMSetErr != nil {
@@ -114,7 +173,7 @@ func (r *ModelRedisHandler) HashMSet(key string, values ...interface{}) bool {
 		}
 		return true
 	} else {
-		_, hMSetErr := r.RedisClient.HMSet(context.Background(), key, values).Result()
+		_, hMSetErr := r.universalClient().HMSet(context.Background(), key, values).Result()
 		if hMSetErr != nil {
 			Logger.Error("Redis HMSet 写入错误! 错误原因: " + hMSetErr.Error())
 			return false
@@ -124,24 +183,33 @@ func (r *ModelRedisHandler) HashMSet(key string, values ...interface{}) bool {
 }
 
 func (r *ModelRedisHandler) HashMGET(key string, fields ...string) ([]interface{}, bool) {
+	if !r.Enable {
+		return make([]interface{}, len(fields)), true
+	}
 	if r.IsCluster {
 		results, hMGetErr := r.RedisClusterClient.HMGet(context.Background(), key, fields...).Result()
 		if hMGetErr != nil && hMGetErr != redis.Nil {
 			Logger.Error("Redis 集群 HMGet 读取错误! 错误原因: " + hMGetErr.Error())
 			return nil, false
 		}
-		return results, true
+		return r.openHashValues(key, fields, results)
 	} else {
-		results, hMGetErr := r.RedisClient.HMGet(context.Background(), key, fields...).Result()
+		results, hMGetErr := r.universalClient().HMGet(context.Background(), key, fields...).Result()
 		if hMGetErr != nil && hMGetErr != redis.Nil {
 			Logger.Error("Redis HMGet 读取错误! 错误原因: " + hMGetErr.Error())
 			return nil, false
 		}
-		return results, true
+		return r.openHashValues(key, fields, results)
 	}
 }
 
 func (r *ModelRedisHandler) HashDel(key string, fields ...string) bool {
+	if !r.Enable {
+		return true
+	}
+	if r.envelopeEnabled() {
+		return r.hashDelEnveloped(key, fields)
+	}
 	if r.IsCluster {
 		_, hDelErr := r.RedisClusterClient.HDel(context.Background(), key, fields...).Result()
 		if hDelErr != nil {
@@ -150,7 +218,7 @@ func (r *ModelRedisHandler) HashDel(key string, fields ...string) bool {
 		}
 		return true
 	} else {
-		_, hDelErr := r.RedisClient.HDel(context.Background(), key, fields...).Result()
+		_, hDelErr := r.universalClient().HDel(context.Background(), key, fields...).Result()
 		if hDelErr != nil {
 			Logger.Error("Redis HDel 删除错误! 错误原因: " + hDelErr.Error())
 			return false
@@ -160,6 +228,9 @@ func (r *ModelRedisHandler) HashDel(key string, fields ...string) bool {
 }
 
 func (r *ModelRedisHandler) HashLen(key string) int64 {
+	if !r.Enable {
+		return 0
+	}
 	if r.IsCluster {
 		hashLen, hLenErr := r.RedisClusterClient.HLen(context.Background(), key).Result()
 		if hLenErr != nil {
@@ -168,7 +239,7 @@ func (r *ModelRedisHandler) HashLen(key string) int64 {
 		}
 		return hashLen
 	} else {
-		hashLen, hLenErr := r.RedisClient.HLen(context.Background(), key).Result()
+		hashLen, hLenErr := r.universalClient().HLen(context.Background(), key).Result()
 		if hLenErr != nil {
 			Logger.Error("Redis HLen 获取长度错误! 错误原因: " + hLenErr.Error())
 			return -1
@@ -178,6 +249,9 @@ func (r *ModelRedisHandler) HashLen(key string) int64 {
 }
 
 func (r *ModelRedisHandler) GetList(key string, start, stop int64) ([]string, bool) {
+	if !r.Enable {
+		return nil, true
+	}
 	if r.IsCluster {
 		result, lRangeErr := r.RedisClusterClient.LRange(context.Background(), key, start, stop).Result()
 		if lRangeErr != nil {
@@ -186,7 +260,7 @@ func (r *ModelRedisHandler) GetList(key string, start, stop int64) ([]string, bo
 		}
 		return result, true
 	} else {
-		result, lRangeErr := r.RedisClient.LRange(context.Background(), key, start, stop).Result()
+		result, lRangeErr := r.universalClient().LRange(context.Background(), key, start, stop).Result()
 		if lRangeErr != nil {
 			Logger.Error("Redis LRANGE 获取列表错误! 错误原因: " + lRangeErr.Error())
 			return nil, false
@@ -196,6 +270,9 @@ func (r *ModelRedisHandler) GetList(key string, start, stop int64) ([]string, bo
 }
 
 func (r *ModelRedisHandler) EmptyList(key string) bool {
+	if !r.Enable {
+		return true
+	}
 	if r.IsCluster {
 		_, lTrimErr := r.RedisClusterClient.LTrim(context.Background(), key, -1, 0).Result()
 		if lTrimErr != nil {
@@ -204,7 +281,7 @@ func (r *ModelRedisHandler) EmptyList(key string) bool {
 		}
 		return true
 	} else {
-		_, lTrimErr := r.RedisClient.LTrim(context.Background(), key, -1, 0).Result()
+		_, lTrimErr := r.universalClient().LTrim(context.Background(), key, -1, 0).Result()
 		if lTrimErr != nil {
 			Logger.Error("Redis LTRIM 获取列表错误! 错误原因: " + lTrimErr.Error())
 			return false
@@ -214,6 +291,9 @@ func (r *ModelRedisHandler) EmptyList(key string) bool {
 }
 
 func (r *ModelRedisHandler) AppendList(key string, value interface{}) bool {
+	if !r.Enable {
+		return true
+	}
 	if r.IsCluster {
 		_, appendErr := r.RedisClusterClient.LPush(context.Background(), key, value).Result()
 		if appendErr != nil {
@@ -222,7 +302,7 @@ func (r *ModelRedisHandler) AppendList(key string, value interface{}) bool {
 		}
 		return true
 	} else {
-		_, appendErr := r.RedisClient.LPush(context.Background(), key, value).Result()
+		_, appendErr := r.universalClient().LPush(context.Background(), key, value).Result()
 		if appendErr != nil {
 			Logger.Error("Redis LPUSH 写入列表错误! 错误原因: " + appendErr.Error())
 			return false
@@ -232,6 +312,9 @@ func (r *ModelRedisHandler) AppendList(key string, value interface{}) bool {
 }
 
 func (r *ModelRedisHandler) BFAdd(key string, value string) (bool, bool) {
+	if !r.Enable {
+		return false, true
+	}
 	// TxPipeline 的性能会比 Pipeline 好
 	if r.IsCluster {
 		inserted, err := r.RedisClusterClient.Do(context.Background(), "BF.ADD", key, value).Bool()
@@ -241,7 +324,7 @@ func (r *ModelRedisHandler) BFAdd(key string, value string) (bool, bool) {
 		}
 		return inserted, true
 	} else {
-		inserted, err := r.RedisClient.Do(context.Background(), "BF.ADD", key, value).Bool()
+		inserted, err := r.universalClient().Do(context.Background(), "BF.ADD", key, value).Bool()
 		if err != nil {
 			Logger.Error("Redis BFAdd 写入布隆过滤器错误! 错误原因: " + err.Error())
 			return false, false
@@ -251,6 +334,9 @@ func (r *ModelRedisHandler) BFAdd(key string, value string) (bool, bool) {
 }
 
 func (r *ModelRedisHandler) BFExists(key string, value string) bool {
+	if !r.Enable {
+		return false
+	}
 	if r.IsCluster {
 		inserted, err := r.RedisClusterClient.Do(context.Background(), "BF.Exists", key, value).Bool()
 		if err != nil {
@@ -260,7 +346,7 @@ func (r *ModelRedisHandler) BFExists(key string, value string) bool {
 		}
 		return inserted
 	} else {
-		inserted, err := r.RedisClient.Do(context.Background(), "BF.Exists", key, value).Bool()
+		inserted, err := r.universalClient().Do(context.Background(), "BF.Exists", key, value).Bool()
 		if err != nil {
 			Logger.Error("Redis BFExists 查询布隆过滤器错误! 错误原因: " + err.Error())
 			return false
@@ -275,7 +361,7 @@ func (r *ModelRedisHandler) Pipeline() (redis.Pipeliner, context.Context) {
 	if r.IsCluster {
 		return r.RedisClusterClient.Pipeline(), context.Background()
 	} else {
-		return r.RedisClient.Pipeline(), context.Background()
+		return r.universalClient().Pipeline(), context.Background()
 	}
 }
 
@@ -284,68 +370,237 @@ func (r *ModelRedisHandler) PipelineExecute(pipe redis.Pipeliner, ctx context.Co
 	return pipe.Exec(ctx)
 }
 
+// BreakerState 当前熔断器状态, 未启用熔断器时始终为 BreakerClosed
+// 集群与分片模式下每个节点一个熔断器, 返回最差的状态 (任一节点打开即为 BreakerOpen), 各节点的状态见 NodeBreakerStates
+func (r *ModelRedisHandler) BreakerState() BreakerState {
+	state := BreakerClosed
+	for _, nodeState := range r.NodeBreakerStates() {
+		if nodeState == BreakerOpen || (nodeState == BreakerHalfOpen && state == BreakerClosed) {
+			state = nodeState
+		}
+	}
+	return state
+}
+
+// NodeBreakerStates 各节点 (地址) 的熔断器状态, 只包含已建立过客户端的节点, 未启用熔断器时为空
+func (r *ModelRedisHandler) NodeBreakerStates() map[string]BreakerState {
+	if r.breakers == nil {
+		return map[string]BreakerState{}
+	}
+	return r.breakers.States()
+}
+
+// limiter 熔断器以 go-redis Limiter 的形式挂在每个节点的客户端上, 每个地址一个
+func (r *ModelRedisHandler) limiter(addr string) redis.Limiter {
+	if r.breakers == nil {
+		return nil
+	}
+	return r.breakers.forNode(addr)
+}
+
+// Ready Redis 是否已连接就绪
+func (r *ModelRedisHandler) Ready() bool {
+	return r.ready.State() == ConnReady
+}
+
+// ConnState 当前连接状态
+func (r *ModelRedisHandler) ConnState() ConnState {
+	return r.ready.State()
+}
+
+// WaitReady 阻塞直到 Redis 连接就绪或 ctx 结束
+func (r *ModelRedisHandler) WaitReady(ctx context.Context) error {
+	return r.ready.WaitReady(ctx)
+}
+
 // ShutdownRedisHandler 关闭 Redis 连接
 func (r *ModelRedisHandler) ShutdownRedisHandler() error {
-	if r.IsCluster {
-		return r.RedisClusterClient.Close()
-	} else {
-		return r.RedisClient.Close()
-	}
+	r.ready.close()
+	r.StopHealthMonitor()
+	return r.universalClient().Close()
 }
 
-func (r *ModelRedisHandler) initRedisClusterClient() {
+func (r *ModelRedisHandler) initRedisClusterClient() error {
 	if !strings.Contains(r.Host, ",") {
-		Logger.Fatal(GetLogPrefix("") + "Redis 集群地址请按英文逗号分割!")
+		return errors.New("Redis 集群地址请按英文逗号分割!")
 	}
 	client := redis.NewClusterClient(&redis.ClusterOptions{
 		Addrs:        strings.Split(r.Host, ","),
 		Password:     r.Password,
 		PoolSize:     PoolSize,
 		MinIdleConns: MinIdles,
+		NewClient: func(opt *redis.Options) *redis.Client {
+			opt.Limiter = r.limiter(opt.Addr)
+			return redis.NewClient(opt)
+		},
 	})
-	pingErr := client.Ping(context.Background()).Err()
-	if pingErr != nil {
-		Logger.Fatal(GetLogPrefix("") + "Redis 集群连接失败! 错误原因: " + pingErr.Error())
-	}
 	r.RedisClusterClient = client
+	return nil
 }
 
-func (r *ModelRedisHandler) initRedisClient() {
+func (r *ModelRedisHandler) initRedisClient() error {
 	client := redis.NewClient(&redis.Options{
 		Addr:         r.Host,
 		Password:     r.Password,
 		DB:           r.Database,
 		PoolSize:     PoolSize,
 		MinIdleConns: MinIdles,
+		Limiter:      r.limiter(r.Host),
 	})
-	pingErr := client.Ping(context.Background()).Err()
-	if pingErr != nil {
-		Logger.Fatal(GetLogPrefix("") + "Redis 连接失败! 错误原因: " + pingErr.Error())
-	}
 	r.RedisClient = client
+	return nil
 }
 
-func (r *ModelRedisHandler) initRedisHandler() {
+// initDisabledClient 为未启用的 Handler 创建不会建立连接的客户端, 保证 Pipeline 等直接使用客户端的方法可用
+func (r *ModelRedisHandler) initDisabledClient() {
 	if r.IsCluster {
-		r.initRedisClusterClient()
-		Logger.Info(GetLogPrefix("") + "Redis 连接成功! 当前模式: Redis 集群")
+		r.RedisClusterClient = redis.NewClusterClient(&redis.ClusterOptions{Addrs: strings.Split(r.Host, ",")})
+		r.RedisClusterClient.AddHook(disabledHook{})
 	} else {
-		r.initRedisClient()
-		Logger.Info(GetLogPrefix("") + "Redis 连接成功! 当前模式: Redis 单点")
+		r.RedisClient = redis.NewClient(&redis.Options{Addr: r.Host})
+		r.RedisClient.AddHook(disabledHook{})
 	}
 }
 
-func NewRedisHandler(redisConf *RedisConf) *ModelRedisHandler {
+func (r *ModelRedisHandler) ping(ctx context.Context) error {
+	if r.isRing() {
+		return r.pingRing(ctx)
+	}
+	if r.IsCluster {
+		return r.RedisClusterClient.Ping(ctx).Err()
+	} else {
+		return r.RedisClient.Ping(ctx).Err()
+	}
+}
+
+// universalClient 当前模式下的客户端
+func (r *ModelRedisHandler) universalClient() redis.UniversalClient {
+	if r.isRing() {
+		return r.RedisRingClient
+	}
+	if r.IsCluster {
+		return r.RedisClusterClient
+	}
+	return r.RedisClient
+}
+
+// addHook 为当前模式下的客户端安装 Hook, 需在使用 Handler 之前调用
+// 单点模式下连接池在 NewClient 时已开始后台建连并读取 Hook, 直接 AddHook 会产生数据竞争,
+// 因此在共享连接池的副本上安装 Hook (WithTimeout 保持原有的读写超时) 并替换 RedisClient
+func (r *ModelRedisHandler) addHook(hook redis.Hook) {
+	switch {
+	case r.IsCluster:
+		r.RedisClusterClient.AddHook(hook)
+	case r.isRing():
+		r.RedisRingClient.AddHook(hook)
+	default:
+		client := r.RedisClient.WithTimeout(r.RedisClient.Options().ReadTimeout)
+		client.AddHook(hook)
+		r.RedisClient = client
+	}
+}
+
+// forEachNode 对每个节点执行 fn, 集群模式下为全部主节点, 分片模式下为全部存活分片 (并发执行)
+func (r *ModelRedisHandler) forEachNode(ctx context.Context, fn func(ctx context.Context, node *redis.Client) error) error {
+	if r.isRing() {
+		return r.RedisRingClient.ForEachShard(ctx, fn)
+	}
+	if r.IsCluster {
+		return r.RedisClusterClient.ForEachMaster(ctx, fn)
+	}
+	return fn(ctx, r.RedisClient)
+}
+
+func (r *ModelRedisHandler) modeName() string {
+	if r.isRing() {
+		return "Redis 分片"
+	}
+	if r.IsCluster {
+		return "Redis 集群"
+	}
+	return "Redis 单点"
+}
+
+func (r *ModelRedisHandler) initRedisHandler(o connectOptions) error {
+	r.ready = newReadiness("Redis")
+	if !r.Enable {
+		r.initDisabledClient()
+		r.ready.setReady()
+		Logger.Info(GetLogPrefix("") + "Redis 未启用, 所有操作均为空操作")
+		return nil
+	}
+	if r.BreakerThreshold >= 0 {
+		r.breakers = newNodeBreakers(r.BreakerThreshold, time.Duration(r.BreakerOpenSeconds)*time.Second)
+	}
+	var initErr error
+	if len(r.Shards) > 0 {
+		initErr = r.initRedisRingClient(nil)
+	} else if r.IsCluster {
+		initErr = r.initRedisClusterClient()
+	} else {
+		initErr = r.initRedisClient()
+	}
+	if initErr != nil {
+		return initErr
+	}
+	if r.RetryMaxAttempts > 0 {
+		r.SetRetryPolicy(RedisRetryPolicy{MaxAttempts: r.RetryMaxAttempts})
+	}
+	if o.background {
+		r.ready.startBackground(r.ping, o)
+		Logger.Info(GetLogPrefix("") + "Redis 后台连接中! 当前模式: " + r.modeName())
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), o.pingTimeout)
+	defer cancel()
+	if pingErr := r.ping(ctx); pingErr != nil {
+		_ = r.ShutdownRedisHandler()
+		if r.isRing() {
+			return fmt.Errorf("Redis 分片连接失败! 错误原因: %w", pingErr)
+		}
+		if r.IsCluster {
+			return fmt.Errorf("Redis 集群连接失败! 错误原因: %w", pingErr)
+		}
+		return fmt.Errorf("Redis 连接失败! 错误原因: %w", pingErr)
+	}
+	r.ready.setReady()
+	Logger.Info(GetLogPrefix("") + "Redis 连接成功! 当前模式: " + r.modeName())
+	return nil
+}
+
+// OpenRedisHandler 创建 Redis Handler, 连接失败时返回错误而不是退出进程
+// 传入 WithBackgroundConnect 时立即返回 connecting 状态的 Handler, 并在后台重试连接
+func OpenRedisHandler(redisConf *RedisConf, opts ...ConnectOption) (*ModelRedisHandler, error) {
 	redisClient := &ModelRedisHandler{
-		RedisConf{
-			Host:      redisConf.Host,
-			Password:  redisConf.Password,
-			Database:  redisConf.Database,
-			IsCluster: redisConf.IsCluster,
+		RedisConf: RedisConf{
+			Host:               redisConf.Host,
+			Password:           redisConf.Password,
+			Database:           redisConf.Database,
+			IsCluster:          redisConf.IsCluster,
+			Enable:             redisConf.Enable,
+			BreakerThreshold:   redisConf.BreakerThreshold,
+			BreakerOpenSeconds: redisConf.BreakerOpenSeconds,
+			Compression:        redisConf.Compression,
+			CompressThreshold:  redisConf.CompressThreshold,
+			MaxValueSize:       redisConf.MaxValueSize,
+			RetryMaxAttempts:   redisConf.RetryMaxAttempts,
+			Shards:             redisConf.Shards,
+			RingHash:           redisConf.RingHash,
+			RingHeartbeatMs:    redisConf.RingHeartbeatMs,
 		},
-		nil,
-		nil,
 	}
-	redisClient.initRedisHandler()
+	if err := redisClient.initRedisHandler(newConnectOptions(opts)); err != nil {
+		return nil, err
+	}
+	return redisClient, nil
+}
+
+// NewRedisHandler 创建 Redis Handler, 连接失败时退出进程
+// 兼容旧版本保留, 新代码请使用 OpenRedisHandler
+func NewRedisHandler(redisConf *RedisConf) *ModelRedisHandler {
+	redisClient, err := OpenRedisHandler(redisConf)
+	if err != nil {
+		Logger.Fatal(GetLogPrefix("") + err.Error())
+	}
 	return redisClient
 }
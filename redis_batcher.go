@@ -0,0 +1,423 @@
+package go_toolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultBatchSize    int = 100
+	DefaultBatchDelay       = 5 * time.Millisecond
+	DefaultBatchTimeout     = 3 * time.Second
+)
+
+// ErrBatcherClosed Batcher 已关闭
+var ErrBatcherClosed = errors.New("Redis Batcher 已关闭")
+
+// BatcherOptions Batcher 配置
+type BatcherOptions struct {
+	// MaxBatchSize 队列中的命令达到该数量时立即 flush
+	MaxBatchSize int
+	// MaxDelay 第一条命令入队后最多等待多久 flush
+	MaxDelay time.Duration
+	// Timeout 单次 flush 的超时时间
+	Timeout time.Duration
+	// OnFlush 每次 flush 完成后回调
+	OnFlush func(report BatchFlushReport)
+}
+
+// BatchFlushReport 一次 flush 的结果
+type BatchFlushReport struct {
+	Commands int
+	Duration time.Duration
+	// Err 部分节点失败时不为空
+	Err *BatchError
+}
+
+// BatchNodeError 单个节点上失败的命令
+type BatchNodeError struct {
+	Node   string
+	Failed int
+	Err    error
+}
+
+// BatchError 一次 flush 中失败的命令按节点汇总, redis.Nil 不视为失败
+type BatchError struct {
+	Total int
+	Nodes []BatchNodeError
+}
+
+func (e *BatchError) Error() string {
+	parts := make([]string, 0, len(e.Nodes))
+	failed := 0
+	for _, node := range e.Nodes {
+		failed += node.Failed
+		parts = append(parts, fmt.Sprintf("%s: %d 条失败 (%v)", node.Node, node.Failed, node.Err))
+	}
+	return fmt.Sprintf("Redis 批量执行部分失败 %d/%d! %s", failed, e.Total, strings.Join(parts, "; "))
+}
+
+// BatchFuture 入队命令的执行结果, 在所属批次 flush 完成后可用
+type BatchFuture struct {
+	cmd  *redis.Cmd
+	node string
+	done chan struct{}
+	// open 开启值信封时解开 GET/HGET 的结果
+	open func(raw string) (string, error)
+}
+
+// Done flush 完成后关闭
+func (f *BatchFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait 等待命令执行完成, 返回命令本身的错误
+func (f *BatchFuture) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.cmd.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Node 命令被发送到的节点地址
+func (f *BatchFuture) Node() string {
+	<-f.done
+	return f.node
+}
+
+func (f *BatchFuture) Err() error {
+	<-f.done
+	return f.cmd.Err()
+}
+
+func (f *BatchFuture) Result() (interface{}, error) {
+	<-f.done
+	return f.cmd.Result()
+}
+
+func (f *BatchFuture) Text() (string, error) {
+	<-f.done
+	return f.cmd.Text()
+}
+
+func (f *BatchFuture) Int64() (int64, error) {
+	<-f.done
+	return f.cmd.Int64()
+}
+
+func (f *BatchFuture) Float64() (float64, error) {
+	<-f.done
+	return f.cmd.Float64()
+}
+
+func (f *BatchFuture) Bool() (bool, error) {
+	<-f.done
+	return f.cmd.Bool()
+}
+
+func (f *BatchFuture) StringSlice() ([]string, error) {
+	<-f.done
+	return f.cmd.StringSlice()
+}
+
+func (f *BatchFuture) Slice() ([]interface{}, error) {
+	<-f.done
+	return f.cmd.Slice()
+}
+
+// RedisBatcher 汇集多个 goroutine 的命令, 数量或延迟达到阈值时通过一个 Pipeline 发送
+type RedisBatcher struct {
+	r       *ModelRedisHandler
+	opts    BatcherOptions
+	mu      sync.Mutex
+	pending []*BatchFuture
+	timer   *time.Timer
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewBatcher 创建自动 flush 的 Pipeline Batcher
+func (r *ModelRedisHandler) NewBatcher(opts BatcherOptions) *RedisBatcher {
+	if opts.MaxBatchSize <= 0 {
+		opts.MaxBatchSize = DefaultBatchSize
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultBatchDelay
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultBatchTimeout
+	}
+	return &RedisBatcher{r: r, opts: opts}
+}
+
+// Do 入队任意命令, 第一个参数之后的参数视为 key (用于集群模式下定位节点)
+// Do 按原样发送参数, 不经过值信封 (压缩/加密), 开启信封时字符串与哈希值请使用 Set/HashSet/Get/HashGet
+func (b *RedisBatcher) Do(args ...interface{}) *BatchFuture {
+	return b.enqueue(&BatchFuture{
+		cmd:  redis.NewCmd(context.Background(), args...),
+		done: make(chan struct{}),
+	})
+}
+
+// failed 不入队, 直接以 err 完成的 Future
+func (b *RedisBatcher) failed(err error, args ...interface{}) *BatchFuture {
+	future := &BatchFuture{
+		cmd:  redis.NewCmd(context.Background(), args...),
+		done: make(chan struct{}),
+	}
+	future.cmd.SetErr(err)
+	close(future.done)
+	return future
+}
+
+func (b *RedisBatcher) enqueue(future *BatchFuture) *BatchFuture {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		future.cmd.SetErr(ErrBatcherClosed)
+		close(future.done)
+		return future
+	}
+	b.pending = append(b.pending, future)
+	if len(b.pending) >= b.opts.MaxBatchSize {
+		batch := b.takeLocked()
+		b.wg.Add(1)
+		b.mu.Unlock()
+		go func() {
+			defer b.wg.Done()
+			_ = b.execute(batch)
+		}()
+		return future
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.opts.MaxDelay, b.flushOnTimer)
+	}
+	b.mu.Unlock()
+	return future
+}
+
+func (b *RedisBatcher) Get(key string) *BatchFuture {
+	future := &BatchFuture{
+		cmd:  redis.NewCmd(context.Background(), "get", key),
+		done: make(chan struct{}),
+	}
+	if b.r.envelopeEnabled() {
+		future.open = func(raw string) (string, error) {
+			return b.r.openValueErr(key, raw)
+		}
+	}
+	return b.enqueue(future)
+}
+
+// Set 与 ModelRedisHandler.Set 写入相同的信封格式; 需要拆分的值 (超过 MaxValueSize) 无法放入同一 Pipeline, 直接返回失败的 Future
+func (b *RedisBatcher) Set(key string, value interface{}, ex time.Duration) *BatchFuture {
+	sealed, err := b.seal(value)
+	if err != nil {
+		return b.failed(err, "set", key, value)
+	}
+	if ex > 0 {
+		return b.Do("set", key, sealed, "px", ex.Milliseconds())
+	}
+	return b.Do("set", key, sealed)
+}
+
+func (b *RedisBatcher) Del(key string) *BatchFuture {
+	return b.Do("del", key)
+}
+
+func (b *RedisBatcher) IncrBy(key string, value int64) *BatchFuture {
+	return b.Do("incrby", key, value)
+}
+
+func (b *RedisBatcher) HashGet(key, field string) *BatchFuture {
+	future := &BatchFuture{
+		cmd:  redis.NewCmd(context.Background(), "hget", key, field),
+		done: make(chan struct{}),
+	}
+	if b.r.envelopeEnabled() {
+		future.open = func(raw string) (string, error) {
+			return b.r.openHashValueErr(key, field, raw)
+		}
+	}
+	return b.enqueue(future)
+}
+
+// HashSet 与 ModelRedisHandler.HashSet 写入相同的信封格式, 需要拆分的值同 Set 直接返回失败的 Future
+func (b *RedisBatcher) HashSet(key string, values ...interface{}) *BatchFuture {
+	if !b.r.envelopeEnabled() {
+		return b.Do(append([]interface{}{"hset", key}, values...)...)
+	}
+	pairs, err := hashPairs(values)
+	if err != nil {
+		return b.failed(err, "hset", key)
+	}
+	args := make([]interface{}, 0, len(pairs)+2)
+	args = append(args, "hset", key)
+	for i := 0; i < len(pairs); i += 2 {
+		sealed, err := b.seal(pairs[i+1])
+		if err != nil {
+			return b.failed(err, "hset", key)
+		}
+		args = append(args, pairs[i], sealed)
+	}
+	return b.Do(args...)
+}
+
+// seal 按 Handler 的信封配置编码值, 未开启信封时原样返回
+func (b *RedisBatcher) seal(value interface{}) (interface{}, error) {
+	if !b.r.envelopeEnabled() {
+		return value, nil
+	}
+	sealed, err := b.r.sealValue(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed.chunks) > 0 {
+		return nil, errors.New("值超过 MaxValueSize, Batcher 不支持分片写入")
+	}
+	return sealed.value, nil
+}
+
+// Flush 立即发送队列中的命令并等待完成, 部分失败时返回 *BatchError
+func (b *RedisBatcher) Flush() error {
+	b.mu.Lock()
+	batch := b.takeLocked()
+	b.mu.Unlock()
+	if err := b.execute(batch); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close 停止接收新命令, 发送剩余命令并等待所有进行中的 flush 完成
+func (b *RedisBatcher) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	batch := b.takeLocked()
+	b.mu.Unlock()
+	err := b.execute(batch)
+	b.wg.Wait()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (b *RedisBatcher) flushOnTimer() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	batch := b.takeLocked()
+	b.wg.Add(1)
+	b.mu.Unlock()
+	defer b.wg.Done()
+	_ = b.execute(batch)
+}
+
+func (b *RedisBatcher) takeLocked() []*BatchFuture {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
+
+// execute 通过一个 Pipeline 发送 batch, 返回值为 *BatchError 或 nil
+func (b *RedisBatcher) execute(batch []*BatchFuture) *BatchError {
+	if len(batch) == 0 {
+		return nil
+	}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), b.opts.Timeout)
+	defer cancel()
+	pipe, _ := b.r.Pipeline()
+	for _, future := range batch {
+		_ = pipe.Process(ctx, future.cmd)
+	}
+	if _, execErr := b.r.PipelineExecute(pipe, ctx); execErr != nil && execErr != redis.Nil {
+		// 连接阶段失败时 go-redis 不会为命令设置错误, 这里补上, 避免未执行的命令看起来执行成功
+		if _, ok := execErr.(redis.Error); !ok {
+			for _, future := range batch {
+				if future.cmd.Err() == nil && future.cmd.Val() == nil {
+					future.cmd.SetErr(execErr)
+				}
+			}
+		}
+	}
+
+	nodes := make(map[string]*BatchNodeError)
+	for _, future := range batch {
+		future.node = b.r.nodeForCmd(ctx, future.cmd)
+		if raw, err := future.cmd.Text(); err == nil && future.open != nil {
+			if value, err := future.open(raw); err != nil {
+				future.cmd.SetErr(err)
+			} else {
+				future.cmd.SetVal(value)
+			}
+		}
+		if err := future.cmd.Err(); err != nil && err != redis.Nil {
+			node, ok := nodes[future.node]
+			if !ok {
+				node = &BatchNodeError{Node: future.node, Err: err}
+				nodes[future.node] = node
+			}
+			node.Failed++
+		}
+		close(future.done)
+	}
+	report := BatchFlushReport{Commands: len(batch), Duration: time.Since(start)}
+	if len(nodes) > 0 {
+		report.Err = &BatchError{Total: len(batch)}
+		for _, node := range nodes {
+			report.Err.Nodes = append(report.Err.Nodes, *node)
+		}
+		sort.Slice(report.Err.Nodes, func(i, j int) bool {
+			return report.Err.Nodes[i].Node < report.Err.Nodes[j].Node
+		})
+		Logger.Warn(GetLogPrefix("") + report.Err.Error())
+	}
+	if b.opts.OnFlush != nil {
+		b.opts.OnFlush(report)
+	}
+	return report.Err
+}
+
+// nodeForCmd 命令所在节点的地址, 集群模式下按第一个 key 计算所属主节点
+func (r *ModelRedisHandler) nodeForCmd(ctx context.Context, cmd redis.Cmder) string {
+	if !r.IsCluster && !r.isRing() {
+		return r.Host
+	}
+	args := cmd.Args()
+	if len(args) < 2 {
+		return ""
+	}
+	return r.nodeForKey(ctx, fmt.Sprint(args[1]))
+}
+
+// nodeForKey key 所在节点的地址: 单点模式为 Host, 集群模式为所属主节点, 分片模式为所属分片; 无法确定时返回空字符串
+func (r *ModelRedisHandler) nodeForKey(ctx context.Context, key string) string {
+	if r.isRing() {
+		return r.Shards[r.ring.shardFor(key)]
+	}
+	if !r.IsCluster {
+		return r.Host
+	}
+	client, err := r.RedisClusterClient.MasterForKey(ctx, key)
+	if err != nil {
+		return ""
+	}
+	return client.Options().Addr
+}
@@ -0,0 +1,142 @@
+package go_toolbox
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestBatcher(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	var (
+		mu      sync.Mutex
+		flushes []BatchFlushReport
+	)
+	batcher := redisHandler.NewBatcher(BatcherOptions{
+		MaxBatchSize: 10,
+		MaxDelay:     20 * time.Millisecond,
+		OnFlush: func(report BatchFlushReport) {
+			mu.Lock()
+			flushes = append(flushes, report)
+			mu.Unlock()
+		},
+	})
+
+	var wg sync.WaitGroup
+	futures := make([]*BatchFuture, 25)
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			futures[i] = batcher.Set(fmt.Sprintf("k%d", i), i, time.Minute)
+		}(i)
+	}
+	wg.Wait()
+	for i, future := range futures {
+		if status, err := future.Text(); err != nil || status != "OK" {
+			t.Fatalf("set %d failed: %q %v", i, status, err)
+		}
+	}
+
+	get := batcher.Get("k7")
+	missing := batcher.Get("missing")
+	incr := batcher.IncrBy("counter", 5)
+	if err := batcher.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if value, err := get.Int64(); err != nil || value != 7 {
+		t.Fatalf("expected 7, got %d %v", value, err)
+	}
+	if _, err := missing.Text(); err != NilType {
+		t.Fatalf("expected redis.Nil, got %v", err)
+	}
+	if value, _ := incr.Int64(); value != 5 {
+		t.Fatalf("expected 5, got %d", value)
+	}
+	if err := batcher.Get("k1").Err(); err != ErrBatcherClosed {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// 25 条 Set 至少触发两次按数量 flush, 剩余的由延迟或 Close 发送
+	if len(flushes) < 3 {
+		t.Fatalf("expected at least 3 flushes, got %d", len(flushes))
+	}
+}
+
+func TestBatcherNodeErrors(t *testing.T) {
+	redisHandler, err := OpenRedisHandler(&RedisConf{Host: "127.0.0.1:1", Enable: true, BreakerThreshold: -1},
+		WithBackgroundConnect())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redisHandler.ShutdownRedisHandler()
+	batcher := redisHandler.NewBatcher(BatcherOptions{Timeout: 500 * time.Millisecond})
+	batcher.Get("a")
+	batcher.Get("b")
+	flushErr := batcher.Flush()
+	batchErr, ok := flushErr.(*BatchError)
+	if !ok || batchErr.Total != 2 || len(batchErr.Nodes) != 1 || batchErr.Nodes[0].Node != "127.0.0.1:1" {
+		t.Fatalf("expected per-node error, got %v", flushErr)
+	}
+}
+
+func TestBatcherEnvelope(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	redisHandler.Compression = CompressionGzip
+	redisHandler.CompressThreshold = 1
+	redisHandler.MaxValueSize = 64
+
+	batcher := redisHandler.NewBatcher(BatcherOptions{})
+	defer batcher.Close()
+	bio := strings.Repeat("la", 100)
+	set := batcher.Set("bio:1", bio, 0)
+	hset := batcher.HashSet("user:1", "bio", bio, "name", "elvis")
+	random := rand.New(rand.NewSource(1))
+	noise := make([]byte, 400)
+	for i := range noise {
+		noise[i] = byte('a' + random.Intn(26))
+	}
+	// 压缩后仍超过 MaxValueSize 的值需要分片, 不入队
+	if err := batcher.Set("bio:2", string(noise), 0).Err(); err == nil || !strings.Contains(err.Error(), "MaxValueSize") {
+		t.Fatalf("values that need chunks should be refused, got %v", err)
+	}
+	if err := batcher.Flush(); err != nil || set.Err() != nil || hset.Err() != nil {
+		t.Fatalf("flush failed: %v %v %v", err, set.Err(), hset.Err())
+	}
+
+	// 批量写入的值与 Handler 写入的格式一致, 两边可以互相读取
+	if raw := redisHandler.RedisClient.Get(context.Background(), "bio:1").Val(); !isEnvelope(raw) {
+		t.Fatal("batched values should be sealed")
+	}
+	if value, ok := redisHandler.Get("bio:1"); !ok || value != bio {
+		t.Fatalf("unexpected value %q", value)
+	}
+	if value, ok := redisHandler.HashGet("user:1", "bio"); !ok || value != bio {
+		t.Fatalf("unexpected hash value %q", value)
+	}
+	redisHandler.Set("bio:3", bio, 0)
+	get := batcher.Get("bio:3")
+	hget := batcher.HashGet("user:1", "bio")
+	missing := batcher.Get("bio:missing")
+	if err := batcher.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := get.Text(); err != nil || value != bio {
+		t.Fatalf("batched Get should open the envelope, got %q %v", value, err)
+	}
+	if value, err := hget.Text(); err != nil || value != bio {
+		t.Fatalf("batched HashGet should open the envelope, got %q %v", value, err)
+	}
+	if err := missing.Err(); err != redis.Nil {
+		t.Fatalf("expected redis.Nil, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package go_toolbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultBigKeyTopN      = 20
+	DefaultBigKeyBatchSize = 200
+)
+
+// BigKeyOptions 大 key 分析参数
+type BigKeyOptions struct {
+	// Pattern 只分析匹配的 key (glob), 为空时分析全部 key
+	Pattern string
+	// TopN 每个节点保留内存占用最大的 key 数, 默认 20
+	TopN int
+	// BatchSize 每次 SCAN 的数量, 默认 200
+	BatchSize int64
+	// KeysPerSecond 限速, 所有节点合计, <=0 表示不限速
+	KeysPerSecond int
+	// MemorySamples MEMORY USAGE 对聚合类型抽样的元素数, 0 使用 Redis 的默认值 (5)
+	MemorySamples int
+}
+
+// BigKey 一个 key 的分析结果, Length 为按类型取得的长度 (STRLEN/HLEN/LLEN/SCARD/ZCARD/XLEN), 其他类型为 -1
+type BigKey struct {
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	MemoryBytes int64  `json:"memory_bytes"`
+	Length      int64  `json:"length"`
+}
+
+// BigKeyNodeReport 单个节点的分析结果
+// Keys 按内存占用从大到小排列, Longest 为每种类型中长度最大的 key, Types 为每种类型的 key 数
+type BigKeyNodeReport struct {
+	Node       string            `json:"node"`
+	Scanned    int64             `json:"scanned"`
+	TotalBytes int64             `json:"total_bytes"`
+	Types      map[string]int64  `json:"types"`
+	Keys       []BigKey          `json:"keys"`
+	Longest    map[string]BigKey `json:"longest"`
+}
+
+// BigKeyReport 大 key 分析结果, 每个节点 (集群为各主节点, 分片模式为各分片) 一项
+type BigKeyReport struct {
+	Nodes    []BigKeyNodeReport `json:"nodes"`
+	Duration time.Duration      `json:"duration"`
+}
+
+// JSON 以缩进的 JSON 导出
+func (rep BigKeyReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(rep, "", "  ")
+}
+
+// AnalyzeBigKeys 离线分析各节点的大 key: SCAN 遍历 key, 每批以 Pipeline 发送 TYPE 与 MEMORY USAGE,
+// 再按类型取得长度, 扫描期间被删除的 key 直接跳过
+// 会遍历整个键空间, 请在低峰期运行并通过 KeysPerSecond 限速; ctx 取消时返回已完成部分的结果
+func (r *ModelRedisHandler) AnalyzeBigKeys(ctx context.Context, opts BigKeyOptions) (BigKeyReport, error) {
+	if !r.Enable {
+		return BigKeyReport{}, errors.New("Redis 未启用")
+	}
+	if opts.TopN <= 0 {
+		opts.TopN = DefaultBigKeyTopN
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBigKeyBatchSize
+	}
+	if opts.Pattern == "" {
+		opts.Pattern = "*"
+	}
+	start := time.Now()
+	analyzer := &bigKeyAnalyzer{opts: opts, limiter: newRateLimiter(opts.KeysPerSecond)}
+	Logger.Info(GetLogPrefix("") + r.logName() + " 大 key 分析开始, pattern: " + opts.Pattern)
+	err := r.forEachNode(ctx, func(ctx context.Context, node *redis.Client) error {
+		return analyzer.analyzeNode(ctx, node)
+	})
+	report := BigKeyReport{Nodes: analyzer.nodes, Duration: time.Since(start)}
+	sort.Slice(report.Nodes, func(i, j int) bool {
+		return report.Nodes[i].Node < report.Nodes[j].Node
+	})
+	var scanned int64
+	for _, node := range report.Nodes {
+		scanned += node.Scanned
+	}
+	Logger.Info(GetLogPrefix("") + r.logName() + fmt.Sprintf(" 大 key 分析结束: 节点 %d, 扫描 %d, 耗时 %v", len(report.Nodes), scanned, report.Duration))
+	return report, err
+}
+
+type bigKeyAnalyzer struct {
+	opts BigKeyOptions
+
+	limiter *rateLimiter
+
+	mu    sync.Mutex
+	nodes []BigKeyNodeReport
+}
+
+func (a *bigKeyAnalyzer) analyzeNode(ctx context.Context, node *redis.Client) error {
+	report := BigKeyNodeReport{
+		Node:    node.Options().Addr,
+		Types:   make(map[string]int64),
+		Longest: make(map[string]BigKey),
+	}
+	// 节点出错或 ctx 取消时同样保留已分析的部分
+	defer func() {
+		sort.Slice(report.Keys, func(i, j int) bool {
+			return report.Keys[i].MemoryBytes > report.Keys[j].MemoryBytes
+		})
+		a.mu.Lock()
+		a.nodes = append(a.nodes, report)
+		a.mu.Unlock()
+	}()
+	var cursor uint64
+	for {
+		keys, next, err := node.Scan(ctx, cursor, a.opts.Pattern, a.opts.BatchSize).Result()
+		if err != nil {
+			return err
+		}
+		if err := a.limiter.wait(ctx, len(keys)); err != nil {
+			return err
+		}
+		bigKeys, err := a.inspect(ctx, node, keys)
+		if err != nil {
+			return err
+		}
+		for _, key := range bigKeys {
+			a.add(&report, key)
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// inspect 第一轮 Pipeline 取得 TYPE 与 MEMORY USAGE, 第二轮按类型取得长度
+func (a *bigKeyAnalyzer) inspect(ctx context.Context, node *redis.Client, keys []string) ([]BigKey, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	types := make([]*redis.StatusCmd, len(keys))
+	usages := make([]*redis.IntCmd, len(keys))
+	_, err := node.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			types[i] = pipe.Type(ctx, key)
+			if a.opts.MemorySamples > 0 {
+				usages[i] = pipe.MemoryUsage(ctx, key, a.opts.MemorySamples)
+			} else {
+				usages[i] = pipe.MemoryUsage(ctx, key)
+			}
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	bigKeys := make([]BigKey, 0, len(keys))
+	for i, key := range keys {
+		keyType := types[i].Val()
+		// 扫描之后被删除的 key: TYPE 为 none, MEMORY USAGE 为 nil
+		if keyType == "none" || usages[i].Err() == redis.Nil {
+			continue
+		}
+		if err := types[i].Err(); err != nil {
+			return nil, err
+		}
+		if err := usages[i].Err(); err != nil {
+			return nil, err
+		}
+		bigKeys = append(bigKeys, BigKey{Key: key, Type: keyType, MemoryBytes: usages[i].Val(), Length: -1})
+	}
+	lengths := make([]*redis.IntCmd, len(bigKeys))
+	_, err = node.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range bigKeys {
+			lengths[i] = bigKeyLength(ctx, pipe, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range bigKeys {
+		if lengths[i] != nil {
+			bigKeys[i].Length = lengths[i].Val()
+		}
+	}
+	return bigKeys, nil
+}
+
+// bigKeyLength 按类型发送长度命令, 没有对应命令的类型 (如 ReJSON, 布隆过滤器) 返回 nil
+func bigKeyLength(ctx context.Context, pipe redis.Pipeliner, key BigKey) *redis.IntCmd {
+	switch key.Type {
+	case "string":
+		return pipe.StrLen(ctx, key.Key)
+	case "hash":
+		return pipe.HLen(ctx, key.Key)
+	case "list":
+		return pipe.LLen(ctx, key.Key)
+	case "set":
+		return pipe.SCard(ctx, key.Key)
+	case "zset":
+		return pipe.ZCard(ctx, key.Key)
+	case "stream":
+		return pipe.XLen(ctx, key.Key)
+	}
+	return nil
+}
+
+// add 累计统计并保留内存占用最大的 TopN 个 key
+func (a *bigKeyAnalyzer) add(report *BigKeyNodeReport, key BigKey) {
+	report.Scanned++
+	report.TotalBytes += key.MemoryBytes
+	report.Types[key.Type]++
+	if longest, ok := report.Longest[key.Type]; key.Length >= 0 && (!ok || key.Length > longest.Length) {
+		report.Longest[key.Type] = key
+	}
+	if len(report.Keys) < a.opts.TopN {
+		report.Keys = append(report.Keys, key)
+		return
+	}
+	smallest := 0
+	for i, k := range report.Keys {
+		if k.MemoryBytes < report.Keys[smallest].MemoryBytes {
+			smallest = i
+		}
+	}
+	if key.MemoryBytes > report.Keys[smallest].MemoryBytes {
+		report.Keys[smallest] = key
+	}
+}
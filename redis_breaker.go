@@ -0,0 +1,222 @@
+package go_toolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BreakerState 熔断器状态
+type BreakerState int32
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+const (
+	DefaultBreakerThreshold    int = 5
+	DefaultBreakerOpenDuration     = 10 * time.Second
+)
+
+// ErrRedisCircuitOpen 熔断器打开期间请求被快速拒绝
+var ErrRedisCircuitOpen = errors.New("Redis 熔断器已打开, 请求被快速拒绝")
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("unknown(%d)", int32(s))
+	}
+}
+
+// circuitBreaker 实现 redis.Limiter, 在每次获取连接前判断是否放行
+// 连续失败 threshold 次后打开, 打开 openDuration 后进入半开状态放行一个探测请求,
+// 探测成功则关闭, 失败则重新打开
+type circuitBreaker struct {
+	mu           sync.Mutex
+	addr         string
+	state        BreakerState
+	failures     int
+	threshold    int
+	openDuration time.Duration
+	openedAt     time.Time
+	probing      bool
+}
+
+func newCircuitBreaker(threshold int, openDuration time.Duration) *circuitBreaker {
+	if threshold == 0 {
+		threshold = DefaultBreakerThreshold
+	}
+	if openDuration <= 0 {
+		openDuration = DefaultBreakerOpenDuration
+	}
+	return &circuitBreaker{
+		state:        BreakerClosed,
+		threshold:    threshold,
+		openDuration: openDuration,
+	}
+}
+
+// State 当前熔断器状态
+func (b *circuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow 判断请求是否放行, 实现 redis.Limiter
+func (b *circuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return ErrRedisCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrRedisCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// ReportResult 记录请求结果, 实现 redis.Limiter
+func (b *circuitBreaker) ReportResult(err error) {
+	failed := isRedisFailure(err)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	case BreakerHalfOpen:
+		b.probing = false
+		if failed {
+			b.open()
+			return
+		}
+		b.failures = 0
+		b.setState(BreakerClosed)
+	}
+}
+
+func (b *circuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.setState(BreakerOpen)
+}
+
+func (b *circuitBreaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	prev := b.state
+	b.state = state
+	switch state {
+	case BreakerOpen:
+		Logger.Warn(GetLogPrefix("") + fmt.Sprintf("Redis 熔断器 %s 状态变更: %s -> %s, 连续失败 %d 次, %v 后尝试恢复",
+			b.addr, prev, state, b.failures, b.openDuration))
+	default:
+		Logger.Info(GetLogPrefix("") + fmt.Sprintf("Redis 熔断器 %s 状态变更: %s -> %s", b.addr, prev, state))
+	}
+}
+
+// nodeBreakers 每个节点 (按地址) 一个熔断器, 集群与分片模式下单个节点故障只熔断该节点的请求
+type nodeBreakers struct {
+	mu           sync.Mutex
+	threshold    int
+	openDuration time.Duration
+	nodes        map[string]*circuitBreaker
+}
+
+func newNodeBreakers(threshold int, openDuration time.Duration) *nodeBreakers {
+	return &nodeBreakers{threshold: threshold, openDuration: openDuration, nodes: make(map[string]*circuitBreaker)}
+}
+
+// forNode 节点的熔断器, 不存在时创建, 节点客户端重建 (如集群拓扑变化) 后沿用同一熔断器
+func (n *nodeBreakers) forNode(addr string) *circuitBreaker {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	breaker, ok := n.nodes[addr]
+	if !ok {
+		breaker = newCircuitBreaker(n.threshold, n.openDuration)
+		breaker.addr = addr
+		n.nodes[addr] = breaker
+	}
+	return breaker
+}
+
+// States 各节点的熔断器状态
+func (n *nodeBreakers) States() map[string]BreakerState {
+	n.mu.Lock()
+	breakers := make(map[string]*circuitBreaker, len(n.nodes))
+	for addr, breaker := range n.nodes {
+		breakers[addr] = breaker
+	}
+	n.mu.Unlock()
+	states := make(map[string]BreakerState, len(breakers))
+	for addr, breaker := range breakers {
+		states[addr] = breaker.State()
+	}
+	return states
+}
+
+// isRedisFailure 判断错误是否代表 Redis 不可用
+// redis.Nil 与普通的服务端错误 (如 WRONGTYPE) 说明服务可用, 不计入失败
+func isRedisFailure(err error) bool {
+	if err == nil || err == redis.Nil || err == ErrRedisCircuitOpen || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if _, ok := err.(redis.Error); ok {
+		return redis.HasErrorPrefix(err, "LOADING") ||
+			redis.HasErrorPrefix(err, "CLUSTERDOWN") ||
+			redis.HasErrorPrefix(err, "MASTERDOWN")
+	}
+	return true
+}
+
+// disabledHook 用于 Enable=false 的 Handler, 所有命令不经过网络直接返回 redis.Nil
+type disabledHook struct{}
+
+func (disabledHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, redis.Nil
+	}
+}
+
+func (disabledHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		cmd.SetErr(redis.Nil)
+		return redis.Nil
+	}
+}
+
+func (disabledHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			cmd.SetErr(redis.Nil)
+		}
+		return redis.Nil
+	}
+}
@@ -0,0 +1,451 @@
+package go_toolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultCounterBucket        = time.Minute
+	DefaultCounterTTL           = 24 * time.Hour
+	DefaultCounterGrace         = 5 * time.Second
+	DefaultCounterFlushInterval = 30 * time.Second
+
+	counterPlain      = "n:"
+	counterHash       = "h:"
+	counterStateSnap  = "snapshot"
+	counterStateWrite = "inserting"
+)
+
+// CounterFlushRow DedupQuery 的结果行, 查询需要返回 flush_id 列
+type CounterFlushRow struct {
+	FlushId string `db:"flush_id"`
+}
+
+// RedisCounterOptions 计数器配置
+type RedisCounterOptions struct {
+	// Prefix key 前缀, 必填
+	Prefix string
+	// Bucket 时间桶宽度, 默认 1 分钟
+	Bucket time.Duration
+	// TTL 计数 key 的过期时间, 需要大于 flush 的最长中断时间, 默认 24 小时
+	TTL time.Duration
+	// Grace 时间桶结束后等待多久再 flush, 用于容忍时钟偏差与延迟写入, 默认 5 秒
+	Grace time.Duration
+	// FlushInterval 后台 flush 间隔, 默认 30 秒
+	FlushInterval time.Duration
+	// InsertQuery 写入 ClickHouse 的语句, 参数依次为 bucket (time.Time), name, field, value (int64), flush_id
+	//	INSERT INTO db.counters (bucket, name, field, value, flush_id) VALUES (?, ?, ?, ?, ?)
+	InsertQuery string
+	// DedupQuery 判断某次 flush 是否已写入的查询, %s 替换为 flush_id, 结果按 CounterFlushRow 解析
+	//	SELECT flush_id FROM db.counters WHERE flush_id = '%s' LIMIT 1
+	// 为空时崩溃恢复会重新写入, 需要表引擎按 flush_id 去重 (如 ReplacingMergeTree)
+	DedupQuery string
+}
+
+// CounterDelta 一次计数, Field 为空时为普通计数 (INCRBY), 否则为哈希计数 (HINCRBY), Time 为空时使用当前时间
+type CounterDelta struct {
+	Name  string
+	Field string
+	Delta int64
+	Time  time.Time
+}
+
+// CounterFlushReport 一次 flush 的结果
+type CounterFlushReport struct {
+	Buckets  int
+	Rows     int
+	Deduped  int
+	Failures int
+}
+
+// RedisCounter 按时间桶计数并定期汇总到 ClickHouse
+// 每个时间桶的 key 使用相同的 hash tag, 集群模式下位于同一槽位, 因此快照 (RENAME) 可以在一个事务中完成
+// flush 分两步: 先原子地把时间桶的全部 key 重命名为快照并记录代数, 再把快照写入 ClickHouse 后删除;
+// 写入前在快照中标记状态, 崩溃后重启会继续处理遗留的快照, 并通过 DedupQuery 判断是否已写入, 避免重复计数
+type RedisCounter struct {
+	r    *ModelRedisHandler
+	ck   ClickHouseStore
+	opts RedisCounterOptions
+
+	mu   sync.Mutex
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewRedisCounter 创建计数器, ck 为 nil 时只计数不汇总
+func NewRedisCounter(r *ModelRedisHandler, ck ClickHouseStore, opts RedisCounterOptions) (*RedisCounter, error) {
+	if opts.Prefix == "" {
+		return nil, errors.New("计数器 Prefix 不能为空")
+	}
+	if ck != nil && opts.InsertQuery == "" {
+		return nil, errors.New("计数器 InsertQuery 不能为空")
+	}
+	if opts.Bucket <= 0 {
+		opts.Bucket = DefaultCounterBucket
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultCounterTTL
+	}
+	if opts.Grace < 0 {
+		opts.Grace = 0
+	} else if opts.Grace == 0 {
+		opts.Grace = DefaultCounterGrace
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultCounterFlushInterval
+	}
+	return &RedisCounter{r: r, ck: ck, opts: opts}, nil
+}
+
+// Incr 当前时间桶的普通计数加 delta
+func (c *RedisCounter) Incr(name string, delta int64) bool {
+	return c.IncrMany([]CounterDelta{{Name: name, Delta: delta}})
+}
+
+// HIncr 当前时间桶的哈希计数 field 加 delta
+func (c *RedisCounter) HIncr(name, field string, delta int64) bool {
+	return c.IncrMany([]CounterDelta{{Name: name, Field: field, Delta: delta}})
+}
+
+// IncrMany 使用一个事务 Pipeline 写入多次计数, 每个计数与其索引登记在同一个 MULTI 中 (同一时间桶的 key 位于同一槽位),
+// 快照不会落在两者之间
+func (c *RedisCounter) IncrMany(deltas []CounterDelta) bool {
+	if !c.r.Enable || len(deltas) == 0 {
+		return true
+	}
+	ctx := context.Background()
+	now := time.Now()
+	buckets := make(map[int64]struct{})
+	_, err := c.r.universalClient().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, d := range deltas {
+			t := d.Time
+			if t.IsZero() {
+				t = now
+			}
+			bucket := c.bucketOf(t)
+			field := counterPlain + d.Name
+			if d.Field != "" {
+				field = counterHash + d.Name
+				pipe.HIncrBy(ctx, c.key(bucket, field), d.Field, d.Delta)
+			} else {
+				pipe.IncrBy(ctx, c.key(bucket, field), d.Delta)
+			}
+			pipe.Expire(ctx, c.key(bucket, field), c.opts.TTL)
+			pipe.HSet(ctx, c.indexKey(bucket), field, 1)
+			buckets[bucket] = struct{}{}
+		}
+		for bucket := range buckets {
+			pipe.Expire(ctx, c.indexKey(bucket), c.opts.TTL)
+			pipe.ZAdd(ctx, c.bucketsKey(), redis.Z{Score: float64(bucket), Member: bucket})
+		}
+		return nil
+	})
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + c.r.logName() + " 计数写入错误! 错误原因: " + err.Error())
+		return false
+	}
+	return true
+}
+
+// Value 读取 t 所在时间桶的普通计数, 用于实时看板
+func (c *RedisCounter) Value(name string, t time.Time) (int64, bool) {
+	if !c.r.Enable {
+		return 0, true
+	}
+	value, err := c.r.universalClient().Get(context.Background(), c.key(c.bucketOf(t), counterPlain+name)).Int64()
+	if err != nil && err != redis.Nil {
+		Logger.Error(GetLogPrefix("") + c.r.logName() + " 计数读取错误! 错误原因: " + err.Error())
+		return 0, false
+	}
+	return value, true
+}
+
+// HValues 读取 t 所在时间桶的哈希计数
+func (c *RedisCounter) HValues(name string, t time.Time) (map[string]int64, bool) {
+	if !c.r.Enable {
+		return map[string]int64{}, true
+	}
+	values, err := c.r.universalClient().HGetAll(context.Background(), c.key(c.bucketOf(t), counterHash+name)).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + c.r.logName() + " 计数读取错误! 错误原因: " + err.Error())
+		return nil, false
+	}
+	return parseCounterHash(values), true
+}
+
+// StartFlusher 启动后台 flush, 多个实例同时运行时通过锁保证同一时刻只有一个实例执行
+func (c *RedisCounter) StartFlusher() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stop = cancel
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.opts.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := c.Flush(ctx); err != nil && ctx.Err() == nil {
+					Logger.Warn(GetLogPrefix("") + "计数器 flush 失败! 错误原因: " + err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// StopFlusher 停止后台 flush 并等待退出
+func (c *RedisCounter) StopFlusher() {
+	c.mu.Lock()
+	stop, done := c.stop, c.done
+	c.stop = nil
+	c.mu.Unlock()
+	if stop != nil {
+		stop()
+		<-done
+	}
+}
+
+// Flush 汇总全部已结束的时间桶 (包括上次崩溃遗留的快照)
+func (c *RedisCounter) Flush(ctx context.Context) (CounterFlushReport, error) {
+	var report CounterFlushReport
+	if !c.r.Enable || c.ck == nil {
+		return report, nil
+	}
+	client := c.r.universalClient()
+	token := strconv.FormatInt(time.Now().UnixNano(), 36)
+	locked, err := client.SetNX(ctx, c.lockKey(), token, c.opts.FlushInterval+time.Minute).Result()
+	if err != nil {
+		return report, err
+	}
+	if !locked {
+		return report, nil
+	}
+	defer c.unlock(token)
+
+	members, err := client.ZRange(ctx, c.bucketsKey(), 0, -1).Result()
+	if err != nil {
+		return report, err
+	}
+	closedBefore := time.Now().Add(-c.opts.Bucket - c.opts.Grace).Unix()
+	var firstErr error
+	for _, member := range members {
+		bucket, err := strconv.ParseInt(member, 10, 64)
+		if err != nil || bucket > closedBefore {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := c.flushBucket(ctx, bucket, &report); err != nil {
+			report.Failures++
+			Logger.Warn(GetLogPrefix("") + fmt.Sprintf("计数器时间桶 %d flush 失败! 错误原因: %v", bucket, err))
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		report.Buckets++
+	}
+	return report, firstErr
+}
+
+func (c *RedisCounter) flushBucket(ctx context.Context, bucket int64, report *CounterFlushReport) error {
+	client := c.r.universalClient()
+	meta, err := client.HGetAll(ctx, c.snapKey(bucket, "meta")).Result()
+	if err != nil {
+		return err
+	}
+	if len(meta) == 0 {
+		if meta, err = c.snapshot(ctx, bucket); err != nil {
+			return err
+		}
+	}
+	if len(meta) > 0 {
+		if err := c.writeSnapshot(ctx, bucket, meta, report); err != nil {
+			return err
+		}
+	}
+	// 快照之后仍有延迟写入时保留时间桶, 下次 flush 时作为新的一代处理
+	exists, err := client.Exists(ctx, c.indexKey(bucket)).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+	return client.ZRem(ctx, c.bucketsKey(), bucket).Err()
+}
+
+// snapshot 在一个事务中把时间桶的全部 key 重命名为快照, 返回快照的元数据, 时间桶为空时返回 nil
+func (c *RedisCounter) snapshot(ctx context.Context, bucket int64) (map[string]string, error) {
+	index, metaKey, genKey := c.indexKey(bucket), c.snapKey(bucket, "meta"), c.key(bucket, "gen")
+	var meta map[string]string
+	err := c.r.Transaction(ctx, []string{index, metaKey, genKey}, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		meta = nil
+		fields, err := tx.HKeys(ctx, index).Result()
+		if err != nil || len(fields) == 0 {
+			return err
+		}
+		gen, err := tx.Get(ctx, genKey).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		gen++
+		// 索引中的 key 可能已不存在 (例如升级前非事务写入留下的索引), 只重命名存在的 key, 避免 RENAME 出错使事务部分执行
+		exists := make([]*redis.IntCmd, len(fields))
+		if _, err := tx.Pipelined(ctx, func(check redis.Pipeliner) error {
+			for i, field := range fields {
+				exists[i] = check.Exists(ctx, c.key(bucket, field))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for i, field := range fields {
+			if exists[i].Val() > 0 {
+				pipe.Rename(ctx, c.key(bucket, field), c.snapKey(bucket, field))
+			}
+		}
+		pipe.Rename(ctx, index, c.snapKey(bucket, "index"))
+		pipe.HSet(ctx, metaKey, "gen", gen, "state", counterStateSnap)
+		pipe.Expire(ctx, metaKey, c.opts.TTL)
+		pipe.Set(ctx, genKey, gen, c.opts.TTL)
+		meta = map[string]string{"gen": strconv.FormatInt(gen, 10), "state": counterStateSnap}
+		return nil
+	})
+	return meta, err
+}
+
+// writeSnapshot 把快照写入 ClickHouse 后删除快照
+func (c *RedisCounter) writeSnapshot(ctx context.Context, bucket int64, meta map[string]string, report *CounterFlushReport) error {
+	client := c.r.universalClient()
+	flushId := fmt.Sprintf("%s:%d:%s", c.opts.Prefix, bucket, meta["gen"])
+	fields, err := client.HKeys(ctx, c.snapKey(bucket, "index")).Result()
+	if err != nil {
+		return err
+	}
+	sort.Strings(fields)
+	cmds := make([]redis.Cmder, len(fields))
+	if _, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, field := range fields {
+			if strings.HasPrefix(field, counterHash) {
+				cmds[i] = pipe.HGetAll(ctx, c.snapKey(bucket, field))
+			} else {
+				cmds[i] = pipe.Get(ctx, c.snapKey(bucket, field))
+			}
+		}
+		return nil
+	}); err != nil && err != redis.Nil {
+		return err
+	}
+	bucketTime := time.Unix(bucket, 0).UTC()
+	var rows [][]interface{}
+	for i, field := range fields {
+		switch cmd := cmds[i].(type) {
+		case *redis.MapStringStringCmd:
+			values := parseCounterHash(cmd.Val())
+			keys := make([]string, 0, len(values))
+			for key := range values {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				rows = append(rows, []interface{}{bucketTime, strings.TrimPrefix(field, counterHash), key, values[key], flushId})
+			}
+		case *redis.StringCmd:
+			if value, err := cmd.Int64(); err == nil {
+				rows = append(rows, []interface{}{bucketTime, strings.TrimPrefix(field, counterPlain), "", value, flushId})
+			}
+		}
+	}
+
+	written := false
+	if meta["state"] == counterStateWrite && c.opts.DedupQuery != "" {
+		var existing []CounterFlushRow
+		if err := c.ck.QueryData(&existing, fmt.Sprintf(c.opts.DedupQuery, flushId)); err != nil {
+			return err
+		}
+		written = len(existing) > 0
+	}
+	if written {
+		report.Deduped += len(rows)
+		Logger.Info(GetLogPrefix("") + "计数器快照已写入过, 跳过: " + flushId)
+	} else if len(rows) > 0 {
+		if err := client.HSet(ctx, c.snapKey(bucket, "meta"), "state", counterStateWrite).Err(); err != nil {
+			return err
+		}
+		if _, err := c.ck.BatchInsertData(c.opts.InsertQuery, rows); err != nil {
+			return err
+		}
+		report.Rows += len(rows)
+	}
+
+	keys := make([]string, 0, len(fields)+2)
+	for _, field := range fields {
+		keys = append(keys, c.snapKey(bucket, field))
+	}
+	keys = append(keys, c.snapKey(bucket, "index"), c.snapKey(bucket, "meta"))
+	return client.Del(ctx, keys...).Err()
+}
+
+func (c *RedisCounter) unlock(token string) {
+	ctx := context.Background()
+	err := c.r.Transaction(ctx, []string{c.lockKey()}, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		if current, err := tx.Get(ctx, c.lockKey()).Result(); err != nil || current != token {
+			return nil
+		}
+		pipe.Del(ctx, c.lockKey())
+		return nil
+	})
+	if err != nil {
+		Logger.Warn(GetLogPrefix("") + "计数器 flush 锁释放失败! 错误原因: " + err.Error())
+	}
+}
+
+func (c *RedisCounter) bucketOf(t time.Time) int64 {
+	return t.Truncate(c.opts.Bucket).Unix()
+}
+
+// key 同一时间桶的 key 共享 hash tag
+func (c *RedisCounter) key(bucket int64, suffix string) string {
+	return fmt.Sprintf("{%s:%d}:%s", c.opts.Prefix, bucket, suffix)
+}
+
+func (c *RedisCounter) indexKey(bucket int64) string {
+	return c.key(bucket, "index")
+}
+
+func (c *RedisCounter) snapKey(bucket int64, suffix string) string {
+	return c.key(bucket, "snap:"+suffix)
+}
+
+func (c *RedisCounter) bucketsKey() string {
+	return c.opts.Prefix + ":buckets"
+}
+
+func (c *RedisCounter) lockKey() string {
+	return c.opts.Prefix + ":flush-lock"
+}
+
+func parseCounterHash(values map[string]string) map[string]int64 {
+	result := make(map[string]int64, len(values))
+	for field, value := range values {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			result[field] = n
+		}
+	}
+	return result
+}
@@ -0,0 +1,134 @@
+package go_toolbox
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const testCounterInsert = "INSERT INTO db.counters (bucket, name, field, value, flush_id) VALUES (?, ?, ?, ?, ?)"
+
+func TestRedisCounterFlush(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ck := NewFakeClickHouse()
+	ctx := context.Background()
+
+	counter, err := NewRedisCounter(redisHandler.ModelRedisHandler, ck, RedisCounterOptions{Prefix: "pv", InsertQuery: testCounterInsert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-10 * time.Minute)
+	counter.IncrMany([]CounterDelta{
+		{Name: "home", Delta: 3, Time: past},
+		{Name: "home", Delta: 2, Time: past},
+		{Name: "region", Field: "cn", Delta: 5, Time: past},
+		{Name: "region", Field: "us", Delta: 1, Time: past},
+	})
+	counter.Incr("home", 7)
+	if value, _ := counter.Value("home", past); value != 5 {
+		t.Fatalf("unexpected value %d", value)
+	}
+	if values, _ := counter.HValues("region", past); values["cn"] != 5 || values["us"] != 1 {
+		t.Fatalf("unexpected hash values %v", values)
+	}
+
+	report, err := counter.Flush(ctx)
+	if err != nil || report.Buckets != 1 || report.Rows != 3 {
+		t.Fatalf("unexpected report: %+v %v", report, err)
+	}
+	rows := ck.InsertedRows(testCounterInsert)
+	if len(rows) != 3 || rows[2][1] != "home" || rows[2][3] != int64(5) || rows[0][2] != "cn" || rows[0][4] != rows[2][4] {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	// 已汇总的时间桶被重置, 当前时间桶未结束不会汇总
+	if value, _ := counter.Value("home", past); value != 0 {
+		t.Fatal("flushed bucket should be reset")
+	}
+	if value, _ := counter.Value("home", time.Now()); value != 7 {
+		t.Fatal("open bucket should not be flushed")
+	}
+	if report, _ := counter.Flush(ctx); report.Rows != 0 || len(ck.InsertedRows(testCounterInsert)) != 3 {
+		t.Fatal("second flush should not insert again")
+	}
+
+	// 快照后的延迟写入作为新的一代汇总
+	counter.IncrMany([]CounterDelta{{Name: "home", Delta: 1, Time: past}})
+	counter.Flush(ctx)
+	rows = ck.InsertedRows(testCounterInsert)
+	if len(rows) != 4 || rows[3][3] != int64(1) || rows[3][4] == rows[0][4] {
+		t.Fatalf("late write should be flushed with a new flush id: %v", rows)
+	}
+}
+
+func TestRedisCounterCrashRecovery(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ck := NewFakeClickHouse()
+	ctx := context.Background()
+	dedup := "SELECT flush_id FROM db.counters WHERE flush_id = '%s' LIMIT 1"
+
+	counter, _ := NewRedisCounter(redisHandler.ModelRedisHandler, ck, RedisCounterOptions{Prefix: "pv", InsertQuery: testCounterInsert, DedupQuery: dedup})
+	past := time.Now().Add(-10 * time.Minute)
+	counter.IncrMany([]CounterDelta{{Name: "home", Delta: 3, Time: past}})
+
+	// 写入 ClickHouse 时失败 (可能已经写入), 快照保留
+	ck.SetError(errors.New("connection reset"))
+	if _, err := counter.Flush(ctx); err == nil {
+		t.Fatal("flush should fail")
+	}
+	ck.SetError(nil)
+	counter.IncrMany([]CounterDelta{{Name: "home", Delta: 100, Time: past}})
+
+	// ClickHouse 中已存在该 flush_id, 不会重复写入
+	flushId := "pv:" + strconv.FormatInt(past.Truncate(time.Minute).Unix(), 10) + ":1"
+	ck.SetQueryResult("SELECT flush_id FROM db.counters WHERE flush_id = '"+flushId+"' LIMIT 1", []CounterFlushRow{{FlushId: flushId}})
+	report, err := counter.Flush(ctx)
+	if err != nil || report.Deduped != 1 {
+		t.Fatalf("unexpected report: %+v %v", report, err)
+	}
+	// 失败后新写入的计数在下一次 flush 中作为第二代写入
+	report, _ = counter.Flush(ctx)
+	rows := ck.InsertedRows(testCounterInsert)
+	if report.Rows != 1 || len(rows) != 1 || rows[0][3] != int64(100) {
+		t.Fatalf("unexpected rows %v %+v", rows, report)
+	}
+	if keys := redisHandler.Keys(); len(keys) != 1 {
+		t.Fatalf("only the generation key should remain, got %v", keys)
+	}
+}
+
+func TestRedisCounterSnapshotBetweenWriteAndIndex(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ck := NewFakeClickHouse()
+	ctx := context.Background()
+	client := redisHandler.RedisClient
+
+	counter, _ := NewRedisCounter(redisHandler.ModelRedisHandler, ck, RedisCounterOptions{Prefix: "pv", InsertQuery: testCounterInsert})
+	past := time.Now().Add(-10 * time.Minute)
+	bucket := counter.bucketOf(past)
+	counter.IncrMany([]CounterDelta{{Name: "home", Delta: 1, Time: past}})
+	// 非事务写入时快照落在计数与索引登记之间: 计数被快照带走, 之后的登记使新索引指向已不存在的 key
+	client.IncrBy(ctx, counter.key(bucket, counterPlain+"home"), 2)
+	if report, err := counter.Flush(ctx); err != nil || report.Rows != 1 {
+		t.Fatalf("unexpected report: %+v %v", report, err)
+	}
+	client.HSet(ctx, counter.indexKey(bucket), counterPlain+"home", 1)
+	client.ZAdd(ctx, counter.bucketsKey(), redis.Z{Score: float64(bucket), Member: bucket})
+
+	if _, err := counter.Flush(ctx); err != nil {
+		t.Fatalf("missing counter keys should be skipped, got %v", err)
+	}
+	rows := ck.InsertedRows(testCounterInsert)
+	if len(rows) != 1 || rows[0][3] != int64(3) {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	if keys := redisHandler.Keys(); len(keys) != 1 {
+		t.Fatalf("only the generation key should remain, got %v", keys)
+	}
+}
@@ -0,0 +1,407 @@
+package go_toolbox
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	envelopeNonceSize       = 12
+	maxKeyringKeyIdLength   = 255
+	DefaultReencryptBatch   = 100
+	DefaultReencryptPattern = "*"
+)
+
+var (
+	// ErrNoPrimaryKey Keyring 中没有用于加密的主密钥
+	ErrNoPrimaryKey = errors.New("Keyring 未设置主密钥")
+	// ErrUnknownKeyId 值使用的密钥不在 Keyring 中
+	ErrUnknownKeyId  = errors.New("Keyring 中不存在该密钥")
+	errReencryptSkip = errors.New("无需重新加密")
+)
+
+// RedisKeyring AES-GCM 密钥环, 使用主密钥加密, 可以使用任意已知密钥解密
+// 轮换密钥时先 AddKey 新密钥并 SetPrimary, 旧密钥保留到重新加密完成后再 RemoveKey
+type RedisKeyring struct {
+	mu      sync.RWMutex
+	keys    map[string]cipher.AEAD
+	primary string
+}
+
+// NewRedisKeyring 创建空的 Keyring
+func NewRedisKeyring() *RedisKeyring {
+	return &RedisKeyring{keys: make(map[string]cipher.AEAD)}
+}
+
+// AddKey 添加密钥, key 长度为 16/24/32 字节 (AES-128/192/256), 第一个添加的密钥自动成为主密钥
+func (k *RedisKeyring) AddKey(id string, key []byte) error {
+	if id == "" || len(id) > maxKeyringKeyIdLength {
+		return fmt.Errorf("密钥编号长度需要在 1~%d 之间", maxKeyringKeyIdLength)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = aead
+	if k.primary == "" {
+		k.primary = id
+	}
+	return nil
+}
+
+// SetPrimary 设置用于加密的主密钥
+func (k *RedisKeyring) SetPrimary(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKeyId, id)
+	}
+	k.primary = id
+	return nil
+}
+
+// RemoveKey 移除密钥, 之后使用该密钥加密的值将无法读取, 不能移除主密钥
+func (k *RedisKeyring) RemoveKey(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if id == k.primary {
+		return errors.New("不能移除主密钥")
+	}
+	delete(k.keys, id)
+	return nil
+}
+
+// Primary 主密钥编号
+func (k *RedisKeyring) Primary() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.primary
+}
+
+// KeyIds 全部密钥编号
+func (k *RedisKeyring) KeyIds() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// seal 使用主密钥加密, 在 header 后追加密钥编号与 nonce, 密钥编号及之前的头部作为附加认证数据
+func (k *RedisKeyring) seal(header, plaintext []byte) (string, []byte, []byte, error) {
+	k.mu.RLock()
+	id := k.primary
+	aead := k.keys[id]
+	k.mu.RUnlock()
+	if aead == nil {
+		return id, nil, nil, ErrNoPrimaryKey
+	}
+	header = append(header, byte(len(id)))
+	header = append(header, id...)
+	aad := append([]byte(nil), header...)
+	nonce := make([]byte, envelopeNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return id, nil, nil, err
+	}
+	header = append(header, nonce...)
+	return id, header, aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+func (k *RedisKeyring) open(env *envelope, ciphertext []byte) ([]byte, error) {
+	k.mu.RLock()
+	aead := k.keys[env.keyId]
+	k.mu.RUnlock()
+	if aead == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyId, env.keyId)
+	}
+	plaintext, err := aead.Open(nil, env.nonce, ciphertext, env.aad)
+	if err != nil {
+		return nil, fmt.Errorf("解密失败 (key %s): %w", env.keyId, err)
+	}
+	return plaintext, nil
+}
+
+// SetKeyring 开启客户端加密, Set/HashSet/HashMSet 及结构体哈希方法写入的值使用 Keyring 的主密钥以 AES-GCM 加密
+// 读取时按值中记录的密钥编号解密, 传入 nil 关闭加密 (已加密的值将无法读取); 可以在使用 Handler 期间调用
+func (r *ModelRedisHandler) SetKeyring(keyring *RedisKeyring) {
+	r.keyringMu.Lock()
+	defer r.keyringMu.Unlock()
+	r.keyring = keyring
+}
+
+// Keyring 当前使用的 Keyring
+func (r *ModelRedisHandler) Keyring() *RedisKeyring {
+	r.keyringMu.RLock()
+	defer r.keyringMu.RUnlock()
+	return r.keyring
+}
+
+// ReencryptOptions 重新加密任务配置
+type ReencryptOptions struct {
+	// Pattern SCAN 的 MATCH 条件, 默认为 *
+	Pattern string
+	// BatchSize SCAN 的 COUNT, 默认 100
+	BatchSize int64
+	// Pause 每批之间的暂停时间, 用于限制对 Redis 的压力
+	Pause time.Duration
+	// EncryptPlaintext 为 true 时同时加密未加密的值 (包括开启加密前写入的旧值)
+	EncryptPlaintext bool
+}
+
+// ReencryptProgress 重新加密任务进度, 以 key 为单位计数
+type ReencryptProgress struct {
+	Scanned     int64
+	Reencrypted int64
+	Skipped     int64
+	Failed      int64
+}
+
+// ReencryptJob 后台重新加密任务
+type ReencryptJob struct {
+	r        *ModelRedisHandler
+	opts     ReencryptOptions
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+	progress ReencryptProgress
+}
+
+// StartReencryption 启动后台任务, 通过 SCAN 遍历 (集群模式下遍历全部主节点) 字符串与哈希,
+// 将使用旧密钥加密的值以主密钥重新加密, 过期时间保持不变
+// 未分片的值在 WATCH 事务中改写, 不会覆盖并发写入; 分片的值按普通 Set 改写
+func (r *ModelRedisHandler) StartReencryption(opts ReencryptOptions) (*ReencryptJob, error) {
+	keyring := r.Keyring()
+	if keyring == nil {
+		return nil, errors.New("未配置 Keyring")
+	}
+	if keyring.Primary() == "" {
+		return nil, ErrNoPrimaryKey
+	}
+	if opts.Pattern == "" {
+		opts.Pattern = DefaultReencryptPattern
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultReencryptBatch
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &ReencryptJob{r: r, opts: opts, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(job.done)
+		job.err = job.run(ctx)
+		Logger.Info(GetLogPrefix("") + fmt.Sprintf("Redis 重新加密任务结束: %+v", job.Progress()))
+	}()
+	return job, nil
+}
+
+// Progress 当前进度
+func (j *ReencryptJob) Progress() ReencryptProgress {
+	return ReencryptProgress{
+		Scanned:     atomic.LoadInt64(&j.progress.Scanned),
+		Reencrypted: atomic.LoadInt64(&j.progress.Reencrypted),
+		Skipped:     atomic.LoadInt64(&j.progress.Skipped),
+		Failed:      atomic.LoadInt64(&j.progress.Failed),
+	}
+}
+
+// Stop 停止任务并等待退出
+func (j *ReencryptJob) Stop() {
+	j.cancel()
+	<-j.done
+}
+
+// Wait 等待任务完成, 被 Stop 时返回 context.Canceled
+func (j *ReencryptJob) Wait() (ReencryptProgress, error) {
+	<-j.done
+	return j.Progress(), j.err
+}
+
+func (j *ReencryptJob) run(ctx context.Context) error {
+	defer j.cancel()
+	return j.r.forEachNode(ctx, func(ctx context.Context, node *redis.Client) error {
+		var cursor uint64
+		for {
+			keys, next, err := node.Scan(ctx, cursor, j.opts.Pattern, j.opts.BatchSize).Result()
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				atomic.AddInt64(&j.progress.Scanned, 1)
+				changed, err := j.reencryptKey(ctx, key)
+				switch {
+				case err != nil:
+					atomic.AddInt64(&j.progress.Failed, 1)
+					Logger.Warn(GetLogPrefix("") + "Redis 重新加密失败! key: " + key + " 错误原因: " + err.Error())
+				case changed:
+					atomic.AddInt64(&j.progress.Reencrypted, 1)
+				default:
+					atomic.AddInt64(&j.progress.Skipped, 1)
+				}
+			}
+			if cursor = next; cursor == 0 {
+				return nil
+			}
+			if j.opts.Pause > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(j.opts.Pause):
+				}
+			}
+		}
+	})
+}
+
+// needsReencrypt 值是否需要以主密钥重新加密
+func (j *ReencryptJob) needsReencrypt(raw string) bool {
+	if !isEnvelope(raw) {
+		return j.opts.EncryptPlaintext
+	}
+	env, err := parseEnvelope(raw)
+	if err != nil {
+		return false
+	}
+	if env.keyId == "" {
+		return j.opts.EncryptPlaintext
+	}
+	keyring := j.r.Keyring()
+	return keyring != nil && env.keyId != keyring.Primary()
+}
+
+// isChunk key 是否为分片信封的分片: key 中的 id 与值开头的 id 一致
+func (j *ReencryptJob) isChunk(key, raw string) bool {
+	id, ok := chunkKeyId(key)
+	return ok && len(raw) >= envelopeChunkIdSize && raw[:envelopeChunkIdSize] == id
+}
+
+func (j *ReencryptJob) reencryptKey(ctx context.Context, key string) (bool, error) {
+	kind, err := j.r.universalClient().Type(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	switch kind {
+	case "string":
+		return j.reencryptString(ctx, key)
+	case "hash":
+		return j.reencryptHash(ctx, key)
+	}
+	return false, nil
+}
+
+func (j *ReencryptJob) reencryptString(ctx context.Context, key string) (bool, error) {
+	var chunked string
+	err := j.r.Transaction(ctx, []string{key}, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		raw, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil || (err == nil && !j.needsReencrypt(raw)) {
+			return errReencryptSkip
+		}
+		if err != nil {
+			return err
+		}
+		// 分片由所属的 key 负责改写
+		if !isEnvelope(raw) && j.isChunk(key, raw) {
+			return errReencryptSkip
+		}
+		value, err := j.r.openValueErr(key, raw)
+		if err != nil {
+			return err
+		}
+		sealed, err := j.r.sealValue(value)
+		if err != nil {
+			return err
+		}
+		if len(sealed.chunks) > 0 || envelopeChunkCount(raw) > 0 {
+			chunked = value
+			return errReencryptSkip
+		}
+		pipe.SetArgs(ctx, key, sealed.value, redis.SetArgs{KeepTTL: true})
+		return nil
+	})
+	if err == errReencryptSkip && chunked == "" {
+		return false, nil
+	}
+	if err != nil && err != errReencryptSkip {
+		return false, err
+	}
+	if chunked != "" {
+		ttl, err := j.r.universalClient().PTTL(ctx, key).Result()
+		if err != nil {
+			return false, err
+		}
+		if ttl < 0 {
+			ttl = 0
+		}
+		if !j.r.setEnveloped(key, chunked, ttl) {
+			return false, errors.New("分片值写入失败")
+		}
+	}
+	return true, nil
+}
+
+func (j *ReencryptJob) reencryptHash(ctx context.Context, key string) (bool, error) {
+	var chunked []interface{}
+	changed := false
+	err := j.r.Transaction(ctx, []string{key}, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		chunked, changed = nil, false
+		fields, err := tx.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		var args []interface{}
+		for field, raw := range fields {
+			if !j.needsReencrypt(raw) {
+				continue
+			}
+			value, err := j.r.openHashValueErr(key, field, raw)
+			if err != nil {
+				return err
+			}
+			sealed, err := j.r.sealValue(value)
+			if err != nil {
+				return err
+			}
+			if len(sealed.chunks) > 0 || envelopeChunkCount(raw) > 0 {
+				chunked = append(chunked, field, value)
+				continue
+			}
+			args = append(args, field, sealed.value)
+		}
+		if len(args) == 0 {
+			return errReencryptSkip
+		}
+		changed = true
+		pipe.HSet(ctx, key, args...)
+		return nil
+	})
+	if err != nil && err != errReencryptSkip {
+		return false, err
+	}
+	if len(chunked) > 0 {
+		if !j.r.hashSetEnveloped(key, chunked) {
+			return changed, errors.New("分片值写入失败")
+		}
+		changed = true
+	}
+	return changed, nil
+}
@@ -0,0 +1,174 @@
+package go_toolbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKeyring(t *testing.T, ids ...string) *RedisKeyring {
+	t.Helper()
+	keyring := NewRedisKeyring()
+	for i, id := range ids {
+		if err := keyring.AddKey(id, bytes.Repeat([]byte{byte(i + 1)}, 32)); err != nil {
+			t.Fatalf("AddKey failed: %v", err)
+		}
+	}
+	return keyring
+}
+
+func TestEncryptedValues(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+
+	redisHandler.RedisClient.Set(ctx, "legacy", "plain", 0)
+	redisHandler.SetKeyring(testKeyring(t, "k1"))
+	if !redisHandler.Set("user:1:phone", "13800000000", 0) || !redisHandler.HashSet("user:1", "email", "a@b.c", "age", 30) {
+		t.Fatal("write failed")
+	}
+	raw := redisHandler.RedisClient.Get(ctx, "user:1:phone").Val()
+	if !isEnvelope(raw) || strings.Contains(raw, "13800000000") {
+		t.Fatalf("value should be encrypted: %q", raw)
+	}
+	if value, ok := redisHandler.Get("user:1:phone"); !ok || value != "13800000000" {
+		t.Fatalf("unexpected decrypted value: %q %v", value, ok)
+	}
+	if results, ok := redisHandler.HashMGET("user:1", "email", "age"); !ok || results[0] != "a@b.c" || results[1] != "30" {
+		t.Fatalf("unexpected hash values: %v", results)
+	}
+	if value, ok := redisHandler.Get("legacy"); !ok || value != "plain" {
+		t.Fatal("plaintext values written before encryption should stay readable")
+	}
+
+	// 篡改密文后无法读取
+	tampered := []byte(raw)
+	tampered[len(tampered)-1] ^= 0xff
+	redisHandler.RedisClient.Set(ctx, "tampered", tampered, 0)
+	if _, ok := redisHandler.Get("tampered"); ok {
+		t.Fatal("tampered ciphertext should fail authentication")
+	}
+
+	// 不认识的密钥
+	redisHandler.SetKeyring(testKeyring(t, "other"))
+	if _, ok := redisHandler.Get("user:1:phone"); ok {
+		t.Fatal("unknown key id should fail")
+	}
+	if _, err := redisHandler.openValueErr("user:1:phone", raw); !errors.Is(err, ErrUnknownKeyId) {
+		t.Fatalf("expected ErrUnknownKeyId, got %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+
+	keyring := testKeyring(t, "k1")
+	redisHandler.SetKeyring(keyring)
+	redisHandler.MaxValueSize = 64
+	redisHandler.Set("session:1", "s1", 10*time.Minute)
+	redisHandler.Set("session:big", strings.Repeat("z", 200), 0)
+	redisHandler.HashSet("profile:1", "name", "elvis", "bio", strings.Repeat("b", 150))
+	redisHandler.RedisClient.Set(ctx, "legacy", "plain", 0)
+
+	if err := keyring.AddKey("k2", bytes.Repeat([]byte{9}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetPrimary("k2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.RemoveKey("k2"); err == nil {
+		t.Fatal("primary key should not be removable")
+	}
+	// 轮换后旧值仍可读取
+	if value, _ := redisHandler.Get("session:1"); value != "s1" {
+		t.Fatalf("old key should still decrypt, got %q", value)
+	}
+
+	job, err := redisHandler.StartReencryption(ReencryptOptions{BatchSize: 2, EncryptPlaintext: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	progress, err := job.Wait()
+	if err != nil || progress.Failed != 0 || progress.Reencrypted != 4 {
+		t.Fatalf("unexpected progress: %+v %v", progress, err)
+	}
+
+	if err := keyring.RemoveKey("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := redisHandler.Get("session:1"); !ok || value != "s1" {
+		t.Fatalf("value should be readable with the new key: %q %v", value, ok)
+	}
+	if ttl := redisHandler.RedisClient.TTL(ctx, "session:1").Val(); ttl <= 0 {
+		t.Fatalf("ttl should be preserved, got %v", ttl)
+	}
+	if value, ok := redisHandler.Get("session:big"); !ok || value != strings.Repeat("z", 200) {
+		t.Fatal("chunked value should be re-encrypted")
+	}
+	if results, ok := redisHandler.HashMGET("profile:1", "name", "bio"); !ok || results[0] != "elvis" || results[1] != strings.Repeat("b", 150) {
+		t.Fatalf("unexpected hash after rotation: %v %v", results, ok)
+	}
+	if env, err := parseEnvelope(redisHandler.RedisClient.Get(ctx, "legacy").Val()); err != nil || env.keyId != "k2" {
+		t.Fatal("plaintext value should be encrypted with the primary key")
+	}
+
+	// 再次执行时没有需要改写的值
+	job, _ = redisHandler.StartReencryption(ReencryptOptions{EncryptPlaintext: true})
+	if progress, _ := job.Wait(); progress.Reencrypted != 0 || progress.Failed != 0 {
+		t.Fatalf("second run should be a no-op: %+v", progress)
+	}
+}
+
+func TestEncryptedHashStructs(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+	redisHandler.SetKeyring(testKeyring(t, "k1"))
+
+	user := structUser{Name: "elvis", Nickname: "pii-nickname", Tags: []string{"a"}}
+	if !redisHandler.HashSetStruct("user:1", user) {
+		t.Fatal("HashSetStruct failed")
+	}
+	updated := user
+	updated.Nickname = "pii-updated"
+	updated.Tags = nil
+	if !redisHandler.HashUpdateStruct("user:1", user, updated) {
+		t.Fatal("HashUpdateStruct failed")
+	}
+	if !HashSetStructs(redisHandler.ModelRedisHandler, []string{"user:2"}, []structUser{{Name: "pii-batch"}}) {
+		t.Fatal("HashSetStructs failed")
+	}
+	for _, key := range []string{"user:1", "user:2"} {
+		for field, raw := range redisHandler.RedisClient.HGetAll(ctx, key).Val() {
+			if !isEnvelope(raw) || strings.Contains(raw, "pii") {
+				t.Fatalf("%s %s should be encrypted: %q", key, field, raw)
+			}
+		}
+	}
+	var got structUser
+	if found, ok := redisHandler.HashGetStruct("user:1", &got); !found || !ok || got.Nickname != "pii-updated" || got.Tags != nil {
+		t.Fatalf("unexpected decrypted struct %+v", got)
+	}
+	users, ok := HashGetStructs[structUser](redisHandler.ModelRedisHandler, []string{"user:1", "user:2"})
+	if !ok || users[0].Name != "elvis" || users[1].Name != "pii-batch" {
+		t.Fatalf("unexpected batch results %+v", users)
+	}
+
+	// 使用期间切换 Keyring 不产生数据竞争
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			redisHandler.SetKeyring(testKeyring(t, "k1"))
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		redisHandler.Set("phone", "13800000000", 0)
+	}
+	<-done
+}
@@ -0,0 +1,718 @@
+package go_toolbox
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+// 值压缩算法, 对应 RedisConf.Compression
+const (
+	CompressionNone   = ""
+	CompressionGzip   = "gzip"
+	CompressionZstd   = "zstd"
+	CompressionSnappy = "snappy"
+	CompressionLZ4    = "lz4"
+)
+
+const DefaultCompressThreshold = 1024
+
+// 值信封格式: magic(4) + version(1) + algorithm(1) + flags(1) + [加密信息] + [分片信息] + 数据
+// 加密信息为 密钥编号长度(1) + 密钥编号 + nonce(12), 数据为 AES-GCM 密文
+// 分片信息为 id(8) + 分片数(uvarint) + 总长度(uvarint) + crc32(4), 此时数据保存在分片中, 每个分片的值为 id(8) + 数据
+// 分片 key 为 key:chunk:<id 的十六进制>:N, 每次写入使用新的随机 id, 并发写入同一个 key 时不会覆盖彼此的分片
+const (
+	envelopeVersion       byte = 1
+	envelopeFlagChunked   byte = 1
+	envelopeFlagEncrypted byte = 2
+	envelopeHeaderSize         = 7
+	envelopeChunkIdSize        = 8
+	envelopeChunkToken         = ":chunk:"
+)
+
+var envelopeMagic = []byte("\x00GTE")
+
+var envelopeAlgorithms = []string{CompressionNone, CompressionGzip, CompressionZstd, CompressionSnappy, CompressionLZ4}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func zstdCodec() (*zstd.Encoder, *zstd.Decoder) {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+		zstdDecoder, _ = zstd.NewReader(nil)
+	})
+	return zstdEncoder, zstdDecoder
+}
+
+func envelopeAlgorithmId(algorithm string) (byte, error) {
+	for i, name := range envelopeAlgorithms {
+		if name == algorithm {
+			return byte(i), nil
+		}
+	}
+	return 0, fmt.Errorf("不支持的压缩算法: %s", algorithm)
+}
+
+func compressValue(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		encoder, _ := zstdCodec()
+		return encoder.EncodeAll(data, nil), nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	case CompressionLZ4:
+		var buf bytes.Buffer
+		w := lz4.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("不支持的压缩算法: %s", algorithm)
+}
+
+func decompressValue(algorithmId byte, data []byte) ([]byte, error) {
+	if int(algorithmId) >= len(envelopeAlgorithms) {
+		return nil, fmt.Errorf("未知的压缩算法编号: %d", algorithmId)
+	}
+	switch envelopeAlgorithms[algorithmId] {
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	case CompressionZstd:
+		_, decoder := zstdCodec()
+		return decoder.DecodeAll(data, nil)
+	case CompressionSnappy:
+		return snappy.Decode(nil, data)
+	case CompressionLZ4:
+		return io.ReadAll(lz4.NewReader(bytes.NewReader(data)))
+	}
+	return data, nil
+}
+
+// envelopeEnabled 是否开启了值信封 (压缩, 分片或加密)
+func (r *ModelRedisHandler) envelopeEnabled() bool {
+	return r.Compression != CompressionNone || r.MaxValueSize > 0 || r.Keyring() != nil
+}
+
+func (r *ModelRedisHandler) compressThreshold() int {
+	if r.CompressThreshold > 0 {
+		return r.CompressThreshold
+	}
+	return DefaultCompressThreshold
+}
+
+// sealedValue 编码后的值, chunks 不为空时需要额外写入分片
+type sealedValue struct {
+	value   interface{}
+	chunkId string
+	chunks  [][]byte
+}
+
+// envelopeBytes 将值转换为写入 Redis 的字节, 格式与 go-redis 一致
+func envelopeBytes(value interface{}) ([]byte, bool, error) {
+	switch v := value.(type) {
+	case string:
+		return []byte(v), true, nil
+	case []byte:
+		return v, true, nil
+	case int:
+		return strconv.AppendInt(nil, int64(v), 10), false, nil
+	case int8:
+		return strconv.AppendInt(nil, int64(v), 10), false, nil
+	case int16:
+		return strconv.AppendInt(nil, int64(v), 10), false, nil
+	case int32:
+		return strconv.AppendInt(nil, int64(v), 10), false, nil
+	case int64:
+		return strconv.AppendInt(nil, v, 10), false, nil
+	case uint:
+		return strconv.AppendUint(nil, uint64(v), 10), false, nil
+	case uint8:
+		return strconv.AppendUint(nil, uint64(v), 10), false, nil
+	case uint16:
+		return strconv.AppendUint(nil, uint64(v), 10), false, nil
+	case uint32:
+		return strconv.AppendUint(nil, uint64(v), 10), false, nil
+	case uint64:
+		return strconv.AppendUint(nil, v, 10), false, nil
+	case float32:
+		return strconv.AppendFloat(nil, float64(v), 'f', -1, 32), false, nil
+	case float64:
+		return strconv.AppendFloat(nil, v, 'f', -1, 64), false, nil
+	case bool:
+		if v {
+			return []byte("1"), false, nil
+		}
+		return []byte("0"), false, nil
+	case encoding.BinaryMarshaler:
+		data, err := v.MarshalBinary()
+		return data, false, err
+	}
+	return nil, false, fmt.Errorf("无法编码类型 %T", value)
+}
+
+// sealValue 按配置压缩, 加密与分片
+// 未开启加密时只处理 string/[]byte, 其余类型原样写入; 开启加密后全部值都会加密
+func (r *ModelRedisHandler) sealValue(value interface{}) (sealedValue, error) {
+	keyring := r.Keyring()
+	data, isText, err := envelopeBytes(value)
+	if keyring == nil && (!isText || err != nil) {
+		return sealedValue{value: value}, nil
+	}
+	if err != nil {
+		return sealedValue{}, err
+	}
+	algorithm := CompressionNone
+	payload := data
+	if r.Compression != CompressionNone && len(data) >= r.compressThreshold() {
+		compressed, err := compressValue(r.Compression, data)
+		if err != nil {
+			return sealedValue{}, err
+		}
+		// 压缩后没有变小时不压缩
+		if len(compressed) < len(data) {
+			algorithm, payload = r.Compression, compressed
+		}
+	}
+	// 原始值恰好以 magic 开头时也需要包装, 避免读取时被误判
+	if keyring == nil && algorithm == CompressionNone && (r.MaxValueSize <= 0 || len(payload) <= r.MaxValueSize) &&
+		!bytes.HasPrefix(data, envelopeMagic) {
+		return sealedValue{value: value}, nil
+	}
+	algorithmId, err := envelopeAlgorithmId(algorithm)
+	if err != nil {
+		return sealedValue{}, err
+	}
+	var flags byte
+	if keyring != nil {
+		flags |= envelopeFlagEncrypted
+	}
+	header := make([]byte, 0, 64)
+	header = append(header, envelopeMagic...)
+	header = append(header, envelopeVersion, algorithmId, flags)
+	if keyring != nil {
+		var keyId string
+		if keyId, header, payload, err = keyring.seal(header, payload); err != nil {
+			return sealedValue{}, fmt.Errorf("加密失败 (key %s): %w", keyId, err)
+		}
+	}
+	if r.MaxValueSize <= 0 || len(payload) <= r.MaxValueSize {
+		return sealedValue{value: append(header, payload...)}, nil
+	}
+
+	header[len(envelopeMagic)+2] |= envelopeFlagChunked
+	id := make([]byte, envelopeChunkIdSize)
+	if _, err := rand.Read(id); err != nil {
+		return sealedValue{}, err
+	}
+	var chunks [][]byte
+	for start := 0; start < len(payload); start += r.MaxValueSize {
+		end := start + r.MaxValueSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunks = append(chunks, append(append(make([]byte, 0, envelopeChunkIdSize+end-start), id...), payload[start:end]...))
+	}
+	header = append(header, id...)
+	var buf [binary.MaxVarintLen64]byte
+	header = append(header, buf[:binary.PutUvarint(buf[:], uint64(len(chunks)))]...)
+	header = append(header, buf[:binary.PutUvarint(buf[:], uint64(len(payload)))]...)
+	binary.BigEndian.PutUint32(buf[:4], crc32.ChecksumIEEE(payload))
+	header = append(header, buf[:4]...)
+	return sealedValue{value: header, chunkId: string(id), chunks: chunks}, nil
+}
+
+func isEnvelope(raw string) bool {
+	return len(raw) >= envelopeHeaderSize && raw[:len(envelopeMagic)] == string(envelopeMagic)
+}
+
+// envelope 解析后的信封
+type envelope struct {
+	algorithm byte
+	// keyId 不为空时 payload 为 AES-GCM 密文, aad 为密钥编号及之前的头部
+	keyId string
+	nonce []byte
+	aad   []byte
+	// chunked 为 true 时 payload 保存在分片中
+	chunked  bool
+	chunkId  string
+	count    int
+	size     int
+	checksum uint32
+	body     []byte
+}
+
+var errEnvelopeCorrupted = errors.New("值信封已损坏")
+
+func parseEnvelope(raw string) (*envelope, error) {
+	if raw[len(envelopeMagic)] != envelopeVersion {
+		return nil, fmt.Errorf("不支持的信封版本: %d", raw[len(envelopeMagic)])
+	}
+	env := &envelope{algorithm: raw[len(envelopeMagic)+1]}
+	flags := raw[len(envelopeMagic)+2]
+	body := []byte(raw[envelopeHeaderSize:])
+	if flags&envelopeFlagEncrypted != 0 {
+		if len(body) < 1 || len(body) < 1+int(body[0])+envelopeNonceSize {
+			return nil, errEnvelopeCorrupted
+		}
+		idEnd := 1 + int(body[0])
+		env.keyId = string(body[1:idEnd])
+		env.aad = []byte(raw[:envelopeHeaderSize+idEnd])
+		// 分片标记不参与认证, 写入时在加密之后才确定
+		env.aad[len(envelopeMagic)+2] &^= envelopeFlagChunked
+		env.nonce = body[idEnd : idEnd+envelopeNonceSize]
+		body = body[idEnd+envelopeNonceSize:]
+	}
+	if flags&envelopeFlagChunked == 0 {
+		env.body = body
+		return env, nil
+	}
+	if len(body) < envelopeChunkIdSize {
+		return nil, errEnvelopeCorrupted
+	}
+	env.chunked, env.chunkId = true, string(body[:envelopeChunkIdSize])
+	body = body[envelopeChunkIdSize:]
+	count, n := binary.Uvarint(body)
+	if n <= 0 {
+		return nil, errEnvelopeCorrupted
+	}
+	body = body[n:]
+	size, n := binary.Uvarint(body)
+	if n <= 0 || len(body[n:]) != 4 {
+		return nil, errEnvelopeCorrupted
+	}
+	env.count, env.size, env.checksum = int(count), int(size), binary.BigEndian.Uint32(body[n:])
+	return env, nil
+}
+
+// assembleChunks 校验并拼接分片
+func assembleChunks(env *envelope, chunks []string) ([]byte, error) {
+	payload := make([]byte, 0, len(chunks)*len(chunks[0]))
+	for i, chunk := range chunks {
+		if len(chunk) < envelopeChunkIdSize || chunk[:envelopeChunkIdSize] != env.chunkId {
+			return nil, fmt.Errorf("分片 %d 缺失或已被覆盖", i)
+		}
+		payload = append(payload, chunk[envelopeChunkIdSize:]...)
+	}
+	if len(payload) != env.size || crc32.ChecksumIEEE(payload) != env.checksum {
+		return nil, errors.New("分片数据校验失败")
+	}
+	return payload, nil
+}
+
+// openPayload 解密并解压信封中的数据
+func (r *ModelRedisHandler) openPayload(env *envelope, payload []byte) (string, error) {
+	if env.keyId != "" {
+		keyring := r.Keyring()
+		if keyring == nil {
+			return "", fmt.Errorf("值已加密 (key %s), 但未配置 Keyring", env.keyId)
+		}
+		var err error
+		if payload, err = keyring.open(env, payload); err != nil {
+			return "", err
+		}
+	}
+	data, err := decompressValue(env.algorithm, payload)
+	return string(data), err
+}
+
+// envelopeChunkCount 旧值为分片信封时返回其分片数量
+func envelopeChunkCount(raw string) int {
+	if !isEnvelope(raw) {
+		return 0
+	}
+	if env, err := parseEnvelope(raw); err == nil && env.chunked {
+		return env.count
+	}
+	return 0
+}
+
+// chunkKey 分片 key, 字符串与哈希字段的分片都以所属 key 为前缀
+func chunkKey(owner, id string, i int) string {
+	return owner + envelopeChunkToken + hex.EncodeToString([]byte(id)) + ":" + strconv.Itoa(i)
+}
+
+// chunkKeyId 从分片 key 中解析出分片 id, 不是分片 key 时返回 false
+func chunkKeyId(key string) (string, bool) {
+	i := strings.LastIndex(key, envelopeChunkToken)
+	if i < 0 {
+		return "", false
+	}
+	parts := strings.Split(key[i+len(envelopeChunkToken):], ":")
+	if len(parts) != 2 {
+		return "", false
+	}
+	id, err := hex.DecodeString(parts[0])
+	if err != nil || len(id) != envelopeChunkIdSize {
+		return "", false
+	}
+	if _, err := strconv.Atoi(parts[1]); err != nil {
+		return "", false
+	}
+	return string(id), true
+}
+
+// envelopeChunkKeys 旧值为分片信封时返回其全部分片 key
+func envelopeChunkKeys(owner, raw string) []string {
+	if !isEnvelope(raw) {
+		return nil
+	}
+	env, err := parseEnvelope(raw)
+	if err != nil || !env.chunked {
+		return nil
+	}
+	keys := make([]string, env.count)
+	for i := range keys {
+		keys[i] = chunkKey(owner, env.chunkId, i)
+	}
+	return keys
+}
+
+// writeChunks 写入分片, 分片可能分布在不同的槽位, 由 Pipeline 按节点合并发送
+func (r *ModelRedisHandler) writeChunks(ctx context.Context, owner string, sealed sealedValue, ex time.Duration) error {
+	if len(sealed.chunks) == 0 {
+		return nil
+	}
+	pipe := r.universalClient().Pipeline()
+	for i, chunk := range sealed.chunks {
+		pipe.Set(ctx, chunkKey(owner, sealed.chunkId, i), chunk, ex)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// deleteChunks 删除被替换的信封的分片, 失败时只记录日志, 残留的分片不影响读取
+func (r *ModelRedisHandler) deleteChunks(ctx context.Context, command string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	pipe := r.universalClient().Pipeline()
+	for _, key := range keys {
+		pipe.Del(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		Logger.Warn(r.logName() + " " + command + " 清理旧分片失败! 错误原因: " + err.Error())
+	}
+}
+
+// openValue 读取时解开信封, 非信封的值原样返回, 因此开启前写入的旧值可以正常读取
+func (r *ModelRedisHandler) openValue(key, raw string) (string, bool) {
+	value, err := r.openValueErr(key, raw)
+	if err != nil {
+		Logger.Error(r.logName() + " 值信封解析错误! key: " + key + " 错误原因: " + err.Error())
+		return "", false
+	}
+	return value, true
+}
+
+func (r *ModelRedisHandler) openValueErr(key, raw string) (string, error) {
+	if !isEnvelope(raw) {
+		return raw, nil
+	}
+	env, err := parseEnvelope(raw)
+	if err != nil {
+		return "", err
+	}
+	payload := env.body
+	if env.chunked {
+		if payload, err = r.readChunks(key, env); err != nil {
+			return "", err
+		}
+	}
+	return r.openPayload(env, payload)
+}
+
+func (r *ModelRedisHandler) readChunks(owner string, env *envelope) ([]byte, error) {
+	if env.count == 0 {
+		return nil, errEnvelopeCorrupted
+	}
+	ctx := context.Background()
+	pipe := r.universalClient().Pipeline()
+	cmds := make([]*redis.StringCmd, env.count)
+	for i := range cmds {
+		cmds[i] = pipe.Get(ctx, chunkKey(owner, env.chunkId, i))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	chunks := make([]string, env.count)
+	for i, cmd := range cmds {
+		chunks[i] = cmd.Val()
+	}
+	return assembleChunks(env, chunks)
+}
+
+// setEnveloped 开启值信封时的 Set: 先以新的 id 写入分片, 再通过 MULTI 替换信封并取回旧值, 最后删除旧值的分片
+// 读取方只会看到完整的旧值或新值; 并发写入时各自的分片互不覆盖, 最终保留的信封总是指向自己的分片
+func (r *ModelRedisHandler) setEnveloped(key string, value interface{}, ex time.Duration) bool {
+	sealed, err := r.sealValue(value)
+	if err != nil {
+		Logger.Error(r.logName() + " Set 值编码错误! 错误原因: " + err.Error())
+		return false
+	}
+	ctx := context.Background()
+	client := r.universalClient()
+	if err := r.writeChunks(ctx, key, sealed, ex); err != nil {
+		Logger.Error(r.logName() + " Set 分片写入错误! 错误原因: " + err.Error())
+		return false
+	}
+	if r.MaxValueSize <= 0 {
+		if err := client.Set(ctx, key, sealed.value, ex).Err(); err != nil {
+			Logger.Error(r.logName() + " Set 写入错误! 错误原因: " + err.Error())
+			return false
+		}
+		return true
+	}
+	var old *redis.StringCmd
+	_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		old = pipe.Get(ctx, key)
+		pipe.Set(ctx, key, sealed.value, ex)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		Logger.Error(r.logName() + " Set 写入错误! 错误原因: " + err.Error())
+		return false
+	}
+	r.deleteChunks(ctx, "Set", envelopeChunkKeys(key, old.Val()))
+	return true
+}
+
+// deleteValue 删除 Set 写入的值, 开启分片时通过 MULTI 取回旧值并删除其分片
+func (r *ModelRedisHandler) deleteValue(ctx context.Context, key string) error {
+	client := r.universalClient()
+	if r.MaxValueSize <= 0 {
+		return client.Del(ctx, key).Err()
+	}
+	var old *redis.StringCmd
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		old = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	r.deleteChunks(ctx, "Del", envelopeChunkKeys(key, old.Val()))
+	return nil
+}
+
+// hashPairs 将 HashSet 支持的参数形式统一为 field, value 对
+func hashPairs(values []interface{}) ([]interface{}, error) {
+	if len(values) == 1 {
+		switch v := values[0].(type) {
+		case []string:
+			pairs := make([]interface{}, len(v))
+			for i, item := range v {
+				pairs[i] = item
+			}
+			values = pairs
+		case []interface{}:
+			values = v
+		case map[string]interface{}:
+			pairs := make([]interface{}, 0, len(v)*2)
+			for field, value := range v {
+				pairs = append(pairs, field, value)
+			}
+			values = pairs
+		case map[string]string:
+			pairs := make([]interface{}, 0, len(v)*2)
+			for field, value := range v {
+				pairs = append(pairs, field, value)
+			}
+			values = pairs
+		}
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("HashSet 参数需要成对出现")
+	}
+	return values, nil
+}
+
+// hashSetEnveloped 开启值信封时的 HashSet/HashMSet
+// 哈希值的分片保存在独立的 key:chunk:<id>:N 中, 哈希本身只包含信封; 分片的过期时间与写入时哈希的过期时间一致,
+// 之后再修改哈希的过期时间不会同步到分片, 通过 HashDel 删除字段时一并删除其分片
+func (r *ModelRedisHandler) hashSetEnveloped(key string, values []interface{}) bool {
+	pairs, err := hashPairs(values)
+	if err != nil {
+		Logger.Error(r.logName() + " HSet 参数错误! 错误原因: " + err.Error())
+		return false
+	}
+	if err := r.hashWriteEnveloped(context.Background(), key, pairs, nil); err != nil {
+		Logger.Error(r.logName() + " HSet 写入错误! 错误原因: " + err.Error())
+		return false
+	}
+	return true
+}
+
+// hashDelEnveloped 开启值信封时的 HashDel, 同时删除被删除字段的分片
+func (r *ModelRedisHandler) hashDelEnveloped(key string, fields []string) bool {
+	if err := r.hashWriteEnveloped(context.Background(), key, nil, fields); err != nil {
+		Logger.Error(r.logName() + " HDel 删除错误! 错误原因: " + err.Error())
+		return false
+	}
+	return true
+}
+
+// hashWriteEnveloped 编码 pairs 并写入分片, 再以一个 MULTI 执行 HSET 与 HDEL removed
+// 开启分片时在同一个 MULTI 中取回被替换或删除的旧值, 之后删除旧值的分片, 并为新分片设置与哈希相同的过期时间
+func (r *ModelRedisHandler) hashWriteEnveloped(ctx context.Context, key string, pairs []interface{}, removed []string) error {
+	args := make([]interface{}, 0, len(pairs))
+	fields := make([]string, 0, len(pairs)/2+len(removed))
+	var chunks []string
+	for i := 0; i < len(pairs); i += 2 {
+		field := fmt.Sprint(pairs[i])
+		sealed, err := r.sealValue(pairs[i+1])
+		if err != nil {
+			return fmt.Errorf("field %s 值编码错误: %w", field, err)
+		}
+		if err := r.writeChunks(ctx, key, sealed, 0); err != nil {
+			return fmt.Errorf("field %s 分片写入错误: %w", field, err)
+		}
+		for n := range sealed.chunks {
+			chunks = append(chunks, chunkKey(key, sealed.chunkId, n))
+		}
+		args = append(args, field, sealed.value)
+		fields = append(fields, field)
+	}
+	fields = append(fields, removed...)
+	if len(fields) == 0 {
+		return nil
+	}
+	chunking := r.MaxValueSize > 0
+	var (
+		old *redis.SliceCmd
+		ttl *redis.DurationCmd
+	)
+	_, err := r.universalClient().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if chunking {
+			old = pipe.HMGet(ctx, key, fields...)
+		}
+		if len(args) > 0 {
+			pipe.HSet(ctx, key, args...)
+		}
+		if len(removed) > 0 {
+			pipe.HDel(ctx, key, removed...)
+		}
+		if chunking {
+			ttl = pipe.PTTL(ctx, key)
+		}
+		return nil
+	})
+	if err != nil || !chunking {
+		return err
+	}
+	if ttl.Val() > 0 && len(chunks) > 0 {
+		pipe := r.universalClient().Pipeline()
+		for _, chunk := range chunks {
+			pipe.PExpire(ctx, chunk, ttl.Val())
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			Logger.Warn(r.logName() + " HSet 设置分片过期时间失败! 错误原因: " + err.Error())
+		}
+	}
+	var stale []string
+	for _, result := range old.Val() {
+		raw, _ := result.(string)
+		stale = append(stale, envelopeChunkKeys(key, raw)...)
+	}
+	r.deleteChunks(ctx, "HSet", stale)
+	return nil
+}
+
+// openHashValue 读取哈希值时解开信封
+func (r *ModelRedisHandler) openHashValue(key, field, raw string) (string, bool) {
+	value, err := r.openHashValueErr(key, field, raw)
+	if err != nil {
+		Logger.Error(r.logName() + " 值信封解析错误! key: " + key + " field: " + field + " 错误原因: " + err.Error())
+		return "", false
+	}
+	return value, true
+}
+
+func (r *ModelRedisHandler) openHashValueErr(key, field, raw string) (string, error) {
+	if !isEnvelope(raw) {
+		return raw, nil
+	}
+	env, err := parseEnvelope(raw)
+	if err != nil {
+		return "", err
+	}
+	payload := env.body
+	if env.chunked {
+		if payload, err = r.readChunks(key, env); err != nil {
+			return "", err
+		}
+	}
+	return r.openPayload(env, payload)
+}
+
+// openHashValues 解开 HMGET 结果中的信封
+func (r *ModelRedisHandler) openHashValues(key string, fields []string, results []interface{}) ([]interface{}, bool) {
+	for i, result := range results {
+		raw, ok := result.(string)
+		if !ok || !isEnvelope(raw) {
+			continue
+		}
+		value, ok := r.openHashValue(key, fields[i], raw)
+		if !ok {
+			return nil, false
+		}
+		results[i] = value
+	}
+	return results, true
+}
+
+// openHashMap 解开 HGETALL 结果中的信封
+func (r *ModelRedisHandler) openHashMap(key string, values map[string]string) error {
+	for field, raw := range values {
+		if !isEnvelope(raw) {
+			continue
+		}
+		value, err := r.openHashValueErr(key, field, raw)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+		values[field] = value
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package go_toolbox
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestValueEnvelopeCompression(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+
+	large := strings.Repeat("go-toolbox envelope ", 500)
+	for _, algorithm := range []string{CompressionGzip, CompressionZstd, CompressionSnappy, CompressionLZ4} {
+		redisHandler.Compression = algorithm
+		if !redisHandler.Set("payload", large, 0) {
+			t.Fatalf("%s: Set failed", algorithm)
+		}
+		raw := redisHandler.RedisClient.Get(ctx, "payload").Val()
+		if !isEnvelope(raw) || len(raw) >= len(large) {
+			t.Fatalf("%s: value should be compressed, got %d bytes", algorithm, len(raw))
+		}
+		if value, ok := redisHandler.Get("payload"); !ok || value != large {
+			t.Fatalf("%s: unexpected round trip (%d bytes)", algorithm, len(value))
+		}
+	}
+
+	// 小于阈值的值与开启前写入的旧值保持原样
+	redisHandler.Set("small", "tiny", 0)
+	if raw := redisHandler.RedisClient.Get(ctx, "small").Val(); raw != "tiny" {
+		t.Fatalf("small values should not be wrapped: %q", raw)
+	}
+	// 关闭压缩后仍然可以读取已压缩的值
+	redisHandler.Compression = CompressionNone
+	if value, ok := redisHandler.Get("payload"); !ok || value != large {
+		t.Fatal("compressed value should stay readable after disabling compression")
+	}
+	redisHandler.Compression = CompressionSnappy
+	tricky := string(envelopeMagic) + "raw"
+	redisHandler.Set("tricky", tricky, 0)
+	if value, _ := redisHandler.Get("tricky"); value != tricky {
+		t.Fatalf("value starting with the magic should round trip, got %q", value)
+	}
+
+	redisHandler.Compression = "brotli"
+	if redisHandler.Set("payload", large, 0) {
+		t.Fatal("unknown compression should fail")
+	}
+}
+
+func TestValueEnvelopeChunking(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	redisHandler.MaxValueSize = 100
+
+	value := strings.Repeat("0123456789", 45)
+	if !redisHandler.Set("blob", value, 0) {
+		t.Fatal("Set failed")
+	}
+	if keys := redisHandler.Keys(); len(keys) != 6 {
+		t.Fatalf("expected header and 5 chunks, got %v", keys)
+	}
+	if got, ok := redisHandler.Get("blob"); !ok || got != value {
+		t.Fatalf("unexpected chunked value (%d bytes)", len(got))
+	}
+
+	// 覆盖为更小的值时清理多余的分片
+	redisHandler.Set("blob", value[:150], 0)
+	if keys := redisHandler.Keys(); len(keys) != 3 {
+		t.Fatalf("stale chunks should be removed, got %v", keys)
+	}
+	raw := redisHandler.RedisClient.Get(context.Background(), "blob").Val()
+	redisHandler.RedisClient.Del(context.Background(), envelopeChunkKeys("blob", raw)[1])
+	if _, ok := redisHandler.Get("blob"); ok {
+		t.Fatal("missing chunk should fail the read")
+	}
+
+	redisHandler.Compression = CompressionZstd
+	redisHandler.CompressThreshold = 10
+	if !redisHandler.HashSet("entity", "profile", value, "name", "elvis") {
+		t.Fatal("HashSet failed")
+	}
+	if got, ok := redisHandler.HashGet("entity", "profile"); !ok || got != value {
+		t.Fatalf("unexpected hash value (%d bytes)", len(got))
+	}
+	big := strings.Repeat("x", 10) + randomText(400)
+	redisHandler.HashMSet("entity", map[string]interface{}{"profile": big})
+	results, ok := redisHandler.HashMGET("entity", "profile", "name", "missing")
+	if !ok || results[0] != big || results[1] != "elvis" || results[2] != nil {
+		t.Fatalf("unexpected HashMGET results: %v", results)
+	}
+	// 分片保存在独立的 key 中, 哈希只包含用户的字段
+	if n := redisHandler.HashLen("entity"); n != 2 {
+		t.Fatalf("unexpected hash length %d", n)
+	}
+	chunks := len(redisHandler.Keys()) - 3
+	if chunks != (len(big)+99)/100 {
+		t.Fatalf("unexpected chunk keys %v", redisHandler.Keys())
+	}
+	if !redisHandler.HashDel("entity", "profile") || len(redisHandler.Keys()) != 3 {
+		t.Fatalf("HashDel should remove the field's chunks, got %v", redisHandler.Keys())
+	}
+}
+
+func TestValueEnvelopeConcurrentChunks(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	redisHandler.MaxValueSize = 64
+
+	values := []string{strings.Repeat("a", 300), strings.Repeat("b", 500)}
+	var wg sync.WaitGroup
+	for _, value := range values {
+		wg.Add(1)
+		go func(value string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				redisHandler.Set("blob", value, 0)
+			}
+		}(value)
+	}
+	wg.Wait()
+	got, ok := redisHandler.Get("blob")
+	if !ok || (got != values[0] && got != values[1]) {
+		t.Fatalf("concurrent writes should leave a readable value, got %d bytes", len(got))
+	}
+	// 只保留最终信封的分片
+	if keys := redisHandler.Keys(); len(keys) != 1+(len(got)+63)/64 {
+		t.Fatalf("stale chunks should be removed, got %d keys", len(keys))
+	}
+}
+
+// randomText 不可压缩的文本, 用于触发分片
+func randomText(n int) string {
+	var b strings.Builder
+	seed := uint32(2166136261)
+	for i := 0; i < n; i++ {
+		seed = seed*16777619 ^ uint32(i)
+		b.WriteByte(byte('!' + seed%90))
+	}
+	return b.String()
+}
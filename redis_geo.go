@@ -0,0 +1,338 @@
+package go_toolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis GEO 支持的坐标范围 (EPSG:3857)
+const (
+	GeoMinLongitude = -180.0
+	GeoMaxLongitude = 180.0
+	GeoMinLatitude  = -85.05112878
+	GeoMaxLatitude  = 85.05112878
+)
+
+// GEO 距离单位
+const (
+	GeoUnitMeters     = "m"
+	GeoUnitKilometers = "km"
+	GeoUnitMiles      = "mi"
+	GeoUnitFeet       = "ft"
+)
+
+// GEO 搜索结果排序
+const (
+	GeoSortAsc  = "ASC"
+	GeoSortDesc = "DESC"
+)
+
+const DefaultGeoLoadBatchSize = 1000
+
+const (
+	// geoLoadPipelineBatches LoadGeoFromClickHouse 每个 Pipeline 包含的 GEOADD 数
+	geoLoadPipelineBatches = 20
+	// geoLoadingTTL 临时 key 的过期时间, 同步中途退出时由 Redis 清理
+	geoLoadingTTL = time.Hour
+)
+
+// GeoMember GEO 集合中的成员
+type GeoMember struct {
+	Name      string  `db:"name"`
+	Longitude float64 `db:"longitude"`
+	Latitude  float64 `db:"latitude"`
+}
+
+// GeoPosition 成员的经纬度
+type GeoPosition struct {
+	Longitude float64
+	Latitude  float64
+}
+
+// GeoSearchResult GEOSEARCH 的单条结果, Dist/GeoHash/经纬度仅在对应的 With* 选项开启时有值
+type GeoSearchResult struct {
+	Name      string
+	Dist      float64
+	GeoHash   int64
+	Longitude float64
+	Latitude  float64
+}
+
+// GeoSearchOptions GEOSEARCH 的查询条件
+// 中心点为 Member 或 Longitude/Latitude, 范围为 Radius (圆形) 或 Width/Height (矩形), 单位默认为米
+type GeoSearchOptions struct {
+	Member    string
+	Longitude float64
+	Latitude  float64
+
+	Radius float64
+	Width  float64
+	Height float64
+	Unit   string
+
+	// Sort 为 GeoSortAsc/GeoSortDesc, 为空时不排序
+	Sort string
+	// Count 限制返回数量, Any 为 true 时找到足够数量即返回, 不保证是最近的
+	Count int
+	Any   bool
+
+	WithCoord bool
+	WithDist  bool
+	WithHash  bool
+}
+
+func (o *GeoSearchOptions) query() (redis.GeoSearchQuery, error) {
+	unit := o.Unit
+	if unit == "" {
+		unit = GeoUnitMeters
+	}
+	q := redis.GeoSearchQuery{
+		Member:    o.Member,
+		Longitude: o.Longitude,
+		Latitude:  o.Latitude,
+		Sort:      o.Sort,
+		Count:     o.Count,
+		CountAny:  o.Any,
+	}
+	switch {
+	case o.Radius > 0 && o.Width <= 0 && o.Height <= 0:
+		q.Radius, q.RadiusUnit = o.Radius, unit
+	case o.Radius <= 0 && o.Width > 0 && o.Height > 0:
+		q.BoxWidth, q.BoxHeight, q.BoxUnit = o.Width, o.Height, unit
+	default:
+		return q, errors.New("GEOSEARCH 需要且只能指定 Radius 或 Width/Height 其中一种范围")
+	}
+	if o.Member == "" && !ValidGeoCoordinate(o.Longitude, o.Latitude) {
+		return q, fmt.Errorf("GEOSEARCH 中心点坐标非法: %v,%v", o.Longitude, o.Latitude)
+	}
+	return q, nil
+}
+
+// ValidGeoCoordinate 坐标是否在 Redis GEO 支持的范围内
+func ValidGeoCoordinate(longitude, latitude float64) bool {
+	return longitude >= GeoMinLongitude && longitude <= GeoMaxLongitude &&
+		latitude >= GeoMinLatitude && latitude <= GeoMaxLatitude
+}
+
+// GeoAdd 写入成员坐标, 返回新增的成员数量
+func (r *ModelRedisHandler) GeoAdd(key string, members ...GeoMember) (int64, bool) {
+	if !r.Enable || len(members) == 0 {
+		return 0, true
+	}
+	locations := make([]*redis.GeoLocation, len(members))
+	for i, member := range members {
+		locations[i] = &redis.GeoLocation{Name: member.Name, Longitude: member.Longitude, Latitude: member.Latitude}
+	}
+	added, err := r.universalClient().GeoAdd(context.Background(), key, locations...).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " GeoAdd 写入错误! 错误原因: " + err.Error())
+		return 0, false
+	}
+	return added, true
+}
+
+// GeoPos 获取成员坐标, 结果与 members 一一对应, 不存在的成员为 nil
+func (r *ModelRedisHandler) GeoPos(key string, members ...string) ([]*GeoPosition, bool) {
+	positions := make([]*GeoPosition, len(members))
+	if !r.Enable || len(members) == 0 {
+		return positions, true
+	}
+	result, err := r.universalClient().GeoPos(context.Background(), key, members...).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " GeoPos 读取错误! 错误原因: " + err.Error())
+		return nil, false
+	}
+	for i, pos := range result {
+		if pos != nil && i < len(positions) {
+			positions[i] = &GeoPosition{Longitude: pos.Longitude, Latitude: pos.Latitude}
+		}
+	}
+	return positions, true
+}
+
+// GeoDist 两个成员之间的距离, unit 为空时单位为米, 返回值依次为距离, 两个成员是否都存在, 是否成功
+func (r *ModelRedisHandler) GeoDist(key, member1, member2, unit string) (float64, bool, bool) {
+	if !r.Enable {
+		return 0, false, true
+	}
+	if unit == "" {
+		unit = GeoUnitMeters
+	}
+	dist, err := r.universalClient().GeoDist(context.Background(), key, member1, member2, unit).Result()
+	if err == redis.Nil {
+		return 0, false, true
+	}
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " GeoDist 读取错误! 错误原因: " + err.Error())
+		return 0, false, false
+	}
+	return dist, true, true
+}
+
+// GeoSearch 按圆形或矩形范围搜索成员
+func (r *ModelRedisHandler) GeoSearch(key string, opts GeoSearchOptions) ([]GeoSearchResult, bool) {
+	if !r.Enable {
+		return nil, true
+	}
+	q, err := opts.query()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " GeoSearch 参数错误! 错误原因: " + err.Error())
+		return nil, false
+	}
+	ctx := context.Background()
+	client := r.universalClient()
+	// 不带 WITH* 选项时 Redis 只返回成员名, 需要使用 GeoSearch 解析
+	if !opts.WithCoord && !opts.WithDist && !opts.WithHash {
+		names, err := client.GeoSearch(ctx, key, &q).Result()
+		if err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " GeoSearch 读取错误! 错误原因: " + err.Error())
+			return nil, false
+		}
+		results := make([]GeoSearchResult, len(names))
+		for i, name := range names {
+			results[i].Name = name
+		}
+		return results, true
+	}
+	locations, err := client.GeoSearchLocation(ctx, key, &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: q,
+		WithCoord:      opts.WithCoord,
+		WithDist:       opts.WithDist,
+		WithHash:       opts.WithHash,
+	}).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " GeoSearch 读取错误! 错误原因: " + err.Error())
+		return nil, false
+	}
+	results := make([]GeoSearchResult, len(locations))
+	for i, loc := range locations {
+		results[i] = GeoSearchResult{
+			Name:      loc.Name,
+			Dist:      loc.Dist,
+			GeoHash:   loc.GeoHash,
+			Longitude: loc.Longitude,
+			Latitude:  loc.Latitude,
+		}
+	}
+	return results, true
+}
+
+// GeoSearchStore 将搜索结果写入 store (覆盖), storeDist 为 true 时以距离作为 score, 返回写入的成员数量
+// 集群模式下 key 与 store 需要在同一槽位
+func (r *ModelRedisHandler) GeoSearchStore(key, store string, opts GeoSearchOptions, storeDist bool) (int64, bool) {
+	if !r.Enable {
+		return 0, true
+	}
+	q, err := opts.query()
+	if err == nil {
+		err = r.checkSameSlot(key, store)
+	}
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " GeoSearchStore 参数错误! 错误原因: " + err.Error())
+		return 0, false
+	}
+	n, err := r.universalClient().GeoSearchStore(context.Background(), key, store, &redis.GeoSearchStoreQuery{
+		GeoSearchQuery: q,
+		StoreDist:      storeDist,
+	}).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " GeoSearchStore 写入错误! 错误原因: " + err.Error())
+		return 0, false
+	}
+	return n, true
+}
+
+// geoLoadingKey 同步时使用的临时 key, 与 key 处于同一槽位以便在集群模式下 RENAME; token 区分同一 key 的并发同步
+func geoLoadingKey(key, token string) string {
+	if tmp := key + ":loading:" + token; KeySlot(tmp) == KeySlot(key) {
+		return tmp
+	}
+	return "{" + key + "}:loading:" + token
+}
+
+// LoadGeoFromClickHouse 执行 ClickHouse 查询并将结果同步到 GEO 集合 key, 返回写入的成员数量
+// query 需要返回 name, longitude, latitude 三列 (可通过 AS 重命名), 坐标非法的行会被跳过
+// 数据先写入临时 key, 完成后通过 RENAME 整体替换, 读取方不会看到写入一半的数据; 同一 key 的并发同步各自使用独立的临时 key, 以最后完成的为准
+// 每 batchSize 行一个 GEOADD, 每 20 个 GEOADD 执行一次 Pipeline; 查询结果会全部读入内存, 数据量需与进程内存相匹配
+func (r *ModelRedisHandler) LoadGeoFromClickHouse(ck ClickHouseStore, query, key string, batchSize int) (int, error) {
+	if !r.Enable {
+		return 0, nil
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultGeoLoadBatchSize
+	}
+	var rows []GeoMember
+	if err := ck.QueryData(&rows, query); err != nil {
+		return 0, fmt.Errorf("ClickHouse 查询失败: %w", err)
+	}
+
+	ctx := context.Background()
+	client := r.universalClient()
+	token, err := newSemaphoreToken()
+	if err != nil {
+		return 0, err
+	}
+	tmp := geoLoadingKey(key, token)
+	loaded, skipped := 0, 0
+	pipe := client.Pipeline()
+	// 每 geoLoadPipelineBatches 个 GEOADD 执行一次 Pipeline, 避免数据量大时缓存全部命令
+	flush := func() error {
+		if pipe.Len() == 0 {
+			return nil
+		}
+		pipe.Expire(ctx, tmp, geoLoadingTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			client.Del(ctx, tmp)
+			return fmt.Errorf("GEO 数据写入失败: %w", err)
+		}
+		return nil
+	}
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		locations := make([]*redis.GeoLocation, 0, end-start)
+		for _, row := range rows[start:end] {
+			if !ValidGeoCoordinate(row.Longitude, row.Latitude) {
+				skipped++
+				continue
+			}
+			locations = append(locations, &redis.GeoLocation{Name: row.Name, Longitude: row.Longitude, Latitude: row.Latitude})
+		}
+		if len(locations) == 0 {
+			continue
+		}
+		pipe.GeoAdd(ctx, tmp, locations...)
+		loaded += len(locations)
+		if pipe.Len() >= geoLoadPipelineBatches {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+	if skipped > 0 {
+		Logger.Warn(GetLogPrefix("") + r.logName() + fmt.Sprintf(" LoadGeoFromClickHouse 跳过 %d 条坐标非法的数据", skipped))
+	}
+	if loaded == 0 {
+		err = client.Del(ctx, key).Err()
+	} else {
+		// RENAME 会带上临时 key 的过期时间, 在同一个 MULTI 中移除
+		_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Rename(ctx, tmp, key)
+			pipe.Persist(ctx, key)
+			return nil
+		})
+	}
+	if err != nil {
+		return 0, err
+	}
+	return loaded, nil
+}
@@ -0,0 +1,151 @@
+package go_toolbox
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+)
+
+var geoStations = []GeoMember{
+	{Name: "people_square", Longitude: 121.4737, Latitude: 31.2304},
+	{Name: "bund", Longitude: 121.4903, Latitude: 31.2400},
+	{Name: "lujiazui", Longitude: 121.5055, Latitude: 31.2397},
+	{Name: "hongqiao", Longitude: 121.3270, Latitude: 31.1979},
+}
+
+func TestGeo(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	if added, ok := redisHandler.GeoAdd("stations", geoStations...); !ok || added != 4 {
+		t.Fatalf("GeoAdd failed: %d %v", added, ok)
+	}
+	positions, ok := redisHandler.GeoPos("stations", "bund", "missing")
+	if !ok || len(positions) != 2 || positions[1] != nil {
+		t.Fatalf("unexpected positions: %v %v", positions, ok)
+	}
+	if math.Abs(positions[0].Longitude-121.4903) > 1e-4 || math.Abs(positions[0].Latitude-31.24) > 1e-4 {
+		t.Fatalf("unexpected bund position: %+v", positions[0])
+	}
+
+	dist, found, ok := redisHandler.GeoDist("stations", "people_square", "bund", GeoUnitKilometers)
+	if !ok || !found || dist < 1.8 || dist > 2.0 {
+		t.Fatalf("unexpected distance: %v %v %v", dist, found, ok)
+	}
+	if _, found, ok := redisHandler.GeoDist("stations", "people_square", "missing", ""); found || !ok {
+		t.Fatalf("missing member should not be found: %v %v", found, ok)
+	}
+
+	results, ok := redisHandler.GeoSearch("stations", GeoSearchOptions{
+		Member: "people_square", Radius: 5, Unit: GeoUnitKilometers,
+		Sort: GeoSortAsc, WithDist: true, WithCoord: true,
+	})
+	if !ok || len(results) != 3 || results[0].Name != "people_square" || results[2].Name != "lujiazui" {
+		t.Fatalf("unexpected radius search: %+v", results)
+	}
+	if results[1].Dist < 1.8 || results[1].Longitude == 0 {
+		t.Fatalf("expected distance and coordinates: %+v", results[1])
+	}
+	results, ok = redisHandler.GeoSearch("stations", GeoSearchOptions{
+		Longitude: 121.4737, Latitude: 31.2304, Width: 40, Height: 20, Unit: GeoUnitKilometers,
+		Sort: GeoSortDesc, Count: 1,
+	})
+	if !ok || len(results) != 1 || results[0].Name != "hongqiao" {
+		t.Fatalf("unexpected box search: %+v", results)
+	}
+	if _, ok := redisHandler.GeoSearch("stations", GeoSearchOptions{Member: "bund"}); ok {
+		t.Fatal("search without a shape should fail")
+	}
+
+	n, ok := redisHandler.GeoSearchStore("stations", "nearby", GeoSearchOptions{Member: "bund", Radius: 1600}, true)
+	if !ok || n != 2 {
+		t.Fatalf("GeoSearchStore failed: %d %v", n, ok)
+	}
+}
+
+func TestLoadGeoFromClickHouse(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	query := "SELECT toString(id) AS name, lon AS longitude, lat AS latitude FROM group.user_geo"
+	ck := NewFakeClickHouse()
+	ck.SetQueryResult(query, append(append([]GeoMember{}, geoStations...), GeoMember{Name: "pole", Longitude: 0, Latitude: 89}))
+
+	redisHandler.GeoAdd("user_geo", GeoMember{Name: "stale", Longitude: 1, Latitude: 1})
+	loaded, err := redisHandler.LoadGeoFromClickHouse(ck, query, "user_geo", 2)
+	if err != nil || loaded != 4 {
+		t.Fatalf("load failed: %d %v", loaded, err)
+	}
+	positions, _ := redisHandler.GeoPos("user_geo", "stale", "hongqiao", "pole")
+	if positions[0] != nil || positions[1] == nil || positions[2] != nil {
+		t.Fatalf("expected the geo set to be replaced: %v", positions)
+	}
+	if keys := redisHandler.Keys(); len(keys) != 1 || keys[0] != "user_geo" {
+		t.Fatalf("temporary key should be renamed away: %v", keys)
+	}
+	if ttl := redisHandler.RedisClient.TTL(context.Background(), "user_geo").Val(); ttl != -1 {
+		t.Fatalf("the loaded set should not keep the temporary TTL, got %v", ttl)
+	}
+}
+
+func TestLoadGeoFromClickHouseConcurrent(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	ck := NewFakeClickHouse()
+	queries := []string{"SELECT * FROM a", "SELECT * FROM b"}
+	for i, query := range queries {
+		rows := make([]GeoMember, 100)
+		for j := range rows {
+			rows[j] = GeoMember{Name: fmt.Sprintf("%d:%d", i, j), Longitude: 121, Latitude: 31}
+		}
+		ck.SetQueryResult(query, rows)
+	}
+	// 同一 key 的并发同步互不干扰, 结果为其中一次的完整数据
+	var wg sync.WaitGroup
+	for _, query := range queries {
+		wg.Add(1)
+		go func(query string) {
+			defer wg.Done()
+			if loaded, err := redisHandler.LoadGeoFromClickHouse(ck, query, "poi_geo", 1); err != nil || loaded != 100 {
+				t.Errorf("load failed: %d %v", loaded, err)
+			}
+		}(query)
+	}
+	wg.Wait()
+	members := redisHandler.RedisClient.ZRange(context.Background(), "poi_geo", 0, -1).Val()
+	if len(members) != 100 {
+		t.Fatalf("expected one complete load, got %d members", len(members))
+	}
+	for _, member := range members {
+		if member[:2] != members[0][:2] {
+			t.Fatalf("loads should not mix: %v", members)
+		}
+	}
+	if keys := redisHandler.Keys(); len(keys) != 1 {
+		t.Fatalf("temporary keys should be renamed away: %v", keys)
+	}
+}
+
+func TestLoadGeoFromClickHouseManyBatches(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	query := "SELECT name, longitude, latitude FROM group.poi"
+	rows := make([]GeoMember, 250)
+	for i := range rows {
+		rows[i] = GeoMember{Name: fmt.Sprintf("poi:%d", i), Longitude: 121 + float64(i)/1000, Latitude: 31}
+	}
+	ck := NewFakeClickHouse()
+	ck.SetQueryResult(query, rows)
+	// 250 行每批 3 行, 共 84 个 GEOADD, 分多个 Pipeline 执行
+	loaded, err := redisHandler.LoadGeoFromClickHouse(ck, query, "poi_geo", 3)
+	if err != nil || loaded != len(rows) {
+		t.Fatalf("load failed: %d %v", loaded, err)
+	}
+	if n := redisHandler.RedisClient.ZCard(context.Background(), "poi_geo").Val(); n != int64(len(rows)) {
+		t.Fatalf("expected %d members, got %d", len(rows), n)
+	}
+}
@@ -0,0 +1,296 @@
+package go_toolbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultHotKeySampleRate = 0.01
+	DefaultHotKeyWindow     = time.Minute
+	DefaultHotKeyTopN       = 20
+	DefaultHotKeyMaxTracked = 10000
+	// hotKeyBuckets 滑动窗口按时间切分的桶数, 窗口每过去 1/hotKeyBuckets 淘汰最旧的一桶
+	hotKeyBuckets = 6
+)
+
+// HotKeyOptions 客户端热点 key 采样参数
+type HotKeyOptions struct {
+	// SampleRate 命令的采样比例 (0~1], 默认 0.01
+	SampleRate float64
+	// Window 统计的滑动窗口, 默认 1 分钟
+	Window time.Duration
+	// TopN HotKeys 返回的 key 数, 默认 20
+	TopN int
+	// MaxTracked 每个时间桶最多跟踪的 key 数, 超出后新出现的 key 不再计数 (已跟踪的 key 继续计数), 默认 10000
+	MaxTracked int
+}
+
+func (o HotKeyOptions) withDefaults() HotKeyOptions {
+	if o.SampleRate <= 0 || o.SampleRate > 1 {
+		o.SampleRate = DefaultHotKeySampleRate
+	}
+	if o.Window <= 0 {
+		o.Window = DefaultHotKeyWindow
+	}
+	if o.TopN <= 0 {
+		o.TopN = DefaultHotKeyTopN
+	}
+	if o.MaxTracked <= 0 {
+		o.MaxTracked = DefaultHotKeyMaxTracked
+	}
+	return o
+}
+
+// HotKey 一个热点 key, EstimatedOps 为按采样比例折算的窗口内命令数
+type HotKey struct {
+	Key          string  `json:"key"`
+	Node         string  `json:"node"`
+	Samples      int64   `json:"samples"`
+	EstimatedOps int64   `json:"estimated_ops"`
+	OpsPerSecond float64 `json:"ops_per_second"`
+}
+
+// HotKeyReport 热点 key 统计结果, NodeOps 为各节点在窗口内的估算命令数 (按全部跟踪的 key 汇总), 用于发现负载倾斜的节点
+type HotKeyReport struct {
+	GeneratedAt time.Time        `json:"generated_at"`
+	Window      time.Duration    `json:"window"`
+	SampleRate  float64          `json:"sample_rate"`
+	Keys        []HotKey         `json:"keys"`
+	NodeOps     map[string]int64 `json:"node_ops"`
+}
+
+// JSON 以缩进的 JSON 导出
+func (rep HotKeyReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(rep, "", "  ")
+}
+
+// hotKeyFirstArg 第一个参数即为 key 的命令, 其余命令见 hotKeyPosition, 不在其中的命令不参与采样
+var hotKeyFirstArg = map[string]bool{
+	"get": true, "set": true, "setnx": true, "setex": true, "psetex": true, "getset": true, "getdel": true, "getex": true,
+	"append": true, "strlen": true, "incr": true, "incrby": true, "incrbyfloat": true, "decr": true, "decrby": true,
+	"getrange": true, "setrange": true, "setbit": true, "getbit": true, "bitcount": true, "bitpos": true,
+	"bitfield": true, "bitfield_ro": true, "mget": true, "mset": true, "msetnx": true, "lcs": true,
+	"del": true, "unlink": true, "exists": true, "type": true, "ttl": true, "pttl": true, "expire": true, "pexpire": true,
+	"expireat": true, "pexpireat": true, "expiretime": true, "pexpiretime": true, "persist": true, "touch": true,
+	"rename": true, "renamenx": true, "copy": true, "move": true, "dump": true, "restore": true, "sort": true, "sort_ro": true, "watch": true,
+	"hset": true, "hsetnx": true, "hmset": true, "hget": true, "hmget": true, "hdel": true, "hlen": true, "hstrlen": true,
+	"hexists": true, "hkeys": true, "hvals": true, "hgetall": true, "hincrby": true, "hincrbyfloat": true, "hscan": true, "hrandfield": true,
+	"lpush": true, "rpush": true, "lpushx": true, "rpushx": true, "lpop": true, "rpop": true, "llen": true, "lrange": true,
+	"lindex": true, "lset": true, "lrem": true, "ltrim": true, "linsert": true, "lpos": true, "lmove": true, "rpoplpush": true,
+	"blpop": true, "brpop": true, "blmove": true, "brpoplpush": true,
+	"sadd": true, "srem": true, "smembers": true, "sismember": true, "smismember": true, "scard": true, "spop": true,
+	"srandmember": true, "smove": true, "sscan": true, "sinter": true, "sunion": true, "sdiff": true,
+	"sinterstore": true, "sunionstore": true, "sdiffstore": true,
+	"zadd": true, "zrem": true, "zscore": true, "zmscore": true, "zincrby": true, "zcard": true, "zcount": true, "zlexcount": true,
+	"zrange": true, "zrangebyscore": true, "zrangebylex": true, "zrevrange": true, "zrevrangebyscore": true, "zrevrangebylex": true,
+	"zrank": true, "zrevrank": true, "zremrangebyrank": true, "zremrangebyscore": true, "zremrangebylex": true,
+	"zpopmin": true, "zpopmax": true, "bzpopmin": true, "bzpopmax": true, "zscan": true, "zrandmember": true,
+	"zrangestore": true, "zunionstore": true, "zinterstore": true, "zdiffstore": true,
+	"geoadd": true, "geopos": true, "geodist": true, "geohash": true, "georadius": true, "georadiusbymember": true,
+	"geosearch": true, "geosearchstore": true, "pfadd": true, "pfcount": true, "pfmerge": true,
+	"xadd": true, "xlen": true, "xrange": true, "xrevrange": true, "xdel": true, "xtrim": true, "xack": true,
+	"xpending": true, "xclaim": true, "xautoclaim": true,
+	"json.set": true, "json.get": true, "json.mget": true, "json.del": true, "json.forget": true, "json.type": true,
+	"json.strlen": true, "json.strappend": true, "json.arrappend": true, "json.arrlen": true, "json.arrinsert": true,
+	"json.arrindex": true, "json.arrpop": true, "json.arrtrim": true, "json.objkeys": true, "json.objlen": true,
+	"json.numincrby": true, "json.nummultby": true, "json.toggle": true, "json.clear": true, "json.merge": true,
+	"bf.add": true, "bf.madd": true, "bf.exists": true, "bf.mexists": true, "bf.reserve": true, "bf.insert": true, "bf.info": true,
+}
+
+type hotKeyBucket struct {
+	epoch  int64
+	counts map[string]int64
+}
+
+// hotKeySampler 以 Hook 的形式对命令的第一个 key 采样, 按时间桶组成滑动窗口计数
+// sampleRate 为 opts.SampleRate 的位表示, 供 record 在加锁前抽样, 未被抽中的命令不会争用锁
+type hotKeySampler struct {
+	sampleRate uint64
+
+	mu      sync.Mutex
+	opts    HotKeyOptions
+	buckets [hotKeyBuckets]hotKeyBucket
+}
+
+// EnableHotKeySampling 开启客户端热点 key 采样, 按 opts.SampleRate 抽取命令并统计第一个 key, 通过 HotKeys 查看结果
+// 首次调用时安装采样 Hook, 需在使用 Handler 之前完成; 之后再次调用只更新参数并清空已有的统计
+func (r *ModelRedisHandler) EnableHotKeySampling(opts HotKeyOptions) {
+	if !r.Enable {
+		return
+	}
+	opts = opts.withDefaults()
+	r.hotKeyOnce.Do(func() {
+		r.hotKeys = &hotKeySampler{}
+		r.addHook(r.hotKeys)
+	})
+	r.hotKeys.mu.Lock()
+	r.hotKeys.opts = opts
+	r.hotKeys.buckets = [hotKeyBuckets]hotKeyBucket{}
+	atomic.StoreUint64(&r.hotKeys.sampleRate, math.Float64bits(opts.SampleRate))
+	r.hotKeys.mu.Unlock()
+}
+
+// HotKeys 当前窗口内采样次数最多的 TopN 个 key, 未开启采样时返回 false
+func (r *ModelRedisHandler) HotKeys() (HotKeyReport, bool) {
+	if r.hotKeys == nil {
+		return HotKeyReport{}, false
+	}
+	now := time.Now()
+	opts, counts := r.hotKeys.snapshot(now)
+	report := HotKeyReport{
+		GeneratedAt: now,
+		Window:      opts.Window,
+		SampleRate:  opts.SampleRate,
+		NodeOps:     make(map[string]int64),
+	}
+	ctx := context.Background()
+	keys := make([]HotKey, 0, len(counts))
+	for key, samples := range counts {
+		estimated := int64(float64(samples) / opts.SampleRate)
+		node := r.nodeForKey(ctx, key)
+		report.NodeOps[node] += estimated
+		keys = append(keys, HotKey{
+			Key:          key,
+			Node:         node,
+			Samples:      samples,
+			EstimatedOps: estimated,
+			OpsPerSecond: float64(estimated) / opts.Window.Seconds(),
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Samples == keys[j].Samples {
+			return keys[i].Key < keys[j].Key
+		}
+		return keys[i].Samples > keys[j].Samples
+	})
+	if len(keys) > opts.TopN {
+		keys = keys[:opts.TopN]
+	}
+	report.Keys = keys
+	return report, true
+}
+
+func (s *hotKeySampler) bucketSize() time.Duration {
+	return s.opts.Window / hotKeyBuckets
+}
+
+func (s *hotKeySampler) record(cmd redis.Cmder) {
+	if rand.Float64() >= math.Float64frombits(atomic.LoadUint64(&s.sampleRate)) {
+		return
+	}
+	key, ok := hotKeyOf(cmd)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	epoch := time.Now().UnixNano() / int64(s.bucketSize())
+	bucket := &s.buckets[epoch%hotKeyBuckets]
+	if bucket.epoch != epoch || bucket.counts == nil {
+		bucket.epoch = epoch
+		bucket.counts = make(map[string]int64)
+	}
+	if _, tracked := bucket.counts[key]; !tracked && len(bucket.counts) >= s.opts.MaxTracked {
+		return
+	}
+	bucket.counts[key]++
+}
+
+// snapshot 汇总窗口内仍然有效的桶
+func (s *hotKeySampler) snapshot(now time.Time) (HotKeyOptions, map[string]int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := now.UnixNano() / int64(s.bucketSize())
+	counts := make(map[string]int64)
+	for _, bucket := range s.buckets {
+		if bucket.counts == nil || current-bucket.epoch >= hotKeyBuckets {
+			continue
+		}
+		for key, n := range bucket.counts {
+			counts[key] += n
+		}
+	}
+	return s.opts, counts
+}
+
+// hotKeyOf 命令的第一个 key, 没有 key 或无法确定位置的命令返回 false
+func hotKeyOf(cmd redis.Cmder) (string, bool) {
+	args := cmd.Args()
+	pos := hotKeyPosition(strings.ToLower(cmd.Name()), args)
+	if pos <= 0 || pos >= len(args) {
+		return "", false
+	}
+	return fmt.Sprint(args[pos]), true
+}
+
+// hotKeyPosition 第一个 key 在参数中的位置, 与 go-redis 的 cmdFirstKeyPos 一致, 0 表示没有 key
+func hotKeyPosition(name string, args []interface{}) int {
+	if hotKeyFirstArg[name] {
+		return 1
+	}
+	switch name {
+	case "eval", "evalsha", "eval_ro", "evalsha_ro", "fcall", "fcall_ro":
+		// script numkeys key ...
+		if len(args) > 3 && fmt.Sprint(args[2]) != "0" {
+			return 3
+		}
+	case "bitop":
+		// BITOP operation destkey key ...
+		return 2
+	case "zunion", "zinter", "zdiff", "sintercard", "lmpop", "zmpop":
+		// numkeys key ...
+		return 2
+	case "blmpop", "bzmpop":
+		// timeout numkeys key ...
+		return 3
+	case "object":
+		// OBJECT ENCODING|FREQ|IDLETIME|REFCOUNT key
+		return 2
+	case "memory":
+		if len(args) > 2 && strings.EqualFold(fmt.Sprint(args[1]), "usage") {
+			return 2
+		}
+	case "xread", "xreadgroup":
+		// ... STREAMS key [key ...] id [id ...]
+		for i := 1; i < len(args); i++ {
+			if strings.EqualFold(fmt.Sprint(args[i]), "streams") {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+func (s *hotKeySampler) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (s *hotKeySampler) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		s.record(cmd)
+		return next(ctx, cmd)
+	}
+}
+
+func (s *hotKeySampler) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			s.record(cmd)
+		}
+		return next(ctx, cmds)
+	}
+}
@@ -0,0 +1,161 @@
+package go_toolbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisHotKeys(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	if _, ok := redisHandler.HotKeys(); ok {
+		t.Fatal("HotKeys should report false before sampling is enabled")
+	}
+	redisHandler.EnableHotKeySampling(HotKeyOptions{SampleRate: 1, TopN: 2})
+	for i := 0; i < 30; i++ {
+		redisHandler.Get("hot:a")
+		if i%3 == 0 {
+			redisHandler.HashGet("hot:b", "f")
+		}
+		redisHandler.Set(fmt.Sprintf("cold:%d", i), i, 0)
+	}
+	redisHandler.RedisClient.Ping(context.Background())
+	report, ok := redisHandler.HotKeys()
+	if !ok || len(report.Keys) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Keys[0].Key != "hot:a" || report.Keys[0].Samples != 30 || report.Keys[1].Key != "hot:b" || report.Keys[1].Samples != 10 {
+		t.Fatalf("unexpected hot keys %+v", report.Keys)
+	}
+	if report.Keys[0].Node != "fake-redis:6379" || report.NodeOps["fake-redis:6379"] != 70 {
+		t.Fatalf("unexpected node attribution %+v %v", report.Keys[0], report.NodeOps)
+	}
+	data, err := report.JSON()
+	if err != nil || !strings.Contains(string(data), `"key": "hot:a"`) {
+		t.Fatalf("unexpected JSON %s: %v", data, err)
+	}
+
+	// 再次调用只更新参数并清空统计, 不会重复安装 Hook
+	redisHandler.EnableHotKeySampling(HotKeyOptions{SampleRate: 1})
+	redisHandler.Get("hot:a")
+	if report, _ := redisHandler.HotKeys(); len(report.Keys) != 1 || report.Keys[0].Samples != 1 {
+		t.Fatalf("unexpected report after reset %+v", report.Keys)
+	}
+}
+
+func TestHotKeySamplerWindow(t *testing.T) {
+	sampler := &hotKeySampler{opts: HotKeyOptions{Window: time.Minute}.withDefaults()}
+	sampler.opts.SampleRate = 1
+	now := time.Now()
+	bucket := now.UnixNano() / int64(sampler.bucketSize())
+	sampler.buckets[bucket%hotKeyBuckets] = hotKeyBucket{epoch: bucket, counts: map[string]int64{"a": 3}}
+	// 上一轮窗口留下的桶已过期, 同一位置的当前窗口内的桶仍然计数
+	sampler.buckets[(bucket+1)%hotKeyBuckets] = hotKeyBucket{epoch: bucket + 1 - 2*hotKeyBuckets, counts: map[string]int64{"a": 100}}
+	sampler.buckets[(bucket+2)%hotKeyBuckets] = hotKeyBucket{epoch: bucket + 2 - hotKeyBuckets, counts: map[string]int64{"a": 5, "b": 1}}
+	if _, counts := sampler.snapshot(now); counts["a"] != 8 || counts["b"] != 1 {
+		t.Fatalf("buckets older than the window should be dropped, got %v", counts)
+	}
+}
+
+func TestRedisAnalyzeBigKeys(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+
+	redisHandler.Set("str:small", "x", 0)
+	redisHandler.Set("str:big", strings.Repeat("x", 4096), 0)
+	for i := 0; i < 100; i++ {
+		redisHandler.HashSet("hash:big", fmt.Sprintf("f%d", i), i)
+	}
+	redisHandler.ListRPush("list:q", "a", "b", "c")
+	redisHandler.SetAdd("set:s", "a", "b")
+
+	report, err := redisHandler.AnalyzeBigKeys(ctx, BigKeyOptions{TopN: 2, BatchSize: 2})
+	if err != nil || len(report.Nodes) != 1 {
+		t.Fatalf("unexpected report %+v: %v", report, err)
+	}
+	node := report.Nodes[0]
+	if node.Scanned != 5 || node.Types["string"] != 2 || node.Types["hash"] != 1 {
+		t.Fatalf("unexpected node statistics %+v", node)
+	}
+	if len(node.Keys) != 2 || node.Keys[0].Key != "str:big" || node.Keys[1].Key != "hash:big" {
+		t.Fatalf("unexpected biggest keys %+v", node.Keys)
+	}
+	if node.Keys[0].Length != 4096 || node.Longest["hash"].Length != 100 || node.Longest["list"].Length != 3 || node.Longest["set"].Length != 2 {
+		t.Fatalf("unexpected lengths %+v %+v", node.Keys, node.Longest)
+	}
+	data, err := report.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded BigKeyReport
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Nodes[0].Keys[0].MemoryBytes != node.Keys[0].MemoryBytes {
+		t.Fatalf("report should round-trip through JSON: %v", err)
+	}
+
+	report, err = redisHandler.AnalyzeBigKeys(ctx, BigKeyOptions{Pattern: "str:*"})
+	if err != nil || report.Nodes[0].Scanned != 2 {
+		t.Fatalf("pattern should limit the scan, got %+v: %v", report.Nodes, err)
+	}
+}
+
+func TestRedisAnalyzeBigKeysRing(t *testing.T) {
+	ring, err := NewFakeRedisRing(RingHashKetama, 0, "a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ring.ShutdownRedisHandler()
+
+	for i := 0; i < 30; i++ {
+		ring.Set(fmt.Sprintf("k:%d", i), strings.Repeat("v", i), 0)
+	}
+	report, err := ring.AnalyzeBigKeys(context.Background(), BigKeyOptions{TopN: 1})
+	if err != nil || len(report.Nodes) != 3 {
+		t.Fatalf("every shard should be analyzed, got %+v: %v", report.Nodes, err)
+	}
+	var scanned int64
+	for _, node := range report.Nodes {
+		scanned += node.Scanned
+		if len(node.Keys) != 1 || ring.ShardForKey(node.Keys[0].Key) == "" {
+			t.Fatalf("unexpected node report %+v", node)
+		}
+	}
+	if scanned != 30 {
+		t.Fatalf("scanned %d keys, want 30", scanned)
+	}
+}
+
+func TestHotKeyOf(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		args []interface{}
+		key  string
+	}{
+		{[]interface{}{"get", "k"}, "k"},
+		{[]interface{}{"xread", "count", 10, "streams", "s1", "0"}, "s1"},
+		{[]interface{}{"xreadgroup", "group", "g", "c", "streams", "s2", ">"}, "s2"},
+		{[]interface{}{"bitop", "and", "dest", "a", "b"}, "dest"},
+		{[]interface{}{"object", "encoding", "k"}, "k"},
+		{[]interface{}{"memory", "usage", "k"}, "k"},
+		{[]interface{}{"zunion", 2, "z1", "z2"}, "z1"},
+		{[]interface{}{"blmpop", 1, 2, "l1", "l2", "left"}, "l1"},
+		{[]interface{}{"evalsha", "sha", 1, "k"}, "k"},
+		{[]interface{}{"eval", "return 1", 0}, ""},
+		{[]interface{}{"xinfo", "stream", "s1"}, ""},
+		{[]interface{}{"slowlog", "get"}, ""},
+		{[]interface{}{"ping"}, ""},
+	}
+	for _, c := range cases {
+		key, ok := hotKeyOf(redis.NewCmd(ctx, c.args...))
+		if ok != (c.key != "") || key != c.key {
+			t.Fatalf("%v: got %q %v, want %q", c.args, key, ok, c.key)
+		}
+	}
+}
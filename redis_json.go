@@ -0,0 +1,264 @@
+package go_toolbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// JSONRoot RedisJSON 文档的根路径
+const JSONRoot = "$"
+
+// errJSONPath 只支持 JSONPath 语法 ($ 开头), 旧版路径语法的返回格式不同
+var errJSONPath = errors.New("RedisJSON 路径必须以 $ 开头 (JSONPath 语法)")
+
+// 以下方法封装 RedisJSON 模块的命令, path 均为 JSONPath ($ 开头), 一个 path 可能匹配多个位置,
+// 因此结果都是按匹配顺序排列的切片; 路径未匹配时结果为空切片, 匹配到类型不符的位置时对应元素为 nil
+
+// JSONSet 将 value 序列化为 JSON 写入 key 的 path, key 不存在时 path 必须为 $
+func (r *ModelRedisHandler) JSONSet(key, path string, value interface{}) bool {
+	_, ok := r.jsonSet(key, path, value, "")
+	return ok
+}
+
+// JSONSetNX 仅在 path 不存在时写入, 返回是否写入
+func (r *ModelRedisHandler) JSONSetNX(key, path string, value interface{}) (bool, bool) {
+	return r.jsonSet(key, path, value, "NX")
+}
+
+// JSONSetXX 仅在 path 已存在时写入, 返回是否写入
+func (r *ModelRedisHandler) JSONSetXX(key, path string, value interface{}) (bool, bool) {
+	return r.jsonSet(key, path, value, "XX")
+}
+
+func (r *ModelRedisHandler) jsonSet(key, path string, value interface{}, mode string) (bool, bool) {
+	if !r.Enable {
+		return true, true
+	}
+	if !strings.HasPrefix(path, JSONRoot) {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.SET 错误! " + errJSONPath.Error())
+		return false, false
+	}
+	data, err := marshalJSONValue(value)
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.SET 序列化错误! key: " + key + " 错误原因: " + err.Error())
+		return false, false
+	}
+	args := []interface{}{"JSON.SET", key, path, data}
+	if mode != "" {
+		args = append(args, mode)
+	}
+	err = r.universalClient().Do(context.Background(), args...).Err()
+	if err == redis.Nil {
+		return false, true
+	}
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.SET 写入错误! key: " + key + " 错误原因: " + err.Error())
+		return false, false
+	}
+	return true, true
+}
+
+// JSONGet 读取 key 中 path 匹配的全部值并解析为 T, key 不存在时返回 nil
+//
+//	names, ok := JSONGet[string](handler, "user:1", "$.friends[*].name")
+func JSONGet[T any](r *ModelRedisHandler, key, path string) ([]T, bool) {
+	if !r.Enable {
+		return nil, true
+	}
+	if !strings.HasPrefix(path, JSONRoot) {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.GET 错误! " + errJSONPath.Error())
+		return nil, false
+	}
+	result, err := r.universalClient().Do(context.Background(), "JSON.GET", key, path).Text()
+	if err == redis.Nil {
+		return nil, true
+	}
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.GET 读取错误! key: " + key + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	var values []T
+	if err := json.Unmarshal([]byte(result), &values); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.GET 解析错误! key: " + key + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	return values, true
+}
+
+// JSONMGet 读取多个 key 中 path 匹配的值, 结果与 keys 一一对应, 不存在的 key 为 nil
+// 集群模式下按槽位分组执行 JSON.MGET
+func JSONMGet[T any](r *ModelRedisHandler, path string, keys ...string) ([][]T, bool) {
+	results := make([][]T, len(keys))
+	if !r.Enable || len(keys) == 0 {
+		return results, true
+	}
+	if !strings.HasPrefix(path, JSONRoot) {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.MGET 错误! " + errJSONPath.Error())
+		return nil, false
+	}
+	groups := make(map[int][]int)
+	for i, key := range keys {
+		slot := 0
+		if r.IsCluster {
+			slot = KeySlot(key)
+		} else if r.isRing() {
+			// 分片模式下无法在客户端外按分片合并, 每个 key 单独读取
+			slot = i
+		}
+		groups[slot] = append(groups[slot], i)
+	}
+	ctx := context.Background()
+	pipe := r.universalClient().Pipeline()
+	cmds := make(map[int]*redis.Cmd, len(groups))
+	for slot, indexes := range groups {
+		args := make([]interface{}, 0, len(indexes)+2)
+		args = append(args, "JSON.MGET")
+		for _, i := range indexes {
+			args = append(args, keys[i])
+		}
+		cmds[slot] = pipe.Do(ctx, append(args, path)...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.MGET 读取错误! 错误原因: " + err.Error())
+		return nil, false
+	}
+	for slot, indexes := range groups {
+		values, err := cmds[slot].Slice()
+		if err != nil || len(values) != len(indexes) {
+			Logger.Error(GetLogPrefix("") + r.logName() + " JSON.MGET 返回格式错误!")
+			return nil, false
+		}
+		for j, value := range values {
+			text, ok := value.(string)
+			if !ok {
+				continue
+			}
+			if err := json.Unmarshal([]byte(text), &results[indexes[j]]); err != nil {
+				Logger.Error(GetLogPrefix("") + r.logName() + " JSON.MGET 解析错误! key: " + keys[indexes[j]] + " 错误原因: " + err.Error())
+				return nil, false
+			}
+		}
+	}
+	return results, true
+}
+
+// JSONDel 删除 path 匹配的全部值, path 为 $ 时删除整个 key, 返回删除的数量
+func (r *ModelRedisHandler) JSONDel(key, path string) (int64, bool) {
+	if !r.Enable {
+		return 0, true
+	}
+	if !strings.HasPrefix(path, JSONRoot) {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.DEL 错误! " + errJSONPath.Error())
+		return 0, false
+	}
+	n, err := r.universalClient().Do(context.Background(), "JSON.DEL", key, path).Int64()
+	if err != nil && err != redis.Nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.DEL 删除错误! key: " + key + " 错误原因: " + err.Error())
+		return 0, false
+	}
+	return n, true
+}
+
+// JSONNumIncrBy 将 path 匹配的数字原子地加 delta, 返回每个位置的新值, 非数字位置为 nil
+func (r *ModelRedisHandler) JSONNumIncrBy(key, path string, delta float64) ([]*float64, bool) {
+	if !r.Enable {
+		return nil, true
+	}
+	if !strings.HasPrefix(path, JSONRoot) {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.NUMINCRBY 错误! " + errJSONPath.Error())
+		return nil, false
+	}
+	result, err := r.universalClient().Do(context.Background(), "JSON.NUMINCRBY", key, path, delta).Text()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.NUMINCRBY 错误! key: " + key + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	var values []*float64
+	if err := json.Unmarshal([]byte(result), &values); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.NUMINCRBY 解析错误! key: " + key + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	return values, true
+}
+
+// JSONArrAppend 向 path 匹配的数组追加 values, 返回每个数组的新长度, 非数组位置为 nil
+func (r *ModelRedisHandler) JSONArrAppend(key, path string, values ...interface{}) ([]*int64, bool) {
+	if !r.Enable {
+		return nil, true
+	}
+	if !strings.HasPrefix(path, JSONRoot) {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.ARRAPPEND 错误! " + errJSONPath.Error())
+		return nil, false
+	}
+	args := make([]interface{}, 0, len(values)+3)
+	args = append(args, "JSON.ARRAPPEND", key, path)
+	for _, value := range values {
+		data, err := marshalJSONValue(value)
+		if err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " JSON.ARRAPPEND 序列化错误! key: " + key + " 错误原因: " + err.Error())
+			return nil, false
+		}
+		args = append(args, data)
+	}
+	result, err := r.universalClient().Do(context.Background(), args...).Slice()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.ARRAPPEND 错误! key: " + key + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	lengths := make([]*int64, len(result))
+	for i, item := range result {
+		if n, ok := item.(int64); ok {
+			lengths[i] = &n
+		}
+	}
+	return lengths, true
+}
+
+// JSONObjKeys 返回 path 匹配的每个对象的字段名, 非对象位置为 nil
+func (r *ModelRedisHandler) JSONObjKeys(key, path string) ([][]string, bool) {
+	if !r.Enable {
+		return nil, true
+	}
+	if !strings.HasPrefix(path, JSONRoot) {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.OBJKEYS 错误! " + errJSONPath.Error())
+		return nil, false
+	}
+	result, err := r.universalClient().Do(context.Background(), "JSON.OBJKEYS", key, path).Slice()
+	if err == redis.Nil {
+		return nil, true
+	}
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " JSON.OBJKEYS 错误! key: " + key + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	keys := make([][]string, len(result))
+	for i, item := range result {
+		names, ok := item.([]interface{})
+		if !ok {
+			continue
+		}
+		keys[i] = make([]string, 0, len(names))
+		for _, name := range names {
+			if s, ok := name.(string); ok {
+				keys[i] = append(keys[i], s)
+			}
+		}
+	}
+	return keys, true
+}
+
+// marshalJSONValue json.RawMessage 与 []byte 视为已序列化的 JSON 原样写入, 其他值使用 json.Marshal
+func marshalJSONValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case json.RawMessage:
+		return string(v), nil
+	case []byte:
+		return string(v), nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
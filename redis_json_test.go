@@ -0,0 +1,77 @@
+package go_toolbox
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type testJSONProfile struct {
+	Name    string            `json:"name"`
+	Age     int               `json:"age"`
+	Tags    []string          `json:"tags"`
+	Address map[string]string `json:"address"`
+}
+
+func TestRedisJSON(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	profile := testJSONProfile{Name: "elvis", Age: 42, Tags: []string{"singer"}, Address: map[string]string{"city": "memphis"}}
+	if !redisHandler.JSONSet("user:1", JSONRoot, profile) {
+		t.Fatal("JSON.SET failed")
+	}
+	if redisHandler.JSONSet("user:2", "$.name", "x") {
+		t.Fatal("new documents must be created at the root")
+	}
+	if redisHandler.JSONSet("user:1", "name", "x") {
+		t.Fatal("legacy paths should be rejected")
+	}
+	docs, ok := JSONGet[testJSONProfile](redisHandler.ModelRedisHandler, "user:1", JSONRoot)
+	if !ok || len(docs) != 1 || docs[0].Address["city"] != "memphis" {
+		t.Fatalf("unexpected document %+v", docs)
+	}
+
+	// 子路径更新
+	redisHandler.JSONSet("user:1", "$.address.zip", "38116")
+	if set, _ := redisHandler.JSONSetNX("user:1", "$.name", "other"); set {
+		t.Fatal("NX should not overwrite")
+	}
+	if set, _ := redisHandler.JSONSetXX("user:1", "$.missing", 1); set {
+		t.Fatal("XX should not create")
+	}
+	ages, _ := redisHandler.JSONNumIncrBy("user:1", "$.age", 1)
+	if len(ages) != 1 || *ages[0] != 43 {
+		t.Fatalf("unexpected NUMINCRBY result %v", ages)
+	}
+	if lengths, _ := redisHandler.JSONArrAppend("user:1", "$.tags", "actor", "legend"); len(lengths) != 1 || *lengths[0] != 3 {
+		t.Fatalf("unexpected ARRAPPEND result %v", lengths)
+	}
+	if lengths, _ := redisHandler.JSONArrAppend("user:1", "$.name", "x"); len(lengths) != 1 || lengths[0] != nil {
+		t.Fatal("non-array matches should be nil")
+	}
+	tags, _ := JSONGet[string](redisHandler.ModelRedisHandler, "user:1", "$.tags[*]")
+	if strings.Join(tags, ",") != "singer,actor,legend" {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+	if keys, _ := redisHandler.JSONObjKeys("user:1", "$.address"); len(keys) != 1 || strings.Join(keys[0], ",") != "city,zip" {
+		t.Fatalf("unexpected OBJKEYS result %v", keys)
+	}
+
+	redisHandler.JSONSet("user:2", JSONRoot, json.RawMessage(`{"name":"presley","age":1}`))
+	names, ok := JSONMGet[string](redisHandler.ModelRedisHandler, "$.name", "user:1", "missing", "user:2")
+	if !ok || names[0][0] != "elvis" || names[1] != nil || names[2][0] != "presley" {
+		t.Fatalf("unexpected MGET result %v", names)
+	}
+
+	if n, _ := redisHandler.JSONDel("user:1", "$.tags[0]"); n != 1 {
+		t.Fatal("JSON.DEL should delete the array element")
+	}
+	tags, _ = JSONGet[string](redisHandler.ModelRedisHandler, "user:1", "$.tags[*]")
+	if strings.Join(tags, ",") != "actor,legend" {
+		t.Fatalf("unexpected tags after delete %v", tags)
+	}
+	if n, _ := redisHandler.JSONDel("user:2", JSONRoot); n != 1 || len(redisHandler.Keys()) != 1 {
+		t.Fatal("deleting the root should remove the key")
+	}
+}
@@ -0,0 +1,467 @@
+package go_toolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 常用的 keyevent 事件名, 完整列表见 Redis keyspace notifications 文档
+const (
+	KeyEventExpired = "expired"
+	KeyEventEvicted = "evicted"
+	KeyEventDel     = "del"
+	KeyEventExpire  = "expire"
+	KeyEventSet     = "set"
+	KeyEventNew     = "new"
+)
+
+const (
+	DefaultKeyspaceHealthCheck     = 30 * time.Second
+	DefaultKeyspaceNodeRefresh     = 30 * time.Second
+	defaultKeyspaceReconnectMin    = 500 * time.Millisecond
+	defaultKeyspaceReconnectMax    = 30 * time.Second
+	notifyKeyspaceEventsConfigName = "notify-keyspace-events"
+)
+
+// keyEventClasses 事件名与 notify-keyspace-events 类型字符的对应关系, 未列出的事件需要 A
+var keyEventClasses = map[string]byte{
+	"expired": 'x', "evicted": 'e', "new": 'n',
+	"del": 'g', "expire": 'g', "persist": 'g', "rename_from": 'g', "rename_to": 'g', "copy_to": 'g', "restore": 'g',
+	"set": '$', "setrange": '$', "incrby": '$', "incrbyfloat": '$', "append": '$',
+	"hset": 'h', "hdel": 'h', "hincrby": 'h', "hincrbyfloat": 'h',
+	"lpush": 'l', "rpush": 'l', "lpop": 'l', "rpop": 'l', "linsert": 'l', "lset": 'l', "lrem": 'l', "ltrim": 'l',
+	"sadd": 's', "srem": 's', "spop": 's', "sinterstore": 's', "sunionstore": 's', "sdiffstore": 's',
+	"zadd": 'z', "zincr": 'z', "zrem": 'z', "zinterstore": 'z', "zunionstore": 'z', "zdiffstore": 'z',
+	"xadd": 't', "xdel": 't', "xtrim": 't',
+}
+
+// KeyspaceEvent 一条 keyevent 通知
+type KeyspaceEvent struct {
+	Event string
+	Key   string
+	DB    int
+	// Node 产生事件的节点地址
+	Node string
+	Time time.Time
+}
+
+// KeyspaceHandler 事件回调, 集群模式下不同节点的事件会并发回调
+type KeyspaceHandler func(event KeyspaceEvent)
+
+// KeyspaceListenerOptions keyspace 监听配置
+type KeyspaceListenerOptions struct {
+	// Events 监听的事件, 默认为 expired 与 evicted
+	Events []string
+	// Patterns key 的 glob 过滤条件, 为空时不过滤
+	Patterns []string
+	DB       int
+	// EnableNotifications 为 true 时在每个节点上通过 CONFIG SET 开启所需的 notify-keyspace-events (与已有配置合并)
+	EnableNotifications bool
+	// HealthCheckInterval 无消息时发送 PING 的间隔, 连续两个间隔无回复视为连接断开
+	HealthCheckInterval time.Duration
+	// NodeRefreshInterval 集群模式下检查主节点变化的间隔
+	NodeRefreshInterval time.Duration
+	ReconnectBackoff    time.Duration
+	MaxReconnectBackoff time.Duration
+}
+
+func (o *KeyspaceListenerOptions) setDefaults() {
+	if len(o.Events) == 0 {
+		o.Events = []string{KeyEventExpired, KeyEventEvicted}
+	}
+	if o.HealthCheckInterval <= 0 {
+		o.HealthCheckInterval = DefaultKeyspaceHealthCheck
+	}
+	if o.NodeRefreshInterval <= 0 {
+		o.NodeRefreshInterval = DefaultKeyspaceNodeRefresh
+	}
+	if o.ReconnectBackoff <= 0 {
+		o.ReconnectBackoff = defaultKeyspaceReconnectMin
+	}
+	if o.MaxReconnectBackoff < o.ReconnectBackoff {
+		o.MaxReconnectBackoff = defaultKeyspaceReconnectMax
+		if o.MaxReconnectBackoff < o.ReconnectBackoff {
+			o.MaxReconnectBackoff = o.ReconnectBackoff
+		}
+	}
+}
+
+// KeyspaceListener 订阅 keyevent 频道并回调, 连接断开后自动重连, 集群模式下订阅全部主节点
+type KeyspaceListener struct {
+	r        *ModelRedisHandler
+	opts     KeyspaceListenerOptions
+	handler  KeyspaceHandler
+	channels []string
+	flags    string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	nodes  map[string]context.CancelFunc
+}
+
+// ListenKeyspace 开始监听 keyevent 通知, 初次订阅失败时返回错误, 之后的断线由后台重连
+func (r *ModelRedisHandler) ListenKeyspace(opts KeyspaceListenerOptions, handler KeyspaceHandler) (*KeyspaceListener, error) {
+	if handler == nil {
+		return nil, errors.New("KeyspaceHandler 不能为空")
+	}
+	opts.setDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &KeyspaceListener{
+		r:       r,
+		opts:    opts,
+		handler: handler,
+		flags:   keyspaceNotifyFlags(opts.Events),
+		ctx:     ctx,
+		cancel:  cancel,
+		nodes:   make(map[string]context.CancelFunc),
+	}
+	for _, event := range opts.Events {
+		l.channels = append(l.channels, fmt.Sprintf("__keyevent@%d__:%s", opts.DB, event))
+	}
+	if !r.Enable {
+		return l, nil
+	}
+
+	if !r.IsCluster && !r.isRing() {
+		ps, err := l.subscribe(ctx, r.RedisClient)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		l.startNode(r.Host, r.RedisClient, ps)
+		return l, nil
+	}
+
+	var mu sync.Mutex
+	err := r.forEachNode(ctx, func(ctx context.Context, client *redis.Client) error {
+		ps, err := l.subscribe(l.ctx, client)
+		if err != nil {
+			return fmt.Errorf("%s: %w", client.Options().Addr, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		l.startNode(client.Options().Addr, client, ps)
+		return nil
+	})
+	if err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	l.wg.Add(1)
+	go l.refreshNodes()
+	return l, nil
+}
+
+// Nodes 当前订阅中的节点地址
+func (l *KeyspaceListener) Nodes() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	nodes := make([]string, 0, len(l.nodes))
+	for node := range l.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// Close 停止监听并等待所有回调返回
+func (l *KeyspaceListener) Close() error {
+	l.cancel()
+	l.wg.Wait()
+	return nil
+}
+
+// keyspaceNotifyFlags 监听 events 所需的 notify-keyspace-events 配置
+func keyspaceNotifyFlags(events []string) string {
+	flags := "E"
+	for _, event := range events {
+		class, ok := keyEventClasses[event]
+		if !ok {
+			class = 'A'
+		}
+		if !strings.ContainsRune(flags, rune(class)) {
+			flags += string(class)
+		}
+	}
+	return flags
+}
+
+// mergeNotifyFlags 将 required 合并到已有的 notify-keyspace-events 配置中, 已包含时返回 false
+func mergeNotifyFlags(current, required string) (string, bool) {
+	merged, changed := current, false
+	for _, flag := range required {
+		if strings.ContainsRune(merged, flag) {
+			continue
+		}
+		if flag != 'A' && strings.ContainsRune(merged, 'A') && strings.ContainsRune("g$lshzxet", flag) {
+			continue
+		}
+		merged += string(flag)
+		changed = true
+	}
+	return merged, changed
+}
+
+func (l *KeyspaceListener) enableNotifications(ctx context.Context, client *redis.Client) error {
+	config, err := client.ConfigGet(ctx, notifyKeyspaceEventsConfigName).Result()
+	if err != nil {
+		return err
+	}
+	merged, changed := mergeNotifyFlags(config[notifyKeyspaceEventsConfigName], l.flags)
+	if !changed {
+		return nil
+	}
+	return client.ConfigSet(ctx, notifyKeyspaceEventsConfigName, merged).Err()
+}
+
+// subscribe 开启通知 (可选) 并订阅 keyevent 频道, 收到全部订阅确认后返回
+func (l *KeyspaceListener) subscribe(ctx context.Context, client *redis.Client) (*redis.PubSub, error) {
+	if l.opts.EnableNotifications {
+		if err := l.enableNotifications(ctx, client); err != nil {
+			return nil, fmt.Errorf("开启 keyspace 通知失败: %w", err)
+		}
+	}
+	ps := client.Subscribe(ctx, l.channels...)
+	for range l.channels {
+		if _, err := ps.ReceiveTimeout(ctx, l.opts.HealthCheckInterval); err != nil {
+			_ = ps.Close()
+			return nil, fmt.Errorf("订阅 keyevent 频道失败: %w", err)
+		}
+	}
+	return ps, nil
+}
+
+func (l *KeyspaceListener) startNode(node string, client *redis.Client, ps *redis.PubSub) {
+	ctx, cancel := context.WithCancel(l.ctx)
+	l.mu.Lock()
+	l.nodes[node] = cancel
+	l.mu.Unlock()
+	l.wg.Add(1)
+	go l.runNode(ctx, node, client, ps)
+}
+
+func (l *KeyspaceListener) stopNode(node string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cancel, ok := l.nodes[node]; ok {
+		cancel()
+		delete(l.nodes, node)
+	}
+}
+
+// runNode 消费单个节点的通知, 断线后按退避时间重新订阅
+func (l *KeyspaceListener) runNode(ctx context.Context, node string, client *redis.Client, ps *redis.PubSub) {
+	defer l.wg.Done()
+	backoff := l.opts.ReconnectBackoff
+	for {
+		if ps != nil {
+			err := l.consume(ctx, node, ps)
+			_ = ps.Close()
+			if ctx.Err() != nil {
+				return
+			}
+			Logger.Warn(GetLogPrefix("") + "Redis keyspace 订阅断开! 节点: " + node + " 错误原因: " + err.Error())
+			backoff = l.opts.ReconnectBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		var err error
+		if ps, err = l.subscribe(ctx, client); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			Logger.Warn(GetLogPrefix("") + "Redis keyspace 重新订阅失败! 节点: " + node + " 错误原因: " + err.Error())
+			if backoff *= 2; backoff > l.opts.MaxReconnectBackoff {
+				backoff = l.opts.MaxReconnectBackoff
+			}
+			continue
+		}
+		Logger.Info(GetLogPrefix("") + "Redis keyspace 重新订阅成功! 节点: " + node)
+	}
+}
+
+// consume 读取通知直到连接出错或 ctx 结束
+func (l *KeyspaceListener) consume(ctx context.Context, node string, ps *redis.PubSub) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// 关闭 PubSub 以唤醒阻塞中的读取
+			_ = ps.Close()
+		case <-stop:
+		}
+	}()
+
+	pingPending := false
+	for {
+		msg, err := ps.ReceiveTimeout(ctx, l.opts.HealthCheckInterval)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !pingPending {
+				if err = ps.Ping(ctx); err == nil {
+					pingPending = true
+					continue
+				}
+			}
+			return err
+		}
+		pingPending = false
+		if m, ok := msg.(*redis.Message); ok {
+			l.dispatch(node, m)
+		}
+	}
+}
+
+func (l *KeyspaceListener) dispatch(node string, msg *redis.Message) {
+	prefix, event, ok := strings.Cut(msg.Channel, "__:")
+	if !ok {
+		return
+	}
+	if len(l.opts.Patterns) > 0 {
+		matched := false
+		for _, pattern := range l.opts.Patterns {
+			if matchRedisPattern(pattern, msg.Payload) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return
+		}
+	}
+	db, _ := strconv.Atoi(strings.TrimPrefix(prefix, "__keyevent@"))
+	defer func() {
+		if err := recover(); err != nil {
+			Logger.Error(GetLogPrefix("") + fmt.Sprintf("Redis keyspace 回调 panic! 事件: %s key: %s 错误原因: %v", event, msg.Payload, err))
+		}
+	}()
+	l.handler(KeyspaceEvent{Event: event, Key: msg.Payload, DB: db, Node: node, Time: time.Now()})
+}
+
+// refreshNodes 集群/分片模式下定期对比主节点 (存活分片) 列表, 订阅新的节点并停止已下线的节点
+func (l *KeyspaceListener) refreshNodes() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.opts.NodeRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		masters := make(map[string]*redis.Client)
+		var mu sync.Mutex
+		err := l.r.forEachNode(l.ctx, func(ctx context.Context, client *redis.Client) error {
+			mu.Lock()
+			masters[client.Options().Addr] = client
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			Logger.Warn(GetLogPrefix("") + "Redis keyspace 获取集群主节点失败! 错误原因: " + err.Error())
+			continue
+		}
+		for _, node := range l.Nodes() {
+			if _, ok := masters[node]; !ok {
+				Logger.Info(GetLogPrefix("") + "Redis keyspace 节点已不是主节点, 停止订阅: " + node)
+				l.stopNode(node)
+			}
+		}
+		for node, client := range masters {
+			l.mu.Lock()
+			_, exists := l.nodes[node]
+			l.mu.Unlock()
+			if !exists {
+				Logger.Info(GetLogPrefix("") + "Redis keyspace 发现新的主节点, 开始订阅: " + node)
+				// 由 runNode 负责订阅与重试
+				l.startNode(node, client, nil)
+			}
+		}
+	}
+}
+
+// matchRedisPattern 按 Redis 的 glob 规则匹配 key, 支持 * ? [abc] [^a] [a-z] 与 \ 转义
+func matchRedisPattern(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchRedisPattern(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				return pattern == s
+			}
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if s[0] >= class[i] && s[0] <= class[i+2] {
+						matched = true
+					}
+					i += 2
+					continue
+				}
+				if class[i] == s[0] {
+					matched = true
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[end+2:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,80 @@
+package go_toolbox
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMergeNotifyFlags(t *testing.T) {
+	flags := keyspaceNotifyFlags([]string{KeyEventExpired, KeyEventDel, KeyEventExpire, "custom"})
+	if flags != "ExgA" {
+		t.Fatalf("unexpected flags: %s", flags)
+	}
+	if merged, changed := mergeNotifyFlags("KEA", "Exg"); changed || merged != "KEA" {
+		t.Fatalf("A already covers x and g: %s %v", merged, changed)
+	}
+	if merged, changed := mergeNotifyFlags("Kl", "Ex"); !changed || merged != "KlEx" {
+		t.Fatalf("unexpected merge: %s %v", merged, changed)
+	}
+}
+
+func TestKeyspaceListener(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+
+	events := make(chan KeyspaceEvent, 10)
+	listener, err := redisHandler.ListenKeyspace(KeyspaceListenerOptions{
+		Events:              []string{KeyEventExpired, KeyEventDel},
+		Patterns:            []string{"session:*", "lock:*"},
+		EnableNotifications: true,
+		HealthCheckInterval: 20 * time.Millisecond,
+		ReconnectBackoff:    10 * time.Millisecond,
+	}, func(event KeyspaceEvent) {
+		events <- event
+	})
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer listener.Close()
+	if flags := redisHandler.RedisClient.ConfigGet(ctx, "notify-keyspace-events").Val()["notify-keyspace-events"]; flags != "Exg" {
+		t.Fatalf("notifications should be enabled, got %q", flags)
+	}
+
+	redisHandler.Set("session:1", "a", 10)
+	redisHandler.Set("cache:1", "b", 10)
+	redisHandler.FastForward(11 * time.Second)
+	expectKeyspaceEvent(t, events, KeyEventExpired, "session:1")
+
+	// 断线后自动重新订阅
+	redisHandler.DropConnections()
+	deadline := time.Now().Add(2 * time.Second)
+	// probe 不匹配 Patterns, 不会触发回调
+	for redisHandler.RedisClient.Publish(ctx, "__keyevent@0__:del", "probe").Val() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("listener did not resubscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	redisHandler.Set("lock:1", "x", 0)
+	redisHandler.RedisClient.Del(ctx, "lock:1")
+	expectKeyspaceEvent(t, events, KeyEventDel, "lock:1")
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event: %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func expectKeyspaceEvent(t *testing.T, events <-chan KeyspaceEvent, event, key string) {
+	t.Helper()
+	select {
+	case got := <-events:
+		if got.Event != event || got.Key != key || got.Node != "fake-redis:6379" {
+			t.Fatalf("unexpected event: %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %s %s", event, key)
+	}
+}
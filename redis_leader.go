@@ -0,0 +1,298 @@
+package go_toolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultLeaderLeaseTTL = 15 * time.Second
+)
+
+// LeaderElectionOptions 选主配置
+type LeaderElectionOptions struct {
+	// Key 选主使用的 key, 必填, 值为当前 Leader 的 Identity
+	Key string
+	// Identity 当前实例的标识, 默认为 主机名-进程号-随机数
+	Identity string
+	// LeaseTTL 租约时长, Leader 失联超过该时间后其他实例可以接任, 默认 15 秒
+	LeaseTTL time.Duration
+	// RenewInterval Leader 续约与 Follower 竞选的间隔, 默认 LeaseTTL/3
+	RenewInterval time.Duration
+	// ObserveOnly 只观察当前 Leader, 不参与竞选
+	ObserveOnly bool
+	// OnElected 成为 Leader 时在新的 goroutine 中调用, ctx 在失去 Leader 身份时取消
+	OnElected func(ctx context.Context)
+	// OnLost 失去 Leader 身份 (续约失败, 被抢占或主动退出) 时调用
+	OnLost func()
+	// OnLeaderChange 观察到的 Leader 发生变化时调用, 没有 Leader 时为空字符串
+	OnLeaderChange func(identity string)
+}
+
+// LeaderElector 基于 Redis 租约的选主
+// Leader 按 RenewInterval 续约, 续约请求失败时以本地租约到期时间为准主动放弃身份,
+// 本地到期时间从发起续约的时刻计算并预留 LeaseTTL/10 的余量, 因此总是早于 Redis 中的 key 过期, 不会出现两个 Leader 同时工作
+type LeaderElector struct {
+	r    *ModelRedisHandler
+	opts LeaderElectionOptions
+
+	mu           sync.Mutex
+	leader       string
+	isLeader     bool
+	leaseExpires time.Time
+	leaderCancel context.CancelFunc
+	stop         context.CancelFunc
+	done         chan struct{}
+}
+
+// NewLeaderElector 创建选主组件, 调用 Start 后开始竞选
+func (r *ModelRedisHandler) NewLeaderElector(opts LeaderElectionOptions) (*LeaderElector, error) {
+	if opts.Key == "" {
+		return nil, errors.New("选主 Key 不能为空")
+	}
+	if !r.Enable {
+		return nil, errors.New("Redis 未启用, 无法选主")
+	}
+	if opts.Identity == "" {
+		hostname, _ := os.Hostname()
+		opts.Identity = fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), rand.Int63())
+	}
+	if opts.LeaseTTL <= 0 {
+		opts.LeaseTTL = DefaultLeaderLeaseTTL
+	}
+	if opts.RenewInterval <= 0 || opts.RenewInterval >= opts.LeaseTTL {
+		opts.RenewInterval = opts.LeaseTTL / 3
+	}
+	return &LeaderElector{r: r, opts: opts}, nil
+}
+
+// Identity 当前实例的标识
+func (e *LeaderElector) Identity() string {
+	return e.opts.Identity
+}
+
+// Start 启动后台竞选 (或观察) 循环
+func (e *LeaderElector) Start() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stop != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.stop = cancel
+	e.done = make(chan struct{})
+	go e.run(ctx)
+}
+
+// IsLeader 当前实例是否为 Leader
+func (e *LeaderElector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.isLeader && time.Now().Before(e.leaseExpires)
+}
+
+// Leader 最近一次观察到的 Leader, 没有 Leader 时返回 false
+func (e *LeaderElector) Leader() (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader, e.leader != ""
+}
+
+// Resign 停止竞选, 当前为 Leader 时主动释放租约以便其他实例立即接任
+func (e *LeaderElector) Resign() {
+	e.mu.Lock()
+	stop, done := e.stop, e.done
+	e.stop = nil
+	e.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	stop()
+	<-done
+	if e.stepDown() {
+		ctx, cancel := context.WithTimeout(context.Background(), e.opts.RenewInterval)
+		defer cancel()
+		if err := e.release(ctx); err != nil {
+			Logger.Warn(GetLogPrefix("") + "选主释放租约失败! key: " + e.opts.Key + " 错误原因: " + err.Error())
+		}
+	}
+}
+
+func (e *LeaderElector) run(ctx context.Context) {
+	defer close(e.done)
+	for {
+		e.tick(ctx)
+		// Leader 在本地租约到期的时刻醒来, 保证到期后立即放弃身份
+		wait := e.opts.RenewInterval
+		e.mu.Lock()
+		if e.isLeader {
+			if untilExpiry := time.Until(e.leaseExpires); untilExpiry < wait {
+				wait = untilExpiry
+			}
+		}
+		e.mu.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (e *LeaderElector) tick(ctx context.Context) {
+	e.checkLease()
+	e.mu.Lock()
+	leading := e.isLeader
+	e.mu.Unlock()
+	start := time.Now()
+	reqCtx, cancel := context.WithTimeout(ctx, e.opts.RenewInterval)
+	defer cancel()
+	switch {
+	case leading:
+		renewed, err := e.renew(reqCtx)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				Logger.Warn(GetLogPrefix("") + "选主续约失败! key: " + e.opts.Key + " 错误原因: " + err.Error())
+			}
+			e.checkLease()
+		case renewed:
+			e.mu.Lock()
+			e.leaseExpires = e.localExpiry(start)
+			e.mu.Unlock()
+		default:
+			Logger.Warn(GetLogPrefix("") + "选主租约已被其他实例持有! key: " + e.opts.Key)
+			e.stepDown()
+			e.observe(reqCtx)
+		}
+	case !e.opts.ObserveOnly:
+		acquired, err := e.r.universalClient().SetNX(reqCtx, e.opts.Key, e.opts.Identity, e.opts.LeaseTTL).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				Logger.Warn(GetLogPrefix("") + "选主竞选失败! key: " + e.opts.Key + " 错误原因: " + err.Error())
+			}
+			return
+		}
+		if acquired {
+			e.elected(start)
+			return
+		}
+		// 本地租约到期但 Redis 中的 key 仍属于自己 (如续约延迟或以相同 Identity 重启), 直接续约
+		if e.observe(reqCtx) == e.opts.Identity {
+			if renewed, err := e.renew(reqCtx); err == nil && renewed {
+				e.elected(start)
+			}
+		}
+	default:
+		e.observe(reqCtx)
+	}
+}
+
+// renew 当前仍持有租约时续约
+func (e *LeaderElector) renew(ctx context.Context) (bool, error) {
+	renewed := false
+	err := e.r.Transaction(ctx, []string{e.opts.Key}, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		current, err := tx.Get(ctx, e.opts.Key).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		renewed = current == e.opts.Identity
+		if renewed {
+			pipe.PExpire(ctx, e.opts.Key, e.opts.LeaseTTL)
+		}
+		return nil
+	})
+	return renewed, err
+}
+
+// release 仍持有租约时删除 key
+func (e *LeaderElector) release(ctx context.Context) error {
+	return e.r.Transaction(ctx, []string{e.opts.Key}, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		current, err := tx.Get(ctx, e.opts.Key).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if current == e.opts.Identity {
+			pipe.Del(ctx, e.opts.Key)
+		}
+		return nil
+	})
+}
+
+// observe 读取当前 Leader, 请求失败时返回空字符串且不更新
+func (e *LeaderElector) observe(ctx context.Context) string {
+	leader, err := e.r.universalClient().Get(ctx, e.opts.Key).Result()
+	if err != nil && err != redis.Nil {
+		return ""
+	}
+	e.setLeader(leader)
+	return leader
+}
+
+// checkLease 无法访问 Redis 时, 本地租约到期后放弃 Leader 身份
+func (e *LeaderElector) checkLease() {
+	e.mu.Lock()
+	expired := e.isLeader && !time.Now().Before(e.leaseExpires)
+	e.mu.Unlock()
+	if expired {
+		Logger.Warn(GetLogPrefix("") + "选主本地租约到期, 放弃 Leader 身份! key: " + e.opts.Key)
+		e.stepDown()
+	}
+}
+
+func (e *LeaderElector) elected(start time.Time) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.mu.Lock()
+	e.isLeader = true
+	e.leaseExpires = e.localExpiry(start)
+	e.leaderCancel = cancel
+	e.mu.Unlock()
+	Logger.Info(GetLogPrefix("") + "选主成为 Leader! key: " + e.opts.Key + " identity: " + e.opts.Identity)
+	e.setLeader(e.opts.Identity)
+	if e.opts.OnElected != nil {
+		go e.opts.OnElected(ctx)
+	}
+}
+
+// localExpiry 从发起请求的时刻计算本地租约到期时间, 预留 LeaseTTL/10 的余量应对时钟误差
+func (e *LeaderElector) localExpiry(start time.Time) time.Time {
+	return start.Add(e.opts.LeaseTTL - e.opts.LeaseTTL/10)
+}
+
+// stepDown 放弃 Leader 身份, 之前为 Leader 时返回 true
+func (e *LeaderElector) stepDown() bool {
+	e.mu.Lock()
+	if !e.isLeader {
+		e.mu.Unlock()
+		return false
+	}
+	e.isLeader = false
+	cancel := e.leaderCancel
+	e.leaderCancel = nil
+	e.mu.Unlock()
+	cancel()
+	if e.opts.OnLost != nil {
+		e.opts.OnLost()
+	}
+	e.setLeader("")
+	return true
+}
+
+func (e *LeaderElector) setLeader(leader string) {
+	e.mu.Lock()
+	changed := e.leader != leader
+	e.leader = leader
+	e.mu.Unlock()
+	if changed && e.opts.OnLeaderChange != nil {
+		e.opts.OnLeaderChange(leader)
+	}
+}
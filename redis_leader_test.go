@@ -0,0 +1,96 @@
+package go_toolbox
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for " + what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	var elected, lost int32
+	var running int32
+	newElector := func(identity string, observeOnly bool) *LeaderElector {
+		elector, err := redisHandler.NewLeaderElector(LeaderElectionOptions{
+			Key: "scheduler:leader", Identity: identity, ObserveOnly: observeOnly,
+			LeaseTTL: 300 * time.Millisecond, RenewInterval: 30 * time.Millisecond,
+			OnElected: func(ctx context.Context) {
+				atomic.AddInt32(&elected, 1)
+				if atomic.AddInt32(&running, 1) > 1 {
+					t.Error("two leaders are running at the same time")
+				}
+				<-ctx.Done()
+				atomic.AddInt32(&running, -1)
+			},
+			OnLost: func() { atomic.AddInt32(&lost, 1) },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		elector.Start()
+		return elector
+	}
+
+	a := newElector("a", false)
+	waitFor(t, "a elected", a.IsLeader)
+	b := newElector("b", false)
+	observer := newElector("observer", true)
+	defer observer.Resign()
+	waitFor(t, "followers learn the leader", func() bool {
+		leader, _ := b.Leader()
+		observed, _ := observer.Leader()
+		return leader == "a" && observed == "a"
+	})
+	time.Sleep(400 * time.Millisecond)
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatal("renewal should keep the lease beyond its TTL")
+	}
+
+	// 模拟 Redis 故障: a 续约失败, 本地租约到期后放弃身份, 故障期间没有 Leader
+	redisHandler.SetDown(true)
+	waitFor(t, "a steps down", func() bool { return !a.IsLeader() })
+	if b.IsLeader() {
+		t.Fatal("no one can be elected while Redis is down")
+	}
+	// 恢复时旧租约已在 Redis 中过期, 由 a 或 b 中的一个接任
+	redisHandler.FastForward(300 * time.Millisecond)
+	redisHandler.SetDown(false)
+	waitFor(t, "a new leader elected", func() bool { return a.IsLeader() || b.IsLeader() })
+	leader, follower := a, b
+	if b.IsLeader() {
+		leader, follower = b, a
+	}
+	waitFor(t, "observer sees the new leader", func() bool {
+		observed, _ := observer.Leader()
+		return observed == leader.opts.Identity
+	})
+	time.Sleep(100 * time.Millisecond)
+	if follower.IsLeader() || !leader.IsLeader() {
+		t.Fatal("the other elector should stay a follower")
+	}
+
+	// Leader 主动退出后 Follower 立即接任, 无需等待租约过期
+	leader.Resign()
+	waitFor(t, "follower elected", follower.IsLeader)
+	follower.Resign()
+	if atomic.LoadInt32(&elected) != 3 || atomic.LoadInt32(&lost) != 3 {
+		t.Fatalf("unexpected callbacks: elected %d lost %d", elected, lost)
+	}
+	if redisHandler.RedisClient.Exists(context.Background(), "scheduler:leader").Val() != 0 {
+		t.Fatal("lease should be released on resign")
+	}
+}
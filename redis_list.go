@@ -0,0 +1,266 @@
+package go_toolbox
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 以下列表方法的错误语义一致: 出错时记录日志并返回 ok 为 false; key 不存在按空列表处理, ok 为 true
+// AppendList 为 LPUSH, 新元素在列表头部; 与之配合的 "最近 N 条" 列表见 ListPushCapped
+
+// ListLPush 将 values 依次插入列表头部, 返回插入后的长度
+func (r *ModelRedisHandler) ListLPush(key string, values ...interface{}) (int64, bool) {
+	return r.listPush("LPUSH", key, values)
+}
+
+// ListRPush 将 values 依次追加到列表尾部, 返回追加后的长度
+func (r *ModelRedisHandler) ListRPush(key string, values ...interface{}) (int64, bool) {
+	return r.listPush("RPUSH", key, values)
+}
+
+func (r *ModelRedisHandler) listPush(command, key string, values []interface{}) (int64, bool) {
+	if !r.Enable || len(values) == 0 {
+		return 0, true
+	}
+	var cmd *redis.IntCmd
+	if command == "LPUSH" {
+		cmd = r.universalClient().LPush(context.Background(), key, values...)
+	} else {
+		cmd = r.universalClient().RPush(context.Background(), key, values...)
+	}
+	if err := cmd.Err(); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " " + command + " 写入列表错误! key: " + key + " 错误原因: " + err.Error())
+		return 0, false
+	}
+	return cmd.Val(), true
+}
+
+// ListLPop 从列表头部弹出最多 count 个元素, 列表为空时返回空切片; count 大于 1 时需要 Redis 6.2 以上
+func (r *ModelRedisHandler) ListLPop(key string, count int) ([]string, bool) {
+	return r.listPop("LPOP", key, count)
+}
+
+// ListRPop 从列表尾部弹出最多 count 个元素, 列表为空时返回空切片; count 大于 1 时需要 Redis 6.2 以上
+func (r *ModelRedisHandler) ListRPop(key string, count int) ([]string, bool) {
+	return r.listPop("RPOP", key, count)
+}
+
+func (r *ModelRedisHandler) listPop(command, key string, count int) ([]string, bool) {
+	if !r.Enable || count <= 0 {
+		return nil, true
+	}
+	ctx := context.Background()
+	client := r.universalClient()
+	var (
+		values []string
+		err    error
+	)
+	switch {
+	case count == 1 && command == "LPOP":
+		values, err = popOne(client.LPop(ctx, key))
+	case count == 1:
+		values, err = popOne(client.RPop(ctx, key))
+	case command == "LPOP":
+		values, err = client.LPopCount(ctx, key, count).Result()
+	default:
+		values, err = client.RPopCount(ctx, key, count).Result()
+	}
+	if err == redis.Nil {
+		return nil, true
+	}
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " " + command + " 弹出列表错误! key: " + key + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	return values, true
+}
+
+func popOne(cmd *redis.StringCmd) ([]string, error) {
+	value, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+	return []string{value}, nil
+}
+
+// ListBLPop 阻塞地从 keys 中第一个非空列表的头部弹出一个元素, 返回所在的 key 与元素
+// 阻塞时间取自 ctx 的截止时间, 超时未弹出时 found 为 false, ok 为 true; 没有截止时间时一直阻塞 (取消 ctx 无法中断)
+// 客户端默认不按 ctx 设置读超时, 因此等待由 Redis 端的超时控制: 先按整秒阻塞, 不足一秒的部分以小数秒发送 (需要 Redis 6.0 以上)
+func (r *ModelRedisHandler) ListBLPop(ctx context.Context, keys ...string) (key, value string, found, ok bool) {
+	return r.listBlockingPop(ctx, "BLPOP", keys)
+}
+
+// ListBRPop 阻塞地从 keys 中第一个非空列表的尾部弹出一个元素, 语义同 ListBLPop
+func (r *ModelRedisHandler) ListBRPop(ctx context.Context, keys ...string) (key, value string, found, ok bool) {
+	return r.listBlockingPop(ctx, "BRPOP", keys)
+}
+
+func (r *ModelRedisHandler) listBlockingPop(ctx context.Context, command string, keys []string) (string, string, bool, bool) {
+	if !r.Enable || len(keys) == 0 {
+		return "", "", false, true
+	}
+	if err := r.checkSameSlot(keys...); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " " + command + " 错误! " + err.Error())
+		return "", "", false, false
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	for {
+		var timeout time.Duration
+		if hasDeadline {
+			// 不足 1 毫秒时按超时处理, 否则格式化后的 0 会让 Redis 一直阻塞
+			if timeout = time.Until(deadline); timeout < time.Millisecond {
+				return "", "", false, true
+			}
+		}
+		// Redis 在超时的同时弹出的元素仍会返回, 读取回复时不能受 ctx 截止时间的限制, 否则该元素会丢失
+		result, err := r.blockingPopOnce(withoutDeadline{ctx}, command, keys, timeout)
+		if err == redis.Nil {
+			if hasDeadline {
+				continue
+			}
+			return "", "", false, true
+		}
+		if err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " " + command + " 弹出列表错误! 错误原因: " + err.Error())
+			return "", "", false, false
+		}
+		if len(result) != 2 {
+			Logger.Error(GetLogPrefix("") + r.logName() + " " + command + " 返回格式错误!")
+			return "", "", false, false
+		}
+		return result[0], result[1], true, true
+	}
+}
+
+// blockingPopOnce 发送一次阻塞弹出, go-redis 的 BLPop/BRPop 只能以整秒传递超时 (并据此放宽读超时),
+// 不足一秒时改用 Do 发送小数秒, 此时仍在默认读超时之内
+func (r *ModelRedisHandler) blockingPopOnce(ctx context.Context, command string, keys []string, timeout time.Duration) ([]string, error) {
+	client := r.universalClient()
+	if timeout > 0 && timeout < time.Second {
+		args := make([]interface{}, 0, len(keys)+2)
+		args = append(args, command)
+		for _, key := range keys {
+			args = append(args, key)
+		}
+		args = append(args, strconv.FormatFloat(timeout.Seconds(), 'f', 3, 64))
+		return client.Do(ctx, args...).StringSlice()
+	}
+	timeout = timeout.Truncate(time.Second)
+	if command == "BLPOP" {
+		return client.BLPop(ctx, timeout, keys...).Result()
+	}
+	return client.BRPop(ctx, timeout, keys...).Result()
+}
+
+// withoutDeadline 保留 ctx 的值, 去掉截止时间, 阻塞命令的等待由发送给 Redis 的超时控制
+type withoutDeadline struct {
+	context.Context
+}
+
+func (withoutDeadline) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// ListLen 列表长度
+func (r *ModelRedisHandler) ListLen(key string) (int64, bool) {
+	if !r.Enable {
+		return 0, true
+	}
+	length, err := r.universalClient().LLen(context.Background(), key).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " LLEN 获取长度错误! key: " + key + " 错误原因: " + err.Error())
+		return 0, false
+	}
+	return length, true
+}
+
+// ListRem 删除列表中等于 value 的元素, count 大于 0 时从头部开始删除 count 个, 小于 0 时从尾部开始, 等于 0 时全部删除; 返回删除的个数
+func (r *ModelRedisHandler) ListRem(key string, count int64, value interface{}) (int64, bool) {
+	if !r.Enable {
+		return 0, true
+	}
+	removed, err := r.universalClient().LRem(context.Background(), key, count, value).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " LREM 删除错误! key: " + key + " 错误原因: " + err.Error())
+		return 0, false
+	}
+	return removed, true
+}
+
+// ListInsertBefore 在第一个等于 pivot 的元素之前插入 value, 返回插入后的长度; 未找到 pivot 时返回 -1, key 不存在时返回 0
+func (r *ModelRedisHandler) ListInsertBefore(key string, pivot, value interface{}) (int64, bool) {
+	return r.listInsert(key, "BEFORE", pivot, value)
+}
+
+// ListInsertAfter 在第一个等于 pivot 的元素之后插入 value, 返回值同 ListInsertBefore
+func (r *ModelRedisHandler) ListInsertAfter(key string, pivot, value interface{}) (int64, bool) {
+	return r.listInsert(key, "AFTER", pivot, value)
+}
+
+func (r *ModelRedisHandler) listInsert(key, op string, pivot, value interface{}) (int64, bool) {
+	if !r.Enable {
+		return 0, true
+	}
+	length, err := r.universalClient().LInsert(context.Background(), key, op, pivot, value).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " LINSERT 写入错误! key: " + key + " 错误原因: " + err.Error())
+		return 0, false
+	}
+	return length, true
+}
+
+// ListPos 第一个等于 value 的元素下标, 未找到时 found 为 false
+// args.Rank 为负数时从尾部开始查找, 为 n 时返回第 n 个匹配; args.MaxLen 限制最多比较的元素个数 (需要 Redis 6.0.6 以上)
+func (r *ModelRedisHandler) ListPos(key, value string, args redis.LPosArgs) (index int64, found, ok bool) {
+	if !r.Enable {
+		return 0, false, true
+	}
+	index, err := r.universalClient().LPos(context.Background(), key, value, args).Result()
+	if err == redis.Nil {
+		return 0, false, true
+	}
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " LPOS 查询错误! key: " + key + " 错误原因: " + err.Error())
+		return 0, false, false
+	}
+	return index, true, true
+}
+
+// ListPosAll 最多 count 个等于 value 的元素下标, count 为 0 时返回全部匹配
+func (r *ModelRedisHandler) ListPosAll(key, value string, count int64, args redis.LPosArgs) ([]int64, bool) {
+	if !r.Enable {
+		return nil, true
+	}
+	indexes, err := r.universalClient().LPosCount(context.Background(), key, value, count, args).Result()
+	if err != nil && err != redis.Nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " LPOS 查询错误! key: " + key + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	return indexes, true
+}
+
+// ListPushCapped "最近 N 条" 列表: 将 values 插入列表头部并裁剪为最多 maxLen 个元素,
+// LPUSH 与 LTRIM 在同一个 MULTI/EXEC 中一次往返完成, 其他客户端不会看到超长的列表; 读取时 GetList(key, 0, -1) 按从新到旧排列
+func (r *ModelRedisHandler) ListPushCapped(key string, maxLen int64, values ...interface{}) bool {
+	if !r.Enable || len(values) == 0 {
+		return true
+	}
+	if maxLen <= 0 {
+		Logger.Error(GetLogPrefix("") + r.logName() + " ListPushCapped 错误! maxLen 必须大于 0, 当前: " + strconv.FormatInt(maxLen, 10))
+		return false
+	}
+	ctx := context.Background()
+	_, err := r.universalClient().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, values...)
+		pipe.LTrim(ctx, key, 0, maxLen-1)
+		return nil
+	})
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " ListPushCapped 写入列表错误! key: " + key + " 错误原因: " + err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package go_toolbox
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisListAPI(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	if n, ok := redisHandler.ListRPush("l", "a", "b", "c", "b", "d"); !ok || n != 5 {
+		t.Fatalf("unexpected length %d", n)
+	}
+	if n, ok := redisHandler.ListLPush("l", "z"); !ok || n != 6 {
+		t.Fatalf("unexpected length %d", n)
+	}
+	if index, found, ok := redisHandler.ListPos("l", "b", redis.LPosArgs{}); !ok || !found || index != 2 {
+		t.Fatalf("unexpected LPOS %d %v", index, found)
+	}
+	if index, found, _ := redisHandler.ListPos("l", "b", redis.LPosArgs{Rank: -1}); !found || index != 4 {
+		t.Fatalf("negative rank should search from the tail, got %d", index)
+	}
+	if _, found, ok := redisHandler.ListPos("l", "missing", redis.LPosArgs{}); !ok || found {
+		t.Fatal("missing element should not be found")
+	}
+	if indexes, ok := redisHandler.ListPosAll("l", "b", 0, redis.LPosArgs{}); !ok || !reflect.DeepEqual(indexes, []int64{2, 4}) {
+		t.Fatalf("unexpected LPOS COUNT %v", indexes)
+	}
+	if n, ok := redisHandler.ListInsertAfter("l", "c", "c2"); !ok || n != 7 {
+		t.Fatalf("unexpected LINSERT length %d", n)
+	}
+	if n, _ := redisHandler.ListInsertBefore("l", "missing", "x"); n != -1 {
+		t.Fatalf("missing pivot should return -1, got %d", n)
+	}
+	if removed, ok := redisHandler.ListRem("l", 0, "b"); !ok || removed != 2 {
+		t.Fatalf("unexpected LREM count %d", removed)
+	}
+	if values, ok := redisHandler.GetList("l", 0, -1); !ok || !reflect.DeepEqual(values, []string{"z", "a", "c", "c2", "d"}) {
+		t.Fatalf("unexpected list %v", values)
+	}
+	if values, ok := redisHandler.ListLPop("l", 2); !ok || !reflect.DeepEqual(values, []string{"z", "a"}) {
+		t.Fatalf("unexpected LPOP %v", values)
+	}
+	if values, ok := redisHandler.ListRPop("l", 1); !ok || !reflect.DeepEqual(values, []string{"d"}) {
+		t.Fatalf("unexpected RPOP %v", values)
+	}
+	if n, ok := redisHandler.ListLen("l"); !ok || n != 2 {
+		t.Fatalf("unexpected LLEN %d", n)
+	}
+	if values, ok := redisHandler.ListLPop("empty", 3); !ok || len(values) != 0 {
+		t.Fatalf("popping a missing list should return nothing, got %v", values)
+	}
+	redisHandler.Set("str", "v", 0)
+	if _, ok := redisHandler.ListLen("str"); ok {
+		t.Fatal("WRONGTYPE should be reported")
+	}
+}
+
+func TestRedisListBlockingPop(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	redisHandler.ListRPush("jobs:low", "j1")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if key, value, found, ok := redisHandler.ListBLPop(ctx, "jobs:high", "jobs:low"); !ok || !found || key != "jobs:low" || value != "j1" {
+		t.Fatalf("unexpected BLPOP %s %s %v %v", key, value, found, ok)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		redisHandler.ListRPush("jobs:high", "j2", "j3")
+	}()
+	if key, value, found, _ := redisHandler.ListBRPop(ctx, "jobs:high", "jobs:low"); !found || key != "jobs:high" || value != "j3" {
+		t.Fatalf("BRPOP should wake up on push, got %s %s %v", key, value, found)
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+	start := time.Now()
+	if _, _, found, ok := redisHandler.ListBLPop(short, "jobs:empty"); !ok || found {
+		t.Fatalf("BLPOP should time out without error, found=%v ok=%v", found, ok)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Fatalf("BLPOP should honour the context deadline, took %v", elapsed)
+	}
+	// 超时的阻塞命令不能在之后弹出元素
+	time.Sleep(20 * time.Millisecond)
+	redisHandler.ListRPush("jobs:empty", "j4")
+	time.Sleep(20 * time.Millisecond)
+	if n, _ := redisHandler.ListLen("jobs:empty"); n != 1 {
+		t.Fatalf("an abandoned BLPOP must not consume elements, length %d", n)
+	}
+}
+
+func TestRedisListPushCapped(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	for _, item := range []string{"a", "b", "c", "d"} {
+		if !redisHandler.ListPushCapped("recent", 3, item) {
+			t.Fatal("ListPushCapped failed")
+		}
+	}
+	if values, _ := redisHandler.GetList("recent", 0, -1); !reflect.DeepEqual(values, []string{"d", "c", "b"}) {
+		t.Fatalf("unexpected recent items %v", values)
+	}
+	if redisHandler.ListPushCapped("recent", 0, "x") {
+		t.Fatal("maxLen must be positive")
+	}
+}
+
+// delayBlockingPop 延迟发送 BLPOP, 使 Redis 端的超时晚于 ctx 的截止时间
+type delayBlockingPop struct {
+	delay time.Duration
+}
+
+func (h delayBlockingPop) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h delayBlockingPop) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == "blpop" {
+			time.Sleep(h.delay)
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h delayBlockingPop) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestRedisListBlockingPopAtDeadline(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	redisHandler.addHook(delayBlockingPop{delay: 40 * time.Millisecond})
+	// 按 ctx 设置读超时时, 截止时间之后才到达的回复同样需要读取
+	redisHandler.RedisClient.Options().ContextTimeoutEnabled = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	go func() {
+		time.Sleep(120 * time.Millisecond)
+		redisHandler.ListRPush("jobs:late", "j1")
+	}()
+	if _, value, found, ok := redisHandler.ListBLPop(ctx, "jobs:late"); !ok || !found || value != "j1" {
+		t.Fatalf("an element popped by Redis after the deadline must be returned, got %q found=%v ok=%v", value, found, ok)
+	}
+}
@@ -0,0 +1,573 @@
+package go_toolbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 导入文件格式
+const (
+	BulkLoadCSV   = "csv"
+	BulkLoadJSONL = "jsonl"
+)
+
+// 写入的数据类型
+const (
+	BulkLoadString = "string"
+	BulkLoadHash   = "hash"
+	BulkLoadSet    = "set"
+	BulkLoadZSet   = "zset"
+)
+
+const (
+	DefaultBulkLoadBatchSize        = 500
+	DefaultBulkLoadConcurrency      = 4
+	DefaultBulkLoadProgressInterval = time.Second
+	maxBulkLoadErrors               = 100
+)
+
+// ErrBulkLoadTooManyErrors 失败的行数超过 MaxErrors, 导入已中止
+var ErrBulkLoadTooManyErrors = errors.New("导入失败的行数超过上限, 已中止")
+
+// BulkLoadMapping 每条记录按映射写入一个 key, 一条记录可以对应多个映射 (例如写入哈希并加入索引集合)
+// Key, Value, Fields 的值, Member 与 Score 均为模板, ${列名} 替换为该列的值, 其余部分原样保留
+//
+//	{Key: "user:${id}", Type: BulkLoadHash, Fields: map[string]string{"name": "${name}"}}
+//	{Key: "city:${city}:users", Type: BulkLoadZSet, Member: "${id}", Score: "${age}"}
+type BulkLoadMapping struct {
+	Key  string
+	Type string
+	// Value string 类型写入的值
+	Value string
+	// Fields hash 类型的字段名到值模板的映射, 为空时写入记录的全部列
+	Fields map[string]string
+	// Member set/zset 的成员
+	Member string
+	// Score zset 的分数, 需为数字
+	Score string
+	// TTL 写入后设置的过期时间, 0 表示不过期
+	TTL time.Duration
+}
+
+// BulkLoadOptions 批量导入参数
+type BulkLoadOptions struct {
+	// Format BulkLoadCSV 或 BulkLoadJSONL
+	Format   string
+	Mappings []BulkLoadMapping
+	// Columns CSV 的列名, 为空时以第一行作为表头
+	Columns []string
+	// Comma CSV 分隔符, 默认逗号
+	Comma rune
+	// BatchSize 每个 Pipeline 包含的记录数, 默认 500
+	BatchSize int
+	// Concurrency 并发执行的 Pipeline 数量, 默认 4
+	Concurrency int
+	// RecordsPerSecond 限速, <=0 表示不限速
+	RecordsPerSecond int
+	// MaxErrors 失败的行数超过该值时中止导入, <=0 表示不限制
+	MaxErrors int64
+	// OnProgress 按 ProgressInterval (默认 1 秒) 回调进度, 导入结束时再回调一次
+	OnProgress       func(BulkLoadProgress)
+	ProgressInterval time.Duration
+}
+
+// BulkLoadProgress 导入进度, Throughput 为每秒写入的记录数
+type BulkLoadProgress struct {
+	Lines      int64
+	Loaded     int64
+	Failed     int64
+	Elapsed    time.Duration
+	Throughput float64
+}
+
+// BulkLoadError 一行记录的错误, Line 为记录在文件中的行号 (从 1 开始)
+type BulkLoadError struct {
+	Line int64
+	Err  error
+}
+
+func (e BulkLoadError) Error() string {
+	return fmt.Sprintf("第 %d 行: %v", e.Line, e.Err)
+}
+
+// BulkLoadReport 导入结果, Errors 最多保留前 100 条
+type BulkLoadReport struct {
+	BulkLoadProgress
+	Errors []BulkLoadError
+}
+
+// BulkLoader 将 CSV / JSON Lines 通过 Pipeline 批量写入 Redis
+type BulkLoader struct {
+	r    *ModelRedisHandler
+	opts BulkLoadOptions
+
+	mu       sync.Mutex
+	start    time.Time
+	progress BulkLoadProgress
+	errs     []BulkLoadError
+	limiter  *rateLimiter
+	abort    context.CancelFunc
+}
+
+type bulkLoadRecord struct {
+	line   int64
+	values map[string]string
+}
+
+// NewBulkLoader 创建批量导入工具, 映射配置有误时返回错误
+func NewBulkLoader(r *ModelRedisHandler, opts BulkLoadOptions) (*BulkLoader, error) {
+	if opts.Format != BulkLoadCSV && opts.Format != BulkLoadJSONL {
+		return nil, fmt.Errorf("不支持的导入格式 %q", opts.Format)
+	}
+	if len(opts.Mappings) == 0 {
+		return nil, errors.New("导入映射不能为空")
+	}
+	for i, mapping := range opts.Mappings {
+		if mapping.Key == "" {
+			return nil, fmt.Errorf("第 %d 个映射的 Key 不能为空", i+1)
+		}
+		switch mapping.Type {
+		case BulkLoadString, BulkLoadHash:
+		case BulkLoadSet:
+			if mapping.Member == "" {
+				return nil, fmt.Errorf("第 %d 个映射缺少 Member", i+1)
+			}
+		case BulkLoadZSet:
+			if mapping.Member == "" || mapping.Score == "" {
+				return nil, fmt.Errorf("第 %d 个映射缺少 Member 或 Score", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("第 %d 个映射的类型 %q 不支持", i+1, mapping.Type)
+		}
+	}
+	if opts.Comma == 0 {
+		opts.Comma = ','
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBulkLoadBatchSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultBulkLoadConcurrency
+	}
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = DefaultBulkLoadProgressInterval
+	}
+	return &BulkLoader{r: r, opts: opts}, nil
+}
+
+// Load 读取 src 并写入 Redis, 单行的错误记录在结果中并继续导入;
+// 读取失败, ctx 取消或失败行数超过 MaxErrors 时返回错误, 结果中为已完成部分的统计
+func (l *BulkLoader) Load(ctx context.Context, src io.Reader) (BulkLoadReport, error) {
+	if !l.r.Enable {
+		return BulkLoadReport{}, errors.New("Redis 未启用")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	l.mu.Lock()
+	l.start = time.Now()
+	l.progress = BulkLoadProgress{}
+	l.errs = nil
+	l.limiter = newRateLimiter(l.opts.RecordsPerSecond)
+	l.abort = cancel
+	l.mu.Unlock()
+
+	batches := make(chan []bulkLoadRecord, l.opts.Concurrency)
+	var workers sync.WaitGroup
+	for i := 0; i < l.opts.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for batch := range batches {
+				l.writeBatch(ctx, batch)
+			}
+		}()
+	}
+	stopProgress := make(chan struct{})
+	progressDone := make(chan struct{})
+	go l.reportProgress(stopProgress, progressDone)
+
+	var readErr error
+	if l.opts.Format == BulkLoadCSV {
+		readErr = l.readCSV(ctx, src, batches)
+	} else {
+		readErr = l.readJSONL(ctx, src, batches)
+	}
+	close(batches)
+	workers.Wait()
+	close(stopProgress)
+	<-progressDone
+
+	report := l.report()
+	Logger.Info(GetLogPrefix("") + fmt.Sprintf("Redis 批量导入结束: 读取 %d 行, 写入 %d, 失败 %d, 耗时 %v, %.0f 条/秒",
+		report.Lines, report.Loaded, report.Failed, report.Elapsed, report.Throughput))
+	switch {
+	case l.opts.MaxErrors > 0 && report.Failed > l.opts.MaxErrors:
+		return report, ErrBulkLoadTooManyErrors
+	case readErr != nil:
+		return report, readErr
+	}
+	return report, ctx.Err()
+}
+
+func (l *BulkLoader) readCSV(ctx context.Context, src io.Reader, batches chan<- []bulkLoadRecord) error {
+	reader := csv.NewReader(src)
+	reader.Comma = l.opts.Comma
+	columns := l.opts.Columns
+	if len(columns) == 0 {
+		header, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("CSV 表头读取失败: %w", err)
+		}
+		columns = header
+	}
+	reader.FieldsPerRecord = len(columns)
+	batch := make([]bulkLoadRecord, 0, l.opts.BatchSize)
+	for ctx.Err() == nil {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return fmt.Errorf("CSV 读取失败: %w", err)
+			}
+			l.countLine()
+			l.fail(int64(parseErr.StartLine), parseErr.Err)
+			continue
+		}
+		l.countLine()
+		line, _ := reader.FieldPos(0)
+		values := make(map[string]string, len(columns))
+		for i, column := range columns {
+			values[column] = fields[i]
+		}
+		batch = append(batch, bulkLoadRecord{line: int64(line), values: values})
+		if len(batch) == l.opts.BatchSize {
+			if !l.send(ctx, batches, batch) {
+				break
+			}
+			batch = make([]bulkLoadRecord, 0, l.opts.BatchSize)
+		}
+	}
+	if len(batch) > 0 {
+		l.send(ctx, batches, batch)
+	}
+	return nil
+}
+
+func (l *BulkLoader) readJSONL(ctx context.Context, src io.Reader, batches chan<- []bulkLoadRecord) error {
+	reader := bufio.NewReader(src)
+	batch := make([]bulkLoadRecord, 0, l.opts.BatchSize)
+	var line int64
+	for ctx.Err() == nil {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("JSONL 读取失败: %w", err)
+		}
+		eof := err == io.EOF
+		line++
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			l.countLine()
+			values, decodeErr := decodeBulkLoadJSON(data)
+			if decodeErr != nil {
+				l.fail(line, decodeErr)
+			} else {
+				batch = append(batch, bulkLoadRecord{line: line, values: values})
+			}
+		}
+		if len(batch) == l.opts.BatchSize {
+			if !l.send(ctx, batches, batch) {
+				break
+			}
+			batch = make([]bulkLoadRecord, 0, l.opts.BatchSize)
+		}
+		if eof {
+			break
+		}
+	}
+	if len(batch) > 0 {
+		l.send(ctx, batches, batch)
+	}
+	return nil
+}
+
+// decodeBulkLoadJSON 将一行 JSON 对象转换为列: 数字保持原始文本, 嵌套的对象与数组保存为 JSON, null 视为缺失
+func decodeBulkLoadJSON(data []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("JSON 解析失败: %w", err)
+	}
+	if object == nil {
+		return nil, errors.New("JSON 行必须是对象")
+	}
+	values := make(map[string]string, len(object))
+	for name, value := range object {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			values[name] = v
+		case json.Number:
+			values[name] = v.String()
+		case bool:
+			values[name] = strconv.FormatBool(v)
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			values[name] = string(encoded)
+		}
+	}
+	return values, nil
+}
+
+func (l *BulkLoader) send(ctx context.Context, batches chan<- []bulkLoadRecord, batch []bulkLoadRecord) bool {
+	select {
+	case batches <- batch:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// writeBatch 将一批记录写入同一个 Pipeline, 按命令结果统计每一行
+func (l *BulkLoader) writeBatch(ctx context.Context, batch []bulkLoadRecord) {
+	type pending struct {
+		line int64
+		cmds []*redis.Cmd
+	}
+	pipe := l.r.universalClient().Pipeline()
+	queued := make([]pending, 0, len(batch))
+	for _, record := range batch {
+		commands, err := l.commands(record.values)
+		if err != nil {
+			l.fail(record.line, err)
+			continue
+		}
+		p := pending{line: record.line, cmds: make([]*redis.Cmd, len(commands))}
+		for i, args := range commands {
+			p.cmds[i] = pipe.Do(ctx, args...)
+		}
+		queued = append(queued, p)
+	}
+	if len(queued) == 0 {
+		return
+	}
+	if err := l.limiter.wait(ctx, len(queued)); err != nil {
+		return
+	}
+	_, _ = pipe.Exec(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	for _, p := range queued {
+		var cmdErr error
+		for _, cmd := range p.cmds {
+			if err := cmd.Err(); err != nil && err != redis.Nil {
+				cmdErr = err
+				break
+			}
+		}
+		if cmdErr != nil {
+			l.fail(p.line, cmdErr)
+			continue
+		}
+		l.mu.Lock()
+		l.progress.Loaded++
+		l.mu.Unlock()
+	}
+}
+
+// commands 按映射生成一条记录的全部命令, 任一映射出错时整条记录不写入
+func (l *BulkLoader) commands(values map[string]string) ([][]interface{}, error) {
+	var commands [][]interface{}
+	for _, mapping := range l.opts.Mappings {
+		key, err := expandBulkLoadTemplate(mapping.Key, values)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return nil, errors.New("key 为空")
+		}
+		switch mapping.Type {
+		case BulkLoadString:
+			value, err := expandBulkLoadTemplate(mapping.Value, values)
+			if err != nil {
+				return nil, err
+			}
+			sealed, err := l.seal(value)
+			if err != nil {
+				return nil, err
+			}
+			args := []interface{}{"SET", key, sealed}
+			if mapping.TTL > 0 {
+				args = append(args, "PX", mapping.TTL.Milliseconds())
+			}
+			commands = append(commands, args)
+			continue
+		case BulkLoadHash:
+			args := []interface{}{"HSET", key}
+			if len(mapping.Fields) == 0 {
+				for _, column := range sortedKeys(values) {
+					sealed, err := l.seal(values[column])
+					if err != nil {
+						return nil, err
+					}
+					args = append(args, column, sealed)
+				}
+			} else {
+				for _, field := range sortedKeys(mapping.Fields) {
+					value, err := expandBulkLoadTemplate(mapping.Fields[field], values)
+					if err != nil {
+						return nil, err
+					}
+					sealed, err := l.seal(value)
+					if err != nil {
+						return nil, err
+					}
+					args = append(args, field, sealed)
+				}
+			}
+			if len(args) == 2 {
+				return nil, errors.New("没有可写入的哈希字段")
+			}
+			commands = append(commands, args)
+		case BulkLoadSet:
+			member, err := expandBulkLoadTemplate(mapping.Member, values)
+			if err != nil {
+				return nil, err
+			}
+			commands = append(commands, []interface{}{"SADD", key, member})
+		case BulkLoadZSet:
+			member, err := expandBulkLoadTemplate(mapping.Member, values)
+			if err != nil {
+				return nil, err
+			}
+			scoreText, err := expandBulkLoadTemplate(mapping.Score, values)
+			if err != nil {
+				return nil, err
+			}
+			score, err := strconv.ParseFloat(strings.TrimSpace(scoreText), 64)
+			if err != nil {
+				return nil, fmt.Errorf("分数 %q 不是数字", scoreText)
+			}
+			commands = append(commands, []interface{}{"ZADD", key, score, member})
+		}
+		if mapping.TTL > 0 {
+			commands = append(commands, []interface{}{"PEXPIRE", key, mapping.TTL.Milliseconds()})
+		}
+	}
+	return commands, nil
+}
+
+// seal 按 Handler 的信封配置 (压缩/加密) 编码字符串与哈希字段的值, 与 Set/HashSet 写入的格式一致
+// 需要拆分的值 (超过 MaxValueSize) 涉及额外的分片 key 与旧分片的清理, 无法放入同一 Pipeline, 该记录按失败处理
+func (l *BulkLoader) seal(value string) (interface{}, error) {
+	if !l.r.envelopeEnabled() {
+		return value, nil
+	}
+	sealed, err := l.r.sealValue(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed.chunks) > 0 {
+		return nil, fmt.Errorf("值长度 %d 超过 MaxValueSize, 批量导入不支持分片写入", len(value))
+	}
+	return sealed.value, nil
+}
+
+// expandBulkLoadTemplate 替换模板中的 ${列名}, 列不存在时返回错误
+func expandBulkLoadTemplate(template string, values map[string]string) (string, error) {
+	if !strings.Contains(template, "${") {
+		return template, nil
+	}
+	var b strings.Builder
+	rest := template
+	for {
+		start := strings.Index(rest, "${")
+		if start < 0 {
+			b.WriteString(rest)
+			return b.String(), nil
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("模板 %q 缺少 }", template)
+		}
+		column := rest[start+2 : start+end]
+		value, ok := values[column]
+		if !ok {
+			return "", fmt.Errorf("缺少列 %s", column)
+		}
+		b.WriteString(rest[:start])
+		b.WriteString(value)
+		rest = rest[start+end+1:]
+	}
+}
+
+func (l *BulkLoader) countLine() {
+	l.mu.Lock()
+	l.progress.Lines++
+	l.mu.Unlock()
+}
+
+func (l *BulkLoader) fail(line int64, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.progress.Failed++
+	if len(l.errs) < maxBulkLoadErrors {
+		l.errs = append(l.errs, BulkLoadError{Line: line, Err: err})
+	}
+	if l.opts.MaxErrors > 0 && l.progress.Failed > l.opts.MaxErrors {
+		l.abort()
+	}
+}
+
+func (l *BulkLoader) reportProgress(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	if l.opts.OnProgress == nil {
+		<-stop
+		return
+	}
+	ticker := time.NewTicker(l.opts.ProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			l.opts.OnProgress(l.report().BulkLoadProgress)
+			return
+		case <-ticker.C:
+			l.opts.OnProgress(l.report().BulkLoadProgress)
+		}
+	}
+}
+
+func (l *BulkLoader) report() BulkLoadReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	report := BulkLoadReport{BulkLoadProgress: l.progress, Errors: append([]BulkLoadError(nil), l.errs...)}
+	report.Elapsed = time.Since(l.start)
+	if seconds := report.Elapsed.Seconds(); seconds > 0 {
+		report.Throughput = float64(report.Loaded) / seconds
+	}
+	sort.Slice(report.Errors, func(i, j int) bool { return report.Errors[i].Line < report.Errors[j].Line })
+	return report
+}
@@ -0,0 +1,177 @@
+package go_toolbox
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkLoaderCSV(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	csvData := "id,name,city,age\n" +
+		"1,elvis,memphis,42\n" +
+		"2,priscilla,memphis,not-a-number\n" +
+		"3,lisa,\"los angeles\",54\n" +
+		"4,broken\n"
+	var mu sync.Mutex
+	var progress []BulkLoadProgress
+	loader, err := NewBulkLoader(redisHandler.ModelRedisHandler, BulkLoadOptions{
+		Format: BulkLoadCSV,
+		Mappings: []BulkLoadMapping{
+			{Key: "user:${id}", Type: BulkLoadHash, Fields: map[string]string{"name": "${name}", "city": "${city}"}, TTL: time.Hour},
+			{Key: "city:${city}", Type: BulkLoadSet, Member: "${id}"},
+			{Key: "users:by-age", Type: BulkLoadZSet, Member: "${id}", Score: "${age}"},
+		},
+		BatchSize:   2,
+		Concurrency: 2,
+		OnProgress: func(p BulkLoadProgress) {
+			mu.Lock()
+			progress = append(progress, p)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := loader.Load(context.Background(), strings.NewReader(csvData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Lines != 4 || report.Loaded != 2 || report.Failed != 2 || len(report.Errors) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Errors[0].Line != 3 || report.Errors[1].Line != 5 {
+		t.Fatalf("errors should carry line numbers: %v", report.Errors)
+	}
+	ctx := context.Background()
+	client := redisHandler.RedisClient
+	if name := client.HGet(ctx, "user:3", "name").Val(); name != "lisa" {
+		t.Fatalf("unexpected hash field %q", name)
+	}
+	if ttl := client.TTL(ctx, "user:1").Val(); ttl <= 0 {
+		t.Fatalf("TTL should be applied, got %v", ttl)
+	}
+	if members := client.SMembers(ctx, "city:memphis").Val(); len(members) != 1 || members[0] != "1" {
+		t.Fatalf("the failed record should not be written: %v", members)
+	}
+	if score := client.ZScore(ctx, "users:by-age", "3").Val(); score != 54 {
+		t.Fatalf("unexpected score %v", score)
+	}
+	if exists := client.Exists(ctx, "user:2").Val(); exists != 0 {
+		t.Fatal("a record with a mapping error must not be partially written")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(progress) == 0 || progress[len(progress)-1].Loaded != 2 {
+		t.Fatalf("final progress should be reported: %+v", progress)
+	}
+}
+
+func TestBulkLoaderJSONL(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	jsonl := `{"sku":"a1","price":9.5,"meta":{"color":"red"}}` + "\n\n" +
+		`{"sku":"a2","price":12}` + "\n" +
+		`not json` + "\n" +
+		`{"sku":"a3"}`
+	loader, err := NewBulkLoader(redisHandler.ModelRedisHandler, BulkLoadOptions{
+		Format: BulkLoadJSONL,
+		Mappings: []BulkLoadMapping{
+			{Key: "sku:${sku}", Type: BulkLoadHash},
+			{Key: "price:${sku}", Type: BulkLoadString, Value: "${price}"},
+		},
+		RecordsPerSecond: 1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := loader.Load(context.Background(), strings.NewReader(jsonl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Lines != 4 || report.Loaded != 2 || report.Failed != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Errors[0].Line != 4 || !strings.Contains(report.Errors[1].Error(), "price") {
+		t.Fatalf("unexpected errors %v", report.Errors)
+	}
+	ctx := context.Background()
+	if meta := redisHandler.RedisClient.HGet(ctx, "sku:a1", "meta").Val(); meta != `{"color":"red"}` {
+		t.Fatalf("nested objects should be stored as JSON, got %q", meta)
+	}
+	if price := redisHandler.RedisClient.Get(ctx, "price:a2").Val(); price != "12" {
+		t.Fatalf("numbers should keep their text, got %q", price)
+	}
+}
+
+func TestBulkLoaderEnvelope(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	redisHandler.Compression = CompressionGzip
+	redisHandler.CompressThreshold = 1
+	redisHandler.MaxValueSize = 64
+
+	random := rand.New(rand.NewSource(1))
+	noise := make([]byte, 400)
+	for i := range noise {
+		noise[i] = byte('a' + random.Intn(26))
+	}
+	jsonl := `{"id":"1","bio":"` + strings.Repeat("la", 100) + `"}` + "\n" +
+		`{"id":"2","bio":"` + string(noise) + `"}`
+	loader, err := NewBulkLoader(redisHandler.ModelRedisHandler, BulkLoadOptions{
+		Format: BulkLoadJSONL,
+		Mappings: []BulkLoadMapping{
+			{Key: "bio:${id}", Type: BulkLoadString, Value: "${bio}"},
+			{Key: "user:${id}", Type: BulkLoadHash, Fields: map[string]string{"bio": "${bio}"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := loader.Load(context.Background(), strings.NewReader(jsonl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Loaded != 1 || report.Failed != 1 || !strings.Contains(report.Errors[0].Error(), "MaxValueSize") {
+		t.Fatalf("values that need chunks should be refused, got %+v", report)
+	}
+	ctx := context.Background()
+	if raw := redisHandler.RedisClient.Get(ctx, "bio:1").Val(); !isEnvelope(raw) {
+		t.Fatal("loaded strings should be sealed like Set")
+	}
+	if bio, ok := redisHandler.Get("bio:1"); !ok || bio != strings.Repeat("la", 100) {
+		t.Fatalf("unexpected string %q", bio)
+	}
+	if bio, ok := redisHandler.HashGet("user:1", "bio"); !ok || bio != strings.Repeat("la", 100) {
+		t.Fatalf("unexpected hash field %q", bio)
+	}
+}
+
+func TestBulkLoaderMaxErrors(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	loader, err := NewBulkLoader(redisHandler.ModelRedisHandler, BulkLoadOptions{
+		Format:    BulkLoadCSV,
+		Columns:   []string{"id"},
+		Mappings:  []BulkLoadMapping{{Key: "k:${missing}", Type: BulkLoadString, Value: "${id}"}},
+		MaxErrors: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loader.Load(context.Background(), strings.NewReader("1\n2\n3\n")); err != ErrBulkLoadTooManyErrors {
+		t.Fatalf("expected ErrBulkLoadTooManyErrors, got %v", err)
+	}
+	if _, err := NewBulkLoader(redisHandler.ModelRedisHandler, BulkLoadOptions{
+		Format: BulkLoadCSV, Mappings: []BulkLoadMapping{{Key: "k", Type: BulkLoadZSet, Member: "${id}"}},
+	}); err == nil {
+		t.Fatal("zset mappings without a score should be rejected")
+	}
+}
@@ -0,0 +1,597 @@
+package go_toolbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultMigrationBatchSize = 200
+	maxMigrationMismatchKeys  = 100
+)
+
+// MigrationOptions 数据迁移参数
+type MigrationOptions struct {
+	// Patterns 需要迁移的 key 模式 (glob), 为空时迁移全部 key
+	Patterns []string
+	// BatchSize 每次 SCAN 的数量, 默认 200
+	BatchSize int64
+	// KeysPerSecond 限速, 所有节点合计, <=0 表示不限速
+	KeysPerSecond int
+	// Replace 目标已存在同名 key 时覆盖, 否则跳过
+	Replace bool
+	// DryRun 只扫描并统计会迁移的 key, 不写入目标
+	DryRun bool
+	// VerifySample 写入后抽样校验的比例 (0~1), 逐个比较源与目标的值
+	VerifySample float64
+	// Resume 从上次中断的位置继续, 优先于 CheckpointKey 中保存的进度
+	Resume *MigrationCheckpoint
+	// CheckpointKey 非空时每批次完成后将进度保存到目标 Redis 的该 key, 再次运行时自动从该进度继续, 迁移完成后删除
+	CheckpointKey string
+	// OnCheckpoint 每批次完成后回调当前进度
+	OnCheckpoint func(MigrationCheckpoint)
+}
+
+// MigrationCheckpoint 各源节点的 SCAN 进度, key 为节点地址
+type MigrationCheckpoint struct {
+	Cursors map[string]uint64 `json:"cursors"`
+	Done    map[string]bool   `json:"done"`
+}
+
+// MigrationReport 迁移结果
+// DryRun 时 Copied 为会被迁移的 key 数量
+type MigrationReport struct {
+	Scanned        int64
+	Copied         int64
+	Skipped        int64
+	Failed         int64
+	Verified       int64
+	Mismatched     int64
+	MismatchedKeys []string
+	Checkpoint     MigrationCheckpoint
+	Duration       time.Duration
+}
+
+// RedisMigrator 在两个 ModelRedisHandler 之间迁移数据 (单点与集群可任意组合)
+// 使用 DUMP/RESTORE 复制 key 并保留剩余 TTL
+type RedisMigrator struct {
+	source *ModelRedisHandler
+	target *ModelRedisHandler
+	opts   MigrationOptions
+
+	mu         sync.Mutex
+	checkpoint MigrationCheckpoint
+	mismatched []string
+	limiter    *rateLimiter
+	report     MigrationReport
+}
+
+// NewRedisMigrator 创建迁移工具
+func NewRedisMigrator(source, target *ModelRedisHandler, opts MigrationOptions) *RedisMigrator {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultMigrationBatchSize
+	}
+	return &RedisMigrator{source: source, target: target, opts: opts}
+}
+
+// Run 执行迁移, ctx 取消时返回已完成部分的结果, 其中的 Checkpoint 可用于 Resume
+func (m *RedisMigrator) Run(ctx context.Context) (MigrationReport, error) {
+	if !m.source.Enable || !m.target.Enable {
+		return MigrationReport{}, errors.New("源或目标 Redis 未启用")
+	}
+	start := time.Now()
+	m.report = MigrationReport{}
+	m.mismatched = nil
+	m.limiter = newRateLimiter(m.opts.KeysPerSecond)
+	if err := m.loadCheckpoint(ctx); err != nil {
+		return MigrationReport{}, err
+	}
+	Logger.Info(GetLogPrefix("") + fmt.Sprintf("Redis 数据迁移开始: %s -> %s, dry-run: %v", m.source.modeName(), m.target.modeName(), m.opts.DryRun))
+	err := m.source.forEachNode(ctx, func(ctx context.Context, node *redis.Client) error {
+		return m.migrateNode(ctx, node)
+	})
+	if err == nil && m.opts.CheckpointKey != "" && !m.opts.DryRun {
+		if delErr := m.target.universalClient().Del(context.Background(), m.opts.CheckpointKey).Err(); delErr != nil {
+			Logger.Warn(GetLogPrefix("") + "Redis 迁移进度删除失败! 错误原因: " + delErr.Error())
+		}
+	}
+	report := m.snapshot()
+	report.Duration = time.Since(start)
+	Logger.Info(GetLogPrefix("") + fmt.Sprintf("Redis 数据迁移结束: 扫描 %d, 迁移 %d, 跳过 %d, 失败 %d, 校验 %d, 不一致 %d, 耗时 %v",
+		report.Scanned, report.Copied, report.Skipped, report.Failed, report.Verified, report.Mismatched, report.Duration))
+	return report, err
+}
+
+func (m *RedisMigrator) loadCheckpoint(ctx context.Context) error {
+	m.checkpoint = MigrationCheckpoint{Cursors: make(map[string]uint64), Done: make(map[string]bool)}
+	resume := m.opts.Resume
+	if resume == nil && m.opts.CheckpointKey != "" {
+		data, err := m.target.universalClient().Get(ctx, m.opts.CheckpointKey).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if data != "" {
+			resume = &MigrationCheckpoint{}
+			if err := json.Unmarshal([]byte(data), resume); err != nil {
+				return fmt.Errorf("迁移进度格式错误: %w", err)
+			}
+		}
+	}
+	if resume != nil {
+		for node, cursor := range resume.Cursors {
+			m.checkpoint.Cursors[node] = cursor
+		}
+		for node, done := range resume.Done {
+			m.checkpoint.Done[node] = done
+		}
+	}
+	return nil
+}
+
+func (m *RedisMigrator) migrateNode(ctx context.Context, node *redis.Client) error {
+	addr := node.Options().Addr
+	m.mu.Lock()
+	done, cursor := m.checkpoint.Done[addr], m.checkpoint.Cursors[addr]
+	m.mu.Unlock()
+	if done {
+		return nil
+	}
+	match := "*"
+	if len(m.opts.Patterns) == 1 {
+		match = m.opts.Patterns[0]
+	}
+	for {
+		keys, next, err := node.Scan(ctx, cursor, match, m.opts.BatchSize).Result()
+		if err != nil {
+			return err
+		}
+		keys = m.filter(keys)
+		atomic.AddInt64(&m.report.Scanned, int64(len(keys)))
+		if err := m.limiter.wait(ctx, len(keys)); err != nil {
+			return err
+		}
+		if m.opts.DryRun {
+			err = m.plan(ctx, keys)
+		} else {
+			err = m.copyKeys(ctx, keys)
+		}
+		if err != nil {
+			return err
+		}
+		cursor = next
+		m.saveCheckpoint(addr, cursor)
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+func (m *RedisMigrator) filter(keys []string) []string {
+	if len(m.opts.Patterns) <= 1 {
+		return keys
+	}
+	matched := keys[:0]
+	for _, key := range keys {
+		for _, pattern := range m.opts.Patterns {
+			if matchRedisPattern(pattern, key) {
+				matched = append(matched, key)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// plan dry-run 模式下统计会迁移与会跳过的 key
+func (m *RedisMigrator) plan(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if m.opts.Replace {
+		atomic.AddInt64(&m.report.Copied, int64(len(keys)))
+		return nil
+	}
+	pipe := m.target.universalClient().Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Exists(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		if cmd.Val() > 0 {
+			atomic.AddInt64(&m.report.Skipped, 1)
+		} else {
+			atomic.AddInt64(&m.report.Copied, 1)
+		}
+	}
+	return nil
+}
+
+func (m *RedisMigrator) copyKeys(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	srcPipe := m.source.universalClient().Pipeline()
+	dumps := make([]*redis.StringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		dumps[i] = srcPipe.Dump(ctx, key)
+		ttls[i] = srcPipe.PTTL(ctx, key)
+	}
+	if _, err := srcPipe.Exec(ctx); err != nil && err != redis.Nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		Logger.Warn(GetLogPrefix("") + "Redis 迁移 DUMP 部分失败! 错误原因: " + err.Error())
+	}
+
+	dstPipe := m.target.universalClient().Pipeline()
+	restoring := make([]string, 0, len(keys))
+	restores := make([]*redis.StatusCmd, 0, len(keys))
+	for i, key := range keys {
+		payload, err := dumps[i].Result()
+		if err == redis.Nil {
+			// 扫描后已被删除或过期
+			atomic.AddInt64(&m.report.Skipped, 1)
+			continue
+		}
+		if err != nil {
+			atomic.AddInt64(&m.report.Failed, 1)
+			Logger.Warn(GetLogPrefix("") + "Redis 迁移 DUMP 失败! key: " + key + " 错误原因: " + err.Error())
+			continue
+		}
+		ttl := ttls[i].Val()
+		if ttl == time.Duration(-2) {
+			// DUMP 与 PTTL 之间过期
+			atomic.AddInt64(&m.report.Skipped, 1)
+			continue
+		}
+		if ttl < 0 {
+			ttl = 0
+		}
+		restoring = append(restoring, key)
+		if m.opts.Replace {
+			restores = append(restores, dstPipe.RestoreReplace(ctx, key, ttl, payload))
+		} else {
+			restores = append(restores, dstPipe.Restore(ctx, key, ttl, payload))
+		}
+	}
+	if len(restores) == 0 {
+		return nil
+	}
+	if _, err := dstPipe.Exec(ctx); err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for i, cmd := range restores {
+		key := restoring[i]
+		switch err := cmd.Err(); {
+		case err == nil:
+			atomic.AddInt64(&m.report.Copied, 1)
+			if m.opts.VerifySample > 0 && rand.Float64() < m.opts.VerifySample {
+				m.verify(ctx, key)
+			}
+		case strings.HasPrefix(err.Error(), "BUSYKEY"):
+			atomic.AddInt64(&m.report.Skipped, 1)
+		default:
+			atomic.AddInt64(&m.report.Failed, 1)
+			Logger.Warn(GetLogPrefix("") + "Redis 迁移 RESTORE 失败! key: " + key + " 错误原因: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// verify 比较源与目标的值, 源在迁移后被修改也会计为不一致
+func (m *RedisMigrator) verify(ctx context.Context, key string) {
+	atomic.AddInt64(&m.report.Verified, 1)
+	srcValue, srcErr := redisLogicalValue(ctx, m.source.universalClient(), key)
+	dstValue, dstErr := redisLogicalValue(ctx, m.target.universalClient(), key)
+	if srcErr == nil && dstErr == nil && srcValue == dstValue {
+		return
+	}
+	atomic.AddInt64(&m.report.Mismatched, 1)
+	Logger.Warn(GetLogPrefix("") + "Redis 迁移校验不一致! key: " + key)
+	m.mu.Lock()
+	if len(m.mismatched) < maxMigrationMismatchKeys {
+		m.mismatched = append(m.mismatched, key)
+	}
+	m.mu.Unlock()
+}
+
+// redisLogicalValue 按类型读取 key 的完整内容并序列化为可比较的字符串
+// 不直接比较 DUMP 结果, 因为不同版本或编码下相同的值 DUMP 结果可能不同
+func redisLogicalValue(ctx context.Context, client redis.UniversalClient, key string) (string, error) {
+	kind, err := client.Type(ctx, key).Result()
+	if err != nil {
+		return "", err
+	}
+	var value interface{}
+	switch kind {
+	case "none":
+		value = nil
+	case "string":
+		value, err = client.Get(ctx, key).Result()
+	case "hash":
+		value, err = client.HGetAll(ctx, key).Result()
+	case "list":
+		value, err = client.LRange(ctx, key, 0, -1).Result()
+	case "set":
+		var members []string
+		members, err = client.SMembers(ctx, key).Result()
+		sort.Strings(members)
+		value = members
+	case "zset":
+		value, err = client.ZRangeWithScores(ctx, key, 0, -1).Result()
+	default:
+		value, err = client.Dump(ctx, key).Result()
+	}
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(value)
+	return kind + ":" + string(data), err
+}
+
+func (m *RedisMigrator) saveCheckpoint(addr string, cursor uint64) {
+	m.mu.Lock()
+	if cursor == 0 {
+		m.checkpoint.Done[addr] = true
+		delete(m.checkpoint.Cursors, addr)
+	} else {
+		m.checkpoint.Cursors[addr] = cursor
+	}
+	checkpoint := m.copyCheckpoint()
+	m.mu.Unlock()
+	if m.opts.CheckpointKey != "" && !m.opts.DryRun {
+		data, _ := json.Marshal(checkpoint)
+		if err := m.target.universalClient().Set(context.Background(), m.opts.CheckpointKey, data, 0).Err(); err != nil {
+			Logger.Warn(GetLogPrefix("") + "Redis 迁移进度保存失败! 错误原因: " + err.Error())
+		}
+	}
+	if m.opts.OnCheckpoint != nil {
+		m.opts.OnCheckpoint(checkpoint)
+	}
+}
+
+func (m *RedisMigrator) copyCheckpoint() MigrationCheckpoint {
+	checkpoint := MigrationCheckpoint{
+		Cursors: make(map[string]uint64, len(m.checkpoint.Cursors)),
+		Done:    make(map[string]bool, len(m.checkpoint.Done)),
+	}
+	for node, cursor := range m.checkpoint.Cursors {
+		checkpoint.Cursors[node] = cursor
+	}
+	for node, done := range m.checkpoint.Done {
+		checkpoint.Done[node] = done
+	}
+	return checkpoint
+}
+
+func (m *RedisMigrator) snapshot() MigrationReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return MigrationReport{
+		Scanned:        atomic.LoadInt64(&m.report.Scanned),
+		Copied:         atomic.LoadInt64(&m.report.Copied),
+		Skipped:        atomic.LoadInt64(&m.report.Skipped),
+		Failed:         atomic.LoadInt64(&m.report.Failed),
+		Verified:       atomic.LoadInt64(&m.report.Verified),
+		Mismatched:     atomic.LoadInt64(&m.report.Mismatched),
+		MismatchedKeys: append([]string(nil), m.mismatched...),
+		Checkpoint:     m.copyCheckpoint(),
+	}
+}
+
+// DualWriter 切换期间的双写包装, 写操作先写源再同步写入目标, 读操作只访问源
+// 目标写入失败只记录日志与计数, 不影响返回值; 只双写匹配迁移 Patterns 的 key
+func (m *RedisMigrator) DualWriter() *DualWriteHandler {
+	return &DualWriteHandler{primary: m.source, secondary: m.target, patterns: m.opts.Patterns}
+}
+
+// DualWriteHandler 双写包装, 实现 RedisStore, 可直接替换业务代码中依赖 RedisStore 的 ModelRedisHandler
+// 只提供 RedisStore 的方法, 其中写操作 Set/HashSet/HashMSet/HashDel/EmptyList/AppendList/BFAdd 双写;
+// 其他写操作 (列表, 集合, 有序集合, JSON 等) 需通过 Pipeline 执行, PipelineExecute 在源执行成功后将其中带 key 的写命令按原样在目标上重放
+// (MULTI/EXEC 事务在目标上不保证原子性)
+type DualWriteHandler struct {
+	primary   *ModelRedisHandler
+	secondary *ModelRedisHandler
+	patterns  []string
+	failures  int64
+}
+
+var _ RedisStore = (*DualWriteHandler)(nil)
+
+// dualWriteReadOnly Pipeline 中不需要在目标上重放的只读命令
+var dualWriteReadOnly = map[string]bool{
+	"get": true, "mget": true, "strlen": true, "getrange": true, "exists": true, "type": true, "ttl": true, "pttl": true,
+	"hget": true, "hmget": true, "hgetall": true, "hlen": true, "hexists": true, "hkeys": true, "hvals": true, "hscan": true,
+	"llen": true, "lindex": true, "lrange": true, "scard": true, "smembers": true, "sismember": true, "smismember": true, "sscan": true,
+	"zscore": true, "zmscore": true, "zcard": true, "zcount": true, "zrange": true, "zrangebyscore": true, "zrevrange": true,
+	"zrevrangebyscore": true, "zrank": true, "zrevrank": true, "zscan": true,
+	"geopos": true, "geodist": true, "geosearch": true, "geohash": true, "pfcount": true, "dump": true,
+	"bf.exists": true, "bf.mexists": true, "bf.info": true, "json.get": true, "json.mget": true, "json.objkeys": true, "json.type": true,
+}
+
+// SecondaryFailures 目标写入失败次数
+func (d *DualWriteHandler) SecondaryFailures() int64 {
+	return atomic.LoadInt64(&d.failures)
+}
+
+func (d *DualWriteHandler) mirror(key, op string, ok bool) {
+	if !ok {
+		atomic.AddInt64(&d.failures, 1)
+		Logger.Warn(GetLogPrefix("") + "Redis 双写目标失败! 操作: " + op + " key: " + key)
+	}
+}
+
+func (d *DualWriteHandler) mirrored(key string) bool {
+	if len(d.patterns) == 0 {
+		return true
+	}
+	for _, pattern := range d.patterns {
+		if matchRedisPattern(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DualWriteHandler) Get(key string) (string, bool) {
+	return d.primary.Get(key)
+}
+
+func (d *DualWriteHandler) HashGet(key, field string) (string, bool) {
+	return d.primary.HashGet(key, field)
+}
+
+func (d *DualWriteHandler) HashMGET(key string, fields ...string) ([]interface{}, bool) {
+	return d.primary.HashMGET(key, fields...)
+}
+
+func (d *DualWriteHandler) HashLen(key string) int64 {
+	return d.primary.HashLen(key)
+}
+
+func (d *DualWriteHandler) GetList(key string, start, stop int64) ([]string, bool) {
+	return d.primary.GetList(key, start, stop)
+}
+
+func (d *DualWriteHandler) BFExists(key string, value string) bool {
+	return d.primary.BFExists(key, value)
+}
+
+// Pipeline 源的 Pipeline, 需通过 PipelineExecute 执行才会双写
+func (d *DualWriteHandler) Pipeline() (redis.Pipeliner, context.Context) {
+	return d.primary.Pipeline()
+}
+
+// PipelineExecute 在源执行 Pipeline, 之后将执行成功且 key 匹配的写命令在一个 Pipeline 中重放到目标
+func (d *DualWriteHandler) PipelineExecute(pipe redis.Pipeliner, ctx context.Context) ([]redis.Cmder, error) {
+	cmds, err := d.primary.PipelineExecute(pipe, ctx)
+	if !d.secondary.Enable {
+		return cmds, err
+	}
+	var replay []redis.Cmder
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && cmdErr != redis.Nil {
+			continue
+		}
+		if dualWriteReadOnly[strings.ToLower(cmd.Name())] {
+			continue
+		}
+		if key, ok := hotKeyOf(cmd); ok && d.mirrored(key) {
+			replay = append(replay, cmd)
+		}
+	}
+	if len(replay) == 0 {
+		return cmds, err
+	}
+	secondaryPipe, secondaryCtx := d.secondary.Pipeline()
+	for _, cmd := range replay {
+		secondaryPipe.Do(secondaryCtx, cmd.Args()...)
+	}
+	secondaryCmds, _ := d.secondary.PipelineExecute(secondaryPipe, secondaryCtx)
+	for i, cmd := range secondaryCmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && cmdErr != redis.Nil {
+			key, _ := hotKeyOf(replay[i])
+			d.mirror(key, "Pipeline "+replay[i].Name(), false)
+		}
+	}
+	return cmds, err
+}
+
+func (d *DualWriteHandler) Ready() bool {
+	return d.primary.Ready()
+}
+
+func (d *DualWriteHandler) WaitReady(ctx context.Context) error {
+	return d.primary.WaitReady(ctx)
+}
+
+// ShutdownRedisHandler 关闭源 Handler, 目标 Handler 由调用方自行关闭
+func (d *DualWriteHandler) ShutdownRedisHandler() error {
+	return d.primary.ShutdownRedisHandler()
+}
+
+func (d *DualWriteHandler) Set(key string, value interface{}, ex time.Duration) bool {
+	if !d.primary.Set(key, value, ex) {
+		return false
+	}
+	if d.mirrored(key) {
+		d.mirror(key, "Set", d.secondary.Set(key, value, ex))
+	}
+	return true
+}
+
+func (d *DualWriteHandler) HashSet(key string, values ...interface{}) bool {
+	if !d.primary.HashSet(key, values...) {
+		return false
+	}
+	if d.mirrored(key) {
+		d.mirror(key, "HashSet", d.secondary.HashSet(key, values...))
+	}
+	return true
+}
+
+func (d *DualWriteHandler) HashMSet(key string, values ...interface{}) bool {
+	if !d.primary.HashMSet(key, values...) {
+		return false
+	}
+	if d.mirrored(key) {
+		d.mirror(key, "HashMSet", d.secondary.HashMSet(key, values...))
+	}
+	return true
+}
+
+func (d *DualWriteHandler) HashDel(key string, fields ...string) bool {
+	if !d.primary.HashDel(key, fields...) {
+		return false
+	}
+	if d.mirrored(key) {
+		d.mirror(key, "HashDel", d.secondary.HashDel(key, fields...))
+	}
+	return true
+}
+
+func (d *DualWriteHandler) EmptyList(key string) bool {
+	if !d.primary.EmptyList(key) {
+		return false
+	}
+	if d.mirrored(key) {
+		d.mirror(key, "EmptyList", d.secondary.EmptyList(key))
+	}
+	return true
+}
+
+func (d *DualWriteHandler) AppendList(key string, value interface{}) bool {
+	if !d.primary.AppendList(key, value) {
+		return false
+	}
+	if d.mirrored(key) {
+		d.mirror(key, "AppendList", d.secondary.AppendList(key, value))
+	}
+	return true
+}
+
+func (d *DualWriteHandler) BFAdd(key string, value string) (bool, bool) {
+	added, ok := d.primary.BFAdd(key, value)
+	if !ok {
+		return added, false
+	}
+	if d.mirrored(key) {
+		_, secondaryOk := d.secondary.BFAdd(key, value)
+		d.mirror(key, "BFAdd", secondaryOk)
+	}
+	return added, true
+}
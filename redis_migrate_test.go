@@ -0,0 +1,124 @@
+package go_toolbox
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedisMigrator(t *testing.T) {
+	source := NewFakeRedis()
+	defer source.ShutdownRedisHandler()
+	target := NewFakeRedis()
+	defer target.ShutdownRedisHandler()
+	ctx := context.Background()
+
+	source.Set("user:1", "elvis", time.Hour)
+	source.Set("user:2", "presley", 0)
+	source.HashSet("profile:1", "name", "elvis", "age", 42)
+	source.AppendList("queue:1", "a")
+	source.AppendList("queue:1", "b")
+	source.BFAdd("bloom:1", "x")
+	source.Set("tmp:1", "skip me", 0)
+	target.Set("user:2", "existing", 0)
+
+	patterns := []string{"user:*", "profile:*", "queue:*", "bloom:*"}
+	report, err := NewRedisMigrator(source.ModelRedisHandler, target.ModelRedisHandler, MigrationOptions{Patterns: patterns, DryRun: true}).Run(ctx)
+	if err != nil || report.Scanned != 5 || report.Copied != 4 || report.Skipped != 1 || len(target.Keys()) != 1 {
+		t.Fatalf("unexpected dry-run report: %+v %v", report, err)
+	}
+
+	report, err = NewRedisMigrator(source.ModelRedisHandler, target.ModelRedisHandler, MigrationOptions{
+		Patterns: patterns, VerifySample: 1, BatchSize: 2, CheckpointKey: "migration:checkpoint",
+	}).Run(ctx)
+	if err != nil || report.Copied != 4 || report.Skipped != 1 || report.Failed != 0 || report.Verified != 4 || report.Mismatched != 0 {
+		t.Fatalf("unexpected report: %+v %v", report, err)
+	}
+	if value, _ := target.Get("user:1"); value != "elvis" {
+		t.Fatalf("unexpected migrated value %q", value)
+	}
+	if ttl := target.RedisClient.TTL(ctx, "user:1").Val(); ttl <= 50*time.Minute {
+		t.Fatalf("ttl should be preserved, got %v", ttl)
+	}
+	if value, _ := target.Get("user:2"); value != "existing" {
+		t.Fatal("existing keys should not be replaced without Replace")
+	}
+	if list, _ := target.GetList("queue:1", 0, -1); strings.Join(list, ",") != "b,a" {
+		t.Fatalf("unexpected list %v", list)
+	}
+	if !target.BFExists("bloom:1", "x") || target.RedisClient.Exists(ctx, "tmp:1", "migration:checkpoint").Val() != 0 {
+		t.Fatal("unexpected target keys")
+	}
+
+	report, _ = NewRedisMigrator(source.ModelRedisHandler, target.ModelRedisHandler, MigrationOptions{Patterns: []string{"user:*"}, Replace: true}).Run(ctx)
+	if value, _ := target.Get("user:2"); report.Copied != 2 || value != "presley" {
+		t.Fatalf("Replace should overwrite: %+v %q", report, value)
+	}
+}
+
+func TestRedisMigratorResume(t *testing.T) {
+	source := NewFakeRedis()
+	defer source.ShutdownRedisHandler()
+	target := NewFakeRedis()
+	defer target.ShutdownRedisHandler()
+
+	for i := 0; i < 10; i++ {
+		source.Set("k"+string(rune('a'+i)), i, 0)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	migrator := NewRedisMigrator(source.ModelRedisHandler, target.ModelRedisHandler, MigrationOptions{
+		BatchSize: 3, CheckpointKey: "checkpoint",
+		OnCheckpoint: func(MigrationCheckpoint) { cancel() },
+	})
+	report, err := migrator.Run(ctx)
+	if err == nil || report.Copied != 3 || len(report.Checkpoint.Cursors) != 1 {
+		t.Fatalf("first batch should be checkpointed before cancel: %+v %v", report, err)
+	}
+
+	// 从 CheckpointKey 中保存的进度继续
+	report, err = NewRedisMigrator(source.ModelRedisHandler, target.ModelRedisHandler, MigrationOptions{BatchSize: 3, CheckpointKey: "checkpoint"}).Run(context.Background())
+	if err != nil || report.Copied != 7 || !report.Checkpoint.Done["fake-redis:6379"] {
+		t.Fatalf("resume should copy the remaining keys: %+v %v", report, err)
+	}
+	if keys := target.Keys(); len(keys) != 10 {
+		t.Fatalf("unexpected target keys %v", keys)
+	}
+}
+
+func TestDualWriteHandler(t *testing.T) {
+	source := NewFakeRedis()
+	defer source.ShutdownRedisHandler()
+	target := NewFakeRedis()
+	defer target.ShutdownRedisHandler()
+
+	var store RedisStore = NewRedisMigrator(source.ModelRedisHandler, target.ModelRedisHandler, MigrationOptions{Patterns: []string{"user:*"}}).DualWriter()
+	store.Set("user:1", "elvis", 0)
+	store.HashSet("user:2", "name", "presley")
+	store.HashDel("user:2", "name")
+	store.Set("other", "x", 0)
+	if value, _ := target.Get("user:1"); value != "elvis" {
+		t.Fatal("writes should be mirrored to the target")
+	}
+	if target.HashLen("user:2") != 0 || len(target.Keys()) != 1 || len(source.Keys()) != 2 {
+		t.Fatalf("unexpected keys: %v %v", source.Keys(), target.Keys())
+	}
+
+	// 其他写操作通过 Pipeline 双写, 只读命令与不匹配的 key 不会重放
+	pipe, ctx := store.Pipeline()
+	pipe.RPush(ctx, "user:list", "a", "b")
+	pipe.Get(ctx, "user:1")
+	pipe.SAdd(ctx, "other:set", "x")
+	if _, err := store.PipelineExecute(pipe, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := target.GetList("user:list", 0, -1); len(values) != 2 || len(target.Keys()) != 2 || len(source.Keys()) != 4 {
+		t.Fatalf("pipeline writes should be mirrored: %v %v", source.Keys(), target.Keys())
+	}
+
+	dual := store.(*DualWriteHandler)
+	target.ShutdownRedisHandler()
+	if !store.Set("user:3", "x", 0) || dual.SecondaryFailures() != 1 {
+		t.Fatal("target failures should not fail the write")
+	}
+}
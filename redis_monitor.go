@@ -0,0 +1,519 @@
+package go_toolbox
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultHealthCheckInterval = 15 * time.Second
+	// redisClusterSlots Redis 集群槽位总数
+	redisClusterSlots = 16384
+	// maxFailoverEvents Health 中保留的最近故障转移事件数量
+	maxFailoverEvents = 20
+)
+
+// RedisMemoryInfo INFO memory
+type RedisMemoryInfo struct {
+	UsedMemory         int64   `json:"UsedMemory"`
+	UsedMemoryRss      int64   `json:"UsedMemoryRss"`
+	UsedMemoryPeak     int64   `json:"UsedMemoryPeak"`
+	MaxMemory          int64   `json:"MaxMemory"`
+	MaxMemoryPolicy    string  `json:"MaxMemoryPolicy"`
+	FragmentationRatio float64 `json:"FragmentationRatio"`
+}
+
+// RedisClientsInfo INFO clients
+type RedisClientsInfo struct {
+	ConnectedClients int64 `json:"ConnectedClients"`
+	BlockedClients   int64 `json:"BlockedClients"`
+}
+
+// RedisReplicaInfo 主节点 INFO replication 中的 slaveN 行
+type RedisReplicaInfo struct {
+	Addr   string `json:"Addr"`
+	State  string `json:"State"`
+	Offset int64  `json:"Offset"`
+	// LagBytes 主节点复制偏移量与从节点偏移量之差
+	LagBytes int64 `json:"LagBytes"`
+	// LagSeconds 从节点最后一次确认距今的秒数
+	LagSeconds int64 `json:"LagSeconds"`
+}
+
+// RedisReplicationInfo INFO replication
+type RedisReplicationInfo struct {
+	Role                  string             `json:"Role"`
+	ConnectedSlaves       int64              `json:"ConnectedSlaves"`
+	MasterReplOffset      int64              `json:"MasterReplOffset"`
+	MasterHost            string             `json:"MasterHost"`
+	MasterPort            int                `json:"MasterPort"`
+	MasterLinkStatus      string             `json:"MasterLinkStatus"`
+	MasterLastIOSecondAgo int64              `json:"MasterLastIOSecondAgo"`
+	SlaveReplOffset       int64              `json:"SlaveReplOffset"`
+	Replicas              []RedisReplicaInfo `json:"Replicas"`
+}
+
+// RedisKeyspaceInfo INFO keyspace 中的 dbN 行
+type RedisKeyspaceInfo struct {
+	DB      string `json:"DB"`
+	Keys    int64  `json:"Keys"`
+	Expires int64  `json:"Expires"`
+	AvgTTL  int64  `json:"AvgTTL"`
+}
+
+// RedisPersistenceInfo INFO persistence
+type RedisPersistenceInfo struct {
+	Loading                 bool      `json:"Loading"`
+	RdbChangesSinceLastSave int64     `json:"RdbChangesSinceLastSave"`
+	RdbBgsaveInProgress     bool      `json:"RdbBgsaveInProgress"`
+	RdbLastSaveTime         time.Time `json:"RdbLastSaveTime"`
+	RdbLastBgsaveStatus     string    `json:"RdbLastBgsaveStatus"`
+	AofEnabled              bool      `json:"AofEnabled"`
+	AofRewriteInProgress    bool      `json:"AofRewriteInProgress"`
+	AofLastWriteStatus      string    `json:"AofLastWriteStatus"`
+}
+
+// RedisInfo 解析后的 INFO 结果
+type RedisInfo struct {
+	Memory      RedisMemoryInfo      `json:"Memory"`
+	Clients     RedisClientsInfo     `json:"Clients"`
+	Replication RedisReplicationInfo `json:"Replication"`
+	Keyspace    []RedisKeyspaceInfo  `json:"Keyspace"`
+	Persistence RedisPersistenceInfo `json:"Persistence"`
+}
+
+// RedisNodeHealth 单个节点的健康状态
+type RedisNodeHealth struct {
+	Addr      string        `json:"Addr"`
+	Role      string        `json:"Role"`
+	Healthy   bool          `json:"Healthy"`
+	Latency   time.Duration `json:"Latency"`
+	Error     string        `json:"Error,omitempty"`
+	Info      RedisInfo     `json:"Info"`
+	CheckedAt time.Time     `json:"CheckedAt"`
+}
+
+// RedisFailoverEvent 槽位的主节点发生变化
+type RedisFailoverEvent struct {
+	SlotStart  int       `json:"SlotStart"`
+	SlotEnd    int       `json:"SlotEnd"`
+	FromMaster string    `json:"FromMaster"`
+	ToMaster   string    `json:"ToMaster"`
+	DetectedAt time.Time `json:"DetectedAt"`
+}
+
+// RedisClusterHealth CLUSTER INFO 与 CLUSTER SLOTS 汇总
+type RedisClusterHealth struct {
+	State         string               `json:"State"`
+	SlotsAssigned int64                `json:"SlotsAssigned"`
+	SlotsOk       int64                `json:"SlotsOk"`
+	SlotsPfail    int64                `json:"SlotsPfail"`
+	SlotsFail     int64                `json:"SlotsFail"`
+	SlotsCovered  int64                `json:"SlotsCovered"`
+	KnownNodes    int64                `json:"KnownNodes"`
+	Masters       []string             `json:"Masters"`
+	Failovers     []RedisFailoverEvent `json:"Failovers"`
+	slots         []redis.ClusterSlot
+}
+
+// RedisHealth 健康检查快照
+type RedisHealth struct {
+	Healthy   bool                `json:"Healthy"`
+	CheckedAt time.Time           `json:"CheckedAt"`
+	Nodes     []RedisNodeHealth   `json:"Nodes"`
+	Cluster   *RedisClusterHealth `json:"Cluster,omitempty"`
+	Warnings  []string            `json:"Warnings"`
+}
+
+// RedisHealthThresholds 告警阈值, 为 0 的项不检查
+type RedisHealthThresholds struct {
+	// MaxMemoryRatio used_memory / maxmemory 的上限, 未设置 maxmemory 时不检查
+	MaxMemoryRatio    float64       `json:"MaxMemoryRatio"`
+	MaxClients        int64         `json:"MaxClients"`
+	MaxReplicationLag int64         `json:"MaxReplicationLag"`
+	MaxLatency        time.Duration `json:"MaxLatency"`
+}
+
+type healthMonitor struct {
+	mu         sync.RWMutex
+	health     RedisHealth
+	slotMaster map[int]string
+	failovers  []RedisFailoverEvent
+	stop       context.CancelFunc
+	done       chan struct{}
+}
+
+// StartHealthMonitor 启动后台健康检查, 每 interval 对所有节点 (集群模式下包括主从节点) 执行 PING 与 INFO
+// 重复调用会先停止已有的监控
+func (r *ModelRedisHandler) StartHealthMonitor(interval time.Duration, thresholds RedisHealthThresholds) {
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	r.StopHealthMonitor()
+	ctx, cancel := context.WithCancel(context.Background())
+	monitor := &healthMonitor{stop: cancel, done: make(chan struct{})}
+	r.monitorMu.Lock()
+	r.monitor = monitor
+	r.monitorMu.Unlock()
+	go func() {
+		defer close(monitor.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			r.runHealthCheck(ctx, monitor, thresholds)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// StopHealthMonitor 停止后台健康检查
+func (r *ModelRedisHandler) StopHealthMonitor() {
+	r.monitorMu.Lock()
+	monitor := r.monitor
+	r.monitor = nil
+	r.monitorMu.Unlock()
+	if monitor != nil {
+		monitor.stop()
+		<-monitor.done
+	}
+}
+
+// Health 后台监控最近一次健康检查的结果, 只读取缓存不会发起检查, 需要立即检查时使用 CheckHealth
+// 未启动监控或首次检查尚未完成时状态未知, 返回 false
+func (r *ModelRedisHandler) Health() (RedisHealth, bool) {
+	r.monitorMu.Lock()
+	monitor := r.monitor
+	r.monitorMu.Unlock()
+	if monitor == nil {
+		return RedisHealth{}, false
+	}
+	monitor.mu.RLock()
+	defer monitor.mu.RUnlock()
+	return monitor.health, !monitor.health.CheckedAt.IsZero()
+}
+
+func (r *ModelRedisHandler) runHealthCheck(ctx context.Context, monitor *healthMonitor, thresholds RedisHealthThresholds) {
+	checkCtx, cancel := context.WithTimeout(ctx, DefaultConnectPingTimeout)
+	defer cancel()
+	health := r.CheckHealth(checkCtx, thresholds)
+	if ctx.Err() != nil {
+		return
+	}
+	if health.Cluster != nil {
+		health.Cluster.Failovers = monitor.detectFailovers(health.Cluster)
+	}
+	for _, warning := range health.Warnings {
+		Logger.Warn(GetLogPrefix("") + warning)
+	}
+	monitor.mu.Lock()
+	monitor.health = health
+	monitor.mu.Unlock()
+}
+
+// CheckHealth 立即执行一次健康检查
+func (r *ModelRedisHandler) CheckHealth(ctx context.Context, thresholds RedisHealthThresholds) RedisHealth {
+	health := RedisHealth{Healthy: true, CheckedAt: time.Now()}
+	if !r.Enable {
+		return health
+	}
+	var mu sync.Mutex
+	collect := func(ctx context.Context, client *redis.Client) error {
+		node := checkRedisNode(ctx, client)
+		mu.Lock()
+		health.Nodes = append(health.Nodes, node)
+		mu.Unlock()
+		return nil
+	}
+	if r.IsCluster {
+		_ = r.RedisClusterClient.ForEachShard(ctx, collect)
+		health.Cluster = checkRedisCluster(ctx, r.RedisClusterClient)
+	} else if r.isRing() {
+		_ = r.RedisRingClient.ForEachShard(ctx, collect)
+		// ForEachShard 跳过已下线的分片, 下线的分片同样计入节点并标记为不健康
+		checked := make(map[string]bool, len(health.Nodes))
+		for _, node := range health.Nodes {
+			checked[node.Addr] = true
+		}
+		for _, shard := range r.RingShards() {
+			if !checked[shard.Addr] {
+				health.Nodes = append(health.Nodes, RedisNodeHealth{Addr: shard.Addr, CheckedAt: time.Now(), Error: "shard down"})
+			}
+		}
+	} else {
+		_ = collect(ctx, r.RedisClient)
+	}
+	sort.Slice(health.Nodes, func(i, j int) bool {
+		return health.Nodes[i].Addr < health.Nodes[j].Addr
+	})
+	health.Warnings = thresholds.check(&health)
+	for _, node := range health.Nodes {
+		if !node.Healthy {
+			health.Healthy = false
+		}
+	}
+	if health.Cluster != nil && health.Cluster.State != "ok" {
+		health.Healthy = false
+	}
+	if len(health.Nodes) == 0 {
+		health.Healthy = false
+	}
+	return health
+}
+
+func checkRedisNode(ctx context.Context, client *redis.Client) RedisNodeHealth {
+	node := RedisNodeHealth{Addr: client.Options().Addr, CheckedAt: time.Now()}
+	start := time.Now()
+	if err := client.Ping(ctx).Err(); err != nil {
+		node.Error = err.Error()
+		return node
+	}
+	node.Latency = time.Since(start)
+	raw, err := client.Info(ctx).Result()
+	if err != nil {
+		node.Error = err.Error()
+		return node
+	}
+	node.Info = ParseRedisInfo(raw)
+	node.Role = node.Info.Replication.Role
+	node.Healthy = true
+	return node
+}
+
+func checkRedisCluster(ctx context.Context, client *redis.ClusterClient) *RedisClusterHealth {
+	cluster := &RedisClusterHealth{}
+	if raw, err := client.ClusterInfo(ctx).Result(); err == nil {
+		fields := parseInfoFields(raw)
+		cluster.State = fields["cluster_state"]
+		cluster.SlotsAssigned = parseInfoInt(fields["cluster_slots_assigned"])
+		cluster.SlotsOk = parseInfoInt(fields["cluster_slots_ok"])
+		cluster.SlotsPfail = parseInfoInt(fields["cluster_slots_pfail"])
+		cluster.SlotsFail = parseInfoInt(fields["cluster_slots_fail"])
+		cluster.KnownNodes = parseInfoInt(fields["cluster_known_nodes"])
+	} else {
+		cluster.State = "unknown"
+	}
+	if slots, err := client.ClusterSlots(ctx).Result(); err == nil {
+		masters := make(map[string]struct{})
+		for _, slot := range slots {
+			cluster.SlotsCovered += int64(slot.End - slot.Start + 1)
+			if len(slot.Nodes) > 0 {
+				masters[slot.Nodes[0].Addr] = struct{}{}
+			}
+		}
+		for addr := range masters {
+			cluster.Masters = append(cluster.Masters, addr)
+		}
+		sort.Strings(cluster.Masters)
+		cluster.slots = slots
+	}
+	return cluster
+}
+
+// detectFailovers 对比两次 CLUSTER SLOTS 结果, 槽位主节点变化视为一次故障转移
+func (m *healthMonitor) detectFailovers(cluster *RedisClusterHealth) []RedisFailoverEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cluster.slots == nil {
+		return append([]RedisFailoverEvent(nil), m.failovers...)
+	}
+	current := make(map[int]string, len(cluster.slots))
+	for _, slot := range cluster.slots {
+		if len(slot.Nodes) == 0 {
+			continue
+		}
+		master := slot.Nodes[0].Addr
+		current[slot.Start] = master
+		if prev, ok := m.slotMaster[slot.Start]; ok && prev != master {
+			event := RedisFailoverEvent{
+				SlotStart:  slot.Start,
+				SlotEnd:    slot.End,
+				FromMaster: prev,
+				ToMaster:   master,
+				DetectedAt: time.Now(),
+			}
+			Logger.Warn(GetLogPrefix("") + fmt.Sprintf("Redis 集群发生故障转移! 槽位 %d-%d 主节点 %s -> %s",
+				event.SlotStart, event.SlotEnd, event.FromMaster, event.ToMaster))
+			m.failovers = append(m.failovers, event)
+		}
+	}
+	if len(m.failovers) > maxFailoverEvents {
+		m.failovers = m.failovers[len(m.failovers)-maxFailoverEvents:]
+	}
+	m.slotMaster = current
+	cluster.slots = nil
+	return append([]RedisFailoverEvent(nil), m.failovers...)
+}
+
+func (t RedisHealthThresholds) check(health *RedisHealth) []string {
+	var warnings []string
+	for _, node := range health.Nodes {
+		if !node.Healthy {
+			warnings = append(warnings, fmt.Sprintf("Redis 节点 %s 不可用! 错误原因: %s", node.Addr, node.Error))
+			continue
+		}
+		info := node.Info
+		if t.MaxLatency > 0 && node.Latency > t.MaxLatency {
+			warnings = append(warnings, fmt.Sprintf("Redis 节点 %s PING 延迟 %v 超过阈值 %v", node.Addr, node.Latency, t.MaxLatency))
+		}
+		if t.MaxMemoryRatio > 0 && info.Memory.MaxMemory > 0 {
+			ratio := float64(info.Memory.UsedMemory) / float64(info.Memory.MaxMemory)
+			if ratio > t.MaxMemoryRatio {
+				warnings = append(warnings, fmt.Sprintf("Redis 节点 %s 内存使用率 %.2f 超过阈值 %.2f", node.Addr, ratio, t.MaxMemoryRatio))
+			}
+		}
+		if t.MaxClients > 0 && info.Clients.ConnectedClients > t.MaxClients {
+			warnings = append(warnings, fmt.Sprintf("Redis 节点 %s 客户端连接数 %d 超过阈值 %d", node.Addr, info.Clients.ConnectedClients, t.MaxClients))
+		}
+		if t.MaxReplicationLag > 0 {
+			for _, replica := range info.Replication.Replicas {
+				if replica.LagBytes > t.MaxReplicationLag {
+					warnings = append(warnings, fmt.Sprintf("Redis 节点 %s 的从节点 %s 复制延迟 %d 字节超过阈值 %d",
+						node.Addr, replica.Addr, replica.LagBytes, t.MaxReplicationLag))
+				}
+			}
+		}
+		if info.Replication.Role == "slave" && info.Replication.MasterLinkStatus != "" && info.Replication.MasterLinkStatus != "up" {
+			warnings = append(warnings, fmt.Sprintf("Redis 从节点 %s 与主节点连接状态为 %s", node.Addr, info.Replication.MasterLinkStatus))
+		}
+		if status := info.Persistence.RdbLastBgsaveStatus; status != "" && status != "ok" {
+			warnings = append(warnings, fmt.Sprintf("Redis 节点 %s 最近一次 RDB 持久化失败", node.Addr))
+		}
+		if status := info.Persistence.AofLastWriteStatus; info.Persistence.AofEnabled && status != "" && status != "ok" {
+			warnings = append(warnings, fmt.Sprintf("Redis 节点 %s 最近一次 AOF 写入失败", node.Addr))
+		}
+	}
+	if cluster := health.Cluster; cluster != nil {
+		if cluster.State != "ok" {
+			warnings = append(warnings, fmt.Sprintf("Redis 集群状态异常: %s", cluster.State))
+		}
+		if cluster.SlotsCovered > 0 && cluster.SlotsCovered < redisClusterSlots {
+			warnings = append(warnings, fmt.Sprintf("Redis 集群槽位未完全覆盖: %d/%d", cluster.SlotsCovered, redisClusterSlots))
+		}
+		if cluster.SlotsPfail > 0 || cluster.SlotsFail > 0 {
+			warnings = append(warnings, fmt.Sprintf("Redis 集群存在异常槽位: pfail=%d fail=%d", cluster.SlotsPfail, cluster.SlotsFail))
+		}
+	}
+	return warnings
+}
+
+// ParseRedisInfo 解析 INFO 命令返回的文本
+func ParseRedisInfo(raw string) RedisInfo {
+	fields := parseInfoFields(raw)
+	info := RedisInfo{
+		Memory: RedisMemoryInfo{
+			UsedMemory:         parseInfoInt(fields["used_memory"]),
+			UsedMemoryRss:      parseInfoInt(fields["used_memory_rss"]),
+			UsedMemoryPeak:     parseInfoInt(fields["used_memory_peak"]),
+			MaxMemory:          parseInfoInt(fields["maxmemory"]),
+			MaxMemoryPolicy:    fields["maxmemory_policy"],
+			FragmentationRatio: parseInfoFloat(fields["mem_fragmentation_ratio"]),
+		},
+		Clients: RedisClientsInfo{
+			ConnectedClients: parseInfoInt(fields["connected_clients"]),
+			BlockedClients:   parseInfoInt(fields["blocked_clients"]),
+		},
+		Replication: RedisReplicationInfo{
+			Role:                  fields["role"],
+			ConnectedSlaves:       parseInfoInt(fields["connected_slaves"]),
+			MasterReplOffset:      parseInfoInt(fields["master_repl_offset"]),
+			MasterHost:            fields["master_host"],
+			MasterPort:            int(parseInfoInt(fields["master_port"])),
+			MasterLinkStatus:      fields["master_link_status"],
+			MasterLastIOSecondAgo: parseInfoInt(fields["master_last_io_seconds_ago"]),
+			SlaveReplOffset:       parseInfoInt(fields["slave_repl_offset"]),
+		},
+		Persistence: RedisPersistenceInfo{
+			Loading:                 fields["loading"] == "1",
+			RdbChangesSinceLastSave: parseInfoInt(fields["rdb_changes_since_last_save"]),
+			RdbBgsaveInProgress:     fields["rdb_bgsave_in_progress"] == "1",
+			RdbLastBgsaveStatus:     fields["rdb_last_bgsave_status"],
+			AofEnabled:              fields["aof_enabled"] == "1",
+			AofRewriteInProgress:    fields["aof_rewrite_in_progress"] == "1",
+			AofLastWriteStatus:      fields["aof_last_write_status"],
+		},
+	}
+	if lastSave := parseInfoInt(fields["rdb_last_save_time"]); lastSave > 0 {
+		info.Persistence.RdbLastSaveTime = time.Unix(lastSave, 0)
+	}
+	for i := int64(0); i < info.Replication.ConnectedSlaves; i++ {
+		line, ok := fields["slave"+strconv.FormatInt(i, 10)]
+		if !ok {
+			continue
+		}
+		attrs := parseInfoAttrs(line)
+		replica := RedisReplicaInfo{
+			Addr:       attrs["ip"] + ":" + attrs["port"],
+			State:      attrs["state"],
+			Offset:     parseInfoInt(attrs["offset"]),
+			LagSeconds: parseInfoInt(attrs["lag"]),
+		}
+		replica.LagBytes = info.Replication.MasterReplOffset - replica.Offset
+		info.Replication.Replicas = append(info.Replication.Replicas, replica)
+	}
+	for key, line := range fields {
+		if !strings.HasPrefix(key, "db") {
+			continue
+		}
+		if _, err := strconv.Atoi(key[2:]); err != nil {
+			continue
+		}
+		attrs := parseInfoAttrs(line)
+		info.Keyspace = append(info.Keyspace, RedisKeyspaceInfo{
+			DB:      key,
+			Keys:    parseInfoInt(attrs["keys"]),
+			Expires: parseInfoInt(attrs["expires"]),
+			AvgTTL:  parseInfoInt(attrs["avg_ttl"]),
+		})
+	}
+	sort.Slice(info.Keyspace, func(i, j int) bool {
+		return info.Keyspace[i].DB < info.Keyspace[j].DB
+	})
+	return info
+}
+
+// parseInfoFields 将 "key:value" 行解析为 map, 忽略 "# Section" 标题行
+func parseInfoFields(raw string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexByte(line, ':'); i > 0 {
+			fields[line[:i]] = line[i+1:]
+		}
+	}
+	return fields
+}
+
+// parseInfoAttrs 解析 "k1=v1,k2=v2" 形式的值
+func parseInfoAttrs(value string) map[string]string {
+	attrs := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if i := strings.IndexByte(pair, '='); i > 0 {
+			attrs[pair[:i]] = pair[i+1:]
+		}
+	}
+	return attrs
+}
+
+func parseInfoInt(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
+
+func parseInfoFloat(value string) float64 {
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
@@ -0,0 +1,152 @@
+package go_toolbox
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const sampleInfo = "# Clients\r\n" +
+	"connected_clients:120\r\n" +
+	"blocked_clients:2\r\n" +
+	"\r\n" +
+	"# Memory\r\n" +
+	"used_memory:900\r\n" +
+	"used_memory_rss:1200\r\n" +
+	"used_memory_peak:950\r\n" +
+	"maxmemory:1000\r\n" +
+	"maxmemory_policy:allkeys-lru\r\n" +
+	"mem_fragmentation_ratio:1.33\r\n" +
+	"\r\n" +
+	"# Persistence\r\n" +
+	"loading:0\r\n" +
+	"rdb_changes_since_last_save:17\r\n" +
+	"rdb_last_save_time:1700000000\r\n" +
+	"rdb_last_bgsave_status:err\r\n" +
+	"aof_enabled:0\r\n" +
+	"\r\n" +
+	"# Replication\r\n" +
+	"role:master\r\n" +
+	"connected_slaves:1\r\n" +
+	"slave0:ip=10.0.0.2,port=6379,state=online,offset=400,lag=1\r\n" +
+	"master_repl_offset:1000\r\n" +
+	"\r\n" +
+	"# Keyspace\r\n" +
+	"db1:keys=5,expires=1,avg_ttl=300\r\n" +
+	"db0:keys=10,expires=2,avg_ttl=0\r\n"
+
+func TestParseRedisInfo(t *testing.T) {
+	info := ParseRedisInfo(sampleInfo)
+	if info.Memory.UsedMemory != 900 || info.Memory.MaxMemory != 1000 || info.Memory.MaxMemoryPolicy != "allkeys-lru" {
+		t.Fatalf("unexpected memory info: %+v", info.Memory)
+	}
+	if info.Clients.ConnectedClients != 120 || info.Clients.BlockedClients != 2 {
+		t.Fatalf("unexpected clients info: %+v", info.Clients)
+	}
+	if len(info.Replication.Replicas) != 1 || info.Replication.Replicas[0].Addr != "10.0.0.2:6379" ||
+		info.Replication.Replicas[0].LagBytes != 600 {
+		t.Fatalf("unexpected replication info: %+v", info.Replication)
+	}
+	if len(info.Keyspace) != 2 || info.Keyspace[0].DB != "db0" || info.Keyspace[0].Keys != 10 {
+		t.Fatalf("unexpected keyspace info: %+v", info.Keyspace)
+	}
+	if info.Persistence.RdbLastSaveTime.Unix() != 1700000000 || info.Persistence.RdbChangesSinceLastSave != 17 {
+		t.Fatalf("unexpected persistence info: %+v", info.Persistence)
+	}
+}
+
+func TestHealthThresholds(t *testing.T) {
+	health := RedisHealth{Nodes: []RedisNodeHealth{{
+		Addr:    "10.0.0.1:6379",
+		Healthy: true,
+		Latency: 50 * time.Millisecond,
+		Info:    ParseRedisInfo(sampleInfo),
+	}}}
+	thresholds := RedisHealthThresholds{
+		MaxMemoryRatio:    0.8,
+		MaxClients:        100,
+		MaxReplicationLag: 500,
+		MaxLatency:        10 * time.Millisecond,
+	}
+	// 延迟, 内存, 连接数, 复制延迟, RDB 失败
+	if warnings := thresholds.check(&health); len(warnings) != 5 {
+		t.Fatalf("expected 5 warnings, got %d: %v", len(warnings), warnings)
+	}
+	if warnings := (RedisHealthThresholds{}).check(&health); len(warnings) != 1 {
+		t.Fatalf("expected only the persistence warning, got %v", warnings)
+	}
+}
+
+func TestDetectFailovers(t *testing.T) {
+	monitor := &healthMonitor{}
+	slots := func(master string) []redis.ClusterSlot {
+		return []redis.ClusterSlot{
+			{Start: 0, End: 8191, Nodes: []redis.ClusterNode{{Addr: "10.0.0.1:6379"}}},
+			{Start: 8192, End: 16383, Nodes: []redis.ClusterNode{{Addr: master}}},
+		}
+	}
+	if events := monitor.detectFailovers(&RedisClusterHealth{slots: slots("10.0.0.2:6379")}); len(events) != 0 {
+		t.Fatalf("first snapshot should not report failovers: %v", events)
+	}
+	events := monitor.detectFailovers(&RedisClusterHealth{slots: slots("10.0.0.3:6379")})
+	if len(events) != 1 || events[0].SlotStart != 8192 || events[0].ToMaster != "10.0.0.3:6379" {
+		t.Fatalf("expected one failover, got %v", events)
+	}
+}
+
+func TestRedisHealthCached(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	// 未启动监控时不发起检查, 节点不可用也立即返回
+	redisHandler.SetDown(true)
+	start := time.Now()
+	if _, ok := redisHandler.Health(); ok || time.Since(start) > 100*time.Millisecond {
+		t.Fatal("Health should report unknown without running a check")
+	}
+	redisHandler.SetDown(false)
+
+	redisHandler.StartHealthMonitor(time.Hour, RedisHealthThresholds{})
+	defer redisHandler.StopHealthMonitor()
+	waitFor(t, "first health check", func() bool {
+		health, ok := redisHandler.Health()
+		return ok && health.Healthy && len(health.Nodes) == 1
+	})
+	redisHandler.StopHealthMonitor()
+	if _, ok := redisHandler.Health(); ok {
+		t.Fatal("Health should report unknown after the monitor stops")
+	}
+}
+
+func TestRedisHealthRingShardDown(t *testing.T) {
+	ring, err := NewFakeRedisRing(RingHashRendezvous, 5*time.Millisecond, "a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ring.ShutdownRedisHandler()
+
+	ctx := context.Background()
+	if health := ring.CheckHealth(ctx, RedisHealthThresholds{}); !health.Healthy || len(health.Nodes) != 3 {
+		t.Fatalf("unexpected health %+v", health)
+	}
+	ring.Shards["b"].SetDown(true)
+	waitFor(t, "shard b to be marked down", func() bool {
+		for _, shard := range ring.RingShards() {
+			if shard.Name == "b" {
+				return !shard.Up
+			}
+		}
+		return false
+	})
+	health := ring.CheckHealth(ctx, RedisHealthThresholds{})
+	if health.Healthy || len(health.Nodes) != 3 {
+		t.Fatalf("a down shard should make the ring unhealthy, got %+v", health)
+	}
+	for _, node := range health.Nodes {
+		if node.Healthy == (node.Addr == ring.ModelRedisHandler.Shards["b"]) {
+			t.Fatalf("unexpected node health %+v", node)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package go_toolbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultRetryMaxAttempts        int = 3
+	DefaultRetryBaseBackoff            = 20 * time.Millisecond
+	DefaultRetryMaxBackoff             = time.Second
+	DefaultRetryBudgetRatio            = 0.1
+	DefaultRetryBudgetBurst            = 20.0
+	DefaultRetryBudgetMinPerSecond     = 1.0
+)
+
+// RedisErrorClass 错误分类, 决定命令能否重试
+type RedisErrorClass int
+
+const (
+	// RedisErrorNone 成功或 redis.Nil
+	RedisErrorNone RedisErrorClass = iota
+	// RedisErrorRejected 服务端或连接池在执行前拒绝 (LOADING, TRYAGAIN, CLUSTERDOWN, MASTERDOWN, 连接失败等), 命令一定未执行, 任何命令都可以重试
+	RedisErrorRejected
+	// RedisErrorAmbiguous 请求已发出但未收到回复 (超时, 连接被重置等), 命令可能已执行, 默认只重试幂等命令
+	RedisErrorAmbiguous
+	// RedisErrorPermanent 重试无意义的错误 (WRONGTYPE 等服务端错误, 熔断器拒绝, 调用方取消)
+	RedisErrorPermanent
+)
+
+func (c RedisErrorClass) String() string {
+	switch c {
+	case RedisErrorNone:
+		return "none"
+	case RedisErrorRejected:
+		return "rejected"
+	case RedisErrorAmbiguous:
+		return "ambiguous"
+	case RedisErrorPermanent:
+		return "permanent"
+	default:
+		return "unknown(" + strconv.Itoa(int(c)) + ")"
+	}
+}
+
+// ClassifyRedisError 默认的错误分类
+func ClassifyRedisError(err error) RedisErrorClass {
+	if err == nil || err == redis.Nil {
+		return RedisErrorNone
+	}
+	if err == ErrRedisCircuitOpen || err == redis.ErrClosed || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return RedisErrorPermanent
+	}
+	if _, ok := err.(redis.Error); ok {
+		for _, prefix := range []string{"LOADING", "TRYAGAIN", "CLUSTERDOWN", "MASTERDOWN", "BUSY"} {
+			if redis.HasErrorPrefix(err, prefix) {
+				return RedisErrorRejected
+			}
+		}
+		if err.Error() == "ERR max number of clients reached" {
+			return RedisErrorRejected
+		}
+		return RedisErrorPermanent
+	}
+	var opErr *net.OpError
+	if (errors.As(err, &opErr) && opErr.Op == "dial") || errors.Is(err, syscall.ECONNREFUSED) {
+		return RedisErrorRejected
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) {
+		return RedisErrorAmbiguous
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return RedisErrorAmbiguous
+	}
+	return RedisErrorPermanent
+}
+
+// RedisRetryPolicy Redis 命令的重试策略
+// 每次尝试都经过熔断器, 熔断器打开后立即停止重试; 同一 Handler 的全部命令共享重试预算,
+// 预算按请求量的 BudgetRatio 积累, 用尽后不再重试, 避免故障时重试放大流量
+type RedisRetryPolicy struct {
+	// MaxAttempts 最多尝试次数 (包含首次), 小于等于 1 时不重试, 默认 3
+	MaxAttempts int
+	// BaseBackoff 首次重试前的退避时间, 之后每次翻倍并加入随机抖动, 默认 20 毫秒
+	BaseBackoff time.Duration
+	// MaxBackoff 单次退避的上限, 默认 1 秒
+	MaxBackoff time.Duration
+	// RetryNonIdempotent 为 true 时 RedisErrorAmbiguous 也重试非幂等命令 (如 LPUSH, INCR), 可能重复执行
+	RetryNonIdempotent bool
+	// BudgetRatio 每个请求为重试预算积累的额度, 默认 0.1, 即重试量约为请求量的 10%
+	BudgetRatio float64
+	// BudgetBurst 预算上限, 也是初始额度, 默认 20
+	BudgetBurst float64
+	// BudgetMinPerSecond 每秒固定补充的额度, 保证低流量时也能重试, 默认 1
+	BudgetMinPerSecond float64
+	// IdempotentCommands 额外视为幂等的命令 (如业务上带去重的 LPUSH), 模糊错误时同样重试, 不区分大小写
+	// Handler 的 Set/AppendList 等方法不接受 ctx, 无法使用 WithIdempotent, 通过此项按命令声明
+	IdempotentCommands []string
+	// Classifier 自定义错误分类, 为 nil 时使用 ClassifyRedisError
+	Classifier func(err error) RedisErrorClass
+}
+
+func (p RedisRetryPolicy) withDefaults() RedisRetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if p.BaseBackoff <= 0 {
+		p.BaseBackoff = DefaultRetryBaseBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	if p.BudgetRatio <= 0 {
+		p.BudgetRatio = DefaultRetryBudgetRatio
+	}
+	if p.BudgetBurst <= 0 {
+		p.BudgetBurst = DefaultRetryBudgetBurst
+	}
+	if p.BudgetMinPerSecond <= 0 {
+		p.BudgetMinPerSecond = DefaultRetryBudgetMinPerSecond
+	}
+	if p.Classifier == nil {
+		p.Classifier = ClassifyRedisError
+	}
+	return p
+}
+
+// backoff 第 attempt 次重试前的退避时间, 在 [d/2, d) 之间随机
+func (p RedisRetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+type retryContextKey struct{}
+
+type retryOverride struct {
+	policy     *RedisRetryPolicy
+	idempotent bool
+	disabled   bool
+}
+
+func retryOverrideFrom(ctx context.Context) retryOverride {
+	override, _ := ctx.Value(retryContextKey{}).(retryOverride)
+	return override
+}
+
+// WithRetryPolicy 返回使用 policy 重试的 ctx, 用于单次调用覆盖 Handler 的默认策略
+// 只对接受 ctx 的调用生效: Handler 的 Transaction, PipelineExecute, ListBLPop/ListBRPop, SetScan, 以及直接使用的 RedisClient/RedisRingClient;
+// 不接受 ctx 的 Handler 方法 (Set, AppendList 等) 始终使用 SetRetryPolicy 设置的策略, 按命令的调整见 RedisRetryPolicy.IdempotentCommands
+func WithRetryPolicy(ctx context.Context, policy RedisRetryPolicy) context.Context {
+	override := retryOverrideFrom(ctx)
+	override.policy = &policy
+	return context.WithValue(ctx, retryContextKey{}, override)
+}
+
+// WithIdempotent 声明本次调用的命令可以安全地重复执行 (例如带去重的 LPUSH), 模糊错误时也会重试
+func WithIdempotent(ctx context.Context) context.Context {
+	override := retryOverrideFrom(ctx)
+	override.idempotent = true
+	return context.WithValue(ctx, retryContextKey{}, override)
+}
+
+// WithoutRetry 本次调用不重试
+func WithoutRetry(ctx context.Context) context.Context {
+	override := retryOverrideFrom(ctx)
+	override.disabled = true
+	return context.WithValue(ctx, retryContextKey{}, override)
+}
+
+// redisRetrier 作为 go-redis 的 Hook 对每条命令与 Pipeline 按策略重试
+type redisRetrier struct {
+	mu     sync.Mutex
+	policy RedisRetryPolicy
+	tokens float64
+	last   time.Time
+}
+
+// SetRetryPolicy 设置 Handler 的默认重试策略, MaxAttempts 小于 0 时关闭重试
+// 首次设置时安装重试 Hook 并关闭 go-redis 内置的重试 (其不区分命令是否幂等), 首次设置需在使用 Handler 之前完成,
+// 之后可以随时修改策略
+// 集群模式不支持, 返回 false: ClusterClient 在 MaxRedirects 次内自行重试 EOF/超时等错误, 且与 MOVED/ASK 重定向共用同一循环无法单独关闭,
+// 叠加重试 Hook 会使尝试次数相乘; 集群模式下沿用 go-redis 内置的重试, 非幂等命令 (LPUSH, INCR 等) 在模糊错误后可能重复执行
+func (r *ModelRedisHandler) SetRetryPolicy(policy RedisRetryPolicy) bool {
+	if r.IsCluster {
+		Logger.Error(GetLogPrefix("") + r.logName() + " 集群模式不支持 SetRetryPolicy, 沿用 go-redis 内置的重试!")
+		return false
+	}
+	policy = policy.withDefaults()
+	r.retryOnce.Do(func() {
+		r.retrier = &redisRetrier{tokens: policy.BudgetBurst, last: time.Now()}
+		r.addHook(r.retrier)
+		if r.isRing() {
+			r.RedisRingClient.Options().MaxRetries = 0
+		} else {
+			r.RedisClient.Options().MaxRetries = 0
+		}
+	})
+	r.retrier.mu.Lock()
+	r.retrier.policy = policy
+	if r.retrier.tokens > policy.BudgetBurst {
+		r.retrier.tokens = policy.BudgetBurst
+	}
+	r.retrier.mu.Unlock()
+	return true
+}
+
+// RetryPolicy 当前的默认重试策略, 未设置时返回 false
+func (r *ModelRedisHandler) RetryPolicy() (RedisRetryPolicy, bool) {
+	if r.retrier == nil {
+		return RedisRetryPolicy{}, false
+	}
+	r.retrier.mu.Lock()
+	defer r.retrier.mu.Unlock()
+	return r.retrier.policy, true
+}
+
+func (rt *redisRetrier) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (rt *redisRetrier) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		return rt.do(ctx, cmd.Name(), []redis.Cmder{cmd}, func() error {
+			return next(ctx, cmd)
+		})
+	}
+}
+
+func (rt *redisRetrier) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		return rt.do(ctx, "pipeline", cmds, func() error {
+			return next(ctx, cmds)
+		})
+	}
+}
+
+func (rt *redisRetrier) do(ctx context.Context, name string, cmds []redis.Cmder, attempt func() error) error {
+	override := retryOverrideFrom(ctx)
+	rt.mu.Lock()
+	policy := rt.policy
+	rt.deposit(policy)
+	rt.mu.Unlock()
+	if override.policy != nil {
+		policy = override.policy.withDefaults()
+	}
+	err := attempt()
+	if override.disabled || policy.MaxAttempts <= 1 {
+		return err
+	}
+	for n := 1; ; n++ {
+		class := policy.Classifier(err)
+		switch class {
+		case RedisErrorNone, RedisErrorPermanent:
+			return err
+		}
+		// Pipeline 中只有出错的命令确定未执行, 其余命令可能已执行, 因此同样要求全部幂等
+		if (class == RedisErrorAmbiguous || len(cmds) > 1) &&
+			!policy.RetryNonIdempotent && !override.idempotent && !policy.idempotent(cmds) {
+			return err
+		}
+		if n >= policy.MaxAttempts {
+			Logger.Warn(GetLogPrefix("") + "Redis 命令 " + strings.ToUpper(name) + " 重试 " + strconv.Itoa(n-1) + " 次后仍失败! 错误原因: " + err.Error())
+			return err
+		}
+		if !rt.withdraw(policy) {
+			Logger.Warn(GetLogPrefix("") + "Redis 重试预算已用尽, 命令 " + strings.ToUpper(name) + " 不再重试! 错误原因: " + err.Error())
+			return err
+		}
+		timer := time.NewTimer(policy.backoff(n))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		for _, cmd := range cmds {
+			cmd.SetErr(nil)
+		}
+		err = attempt()
+	}
+}
+
+// deposit 每个请求积累预算, 调用方持有 mu
+func (rt *redisRetrier) deposit(policy RedisRetryPolicy) {
+	rt.tokens += policy.BudgetRatio
+	if rt.tokens > policy.BudgetBurst {
+		rt.tokens = policy.BudgetBurst
+	}
+}
+
+// withdraw 扣除一次重试的预算, 不足时返回 false
+func (rt *redisRetrier) withdraw(policy RedisRetryPolicy) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	now := time.Now()
+	rt.tokens += now.Sub(rt.last).Seconds() * policy.BudgetMinPerSecond
+	rt.last = now
+	if rt.tokens > policy.BudgetBurst {
+		rt.tokens = policy.BudgetBurst
+	}
+	if rt.tokens < 1 {
+		return false
+	}
+	rt.tokens--
+	return true
+}
+
+// redisIdempotentCmds 重复执行不会改变最终状态的命令 (返回值可能不同, 例如重复 DEL 返回 0)
+var redisIdempotentCmds = map[string]bool{
+	"get": true, "mget": true, "strlen": true, "getrange": true, "exists": true, "type": true, "ttl": true, "pttl": true,
+	"hget": true, "hmget": true, "hgetall": true, "hlen": true, "hexists": true, "hkeys": true, "hvals": true, "hscan": true,
+	"llen": true, "lindex": true, "lrange": true, "scard": true, "smembers": true, "sismember": true, "smismember": true, "sscan": true,
+	"zscore": true, "zmscore": true, "zcard": true, "zcount": true, "zrange": true, "zrangebyscore": true, "zrevrange": true, "zrank": true, "zscan": true,
+	"geopos": true, "geodist": true, "geosearch": true, "geohash": true, "pfcount": true, "dump": true,
+	"scan": true, "keys": true, "dbsize": true, "ping": true, "echo": true, "info": true, "time": true, "select": true, "hello": true, "client": true, "command": true,
+	"bf.exists": true, "bf.mexists": true, "bf.info": true, "json.get": true, "json.mget": true, "json.objkeys": true, "json.type": true,
+	"ft.search": true, "ft.aggregate": true, "ft.info": true, "ft._list": true,
+	"mset": true, "hset": true, "hmset": true, "lset": true, "del": true, "unlink": true, "hdel": true,
+	"sadd": true, "srem": true, "zrem": true, "geoadd": true, "pfadd": true, "bf.add": true, "bf.madd": true, "json.del": true,
+	"expire": true, "pexpire": true, "expireat": true, "pexpireat": true, "persist": true, "setex": true, "psetex": true,
+	"watch": true, "unwatch": true, "multi": true, "exec": true,
+}
+
+// idempotent 全部命令都幂等 (内置列表或 IdempotentCommands) 时返回 true
+func (p RedisRetryPolicy) idempotent(cmds []redis.Cmder) bool {
+	for _, cmd := range cmds {
+		if !idempotentRedisCmd(cmd) && !p.declaredIdempotent(cmd.Name()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p RedisRetryPolicy) declaredIdempotent(name string) bool {
+	for _, declared := range p.IdempotentCommands {
+		if strings.EqualFold(declared, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func idempotentRedisCmd(cmd redis.Cmder) bool {
+	name := strings.ToLower(cmd.Name())
+	if redisIdempotentCmds[name] {
+		return true
+	}
+	args := cmd.Args()
+	switch name {
+	case "set", "json.set":
+		// NX/XX 的结果依赖执行前的状态, GET 会返回被自己覆盖后的值
+		for _, arg := range redisArgsFrom(args, 3) {
+			switch strings.ToUpper(strings.TrimSpace(toRedisArgString(arg))) {
+			case "NX", "XX", "GET":
+				return false
+			}
+		}
+		return true
+	case "zadd":
+		for _, arg := range redisArgsFrom(args, 2) {
+			if strings.EqualFold(toRedisArgString(arg), "INCR") {
+				return false
+			}
+		}
+		return true
+	case "restore":
+		for _, arg := range redisArgsFrom(args, 4) {
+			if strings.EqualFold(toRedisArgString(arg), "REPLACE") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func redisArgsFrom(args []interface{}, i int) []interface{} {
+	if i >= len(args) {
+		return nil
+	}
+	return args[i:]
+}
+
+func toRedisArgString(arg interface{}) string {
+	if s, ok := arg.(string); ok {
+		return s
+	}
+	return ""
+}
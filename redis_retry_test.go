@@ -0,0 +1,118 @@
+package go_toolbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestClassifyRedisError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want RedisErrorClass
+	}{
+		{nil, RedisErrorNone},
+		{redis.Nil, RedisErrorNone},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, RedisErrorRejected},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, RedisErrorAmbiguous},
+		{io.EOF, RedisErrorAmbiguous},
+		{ErrRedisCircuitOpen, RedisErrorPermanent},
+		{context.Canceled, RedisErrorPermanent},
+		{errors.New("boom"), RedisErrorPermanent},
+	}
+	for _, c := range cases {
+		if got := ClassifyRedisError(c.err); got != c.want {
+			t.Errorf("ClassifyRedisError(%v) = %s, want %s", c.err, got, c.want)
+		}
+	}
+}
+
+func TestRedisRetryPolicy(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	if !redisHandler.SetRetryPolicy(RedisRetryPolicy{BaseBackoff: time.Millisecond}) {
+		t.Fatal("SetRetryPolicy should be accepted in standalone mode")
+	}
+	ctx := context.Background()
+	client := redisHandler.RedisClient
+
+	// 服务端拒绝的命令一定未执行, 非幂等命令也可以重试
+	redisHandler.FailNext("LPUSH", 1, "LOADING Redis is loading the dataset in memory")
+	if !redisHandler.AppendList("queue", "a") {
+		t.Fatal("LOADING should be retried")
+	}
+	// 执行后断开连接: 非幂等命令不重试, 避免重复写入
+	redisHandler.FailNext("LPUSH", 1, "")
+	if redisHandler.AppendList("queue", "b") {
+		t.Fatal("LPUSH should not be retried after an ambiguous failure")
+	}
+	if n := client.LLen(ctx, "queue").Val(); n != 2 {
+		t.Fatalf("LPUSH should be applied exactly once per call, got length %d", n)
+	}
+	// 幂等命令在模糊错误后重试
+	redisHandler.FailNext("SET", 1, "")
+	if !redisHandler.Set("k", "v", 0) {
+		t.Fatal("SET should be retried after an ambiguous failure")
+	}
+	// 单次调用声明幂等
+	redisHandler.FailNext("LPUSH", 1, "")
+	if err := client.LPush(WithIdempotent(ctx), "queue", "c").Err(); err != nil {
+		t.Fatalf("LPUSH declared idempotent should be retried: %v", err)
+	}
+	// 单次调用关闭重试
+	redisHandler.FailNext("GET", 1, "TRYAGAIN Multiple keys request during rehashing of slot")
+	if err := client.Get(WithoutRetry(ctx), "k").Err(); err == nil {
+		t.Fatal("WithoutRetry should surface the first error")
+	}
+	// 重试次数用尽
+	redisHandler.FailNext("GET", 3, "CLUSTERDOWN The cluster is down")
+	if _, ok := redisHandler.Get("k"); ok {
+		t.Fatal("GET should fail after MaxAttempts")
+	}
+	redisHandler.FailNext("GET", 3, "CLUSTERDOWN The cluster is down")
+	if err := client.Get(WithRetryPolicy(ctx, RedisRetryPolicy{MaxAttempts: 4, BaseBackoff: time.Millisecond}), "k").Err(); err != nil {
+		t.Fatalf("per-call policy should allow more attempts: %v", err)
+	}
+	// 按命令声明幂等, 不接受 ctx 的 Handler 方法同样生效
+	redisHandler.SetRetryPolicy(RedisRetryPolicy{BaseBackoff: time.Millisecond, IdempotentCommands: []string{"lpush"}})
+	redisHandler.FailNext("LPUSH", 1, "")
+	if !redisHandler.AppendList("queue", "d") {
+		t.Fatal("LPUSH listed in IdempotentCommands should be retried")
+	}
+	// 永久错误不重试
+	redisHandler.FailNext("GET", 1, "WRONGTYPE Operation against a key holding the wrong kind of value")
+	if _, ok := redisHandler.Get("k"); ok {
+		t.Fatal("WRONGTYPE should not be retried")
+	}
+}
+
+func TestRedisRetryBudget(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	redisHandler.SetRetryPolicy(RedisRetryPolicy{BaseBackoff: time.Millisecond, BudgetBurst: 1, BudgetRatio: 0.01, BudgetMinPerSecond: 0.001})
+
+	redisHandler.FailNext("GET", 1, "LOADING Redis is loading the dataset in memory")
+	if _, ok := redisHandler.Get("k"); !ok {
+		t.Fatal("the first retry should fit in the budget")
+	}
+	redisHandler.FailNext("GET", 1, "LOADING Redis is loading the dataset in memory")
+	if _, ok := redisHandler.Get("k"); ok {
+		t.Fatal("retries beyond the budget should be refused")
+	}
+}
+
+func TestRedisRetryPolicyCluster(t *testing.T) {
+	redisHandler := &ModelRedisHandler{RedisConf: RedisConf{IsCluster: true, Enable: true}}
+	if redisHandler.SetRetryPolicy(RedisRetryPolicy{}) {
+		t.Fatal("SetRetryPolicy should be refused in cluster mode")
+	}
+	if _, ok := redisHandler.RetryPolicy(); ok {
+		t.Fatal("no retry hook should be installed in cluster mode")
+	}
+}
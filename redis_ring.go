@@ -0,0 +1,260 @@
+package go_toolbox
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/dgryski/go-rendezvous"
+	"github.com/redis/go-redis/v9"
+)
+
+// 分片模式下的一致性哈希算法
+const (
+	RingHashRendezvous = "rendezvous"
+	RingHashKetama     = "ketama"
+)
+
+// ketamaPointsPerShard 每个分片在 ketama 哈希环上的虚拟节点数, 与 libmemcached 保持一致
+const ketamaPointsPerShard = 160
+
+var errRingShardsDown = errors.New("Redis 分片全部下线")
+
+// RingShard 分片模式下单个分片的状态
+type RingShard struct {
+	Name string
+	Addr string
+	Up   bool
+}
+
+// CrossShardError 分片模式下要求同一分片的 key 分布在不同分片
+type CrossShardError struct {
+	Keys   []string
+	Shards []string
+}
+
+func (e *CrossShardError) Error() string {
+	parts := make([]string, 0, len(e.Keys))
+	for i, key := range e.Keys {
+		parts = append(parts, key+"("+e.Shards[i]+")")
+	}
+	return "Redis 分片中 key 不在同一分片, 请使用 {hashtag}! " + strings.Join(parts, ", ")
+}
+
+// redisRing 记录分片模式下当前生效的哈希环与存活分片
+// go-redis 每次心跳发现分片上下线时以存活分片重建哈希环, 这里拦截重建以便计算 key 所属分片并记录上下线日志
+type redisRing struct {
+	mu      sync.RWMutex
+	newHash func(shards []string) redis.ConsistentHash
+	hash    redis.ConsistentHash
+	live    map[string]bool
+}
+
+func newRedisRing(algorithm string) (*redisRing, error) {
+	ring := &redisRing{}
+	switch strings.ToLower(algorithm) {
+	case "", RingHashRendezvous:
+		ring.newHash = newRendezvousHash
+	case RingHashKetama:
+		ring.newHash = newKetamaHash
+	default:
+		return nil, fmt.Errorf("Redis 分片不支持的哈希算法: %s", algorithm)
+	}
+	return ring, nil
+}
+
+// consistentHash 作为 RingOptions.NewConsistentHash 使用
+func (g *redisRing) consistentHash(shards []string) redis.ConsistentHash {
+	hash := g.newHash(shards)
+	live := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		live[shard] = true
+	}
+	g.mu.Lock()
+	previous := g.live
+	g.hash, g.live = hash, live
+	g.mu.Unlock()
+	if previous == nil {
+		return hash
+	}
+	for shard := range previous {
+		if !live[shard] {
+			Logger.Warn(GetLogPrefix("") + "Redis 分片 " + shard + " 已下线, 已从哈希环中移除")
+		}
+	}
+	for shard := range live {
+		if !previous[shard] {
+			Logger.Info(GetLogPrefix("") + "Redis 分片 " + shard + " 已恢复, 已重新加入哈希环")
+		}
+	}
+	return hash
+}
+
+// shardFor key 所属的分片名, 与 go-redis 一致按 {hashtag} 计算; 没有存活分片时返回空字符串
+func (g *redisRing) shardFor(key string) string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.hash == nil || len(g.live) == 0 {
+		return ""
+	}
+	return g.hash.Get(hashTag(key))
+}
+
+func (g *redisRing) isLive(shard string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.live[shard]
+}
+
+type rendezvousHash struct {
+	*rendezvous.Rendezvous
+}
+
+func (h rendezvousHash) Get(key string) string {
+	return h.Lookup(key)
+}
+
+// newRendezvousHash rendezvous (HRW) 哈希, 与 go-redis 默认算法相同
+func newRendezvousHash(shards []string) redis.ConsistentHash {
+	return rendezvousHash{rendezvous.New(shards, xxhash.Sum64String)}
+}
+
+// ketamaHash ketama 哈希环, 每个分片按 md5 生成 ketamaPointsPerShard 个虚拟节点
+type ketamaHash struct {
+	points []uint32
+	owners []string
+}
+
+func newKetamaHash(shards []string) redis.ConsistentHash {
+	type point struct {
+		hash  uint32
+		shard string
+	}
+	points := make([]point, 0, len(shards)*ketamaPointsPerShard)
+	for _, shard := range shards {
+		for i := 0; i < ketamaPointsPerShard/4; i++ {
+			digest := md5.Sum([]byte(shard + "-" + strconv.Itoa(i)))
+			for j := 0; j < 4; j++ {
+				points = append(points, point{binary.LittleEndian.Uint32(digest[j*4:]), shard})
+			}
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash == points[j].hash {
+			return points[i].shard < points[j].shard
+		}
+		return points[i].hash < points[j].hash
+	})
+	k := &ketamaHash{points: make([]uint32, len(points)), owners: make([]string, len(points))}
+	for i, p := range points {
+		k.points[i], k.owners[i] = p.hash, p.shard
+	}
+	return k
+}
+
+func (k *ketamaHash) Get(key string) string {
+	if len(k.points) == 0 {
+		return ""
+	}
+	digest := md5.Sum([]byte(key))
+	hash := binary.LittleEndian.Uint32(digest[:4])
+	i := sort.Search(len(k.points), func(i int) bool { return k.points[i] >= hash })
+	if i == len(k.points) {
+		i = 0
+	}
+	return k.owners[i]
+}
+
+func (r *ModelRedisHandler) isRing() bool {
+	return r.RedisRingClient != nil
+}
+
+// initRedisRingClient 创建分片客户端, dialer 为空时使用默认的 TCP 连接
+func (r *ModelRedisHandler) initRedisRingClient(dialer func(ctx context.Context, network, addr string) (net.Conn, error)) error {
+	if r.IsCluster {
+		return errors.New("Redis 集群模式与分片模式不能同时开启!")
+	}
+	for name, addr := range r.Shards {
+		if name == "" || addr == "" {
+			return errors.New("Redis 分片名称与地址不能为空!")
+		}
+	}
+	ring, err := newRedisRing(r.RingHash)
+	if err != nil {
+		return err
+	}
+	r.ring = ring
+	r.RedisRingClient = redis.NewRing(&redis.RingOptions{
+		Addrs:        r.Shards,
+		Password:     r.Password,
+		DB:           r.Database,
+		PoolSize:     PoolSize,
+		MinIdleConns: MinIdles,
+		NewClient: func(opt *redis.Options) *redis.Client {
+			opt.Limiter = r.limiter(opt.Addr)
+			return redis.NewClient(opt)
+		},
+		HeartbeatFrequency: time.Duration(r.RingHeartbeatMs) * time.Millisecond,
+		NewConsistentHash:  ring.consistentHash,
+		Dialer:             dialer,
+	})
+	return nil
+}
+
+// pingRing 分片模式下要求所有存活分片均可用
+func (r *ModelRedisHandler) pingRing(ctx context.Context) error {
+	if r.RedisRingClient.Len() == 0 {
+		return errRingShardsDown
+	}
+	return r.RedisRingClient.ForEachShard(ctx, func(ctx context.Context, client *redis.Client) error {
+		if err := client.Ping(ctx).Err(); err != nil {
+			return fmt.Errorf("%s: %w", client.Options().Addr, err)
+		}
+		return nil
+	})
+}
+
+// ShardForKey 分片模式下 key 所属的分片名, 非分片模式或没有存活分片时返回空字符串
+func (r *ModelRedisHandler) ShardForKey(key string) string {
+	if !r.isRing() {
+		return ""
+	}
+	return r.ring.shardFor(key)
+}
+
+// RingShards 分片模式下各分片的状态, 连续 3 次心跳失败的分片视为下线, 其上的 key 由其余分片接管
+func (r *ModelRedisHandler) RingShards() []RingShard {
+	if !r.isRing() {
+		return nil
+	}
+	shards := make([]RingShard, 0, len(r.Shards))
+	for _, name := range sortedKeys(r.Shards) {
+		shards = append(shards, RingShard{Name: name, Addr: r.Shards[name], Up: r.ring.isLive(name)})
+	}
+	return shards
+}
+
+// checkSameShard 分片模式下校验 keys 属于同一分片
+func (r *ModelRedisHandler) checkSameShard(keys ...string) error {
+	shards := make([]string, len(keys))
+	same := true
+	for i, key := range keys {
+		shards[i] = r.ring.shardFor(key)
+		if shards[i] != shards[0] {
+			same = false
+		}
+	}
+	if same {
+		return nil
+	}
+	return &CrossShardError{Keys: keys, Shards: shards}
+}
@@ -0,0 +1,128 @@
+package go_toolbox
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRedisRingTransparent(t *testing.T) {
+	for _, hash := range []string{RingHashRendezvous, RingHashKetama} {
+		ring, err := NewFakeRedisRing(hash, 0, "a", "b", "c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 30; i++ {
+			key := fmt.Sprintf("user:%d", i)
+			if !ring.Set(key, i, 0) || !ring.HashSet("h:"+key, "name", key) {
+				t.Fatalf("%s: write failed", hash)
+			}
+			if _, ok := ring.BFAdd("bf:"+key, key); !ok {
+				t.Fatalf("%s: BFAdd failed", hash)
+			}
+		}
+		for i := 0; i < 30; i++ {
+			key := fmt.Sprintf("user:%d", i)
+			if value, ok := ring.Get(key); !ok || value != fmt.Sprint(i) {
+				t.Fatalf("%s: unexpected value %q for %s", hash, value, key)
+			}
+			if name, ok := ring.HashGet("h:"+key, "name"); !ok || name != key {
+				t.Fatalf("%s: unexpected hash field %q", hash, name)
+			}
+			if !ring.BFExists("bf:"+key, key) {
+				t.Fatalf("%s: bloom filter lost %s", hash, key)
+			}
+			// key 只写入 ShardForKey 计算出的分片
+			owner := ring.Shards[ring.ShardForKey(key)]
+			if value, _ := owner.Get(key); value != fmt.Sprint(i) {
+				t.Fatalf("%s: %s is not stored on shard %s", hash, key, ring.ShardForKey(key))
+			}
+		}
+		for name, shard := range ring.Shards {
+			if len(shard.Keys()) == 0 {
+				t.Fatalf("%s: shard %s received no keys", hash, name)
+			}
+		}
+		_ = ring.ShutdownRedisHandler()
+	}
+}
+
+func TestRedisRingCrossShard(t *testing.T) {
+	ring, err := NewFakeRedisRing(RingHashKetama, 0, "a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ring.ShutdownRedisHandler()
+
+	if err := ring.checkSameSlot("{order:1}:items", "{order:1}:total"); err != nil {
+		t.Fatalf("keys with the same hashtag should share a shard: %v", err)
+	}
+	var crossShard *CrossShardError
+	found := false
+	for i := 1; i < 50 && !found; i++ {
+		err := ring.checkSameSlot("k:0", fmt.Sprintf("k:%d", i))
+		found = errors.As(err, &crossShard)
+	}
+	if !found {
+		t.Fatal("keys on different shards should be rejected")
+	}
+	if _, err := NewFakeRedisRing("crc32", 0, "a"); err == nil {
+		t.Fatal("unknown hash algorithms should be rejected")
+	}
+}
+
+func TestKetamaStability(t *testing.T) {
+	before := newKetamaHash([]string{"a", "b", "c", "d"})
+	after := newKetamaHash([]string{"a", "b", "c"})
+	moved := 0
+	for i := 0; i < 4000; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		from, to := before.Get(key), after.Get(key)
+		if from != "d" && from != to {
+			moved++
+		}
+	}
+	if moved != 0 {
+		t.Fatalf("removing a shard should only move its own keys, %d keys moved", moved)
+	}
+}
+
+func TestRedisRingShardDown(t *testing.T) {
+	ring, err := NewFakeRedisRing(RingHashRendezvous, 5*time.Millisecond, "a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ring.ShutdownRedisHandler()
+
+	key := "session:42"
+	dead := ring.ShardForKey(key)
+	ring.Shards[dead].SetDown(true)
+	deadline := time.Now().Add(2 * time.Second)
+	for ring.ShardForKey(key) == dead {
+		if time.Now().After(deadline) {
+			t.Fatalf("shard %s should be removed after failing heartbeats", dead)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for _, shard := range ring.RingShards() {
+		if shard.Up == (shard.Name == dead) {
+			t.Fatalf("unexpected shard state %+v", shard)
+		}
+	}
+	if !ring.Set(key, "v", 0) {
+		t.Fatal("writes should move to a live shard")
+	}
+	if value, ok := ring.Get(key); !ok || value != "v" {
+		t.Fatalf("unexpected value %q", value)
+	}
+
+	ring.Shards[dead].SetDown(false)
+	deadline = time.Now().Add(2 * time.Second)
+	for ring.ShardForKey(key) != dead {
+		if time.Now().After(deadline) {
+			t.Fatalf("shard %s should rejoin the ring after recovering", dead)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
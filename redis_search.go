@@ -0,0 +1,638 @@
+package go_toolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// RediSearch 字段类型
+const (
+	SearchFieldText    = "TEXT"
+	SearchFieldTag     = "TAG"
+	SearchFieldNumeric = "NUMERIC"
+	SearchFieldGeo     = "GEO"
+)
+
+// SearchField 索引中的一个字段
+type SearchField struct {
+	Name      string
+	Type      string
+	Sortable  bool
+	NoIndex   bool
+	Weight    float64
+	Separator string
+}
+
+// SearchIndexOptions FT.CREATE 的索引定义
+type SearchIndexOptions struct {
+	// Prefixes 需要索引的哈希 key 前缀, 为空时索引全部哈希
+	Prefixes []string
+	// Filter 过滤表达式, 例如 "@age>18"
+	Filter string
+	// Language 文本字段的默认语言
+	Language string
+	// StopWords 为 nil 时使用默认停用词, 为空切片时关闭停用词
+	StopWords []string
+}
+
+// SearchIndexInfo FT.INFO 的常用字段, 其余字段见 Raw
+type SearchIndexInfo struct {
+	Name     string
+	NumDocs  int64
+	Prefixes []string
+	Fields   []SearchField
+	Raw      map[string]interface{}
+}
+
+// SearchSchemaOf 从结构体解析索引字段: 字段名取 `redis:"name"` 标签 (与 HashSetStruct 一致),
+// 类型与选项取 `search:"TEXT,SORTABLE,WEIGHT=2"` 标签, 未打 search 标签的字段不建索引
+//
+//	type Product struct {
+//		Title string   `redis:"title" search:"TEXT,WEIGHT=2"`
+//		Tags  string   `redis:"tags" search:"TAG,SEPARATOR=|"`
+//		Price float64  `redis:"price" search:"NUMERIC,SORTABLE"`
+//		Loc   string   `redis:"loc" search:"GEO"`
+//	}
+func SearchSchemaOf(schema interface{}) ([]SearchField, error) {
+	t := reflect.TypeOf(schema)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("索引结构需要结构体, 实际为 %v", t)
+	}
+	var fields []SearchField
+	for _, hf := range hashFieldsOf(t) {
+		tag := t.FieldByIndex(hf.index).Tag.Get("search")
+		if tag == "" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		field := SearchField{Name: hf.name, Type: strings.ToUpper(strings.TrimSpace(parts[0]))}
+		switch field.Type {
+		case SearchFieldText, SearchFieldTag, SearchFieldNumeric, SearchFieldGeo:
+		default:
+			return nil, fmt.Errorf("字段 %s 的索引类型 %q 不支持", hf.name, parts[0])
+		}
+		for _, opt := range parts[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+			switch strings.ToUpper(name) {
+			case "SORTABLE":
+				field.Sortable = true
+			case "NOINDEX":
+				field.NoIndex = true
+			case "WEIGHT":
+				weight, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, fmt.Errorf("字段 %s 的 WEIGHT 格式错误: %w", hf.name, err)
+				}
+				field.Weight = weight
+			case "SEPARATOR":
+				field.Separator = value
+			default:
+				return nil, fmt.Errorf("字段 %s 的索引选项 %q 不支持", hf.name, opt)
+			}
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%s 没有带 search 标签的字段", t.Name())
+	}
+	return fields, nil
+}
+
+// searchUnsupported 检查当前模式能否使用 RediSearch, 不能时记录错误并返回 true
+//   - 集群/分片模式: FT.* 按索引名路由到单个节点, 索引与查询只覆盖该节点上的哈希
+//   - 开启压缩/分片/加密的信封时: HashSet 写入的字段值为二进制信封, RediSearch 无法解析与索引
+//
+// documents 为 false 时只检查路由 (DropSearchIndex/SearchIndexInfo 不读取文档)
+func (r *ModelRedisHandler) searchUnsupported(command string, documents bool) bool {
+	var err error
+	switch {
+	case r.IsCluster || r.isRing():
+		err = errors.New(r.modeName() + "不支持 RediSearch, 索引与查询只会路由到单个节点")
+	case documents && r.envelopeEnabled():
+		err = errors.New("开启压缩/分片/加密时哈希字段为二进制信封, RediSearch 无法索引")
+	default:
+		return false
+	}
+	Logger.Error(GetLogPrefix("") + r.logName() + " " + command + " 错误! 错误原因: " + err.Error())
+	return true
+}
+
+// CreateSearchIndex 按结构体 schema 创建索引 (FT.CREATE ... ON HASH), 索引已存在时返回失败
+// 只支持单点模式且不能开启信封 (Compression/MaxValueSize/SetKeyring), 否则返回失败, RediSearch 的其余方法相同
+func (r *ModelRedisHandler) CreateSearchIndex(index string, schema interface{}, opts SearchIndexOptions) bool {
+	if !r.Enable {
+		return true
+	}
+	if r.searchUnsupported("FT.CREATE", true) {
+		return false
+	}
+	fields, err := SearchSchemaOf(schema)
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " FT.CREATE 错误! 错误原因: " + err.Error())
+		return false
+	}
+	args := []interface{}{"FT.CREATE", index, "ON", "HASH"}
+	if len(opts.Prefixes) > 0 {
+		args = append(args, "PREFIX", len(opts.Prefixes))
+		for _, prefix := range opts.Prefixes {
+			args = append(args, prefix)
+		}
+	}
+	if opts.Filter != "" {
+		args = append(args, "FILTER", opts.Filter)
+	}
+	if opts.Language != "" {
+		args = append(args, "LANGUAGE", opts.Language)
+	}
+	if opts.StopWords != nil {
+		args = append(args, "STOPWORDS", len(opts.StopWords))
+		for _, word := range opts.StopWords {
+			args = append(args, word)
+		}
+	}
+	args = append(args, "SCHEMA")
+	for _, field := range fields {
+		args = append(args, field.Name, field.Type)
+		if field.Type == SearchFieldText && field.Weight > 0 {
+			args = append(args, "WEIGHT", field.Weight)
+		}
+		if field.Type == SearchFieldTag && field.Separator != "" {
+			args = append(args, "SEPARATOR", field.Separator)
+		}
+		if field.Sortable {
+			args = append(args, "SORTABLE")
+		}
+		if field.NoIndex {
+			args = append(args, "NOINDEX")
+		}
+	}
+	if err := r.universalClient().Do(context.Background(), args...).Err(); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " FT.CREATE 创建索引错误! index: " + index + " 错误原因: " + err.Error())
+		return false
+	}
+	return true
+}
+
+// DropSearchIndex 删除索引, deleteDocs 为 true 时同时删除被索引的哈希 (DD)
+func (r *ModelRedisHandler) DropSearchIndex(index string, deleteDocs bool) bool {
+	if !r.Enable {
+		return true
+	}
+	if r.searchUnsupported("FT.DROPINDEX", false) {
+		return false
+	}
+	args := []interface{}{"FT.DROPINDEX", index}
+	if deleteDocs {
+		args = append(args, "DD")
+	}
+	if err := r.universalClient().Do(context.Background(), args...).Err(); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " FT.DROPINDEX 删除索引错误! index: " + index + " 错误原因: " + err.Error())
+		return false
+	}
+	return true
+}
+
+// SearchIndexInfo 读取索引信息, 索引不存在时 found 为 false
+func (r *ModelRedisHandler) SearchIndexInfo(index string) (info SearchIndexInfo, found bool, ok bool) {
+	if !r.Enable {
+		return info, false, true
+	}
+	if r.searchUnsupported("FT.INFO", false) {
+		return info, false, false
+	}
+	result, err := r.universalClient().Do(context.Background(), "FT.INFO", index).Slice()
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unknown index") || strings.Contains(strings.ToLower(err.Error()), "no such index") {
+			return info, false, true
+		}
+		Logger.Error(GetLogPrefix("") + r.logName() + " FT.INFO 错误! index: " + index + " 错误原因: " + err.Error())
+		return info, false, false
+	}
+	info.Raw = searchPairs(result)
+	info.Name = searchString(info.Raw["index_name"])
+	info.NumDocs, _ = strconv.ParseInt(searchString(info.Raw["num_docs"]), 10, 64)
+	if definition, ok := info.Raw["index_definition"].([]interface{}); ok {
+		if prefixes, ok := searchPairs(definition)["prefixes"].([]interface{}); ok {
+			for _, prefix := range prefixes {
+				info.Prefixes = append(info.Prefixes, searchString(prefix))
+			}
+		}
+	}
+	attributes, _ := info.Raw["attributes"].([]interface{})
+	for _, attribute := range attributes {
+		items, ok := attribute.([]interface{})
+		if !ok {
+			continue
+		}
+		field := SearchField{}
+		for i := 0; i < len(items); i++ {
+			switch strings.ToUpper(searchString(items[i])) {
+			case "ATTRIBUTE":
+				if i+1 < len(items) {
+					field.Name = searchString(items[i+1])
+				}
+			case "TYPE":
+				if i+1 < len(items) {
+					field.Type = searchString(items[i+1])
+				}
+			case "SEPARATOR":
+				if i+1 < len(items) {
+					field.Separator = searchString(items[i+1])
+				}
+			case "WEIGHT":
+				if i+1 < len(items) {
+					field.Weight, _ = strconv.ParseFloat(searchString(items[i+1]), 64)
+				}
+			case "SORTABLE":
+				field.Sortable = true
+			case "NOINDEX":
+				field.NoIndex = true
+			}
+		}
+		info.Fields = append(info.Fields, field)
+	}
+	return info, true, true
+}
+
+// SearchQuery FT.SEARCH 查询构造器, 多个条件之间为 AND
+//
+//	q := NewSearchQuery().Text("title", "iphone").Tag("city", "bj", "sh").Range("price", 100, 500).
+//		SortBy("price", false).Limit(0, 20).Return("title", "price")
+type SearchQuery struct {
+	clauses  []string
+	sortBy   string
+	sortDesc bool
+	offset   int64
+	num      int64
+	limited  bool
+	fields   []string
+	verbatim bool
+}
+
+// NewSearchQuery 创建空查询, 没有条件时匹配全部文档
+func NewSearchQuery() *SearchQuery {
+	return &SearchQuery{}
+}
+
+// Raw 追加原始查询语句
+func (q *SearchQuery) Raw(query string) *SearchQuery {
+	q.clauses = append(q.clauses, query)
+	return q
+}
+
+// Match 全部文本字段中包含 words 中的全部词
+func (q *SearchQuery) Match(words string) *SearchQuery {
+	if terms := searchTerms(words); len(terms) > 0 {
+		q.clauses = append(q.clauses, "("+strings.Join(terms, " ")+")")
+	}
+	return q
+}
+
+// Text 文本字段 field 中包含 words 中的全部词
+func (q *SearchQuery) Text(field, words string) *SearchQuery {
+	if terms := searchTerms(words); len(terms) > 0 {
+		q.clauses = append(q.clauses, "@"+field+":("+strings.Join(terms, " ")+")")
+	}
+	return q
+}
+
+// Tag 标签字段 field 等于 values 中的任意一个
+func (q *SearchQuery) Tag(field string, values ...string) *SearchQuery {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = EscapeSearchTag(value)
+	}
+	q.clauses = append(q.clauses, "@"+field+":{"+strings.Join(escaped, " | ")+"}")
+	return q
+}
+
+// Range 数值字段 field 在 [min, max] 区间内, 使用 math.Inf 表示无界
+func (q *SearchQuery) Range(field string, min, max float64) *SearchQuery {
+	q.clauses = append(q.clauses, fmt.Sprintf("@%s:[%s %s]", field, searchNumber(min), searchNumber(max)))
+	return q
+}
+
+// Geo 地理字段 field 在以 (longitude, latitude) 为圆心, radius 为半径的范围内, unit 为 GeoUnit* 常量
+func (q *SearchQuery) Geo(field string, longitude, latitude, radius float64, unit string) *SearchQuery {
+	if unit == "" {
+		unit = GeoUnitMeters
+	}
+	q.clauses = append(q.clauses, fmt.Sprintf("@%s:[%s %s %s %s]", field,
+		strconv.FormatFloat(longitude, 'f', -1, 64), strconv.FormatFloat(latitude, 'f', -1, 64),
+		strconv.FormatFloat(radius, 'f', -1, 64), unit))
+	return q
+}
+
+// Not 排除匹配 other 的文档
+func (q *SearchQuery) Not(other *SearchQuery) *SearchQuery {
+	if query := other.String(); query != "*" {
+		q.clauses = append(q.clauses, "-("+query+")")
+	}
+	return q
+}
+
+// SortBy 按字段排序, 字段需要 SORTABLE
+func (q *SearchQuery) SortBy(field string, desc bool) *SearchQuery {
+	q.sortBy, q.sortDesc = field, desc
+	return q
+}
+
+// Limit 分页, 默认返回前 10 条
+func (q *SearchQuery) Limit(offset, num int64) *SearchQuery {
+	q.offset, q.num, q.limited = offset, num, true
+	return q
+}
+
+// Return 只返回指定字段, 不调用时返回全部字段
+func (q *SearchQuery) Return(fields ...string) *SearchQuery {
+	q.fields = append(q.fields, fields...)
+	return q
+}
+
+// Verbatim 不做词干提取
+func (q *SearchQuery) Verbatim() *SearchQuery {
+	q.verbatim = true
+	return q
+}
+
+// String 查询语句
+func (q *SearchQuery) String() string {
+	if len(q.clauses) == 0 {
+		return "*"
+	}
+	return strings.Join(q.clauses, " ")
+}
+
+func (q *SearchQuery) args(index string) []interface{} {
+	args := []interface{}{"FT.SEARCH", index, q.String()}
+	if q.verbatim {
+		args = append(args, "VERBATIM")
+	}
+	if len(q.fields) > 0 {
+		args = append(args, "RETURN", len(q.fields))
+		for _, field := range q.fields {
+			args = append(args, field)
+		}
+	}
+	if q.sortBy != "" {
+		order := "ASC"
+		if q.sortDesc {
+			order = "DESC"
+		}
+		args = append(args, "SORTBY", q.sortBy, order)
+	}
+	if q.limited {
+		args = append(args, "LIMIT", q.offset, q.num)
+	}
+	return args
+}
+
+// SearchDocument FT.SEARCH 返回的一个文档, Id 为哈希的 key
+type SearchDocument struct {
+	Id     string
+	Fields map[string]string
+}
+
+// Search 执行 FT.SEARCH, 返回匹配总数与当前页的文档
+func (r *ModelRedisHandler) Search(index string, q *SearchQuery) (int64, []SearchDocument, bool) {
+	if !r.Enable {
+		return 0, nil, true
+	}
+	if r.searchUnsupported("FT.SEARCH", true) {
+		return 0, nil, false
+	}
+	result, err := r.universalClient().Do(context.Background(), q.args(index)...).Slice()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " FT.SEARCH 查询错误! index: " + index + " 错误原因: " + err.Error())
+		return 0, nil, false
+	}
+	if len(result) == 0 {
+		return 0, nil, true
+	}
+	total, _ := result[0].(int64)
+	docs := make([]SearchDocument, 0, (len(result)-1)/2)
+	for i := 1; i < len(result); i++ {
+		doc := SearchDocument{Id: searchString(result[i]), Fields: map[string]string{}}
+		if i+1 < len(result) {
+			if fields, ok := result[i+1].([]interface{}); ok {
+				doc.Fields = searchStringPairs(fields)
+				i++
+			}
+		}
+		docs = append(docs, doc)
+	}
+	return total, docs, true
+}
+
+// SearchInto 执行 FT.SEARCH 并按 `redis` 标签将文档解析为 T, ids 与 items 一一对应
+func SearchInto[T any](r *ModelRedisHandler, index string, q *SearchQuery) (total int64, ids []string, items []T, ok bool) {
+	total, docs, ok := r.Search(index, q)
+	if !ok {
+		return 0, nil, nil, false
+	}
+	ids = make([]string, len(docs))
+	items = make([]T, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.Id
+		if err := decodeHashStruct(doc.Fields, &items[i]); err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " FT.SEARCH 解析错误! key: " + doc.Id + " 错误原因: " + err.Error())
+			return 0, nil, nil, false
+		}
+	}
+	return total, ids, items, true
+}
+
+// SearchReducer FT.AGGREGATE GROUPBY 中的 REDUCE
+type SearchReducer struct {
+	Function string
+	Args     []string
+	As       string
+}
+
+// SearchReduce 创建 Reducer, 例如 SearchReduce("SUM", "total", "@price")
+func SearchReduce(function, as string, args ...string) SearchReducer {
+	return SearchReducer{Function: strings.ToUpper(function), Args: args, As: as}
+}
+
+// SearchAggregate FT.AGGREGATE 构造器, 各步骤按调用顺序组成管道
+//
+//	agg := NewSearchAggregate(NewSearchQuery().Range("price", 0, 100)).
+//		GroupBy([]string{"@city"}, SearchReduce("COUNT", "n"), SearchReduce("AVG", "avg_price", "@price")).
+//		SortBy("@n", true).Limit(0, 10)
+type SearchAggregate struct {
+	query *SearchQuery
+	steps []interface{}
+}
+
+// NewSearchAggregate 创建聚合, query 为 nil 时匹配全部文档
+func NewSearchAggregate(query *SearchQuery) *SearchAggregate {
+	if query == nil {
+		query = NewSearchQuery()
+	}
+	return &SearchAggregate{query: query}
+}
+
+// Load 加载未设置 SORTABLE 的字段
+func (a *SearchAggregate) Load(fields ...string) *SearchAggregate {
+	a.steps = append(a.steps, "LOAD", len(fields))
+	for _, field := range fields {
+		a.steps = append(a.steps, searchProperty(field))
+	}
+	return a
+}
+
+// GroupBy 按字段分组并计算 reducers
+func (a *SearchAggregate) GroupBy(fields []string, reducers ...SearchReducer) *SearchAggregate {
+	a.steps = append(a.steps, "GROUPBY", len(fields))
+	for _, field := range fields {
+		a.steps = append(a.steps, searchProperty(field))
+	}
+	for _, reducer := range reducers {
+		a.steps = append(a.steps, "REDUCE", reducer.Function, len(reducer.Args))
+		for _, arg := range reducer.Args {
+			a.steps = append(a.steps, arg)
+		}
+		if reducer.As != "" {
+			a.steps = append(a.steps, "AS", reducer.As)
+		}
+	}
+	return a
+}
+
+// Apply 计算表达式并写入 as 字段
+func (a *SearchAggregate) Apply(expression, as string) *SearchAggregate {
+	a.steps = append(a.steps, "APPLY", expression, "AS", as)
+	return a
+}
+
+// Filter 按表达式过滤当前结果
+func (a *SearchAggregate) Filter(expression string) *SearchAggregate {
+	a.steps = append(a.steps, "FILTER", expression)
+	return a
+}
+
+// SortBy 按字段排序
+func (a *SearchAggregate) SortBy(field string, desc bool) *SearchAggregate {
+	order := "ASC"
+	if desc {
+		order = "DESC"
+	}
+	a.steps = append(a.steps, "SORTBY", 2, searchProperty(field), order)
+	return a
+}
+
+// Limit 分页
+func (a *SearchAggregate) Limit(offset, num int64) *SearchAggregate {
+	a.steps = append(a.steps, "LIMIT", offset, num)
+	return a
+}
+
+// Aggregate 执行 FT.AGGREGATE, 返回每一行的字段
+func (r *ModelRedisHandler) Aggregate(index string, a *SearchAggregate) ([]map[string]string, bool) {
+	if !r.Enable {
+		return nil, true
+	}
+	if r.searchUnsupported("FT.AGGREGATE", true) {
+		return nil, false
+	}
+	args := append([]interface{}{"FT.AGGREGATE", index, a.query.String()}, a.steps...)
+	result, err := r.universalClient().Do(context.Background(), args...).Slice()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " FT.AGGREGATE 聚合错误! index: " + index + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	rows := make([]map[string]string, 0, len(result))
+	for i := 1; i < len(result); i++ {
+		item := result[i]
+		if fields, ok := item.([]interface{}); ok {
+			rows = append(rows, searchStringPairs(fields))
+		}
+	}
+	return rows, true
+}
+
+// AggregateInto 执行 FT.AGGREGATE 并按 `redis` 标签将每一行解析为 T (字段名为 AS 指定的名称)
+func AggregateInto[T any](r *ModelRedisHandler, index string, a *SearchAggregate) ([]T, bool) {
+	rows, ok := r.Aggregate(index, a)
+	if !ok {
+		return nil, false
+	}
+	items := make([]T, len(rows))
+	for i, row := range rows {
+		if err := decodeHashStruct(row, &items[i]); err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " FT.AGGREGATE 解析错误! 错误原因: " + err.Error())
+			return nil, false
+		}
+	}
+	return items, true
+}
+
+// EscapeSearchTag 转义标签值中的标点与空格
+func EscapeSearchTag(value string) string {
+	var b strings.Builder
+	for _, c := range value {
+		if strings.ContainsRune(",.<>{}[]\"':;!@#$%^&*()-+=~|/\\ ", c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// searchTerms 拆分文本并转义, 标点视为分隔符
+func searchTerms(words string) []string {
+	return strings.FieldsFunc(words, func(c rune) bool {
+		return strings.ContainsRune(",.<>{}[]\"':;!@#$%^&*()-+=~|/\\ \t\n", c)
+	})
+}
+
+func searchNumber(f float64) string {
+	switch {
+	case f > 1e308:
+		return "+inf"
+	case f < -1e308:
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func searchProperty(field string) string {
+	if strings.HasPrefix(field, "@") {
+		return field
+	}
+	return "@" + field
+}
+
+func searchString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(s)
+	}
+}
+
+func searchPairs(items []interface{}) map[string]interface{} {
+	pairs := make(map[string]interface{}, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		pairs[searchString(items[i])] = items[i+1]
+	}
+	return pairs
+}
+
+func searchStringPairs(items []interface{}) map[string]string {
+	pairs := make(map[string]string, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		pairs[searchString(items[i])] = searchString(items[i+1])
+	}
+	return pairs
+}
@@ -0,0 +1,143 @@
+package go_toolbox
+
+import (
+	"math"
+	"testing"
+)
+
+type testSearchProduct struct {
+	Title string  `redis:"title" search:"TEXT,WEIGHT=2"`
+	City  string  `redis:"city" search:"TAG,SORTABLE"`
+	Price float64 `redis:"price" search:"NUMERIC,SORTABLE"`
+	Loc   string  `redis:"loc" search:"GEO"`
+	Note  string  `redis:"note"`
+}
+
+type testSearchCityStats struct {
+	City  string  `redis:"city"`
+	Count int     `redis:"n"`
+	Avg   float64 `redis:"avg_price"`
+}
+
+func TestSearchSchemaOf(t *testing.T) {
+	fields, err := SearchSchemaOf(&testSearchProduct{})
+	if err != nil || len(fields) != 4 {
+		t.Fatalf("unexpected schema %+v, %v", fields, err)
+	}
+	if fields[0].Weight != 2 || fields[1].Type != SearchFieldTag || !fields[2].Sortable {
+		t.Fatalf("unexpected schema %+v", fields)
+	}
+	if _, err := SearchSchemaOf(struct {
+		A string `redis:"a" search:"VECTOR"`
+	}{}); err == nil {
+		t.Fatal("unsupported field types should be rejected")
+	}
+}
+
+func TestRedisSearch(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	products := map[string]testSearchProduct{
+		"product:1": {Title: "Red running shoes", City: "beijing", Price: 300, Loc: "116.40,39.90"},
+		"product:2": {Title: "Blue running shirt", City: "shanghai", Price: 120, Loc: "121.47,31.23"},
+		"product:3": {Title: "Red winter coat", City: "beijing", Price: 800, Loc: "116.41,39.91"},
+		"product:4": {Title: "Green hat", City: "new york", Price: 50, Loc: "-74.00,40.71"},
+	}
+	for key, product := range products {
+		redisHandler.HashSetStruct(key, product)
+	}
+	redisHandler.HashSet("other:1", "title", "red running shoes")
+
+	if !redisHandler.CreateSearchIndex("idx:product", testSearchProduct{}, SearchIndexOptions{Prefixes: []string{"product:"}}) {
+		t.Fatal("FT.CREATE failed")
+	}
+	if redisHandler.CreateSearchIndex("idx:product", testSearchProduct{}, SearchIndexOptions{}) {
+		t.Fatal("creating an existing index should fail")
+	}
+	info, found, ok := redisHandler.SearchIndexInfo("idx:product")
+	if !ok || !found || info.NumDocs != 4 || len(info.Fields) != 4 || info.Prefixes[0] != "product:" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if _, found, ok := redisHandler.SearchIndexInfo("idx:missing"); !ok || found {
+		t.Fatal("missing index should be reported as not found")
+	}
+
+	total, docs, ok := redisHandler.Search("idx:product", NewSearchQuery().Text("title", "red").SortBy("price", true))
+	if !ok || total != 2 || docs[0].Id != "product:3" || docs[1].Id != "product:1" {
+		t.Fatalf("unexpected text search result %d %+v", total, docs)
+	}
+	total, docs, _ = redisHandler.Search("idx:product", NewSearchQuery().Tag("city", "new york").Return("title"))
+	if total != 1 || docs[0].Fields["title"] != "Green hat" || len(docs[0].Fields) != 1 {
+		t.Fatalf("tag values with spaces should be escaped: %+v", docs)
+	}
+	total, _, _ = redisHandler.Search("idx:product", NewSearchQuery().Match("running").Range("price", 100, 200))
+	if total != 1 {
+		t.Fatalf("numeric range should narrow the match, got %d", total)
+	}
+	total, _, _ = redisHandler.Search("idx:product", NewSearchQuery().Range("price", math.Inf(-1), 300).Not(NewSearchQuery().Tag("city", "shanghai")))
+	if total != 2 {
+		t.Fatalf("negated clause should exclude shanghai, got %d", total)
+	}
+	total, docs, _ = redisHandler.Search("idx:product", NewSearchQuery().Geo("loc", 116.40, 39.90, 5, GeoUnitKilometers))
+	if total != 2 {
+		t.Fatalf("geo filter should match two products, got %d %+v", total, docs)
+	}
+
+	// 分页并解析为结构体
+	total, ids, items, ok := SearchInto[testSearchProduct](redisHandler.ModelRedisHandler, "idx:product",
+		NewSearchQuery().SortBy("price", false).Limit(1, 2))
+	if !ok || total != 4 || len(items) != 2 || ids[0] != "product:2" || items[1].Title != "Red running shoes" {
+		t.Fatalf("unexpected page %v %+v", ids, items)
+	}
+
+	agg := NewSearchAggregate(nil).
+		GroupBy([]string{"city"}, SearchReduce("COUNT", "n"), SearchReduce("AVG", "avg_price", "@price")).
+		SortBy("n", true).Limit(0, 2)
+	stats, ok := AggregateInto[testSearchCityStats](redisHandler.ModelRedisHandler, "idx:product", agg)
+	if !ok || len(stats) != 2 || stats[0].City != "beijing" || stats[0].Count != 2 || stats[0].Avg != 550 {
+		t.Fatalf("unexpected aggregation %+v", stats)
+	}
+
+	if !redisHandler.DropSearchIndex("idx:product", true) {
+		t.Fatal("FT.DROPINDEX failed")
+	}
+	if keys := redisHandler.Keys(); len(keys) != 1 || keys[0] != "other:1" {
+		t.Fatalf("DD should only delete indexed documents, left %v", keys)
+	}
+}
+
+func TestSearchQueryString(t *testing.T) {
+	q := NewSearchQuery().Text("title", "hello, world").Tag("email", "a@b.com").Range("age", 18, math.Inf(1))
+	want := "@title:(hello world) @email:{a\\@b\\.com} @age:[18 +inf]"
+	if q.String() != want {
+		t.Fatalf("got %q, want %q", q.String(), want)
+	}
+	if NewSearchQuery().String() != "*" {
+		t.Fatal("empty query should match everything")
+	}
+}
+
+func TestRedisSearchUnsupported(t *testing.T) {
+	ring, err := NewFakeRedisRing(RingHashRendezvous, 0, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ring.ShutdownRedisHandler()
+	if ring.CreateSearchIndex("idx:product", testSearchProduct{}, SearchIndexOptions{}) {
+		t.Fatal("FT.CREATE should be refused in ring mode")
+	}
+	if _, _, ok := ring.Search("idx:product", NewSearchQuery()); ok {
+		t.Fatal("FT.SEARCH should be refused in ring mode")
+	}
+
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	redisHandler.Compression = CompressionGzip
+	if redisHandler.CreateSearchIndex("idx:product", testSearchProduct{}, SearchIndexOptions{}) {
+		t.Fatal("FT.CREATE should be refused when values are enveloped")
+	}
+	if _, ok := redisHandler.Aggregate("idx:product", NewSearchAggregate(nil)); ok {
+		t.Fatal("FT.AGGREGATE should be refused when values are enveloped")
+	}
+}
@@ -0,0 +1,349 @@
+package go_toolbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultSemaphoreTTL          = 30 * time.Second
+	DefaultSemaphorePollInterval = 50 * time.Millisecond
+)
+
+// ErrSemaphoreLeaseLost 租约已过期并被清理, 或已释放
+var ErrSemaphoreLeaseLost = errors.New("信号量租约已失效")
+
+// SemaphoreOptions 分布式信号量配置
+type SemaphoreOptions struct {
+	// Limit 最多同时持有的数量, 必填
+	Limit int
+	// TTL 租约时长, 持有者超过该时间未续约视为失效并被自动清理, 默认 30 秒
+	TTL time.Duration
+	// PollInterval 阻塞获取时的轮询间隔, 默认 50 毫秒
+	PollInterval time.Duration
+	// AutoRefresh 获取成功后在后台按 TTL/3 自动续约, 直到 Release
+	AutoRefresh bool
+}
+
+// RedisSemaphore 基于有序集合的分布式计数信号量
+// holders 的成员为持有者 token, 分数为到期时间 (毫秒); queue 的成员为等待者 token, 分数为 seq 领取的号码,
+// 等待者按领号顺序获取, 先到先得; 每个等待者的心跳为单独的 waiter:{token} key (带过期时间), 心跳过期 (进程崩溃) 的等待者会被移出队列
+// 全部 key 使用相同的 hash tag, 集群模式下位于同一槽位; 获取时以 WATCH 事务保证一致, 只 WATCH holders 与 queue,
+// 心跳不在 WATCH 的 key 中, 刷新心跳不会使其他等待者的事务失败; holders, queue 与 seq 的过期时间为 2 倍 TTL, 每次获取时延长
+type RedisSemaphore struct {
+	r    *ModelRedisHandler
+	name string
+	opts SemaphoreOptions
+}
+
+// SemaphoreLease 一次成功获取的租约
+type SemaphoreLease struct {
+	sem   *RedisSemaphore
+	Token string
+
+	mu       sync.Mutex
+	released bool
+	stop     context.CancelFunc
+	done     chan struct{}
+}
+
+// NewSemaphore 创建名为 name 的分布式信号量, 同名信号量在所有实例间共享
+func (r *ModelRedisHandler) NewSemaphore(name string, opts SemaphoreOptions) (*RedisSemaphore, error) {
+	if name == "" {
+		return nil, errors.New("信号量名称不能为空")
+	}
+	if opts.Limit <= 0 {
+		return nil, errors.New("信号量 Limit 必须大于 0")
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultSemaphoreTTL
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultSemaphorePollInterval
+	}
+	return &RedisSemaphore{r: r, name: name, opts: opts}, nil
+}
+
+// TryAcquire 尝试获取一个名额, 持有者与排队中的有效等待者合计占满 Limit 时立即返回 false;
+// 有人排队但仍有空余名额时可以获取, 不会占用排队者的名额
+func (s *RedisSemaphore) TryAcquire(ctx context.Context) (*SemaphoreLease, bool, error) {
+	token, err := newSemaphoreToken()
+	if err != nil {
+		return nil, false, err
+	}
+	acquired, err := s.tryAcquire(ctx, token, false)
+	if err != nil || !acquired {
+		return nil, false, err
+	}
+	return s.newLease(token), true, nil
+}
+
+// Acquire 阻塞直到获取名额, 按排队顺序公平获取; ctx 结束时退出队列并返回 ctx.Err()
+func (s *RedisSemaphore) Acquire(ctx context.Context) (*SemaphoreLease, error) {
+	token, err := newSemaphoreToken()
+	if err != nil {
+		return nil, err
+	}
+	if !s.r.Enable {
+		return s.newLease(token), nil
+	}
+	client := s.r.universalClient()
+	var ticket *redis.IntCmd
+	if _, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		ticket = pipe.Incr(ctx, s.key("seq"))
+		pipe.PExpire(ctx, s.key("seq"), s.opts.TTL*2)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, s.key("queue"), redis.Z{Score: float64(ticket.Val()), Member: token})
+		pipe.PExpire(ctx, s.key("queue"), s.opts.TTL*2)
+		pipe.Set(ctx, s.waiterKey(token), 1, s.opts.TTL)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for {
+		acquired, err := s.tryAcquire(ctx, token, true)
+		if err == nil && acquired {
+			return s.newLease(token), nil
+		}
+		if err != nil && ctx.Err() == nil {
+			Logger.Warn(GetLogPrefix("") + "信号量 " + s.name + " 获取失败, 稍后重试! 错误原因: " + err.Error())
+		}
+		timer := time.NewTimer(s.opts.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.leaveQueue(token)
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		// 刷新心跳, 避免被当作已放弃的等待者清理
+		client.Set(ctx, s.waiterKey(token), 1, s.opts.TTL)
+	}
+}
+
+// Do 获取名额后执行 fn, 执行结束后释放, 用作并发限制器
+func (s *RedisSemaphore) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	lease, err := s.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := lease.Release(); err != nil {
+			Logger.Warn(GetLogPrefix("") + "信号量 " + s.name + " 释放失败! 错误原因: " + err.Error())
+		}
+	}()
+	return fn(ctx)
+}
+
+// Holders 当前有效的持有者数量
+func (s *RedisSemaphore) Holders(ctx context.Context) (int64, error) {
+	if !s.r.Enable {
+		return 0, nil
+	}
+	return s.r.universalClient().ZCount(ctx, s.key("holders"), "("+strconv.FormatInt(time.Now().UnixMilli(), 10), "+inf").Result()
+}
+
+// tryAcquire 清理过期的持有者与等待者后判断能否获取, queued 为 true 时 token 已在队列中
+func (s *RedisSemaphore) tryAcquire(ctx context.Context, token string, queued bool) (bool, error) {
+	if !s.r.Enable {
+		return true, nil
+	}
+	holdersKey, queueKey := s.key("holders"), s.key("queue")
+	acquired := false
+	err := s.r.Transaction(ctx, []string{holdersKey, queueKey}, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		acquired = false
+		now := time.Now()
+		nowMs := float64(now.UnixMilli())
+		holders, err := tx.ZRangeWithScores(ctx, holdersKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		active := 0
+		for _, holder := range holders {
+			if holder.Score <= nowMs {
+				pipe.ZRem(ctx, holdersKey, holder.Member)
+			} else {
+				active++
+			}
+		}
+		queue, err := tx.ZRange(ctx, queueKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		// 排在 token 前面的有效等待者数量, 心跳已过期的等待者移出队列
+		ahead := 0
+		for _, member := range queue {
+			if member == token {
+				break
+			}
+			ahead++
+		}
+		if ahead > 0 {
+			waiterKeys := make([]string, ahead)
+			for i, member := range queue[:ahead] {
+				waiterKeys[i] = s.waiterKey(member)
+			}
+			heartbeats, err := tx.MGet(ctx, waiterKeys...).Result()
+			if err != nil {
+				return err
+			}
+			for i, heartbeat := range heartbeats {
+				if heartbeat == nil {
+					ahead--
+					pipe.ZRem(ctx, queueKey, queue[i])
+				}
+			}
+		}
+		if active+ahead < s.opts.Limit {
+			acquired = true
+			pipe.ZAdd(ctx, holdersKey, redis.Z{Score: float64(s.deadline(now)), Member: token})
+			if queued {
+				pipe.ZRem(ctx, queueKey, token)
+				pipe.Del(ctx, s.waiterKey(token))
+			}
+		}
+		pipe.PExpire(ctx, holdersKey, s.opts.TTL*2)
+		pipe.PExpire(ctx, queueKey, s.opts.TTL*2)
+		pipe.PExpire(ctx, s.key("seq"), s.opts.TTL*2)
+		return nil
+	})
+	if err != nil {
+		acquired = false
+	}
+	return acquired, err
+}
+
+func (s *RedisSemaphore) leaveQueue(token string) {
+	ctx := context.Background()
+	if _, err := s.r.universalClient().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, s.key("queue"), token)
+		pipe.Del(ctx, s.waiterKey(token))
+		return nil
+	}); err != nil {
+		Logger.Warn(GetLogPrefix("") + "信号量 " + s.name + " 退出队列失败! 错误原因: " + err.Error())
+	}
+}
+
+func (s *RedisSemaphore) newLease(token string) *SemaphoreLease {
+	lease := &SemaphoreLease{sem: s, Token: token}
+	if s.opts.AutoRefresh && s.r.Enable {
+		ctx, cancel := context.WithCancel(context.Background())
+		lease.stop = cancel
+		lease.done = make(chan struct{})
+		go lease.autoRefresh(ctx)
+	}
+	return lease
+}
+
+// Refresh 续约, 租约已过期被清理时返回 ErrSemaphoreLeaseLost
+func (l *SemaphoreLease) Refresh(ctx context.Context) error {
+	l.mu.Lock()
+	released := l.released
+	l.mu.Unlock()
+	if released {
+		return ErrSemaphoreLeaseLost
+	}
+	s := l.sem
+	if !s.r.Enable {
+		return nil
+	}
+	holdersKey := s.key("holders")
+	lost := false
+	err := s.r.Transaction(ctx, []string{holdersKey}, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		now := time.Now()
+		score, err := tx.ZScore(ctx, holdersKey, l.Token).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		// 已被清理, 或已过期但尚未被清理
+		lost = err == redis.Nil || score <= float64(now.UnixMilli())
+		if lost {
+			pipe.ZRem(ctx, holdersKey, l.Token)
+			return nil
+		}
+		pipe.ZAdd(ctx, holdersKey, redis.Z{Score: float64(s.deadline(now)), Member: l.Token})
+		pipe.PExpire(ctx, holdersKey, s.opts.TTL*2)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if lost {
+		return ErrSemaphoreLeaseLost
+	}
+	return nil
+}
+
+// Release 释放名额, 重复调用无副作用
+func (l *SemaphoreLease) Release() error {
+	l.mu.Lock()
+	if l.released {
+		l.mu.Unlock()
+		return nil
+	}
+	l.released = true
+	stop, done := l.stop, l.done
+	l.mu.Unlock()
+	if stop != nil {
+		stop()
+		<-done
+	}
+	if !l.sem.r.Enable {
+		return nil
+	}
+	return l.sem.r.universalClient().ZRem(context.Background(), l.sem.key("holders"), l.Token).Err()
+}
+
+func (l *SemaphoreLease) autoRefresh(ctx context.Context) {
+	defer close(l.done)
+	ticker := time.NewTicker(l.sem.opts.TTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := l.Refresh(ctx)
+			if err == ErrSemaphoreLeaseLost {
+				Logger.Warn(GetLogPrefix("") + "信号量 " + l.sem.name + " 租约已失效, 停止自动续约")
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				Logger.Warn(GetLogPrefix("") + "信号量 " + l.sem.name + " 续约失败! 错误原因: " + err.Error())
+			}
+		}
+	}
+}
+
+func (s *RedisSemaphore) deadline(now time.Time) int64 {
+	return now.Add(s.opts.TTL).UnixMilli()
+}
+
+// key 同一信号量的 key 共享 hash tag
+func (s *RedisSemaphore) key(suffix string) string {
+	return "{semaphore:" + s.name + "}:" + suffix
+}
+
+// waiterKey 等待者的心跳
+func (s *RedisSemaphore) waiterKey(token string) string {
+	return s.key("waiter:" + token)
+}
+
+func newSemaphoreToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,180 @@
+package go_toolbox
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisSemaphore(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+
+	sem, err := redisHandler.NewSemaphore("third-party-api", SemaphoreOptions{Limit: 2, TTL: 100 * time.Millisecond, PollInterval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, ok, _ := sem.TryAcquire(ctx)
+	second, ok2, _ := sem.TryAcquire(ctx)
+	if !ok || !ok2 {
+		t.Fatal("two holders should be allowed")
+	}
+	if _, ok, _ := sem.TryAcquire(ctx); ok {
+		t.Fatal("limit should be enforced")
+	}
+	if err := first.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := sem.Holders(ctx); n != 1 {
+		t.Fatalf("unexpected holders %d", n)
+	}
+
+	// 持有者过期后被自动清理
+	time.Sleep(150 * time.Millisecond)
+	if err := second.Refresh(ctx); err != ErrSemaphoreLeaseLost {
+		t.Fatalf("expired lease should be lost, got %v", err)
+	}
+	third, ok, _ := sem.TryAcquire(ctx)
+	fourth, ok2, _ := sem.TryAcquire(ctx)
+	if !ok || !ok2 {
+		t.Fatal("expired holders should be cleaned up")
+	}
+	if err := third.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 阻塞获取可以被取消
+	waitCtx, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	if _, err := sem.Acquire(waitCtx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if n := redisHandler.RedisClient.ZCard(ctx, sem.key("queue")).Val(); n != 0 {
+		t.Fatal("cancelled waiter should leave the queue")
+	}
+	third.Release()
+	fourth.Release()
+}
+
+func TestRedisSemaphoreFairness(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+
+	sem, _ := redisHandler.NewSemaphore("api", SemaphoreOptions{Limit: 1, TTL: time.Second, PollInterval: 2 * time.Millisecond, AutoRefresh: true})
+	holder, _ := sem.Acquire(ctx)
+
+	// 等待者按排队顺序获取
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lease, err := sem.Acquire(ctx)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			lease.Release()
+		}(i)
+		waitFor(t, "waiter queued", func() bool {
+			return redisHandler.RedisClient.ZCard(ctx, sem.key("queue")).Val() == int64(i+1)
+		})
+	}
+	// 有人排队时 TryAcquire 不能插队
+	if _, ok, _ := sem.TryAcquire(ctx); ok {
+		t.Fatal("TryAcquire should not jump the queue")
+	}
+	holder.Release()
+	wg.Wait()
+	if len(order) != 3 || order[0] != 0 || order[1] != 1 || order[2] != 2 {
+		t.Fatalf("waiters should acquire in FIFO order, got %v", order)
+	}
+
+	// 并发限制器
+	var running, peak int32
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem.Do(ctx, func(ctx context.Context) error {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					old := atomic.LoadInt32(&peak)
+					if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+						break
+					}
+				}
+				time.Sleep(3 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	if peak != 1 {
+		t.Fatalf("limit should cap concurrency, peak %d", peak)
+	}
+}
+
+func TestRedisSemaphoreAbandonedWaiter(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+	client := redisHandler.RedisClient
+
+	sem, _ := redisHandler.NewSemaphore("jobs", SemaphoreOptions{Limit: 1, TTL: time.Second, PollInterval: 2 * time.Millisecond})
+	// 排在队首但没有心跳的等待者 (进程已崩溃) 被移出队列, 不再阻塞后来者
+	client.ZAdd(ctx, sem.key("queue"), redis.Z{Score: 0, Member: "crashed"})
+	lease, err := sem.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.ZScore(ctx, sem.key("queue"), "crashed").Err() != redis.Nil {
+		t.Fatal("an abandoned waiter should be removed from the queue")
+	}
+	for _, suffix := range []string{"seq", "queue", "holders"} {
+		if ttl := client.PTTL(ctx, sem.key(suffix)).Val(); ttl <= 0 && client.Exists(ctx, sem.key(suffix)).Val() == 1 {
+			t.Fatalf("%s should expire, got ttl %v", suffix, ttl)
+		}
+	}
+	lease.Release()
+}
+
+func TestRedisSemaphoreTryAcquireWithWaiters(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+	client := redisHandler.RedisClient
+
+	sem, _ := redisHandler.NewSemaphore("jobs", SemaphoreOptions{Limit: 3, TTL: time.Second})
+	first, ok, err := sem.TryAcquire(ctx)
+	if err != nil || !ok {
+		t.Fatalf("TryAcquire failed: %v", err)
+	}
+	defer first.Release()
+	// 一个仍有心跳的等待者
+	client.ZAdd(ctx, sem.key("queue"), redis.Z{Score: 0, Member: "waiting"})
+	client.Set(ctx, sem.waiterKey("waiting"), 1, time.Second)
+
+	// 1 个持有者 + 1 个等待者, 仍有一个空余名额
+	second, ok, err := sem.TryAcquire(ctx)
+	if err != nil || !ok {
+		t.Fatalf("TryAcquire should use the spare slot: %v", err)
+	}
+	defer second.Release()
+	if _, ok, _ := sem.TryAcquire(ctx); ok {
+		t.Fatal("holders and waiters fill the limit, TryAcquire should fail")
+	}
+}
@@ -0,0 +1,319 @@
+package go_toolbox
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// setScanCount 客户端计算集合运算时每次 SSCAN 的 COUNT, 同时作为写入结果时每条 SADD 的成员数
+const setScanCount = 1000
+
+// 以下集合方法的错误语义与列表方法一致: 出错时记录日志并返回 ok 为 false; key 不存在按空集合处理, ok 为 true
+
+// SetAdd 向集合添加成员, 返回新增的个数
+func (r *ModelRedisHandler) SetAdd(key string, members ...interface{}) (int64, bool) {
+	if !r.Enable || len(members) == 0 {
+		return 0, true
+	}
+	added, err := r.universalClient().SAdd(context.Background(), key, members...).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " SADD 写入错误! key: " + key + " 错误原因: " + err.Error())
+		return 0, false
+	}
+	return added, true
+}
+
+// SetRem 从集合删除成员, 返回删除的个数
+func (r *ModelRedisHandler) SetRem(key string, members ...interface{}) (int64, bool) {
+	if !r.Enable || len(members) == 0 {
+		return 0, true
+	}
+	removed, err := r.universalClient().SRem(context.Background(), key, members...).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " SREM 删除错误! key: " + key + " 错误原因: " + err.Error())
+		return 0, false
+	}
+	return removed, true
+}
+
+// SetIsMember member 是否在集合中
+func (r *ModelRedisHandler) SetIsMember(key string, member interface{}) (isMember, ok bool) {
+	if !r.Enable {
+		return false, true
+	}
+	isMember, err := r.universalClient().SIsMember(context.Background(), key, member).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " SISMEMBER 查询错误! key: " + key + " 错误原因: " + err.Error())
+		return false, false
+	}
+	return isMember, true
+}
+
+// SetMIsMember 按顺序返回每个 member 是否在集合中 (需要 Redis 6.2 以上)
+func (r *ModelRedisHandler) SetMIsMember(key string, members ...interface{}) ([]bool, bool) {
+	if !r.Enable || len(members) == 0 {
+		return make([]bool, len(members)), true
+	}
+	result, err := r.universalClient().SMIsMember(context.Background(), key, members...).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " SMISMEMBER 查询错误! key: " + key + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	return result, true
+}
+
+// SetMembers 集合的全部成员, 大集合请使用 SetScan 分批读取
+func (r *ModelRedisHandler) SetMembers(key string) ([]string, bool) {
+	if !r.Enable {
+		return nil, true
+	}
+	members, err := r.universalClient().SMembers(context.Background(), key).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " SMEMBERS 读取错误! key: " + key + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	return members, true
+}
+
+// SetCard 集合的成员个数
+func (r *ModelRedisHandler) SetCard(key string) (int64, bool) {
+	if !r.Enable {
+		return 0, true
+	}
+	card, err := r.universalClient().SCard(context.Background(), key).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " SCARD 获取个数错误! key: " + key + " 错误原因: " + err.Error())
+		return 0, false
+	}
+	return card, true
+}
+
+// SetRandMember 随机返回 count 个成员但不删除, count 为正数时成员不重复, 为负数时返回 -count 个且可能重复
+func (r *ModelRedisHandler) SetRandMember(key string, count int64) ([]string, bool) {
+	if !r.Enable || count == 0 {
+		return nil, true
+	}
+	members, err := r.universalClient().SRandMemberN(context.Background(), key, count).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " SRANDMEMBER 读取错误! key: " + key + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	return members, true
+}
+
+// SetPop 随机弹出最多 count 个成员
+func (r *ModelRedisHandler) SetPop(key string, count int64) ([]string, bool) {
+	if !r.Enable || count <= 0 {
+		return nil, true
+	}
+	members, err := r.universalClient().SPopN(context.Background(), key, count).Result()
+	if err != nil && err != redis.Nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " SPOP 弹出错误! key: " + key + " 错误原因: " + err.Error())
+		return nil, false
+	}
+	return members, true
+}
+
+// SetScan 以 SSCAN 分批遍历集合, fn 返回 false 时停止; SSCAN 可能返回重复的成员
+func (r *ModelRedisHandler) SetScan(ctx context.Context, key string, fn func(members []string) bool) bool {
+	if !r.Enable {
+		return true
+	}
+	if err := r.scanSet(ctx, key, fn); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " SSCAN 遍历错误! key: " + key + " 错误原因: " + err.Error())
+		return false
+	}
+	return true
+}
+
+func (r *ModelRedisHandler) scanSet(ctx context.Context, key string, fn func(members []string) bool) error {
+	var cursor uint64
+	for {
+		members, next, err := r.universalClient().SScan(ctx, key, cursor, "", setScanCount).Result()
+		if err != nil {
+			return err
+		}
+		if len(members) > 0 && !fn(members) {
+			return nil
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// 集合运算: 单点模式以及 keys 位于同一槽位 (分片模式下为同一分片) 时直接使用 SINTER/SUNION/SDIFF 等命令;
+// 集群/分片模式下 keys 跨槽位时退化为客户端计算: 以 SSCAN 分批读取各集合并在内存中求结果, STORE 命令再以 MULTI/EXEC 写入目标 key
+// 客户端计算不是原子的, 读取期间其他客户端的修改可能部分可见; 内存占用取决于结果集合 (交集与差集以第一个集合为上限)
+
+// SetInter 多个集合的交集
+func (r *ModelRedisHandler) SetInter(keys ...string) ([]string, bool) {
+	return r.setAlgebra("SINTER", keys)
+}
+
+// SetUnion 多个集合的并集
+func (r *ModelRedisHandler) SetUnion(keys ...string) ([]string, bool) {
+	return r.setAlgebra("SUNION", keys)
+}
+
+// SetDiff 第一个集合减去其余集合的差集
+func (r *ModelRedisHandler) SetDiff(keys ...string) ([]string, bool) {
+	return r.setAlgebra("SDIFF", keys)
+}
+
+// SetInterStore 将交集写入 dest (覆盖原有的值), 返回结果的成员个数
+func (r *ModelRedisHandler) SetInterStore(dest string, keys ...string) (int64, bool) {
+	return r.setAlgebraStore("SINTERSTORE", dest, keys)
+}
+
+// SetUnionStore 将并集写入 dest (覆盖原有的值), 返回结果的成员个数
+func (r *ModelRedisHandler) SetUnionStore(dest string, keys ...string) (int64, bool) {
+	return r.setAlgebraStore("SUNIONSTORE", dest, keys)
+}
+
+// SetDiffStore 将差集写入 dest (覆盖原有的值), 返回结果的成员个数
+func (r *ModelRedisHandler) SetDiffStore(dest string, keys ...string) (int64, bool) {
+	return r.setAlgebraStore("SDIFFSTORE", dest, keys)
+}
+
+func (r *ModelRedisHandler) setAlgebra(command string, keys []string) ([]string, bool) {
+	if !r.Enable || len(keys) == 0 {
+		return nil, true
+	}
+	ctx := context.Background()
+	if r.checkSameSlot(keys...) != nil {
+		result, err := r.setAlgebraLocal(ctx, command, keys)
+		if err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " " + command + " 客户端计算错误! 错误原因: " + err.Error())
+			return nil, false
+		}
+		return sortedKeys(result), true
+	}
+	client := r.universalClient()
+	var cmd *redis.StringSliceCmd
+	switch command {
+	case "SINTER":
+		cmd = client.SInter(ctx, keys...)
+	case "SUNION":
+		cmd = client.SUnion(ctx, keys...)
+	default:
+		cmd = client.SDiff(ctx, keys...)
+	}
+	if err := cmd.Err(); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " " + command + " 读取错误! 错误原因: " + err.Error())
+		return nil, false
+	}
+	return cmd.Val(), true
+}
+
+func (r *ModelRedisHandler) setAlgebraStore(command, dest string, keys []string) (int64, bool) {
+	if !r.Enable || len(keys) == 0 {
+		return 0, true
+	}
+	ctx := context.Background()
+	if r.checkSameSlot(append([]string{dest}, keys...)...) != nil {
+		result, err := r.setAlgebraLocal(ctx, command[:len(command)-len("STORE")], keys)
+		if err == nil {
+			err = r.storeSet(ctx, dest, result)
+		}
+		if err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " " + command + " 客户端计算错误! dest: " + dest + " 错误原因: " + err.Error())
+			return 0, false
+		}
+		return int64(len(result)), true
+	}
+	client := r.universalClient()
+	var cmd *redis.IntCmd
+	switch command {
+	case "SINTERSTORE":
+		cmd = client.SInterStore(ctx, dest, keys...)
+	case "SUNIONSTORE":
+		cmd = client.SUnionStore(ctx, dest, keys...)
+	default:
+		cmd = client.SDiffStore(ctx, dest, keys...)
+	}
+	if err := cmd.Err(); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " " + command + " 写入错误! dest: " + dest + " 错误原因: " + err.Error())
+		return 0, false
+	}
+	return cmd.Val(), true
+}
+
+// setAlgebraLocal 以 SSCAN 读取各集合并在客户端计算 SINTER/SUNION/SDIFF
+// 交集从最小的集合开始, 之后每个集合只保留已有的候选成员, 候选为空时提前结束
+func (r *ModelRedisHandler) setAlgebraLocal(ctx context.Context, command string, keys []string) (map[string]struct{}, error) {
+	if command == "SINTER" {
+		smallest, smallestCard := 0, int64(-1)
+		for i, key := range keys {
+			card, err := r.universalClient().SCard(ctx, key).Result()
+			if err != nil {
+				return nil, err
+			}
+			if smallestCard < 0 || card < smallestCard {
+				smallest, smallestCard = i, card
+			}
+		}
+		ordered := append([]string{keys[smallest]}, keys[:smallest]...)
+		keys = append(ordered, keys[smallest+1:]...)
+	}
+	result := make(map[string]struct{})
+	err := r.scanSet(ctx, keys[0], func(members []string) bool {
+		for _, member := range members {
+			result[member] = struct{}{}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys[1:] {
+		if command != "SUNION" && len(result) == 0 {
+			break
+		}
+		seen := make(map[string]struct{})
+		err := r.scanSet(ctx, key, func(members []string) bool {
+			for _, member := range members {
+				switch command {
+				case "SUNION":
+					result[member] = struct{}{}
+				case "SDIFF":
+					delete(result, member)
+				default:
+					if _, ok := result[member]; ok {
+						seen[member] = struct{}{}
+					}
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		if command == "SINTER" {
+			result = seen
+		}
+	}
+	return result, nil
+}
+
+// storeSet 以 MULTI/EXEC 覆盖写入 dest, 成员按 setScanCount 分批 SADD
+func (r *ModelRedisHandler) storeSet(ctx context.Context, dest string, members map[string]struct{}) error {
+	_, err := r.universalClient().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, dest)
+		batch := make([]interface{}, 0, setScanCount)
+		for _, member := range sortedKeys(members) {
+			batch = append(batch, member)
+			if len(batch) == setScanCount {
+				pipe.SAdd(ctx, dest, batch...)
+				batch = make([]interface{}, 0, setScanCount)
+			}
+		}
+		if len(batch) > 0 {
+			pipe.SAdd(ctx, dest, batch...)
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,123 @@
+package go_toolbox
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRedisSetAPI(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	if added, ok := redisHandler.SetAdd("tags", "go", "redis", "go", "sql"); !ok || added != 3 {
+		t.Fatalf("unexpected SADD result %d", added)
+	}
+	if isMember, ok := redisHandler.SetIsMember("tags", "redis"); !ok || !isMember {
+		t.Fatal("redis should be a member")
+	}
+	if result, ok := redisHandler.SetMIsMember("tags", "go", "rust", "sql"); !ok || !reflect.DeepEqual(result, []bool{true, false, true}) {
+		t.Fatalf("unexpected SMISMEMBER %v", result)
+	}
+	if card, _ := redisHandler.SetCard("tags"); card != 3 {
+		t.Fatalf("unexpected SCARD %d", card)
+	}
+	if members, ok := redisHandler.SetRandMember("tags", 5); !ok || len(members) != 3 {
+		t.Fatalf("positive count should return distinct members, got %v", members)
+	}
+	if members, _ := redisHandler.SetRandMember("tags", -5); len(members) != 5 {
+		t.Fatalf("negative count may repeat members, got %v", members)
+	}
+	if removed, ok := redisHandler.SetRem("tags", "sql", "missing"); !ok || removed != 1 {
+		t.Fatalf("unexpected SREM %d", removed)
+	}
+	popped, ok := redisHandler.SetPop("tags", 1)
+	if !ok || len(popped) != 1 {
+		t.Fatalf("unexpected SPOP %v", popped)
+	}
+	if members, _ := redisHandler.SetMembers("tags"); len(members) != 1 || members[0] == popped[0] {
+		t.Fatalf("popped member should be removed, left %v", members)
+	}
+	if members, ok := redisHandler.SetPop("missing", 2); !ok || len(members) != 0 {
+		t.Fatalf("popping a missing set should return nothing, got %v", members)
+	}
+}
+
+func TestRedisSetAlgebra(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	redisHandler.SetAdd("a", "1", "2", "3")
+	redisHandler.SetAdd("b", "2", "3", "4")
+	inter, _ := redisHandler.SetInter("a", "b")
+	union, _ := redisHandler.SetUnion("a", "b")
+	diff, _ := redisHandler.SetDiff("a", "b")
+	sort.Strings(inter)
+	sort.Strings(union)
+	if !reflect.DeepEqual(inter, []string{"2", "3"}) || !reflect.DeepEqual(union, []string{"1", "2", "3", "4"}) || !reflect.DeepEqual(diff, []string{"1"}) {
+		t.Fatalf("unexpected algebra results %v %v %v", inter, union, diff)
+	}
+	if n, ok := redisHandler.SetUnionStore("u", "a", "b"); !ok || n != 4 {
+		t.Fatalf("unexpected SUNIONSTORE %d", n)
+	}
+}
+
+func TestRedisSetAlgebraCrossShard(t *testing.T) {
+	ring, err := NewFakeRedisRing(RingHashKetama, 0, "a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ring.ShutdownRedisHandler()
+
+	// 找到分布在不同分片上的 key, 集合足够大以覆盖多次 SSCAN
+	keys := []string{"left"}
+	for i := 0; len(keys) < 3; i++ {
+		key := fmt.Sprintf("set:%d", i)
+		if ring.ShardForKey(key) != ring.ShardForKey(keys[len(keys)-1]) {
+			keys = append(keys, key)
+		}
+	}
+	for i := 0; i < 2500; i++ {
+		ring.SetAdd(keys[0], i)
+		if i%2 == 0 {
+			ring.SetAdd(keys[1], i)
+		}
+		if i%3 == 0 {
+			ring.SetAdd(keys[2], i)
+		}
+	}
+	if ring.checkSameSlot(keys...) == nil {
+		t.Fatal("keys should live on different shards")
+	}
+	inter, ok := ring.SetInter(keys...)
+	if !ok || len(inter) != 417 {
+		t.Fatalf("unexpected cross-shard SINTER size %d", len(inter))
+	}
+	if union, _ := ring.SetUnion(keys[1], keys[2]); len(union) != 1667 {
+		t.Fatalf("unexpected cross-shard SUNION size %d", len(union))
+	}
+	if diff, _ := ring.SetDiff(keys...); len(diff) != 833 {
+		t.Fatalf("unexpected cross-shard SDIFF size %d", len(diff))
+	}
+	dest := "dest"
+	for ring.ShardForKey(dest) == ring.ShardForKey(keys[1]) {
+		dest += "'"
+	}
+	ring.Set(dest, "stale", 0)
+	if n, ok := ring.SetDiffStore(dest, keys[1], keys[2]); !ok || n != 833 {
+		t.Fatalf("unexpected cross-shard SDIFFSTORE %d", n)
+	}
+	if card, ok := ring.SetCard(dest); !ok || card != 833 {
+		t.Fatalf("dest should be overwritten with the result, card %d", card)
+	}
+	seen := 0
+	ring.SetScan(context.Background(), dest, func(members []string) bool {
+		seen += len(members)
+		return true
+	})
+	if seen != 833 {
+		t.Fatalf("SetScan should visit every member, saw %d", seen)
+	}
+}
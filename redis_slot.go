@@ -0,0 +1,85 @@
+package go_toolbox
+
+import (
+	"fmt"
+	"strings"
+)
+
+var crc16Table [256]uint16
+
+func init() {
+	// CRC16-CCITT (XMODEM), 与 Redis 集群计算槽位的算法一致
+	for i := 0; i < 256; i++ {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16Table[i] = crc
+	}
+}
+
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^key[i]]
+	}
+	return crc
+}
+
+// KeySlot 计算 key 在 Redis 集群中的槽位, 支持 {hashtag}
+func KeySlot(key string) int {
+	return int(crc16(hashTag(key))) % redisClusterSlots
+}
+
+// hashTag key 中参与分布计算的部分, 存在非空的 {hashtag} 时只取 hashtag
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+// CrossSlotError 集群模式下要求同一槽位的 key 分布在不同槽位
+type CrossSlotError struct {
+	Keys  []string
+	Slots []int
+}
+
+func (e *CrossSlotError) Error() string {
+	parts := make([]string, 0, len(e.Keys))
+	for i, key := range e.Keys {
+		parts = append(parts, fmt.Sprintf("%s(%d)", key, e.Slots[i]))
+	}
+	return "Redis 集群中 key 不在同一槽位, 请使用 {hashtag}! " + strings.Join(parts, ", ")
+}
+
+// checkSameSlot 集群模式下校验 keys 属于同一槽位, 分片模式下校验属于同一分片, 单点模式直接通过
+func (r *ModelRedisHandler) checkSameSlot(keys ...string) error {
+	if len(keys) < 2 {
+		return nil
+	}
+	if r.isRing() {
+		return r.checkSameShard(keys...)
+	}
+	if !r.IsCluster {
+		return nil
+	}
+	slots := make([]int, len(keys))
+	same := true
+	for i, key := range keys {
+		slots[i] = KeySlot(key)
+		if slots[i] != slots[0] {
+			same = false
+		}
+	}
+	if same {
+		return nil
+	}
+	return &CrossSlotError{Keys: keys, Slots: slots}
+}
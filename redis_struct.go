@@ -0,0 +1,411 @@
+package go_toolbox
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// hashField 结构体中与哈希字段对应的成员
+type hashField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var hashFieldCache sync.Map
+
+// hashFieldsOf 解析结构体的 `redis:"name,omitempty"` 标签, 未打标签的字段忽略, 匿名结构体字段会被展开
+func hashFieldsOf(t reflect.Type) []hashField {
+	if cached, ok := hashFieldCache.Load(t); ok {
+		return cached.([]hashField)
+	}
+	var fields []hashField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, tagged := sf.Tag.Lookup("redis")
+		if tag == "-" {
+			continue
+		}
+		if !tagged {
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				for _, inner := range hashFieldsOf(sf.Type) {
+					inner.index = append([]int{i}, inner.index...)
+					fields = append(fields, inner)
+				}
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+		omitEmpty := false
+		for _, opt := range strings.Split(opts, ",") {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		fields = append(fields, hashField{name: name, index: []int{i}, omitEmpty: omitEmpty})
+	}
+	hashFieldCache.Store(t, fields)
+	return fields
+}
+
+func structValueOf(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return reflect.Value{}, errors.New("结构体指针为空")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("需要结构体, 实际为 %s", rv.Kind())
+	}
+	return rv, nil
+}
+
+// encodeHashStruct 将结构体编码为哈希字段, omitempty 的零值字段与 nil 指针不会出现在结果中
+func encodeHashStruct(v interface{}) (map[string]string, error) {
+	rv, err := structValueOf(v)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, field := range hashFieldsOf(rv.Type()) {
+		fv := rv.FieldByIndex(field.index)
+		if field.omitEmpty && fv.IsZero() {
+			continue
+		}
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		encoded, err := encodeHashValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("字段 %s 编码失败: %w", field.name, err)
+		}
+		values[field.name] = encoded
+	}
+	return values, nil
+}
+
+func encodeHashValue(fv reflect.Value) (string, error) {
+	if marshaler, ok := fv.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Bool:
+		if fv.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, 64), nil
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(fv.Bytes()), nil
+		}
+	}
+	// 结构体, map, 切片等嵌套类型以 JSON 存储
+	data, err := json.Marshal(fv.Interface())
+	return string(data), err
+}
+
+// decodeHashStruct 将哈希字段写入结构体, 哈希中不存在的字段保持原值
+func decodeHashStruct(values map[string]string, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("需要非空的结构体指针")
+	}
+	rv, err := structValueOf(dst)
+	if err != nil {
+		return err
+	}
+	for _, field := range hashFieldsOf(rv.Type()) {
+		value, ok := values[field.name]
+		if !ok {
+			continue
+		}
+		fv := rv.FieldByIndex(field.index)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			fv = fv.Elem()
+		}
+		if err := decodeHashValue(value, fv); err != nil {
+			return fmt.Errorf("字段 %s 解析失败: %w", field.name, err)
+		}
+	}
+	return nil
+}
+
+func decodeHashValue(value string, fv reflect.Value) error {
+	if unmarshaler, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(value))
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+		return nil
+	case reflect.Bool:
+		switch value {
+		case "1", "true":
+			fv.SetBool(true)
+		case "0", "false", "":
+			fv.SetBool(false)
+		default:
+			return fmt.Errorf("无法解析布尔值 %q", value)
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			fv.SetBytes([]byte(value))
+			return nil
+		}
+	}
+	return json.Unmarshal([]byte(value), fv.Addr().Interface())
+}
+
+func hashArgs(values map[string]string) []interface{} {
+	args := make([]interface{}, 0, len(values)*2)
+	for field, value := range values {
+		args = append(args, field, value)
+	}
+	return args
+}
+
+// logName 日志中的 Redis 模式前缀
+func (r *ModelRedisHandler) logName() string {
+	if r.isRing() {
+		return "Redis 分片"
+	}
+	if r.IsCluster {
+		return "Redis 集群"
+	}
+	return "Redis"
+}
+
+// HashSetStruct 将结构体按 `redis:"name,omitempty"` 标签写入哈希
+// 数值, 布尔 ("1"/"0"), time.Time (RFC3339) 直接存储, 嵌套的结构体/map/切片以 JSON 存储
+func (r *ModelRedisHandler) HashSetStruct(key string, v interface{}) bool {
+	if !r.Enable {
+		return true
+	}
+	values, err := encodeHashStruct(v)
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " HashSetStruct 编码错误! 错误原因: " + err.Error())
+		return false
+	}
+	if len(values) == 0 {
+		return true
+	}
+	if r.envelopeEnabled() {
+		return r.hashSetEnveloped(key, hashArgs(values))
+	}
+	if err := r.universalClient().HSet(context.Background(), key, hashArgs(values)...).Err(); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " HSet 写入错误! 错误原因: " + err.Error())
+		return false
+	}
+	return true
+}
+
+// HashUpdateStruct 对比 old 与 new 只写入发生变化的字段, new 中被省略的字段 (omitempty 零值或 nil 指针) 会被删除
+// HSET 与 HDEL 在同一个 MULTI 中执行
+func (r *ModelRedisHandler) HashUpdateStruct(key string, old, new interface{}) bool {
+	if !r.Enable {
+		return true
+	}
+	if reflect.TypeOf(old) != reflect.TypeOf(new) {
+		Logger.Error(GetLogPrefix("") + r.logName() + " HashUpdateStruct 新旧结构体类型不一致!")
+		return false
+	}
+	oldValues, err := encodeHashStruct(old)
+	if err == nil {
+		var newValues map[string]string
+		if newValues, err = encodeHashStruct(new); err == nil {
+			return r.hashApplyDiff(key, oldValues, newValues)
+		}
+	}
+	Logger.Error(GetLogPrefix("") + r.logName() + " HashUpdateStruct 编码错误! 错误原因: " + err.Error())
+	return false
+}
+
+func (r *ModelRedisHandler) hashApplyDiff(key string, oldValues, newValues map[string]string) bool {
+	changed := make(map[string]string)
+	for field, value := range newValues {
+		if prev, ok := oldValues[field]; !ok || prev != value {
+			changed[field] = value
+		}
+	}
+	var removed []string
+	for field := range oldValues {
+		if _, ok := newValues[field]; !ok {
+			removed = append(removed, field)
+		}
+	}
+	if len(changed) == 0 && len(removed) == 0 {
+		return true
+	}
+	ctx := context.Background()
+	if r.envelopeEnabled() {
+		if err := r.hashWriteEnveloped(ctx, key, hashArgs(changed), removed); err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " HashUpdateStruct 写入错误! 错误原因: " + err.Error())
+			return false
+		}
+		return true
+	}
+	_, err := r.universalClient().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(changed) > 0 {
+			pipe.HSet(ctx, key, hashArgs(changed)...)
+		}
+		if len(removed) > 0 {
+			pipe.HDel(ctx, key, removed...)
+		}
+		return nil
+	})
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " HashUpdateStruct 写入错误! 错误原因: " + err.Error())
+		return false
+	}
+	return true
+}
+
+// HashGetStruct 读取哈希并写入 dst (结构体指针), 返回值依次为 key 是否存在, 是否成功
+func (r *ModelRedisHandler) HashGetStruct(key string, dst interface{}) (bool, bool) {
+	if !r.Enable {
+		return false, true
+	}
+	values, err := r.universalClient().HGetAll(context.Background(), key).Result()
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " HGetAll 读取错误! 错误原因: " + err.Error())
+		return false, false
+	}
+	if len(values) == 0 {
+		return false, true
+	}
+	if err := r.openHashMap(key, values); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " HashGetStruct 值信封解析错误! key: " + key + " 错误原因: " + err.Error())
+		return true, false
+	}
+	if err := decodeHashStruct(values, dst); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " HashGetStruct 解析错误! 错误原因: " + err.Error())
+		return true, false
+	}
+	return true, true
+}
+
+// HashGetStructs 通过 Pipeline 批量读取多个哈希, 结果与 keys 一一对应, 不存在的 key 为 nil
+func HashGetStructs[T any](r *ModelRedisHandler, keys []string) ([]*T, bool) {
+	results := make([]*T, len(keys))
+	if !r.Enable || len(keys) == 0 {
+		return results, true
+	}
+	ctx := context.Background()
+	pipe := r.universalClient().Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HGetAll(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " HashGetStructs 批量读取错误! 错误原因: " + err.Error())
+		return nil, false
+	}
+	for i, cmd := range cmds {
+		values := cmd.Val()
+		if len(values) == 0 {
+			continue
+		}
+		if err := r.openHashMap(keys[i], values); err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " HashGetStructs 值信封解析错误! key: " + keys[i] + " 错误原因: " + err.Error())
+			return nil, false
+		}
+		item := new(T)
+		if err := decodeHashStruct(values, item); err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " HashGetStructs 解析错误! key: " + keys[i] + " 错误原因: " + err.Error())
+			return nil, false
+		}
+		results[i] = item
+	}
+	return results, true
+}
+
+// HashSetStructs 通过 Pipeline 批量写入多个哈希, keys 与 items 一一对应
+// 开启值信封 (压缩, 分片或加密) 时逐个 key 编码写入, 不使用 Pipeline
+func HashSetStructs[T any](r *ModelRedisHandler, keys []string, items []T) bool {
+	if len(keys) != len(items) {
+		Logger.Error(GetLogPrefix("") + r.logName() + " HashSetStructs keys 与 items 数量不一致!")
+		return false
+	}
+	if !r.Enable || len(keys) == 0 {
+		return true
+	}
+	if r.envelopeEnabled() {
+		for i, key := range keys {
+			if !r.HashSetStruct(key, items[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	ctx := context.Background()
+	pipe := r.universalClient().Pipeline()
+	for i, key := range keys {
+		values, err := encodeHashStruct(items[i])
+		if err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " HashSetStructs 编码错误! key: " + key + " 错误原因: " + err.Error())
+			return false
+		}
+		if len(values) > 0 {
+			pipe.HSet(ctx, key, hashArgs(values)...)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " HashSetStructs 批量写入错误! 错误原因: " + err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package go_toolbox
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type structAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+type structBase struct {
+	Id int64 `redis:"id"`
+}
+
+type structUser struct {
+	structBase
+	Name     string            `redis:"name"`
+	Score    float64           `redis:"score"`
+	Active   bool              `redis:"active"`
+	Level    uint8             `redis:"level"`
+	Created  time.Time         `redis:"created"`
+	Nickname string            `redis:"nickname,omitempty"`
+	Address  structAddress     `redis:"address"`
+	Tags     []string          `redis:"tags,omitempty"`
+	Extra    map[string]string `redis:"extra,omitempty"`
+	Parent   *int64            `redis:"parent"`
+	Ignored  string            `redis:"-"`
+	Untagged string
+}
+
+func TestHashStruct(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	parent := int64(7)
+	created := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	user := structUser{
+		structBase: structBase{Id: 42},
+		Name:       "elvis",
+		Score:      99.5,
+		Active:     true,
+		Level:      3,
+		Created:    created,
+		Address:    structAddress{City: "Shanghai", Zip: "200000"},
+		Tags:       []string{"a", "b"},
+		Parent:     &parent,
+		Ignored:    "x",
+		Untagged:   "y",
+	}
+	if !redisHandler.HashSetStruct("user:42", &user) {
+		t.Fatal("HashSetStruct failed")
+	}
+	fields := redisHandler.RedisClient.HGetAll(context.Background(), "user:42").Val()
+	if fields["active"] != "1" || fields["created"] != "2024-05-01T08:30:00Z" || fields["address"] != `{"city":"Shanghai","zip":"200000"}` {
+		t.Fatalf("unexpected encoded fields: %v", fields)
+	}
+	if _, ok := fields["nickname"]; ok {
+		t.Fatal("omitempty field should not be written")
+	}
+	if len(fields) != 9 {
+		t.Fatalf("expected 9 fields, got %v", fields)
+	}
+
+	var got structUser
+	if found, ok := redisHandler.HashGetStruct("user:42", &got); !found || !ok {
+		t.Fatalf("HashGetStruct failed: %v %v", found, ok)
+	}
+	if got.Id != 42 || got.Name != "elvis" || got.Score != 99.5 || !got.Active || got.Level != 3 ||
+		!got.Created.Equal(created) || got.Address.City != "Shanghai" || len(got.Tags) != 2 ||
+		got.Parent == nil || *got.Parent != 7 || got.Ignored != "" || got.Untagged != "" {
+		t.Fatalf("unexpected decoded struct: %+v", got)
+	}
+	if found, ok := redisHandler.HashGetStruct("user:missing", &got); found || !ok {
+		t.Fatalf("missing key should be a miss, got %v %v", found, ok)
+	}
+}
+
+func TestHashUpdateStruct(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+
+	old := structUser{Name: "elvis", Score: 1, Tags: []string{"a"}}
+	if !redisHandler.HashSetStruct("user:1", old) {
+		t.Fatal("HashSetStruct failed")
+	}
+	// 模拟其他进程修改了未变化的字段, 增量更新不应覆盖
+	redisHandler.RedisClient.HSet(ctx, "user:1", "name", "other")
+
+	updated := old
+	updated.Score = 2
+	updated.Tags = nil
+	if !redisHandler.HashUpdateStruct("user:1", old, updated) {
+		t.Fatal("HashUpdateStruct failed")
+	}
+	fields := redisHandler.RedisClient.HGetAll(ctx, "user:1").Val()
+	if fields["name"] != "other" || fields["score"] != "2" {
+		t.Fatalf("unexpected fields after update: %v", fields)
+	}
+	if _, ok := fields["tags"]; ok {
+		t.Fatal("cleared omitempty field should be removed")
+	}
+	if redisHandler.HashUpdateStruct("user:1", old, &updated) {
+		t.Fatal("mismatched types should fail")
+	}
+}
+
+func TestHashStructs(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	keys := []string{"user:1", "user:2"}
+	users := []structUser{{Name: "a"}, {Name: "b", Active: true}}
+	if !HashSetStructs(redisHandler.ModelRedisHandler, keys, users) {
+		t.Fatal("HashSetStructs failed")
+	}
+	got, ok := HashGetStructs[structUser](redisHandler.ModelRedisHandler, []string{"user:1", "user:3", "user:2"})
+	if !ok || len(got) != 3 {
+		t.Fatalf("HashGetStructs failed: %v %v", got, ok)
+	}
+	if got[0].Name != "a" || got[1] != nil || got[2].Name != "b" || !got[2].Active {
+		t.Fatalf("unexpected results: %+v %+v %+v", got[0], got[1], got[2])
+	}
+}
+
+func TestHashFieldTagOptions(t *testing.T) {
+	type tagged struct {
+		A string `redis:"a,omitempty"`
+		B string `redis:"b,other,omitempty"`
+		C string `redis:"c,other"`
+		D string `redis:",omitempty"`
+	}
+	fields := hashFieldsOf(reflect.TypeOf(tagged{}))
+	want := map[string]bool{"a": true, "b": true, "c": false, "D": true}
+	if len(fields) != len(want) {
+		t.Fatalf("unexpected fields %+v", fields)
+	}
+	for _, field := range fields {
+		if omit, ok := want[field.name]; !ok || omit != field.omitEmpty {
+			t.Fatalf("unexpected field %+v", field)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package go_toolbox
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CacheTagPrefix 标签相关 key 的前缀, 标签 t 的集合为 cache:tag:{t}
+const CacheTagPrefix = "cache:tag:"
+
+const (
+	// cacheTagBatch 失效标签时每批读取与删除的 key 数
+	cacheTagBatch = 500
+	// cacheTagSnapshotTTL 失效快照 (没有过期时间时) 与代数 key 的过期时间, 中断的失效在此期间由下一次失效继续完成
+	cacheTagSnapshotTTL = 24 * time.Hour
+)
+
+// 标签失效: 每个标签对应以下 key, 标签整体作为 hashtag, 位于同一槽位:
+//   - cache:tag:{t}           有序集合, 成员为带过期时间的缓存 key, 分数为到期时间 (毫秒), 过期时间为最晚到期的成员
+//   - cache:tag:{t}:persist   有序集合, 成员为不过期的缓存 key, 不过期
+//   - cache:tag:{t}:gen       失效代数, 每次失效加一
+//   - cache:tag:{t}:pending   尚未删除完成的失效快照
+// 登记与失效都是单个 MULTI, 不使用 WATCH, 同一标签的并发写入不会互相冲突; 需要 Redis 7.0 以上 (PEXPIRE NX/GT)
+// 缓存 key 与标签分布在不同槽位, 集群/分片模式下可直接使用
+
+func cacheTagKey(tag string) string {
+	return CacheTagPrefix + "{" + tag + "}"
+}
+
+func cacheTagPersistKey(tag string) string {
+	return cacheTagKey(tag) + ":persist"
+}
+
+func cacheTagGenKey(tag string) string {
+	return cacheTagKey(tag) + ":gen"
+}
+
+func cacheTagPendingKey(tag string) string {
+	return cacheTagKey(tag) + ":pending"
+}
+
+// SetWithTags 写入缓存并登记到 tags 对应的标签集合, 之后 InvalidateTags 任一标签都会删除该 key
+// 写入前读取各标签的失效代数, 写入后在登记的 MULTI 中再次读取, 代数变化说明期间发生了失效, 此时删除刚写入的值;
+// 登记失败时同样删除, 不会留下无法被失效的缓存
+func (r *ModelRedisHandler) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) bool {
+	if !r.Enable {
+		return true
+	}
+	ctx := context.Background()
+	gens, err := r.cacheTagGens(ctx, tags)
+	if err != nil {
+		Logger.Error(GetLogPrefix("") + r.logName() + " SetWithTags 读取标签代数错误! key: " + key + " 错误原因: " + err.Error())
+		return false
+	}
+	if !r.Set(key, value, ttl) {
+		return false
+	}
+	for i, tag := range tags {
+		current, err := r.addCacheTag(ctx, tag, key, ttl)
+		if err == nil && current == gens[i] {
+			continue
+		}
+		if err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " SetWithTags 登记标签错误! key: " + key + " tag: " + tag + " 错误原因: " + err.Error())
+		}
+		if delErr := r.deleteValue(ctx, key); delErr != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " SetWithTags 删除未登记的值错误! key: " + key + " 错误原因: " + delErr.Error())
+			return false
+		}
+		// 写入期间标签被失效, 值已删除, 按写入成功处理
+		return err == nil
+	}
+	return true
+}
+
+// cacheTagGens 各标签当前的失效代数, 没有失效过的标签为空字符串
+func (r *ModelRedisHandler) cacheTagGens(ctx context.Context, tags []string) ([]string, error) {
+	cmds := make([]*redis.StringCmd, len(tags))
+	_, err := r.universalClient().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, tag := range tags {
+			cmds[i] = pipe.Get(ctx, cacheTagGenKey(tag))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	gens := make([]string, len(tags))
+	for i, cmd := range cmds {
+		gens[i] = cmd.Val()
+	}
+	return gens, nil
+}
+
+// addCacheTag 在一个 MULTI 中读取失效代数并登记成员, 返回登记时的代数
+// 带过期时间的成员同时清理已到期的成员, 并以 PEXPIRE NX 与 GT 只延长不缩短标签集合的过期时间
+func (r *ModelRedisHandler) addCacheTag(ctx context.Context, tag, key string, ttl time.Duration) (string, error) {
+	var gen *redis.StringCmd
+	_, err := r.universalClient().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		gen = pipe.Get(ctx, cacheTagGenKey(tag))
+		if ttl <= 0 {
+			pipe.ZAdd(ctx, cacheTagPersistKey(tag), redis.Z{Score: 0, Member: key})
+			return nil
+		}
+		tagKey := cacheTagKey(tag)
+		now := time.Now()
+		pipe.ZAdd(ctx, tagKey, redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: key})
+		pipe.ZRemRangeByScore(ctx, tagKey, "-inf", "("+strconv.FormatInt(now.UnixMilli(), 10))
+		pexpireIf(ctx, pipe, tagKey, ttl, "NX")
+		pexpireIf(ctx, pipe, tagKey, ttl, "GT")
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+	return gen.Val(), nil
+}
+
+// InvalidateTags 删除带有任一标签的全部缓存 key, 返回删除的 key 数
+// 每个标签在一个 MULTI 中增加失效代数并将标签集合 RENAME 为快照, 之后分批删除快照中的 key;
+// 失效期间新写入的缓存登记在新的标签集合中, 不会被误删或遗漏; 删除中途失败时快照保留在 pending 中, 下一次失效时继续删除
+// key 被重新写入而不再带有该标签时, 旧的登记仍会使其被删除 (多删不影响缓存的正确性)
+func (r *ModelRedisHandler) InvalidateTags(tags ...string) (int64, bool) {
+	if !r.Enable {
+		return 0, true
+	}
+	ctx := context.Background()
+	var deleted int64
+	for _, tag := range tags {
+		n, err := r.invalidateCacheTag(ctx, tag)
+		deleted += n
+		if err != nil {
+			Logger.Error(GetLogPrefix("") + r.logName() + " InvalidateTags 失效标签错误! tag: " + tag + " 错误原因: " + err.Error())
+			return deleted, false
+		}
+	}
+	return deleted, true
+}
+
+func (r *ModelRedisHandler) invalidateCacheTag(ctx context.Context, tag string) (int64, error) {
+	token, err := newSemaphoreToken()
+	if err != nil {
+		return 0, err
+	}
+	pendingKey := cacheTagPendingKey(tag)
+	client := r.universalClient()
+	cmds, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, cacheTagGenKey(tag))
+		pipe.PExpire(ctx, cacheTagGenKey(tag), cacheTagSnapshotTTL)
+		for _, tagKey := range []string{cacheTagKey(tag), cacheTagPersistKey(tag)} {
+			snapshot := tagKey + ":invalidating:" + token
+			pipe.Rename(ctx, tagKey, snapshot)
+			// 带过期时间的快照沿用标签集合的过期时间, 到期时其中的 key 均已过期
+			pexpireIf(ctx, pipe, snapshot, cacheTagSnapshotTTL, "NX")
+			pipe.SAdd(ctx, pendingKey, snapshot)
+		}
+		return nil
+	})
+	// 标签集合不存在时 RENAME 返回错误, 其余命令照常执行
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && !isNoSuchKey(cmdErr) {
+			return 0, cmdErr
+		}
+	}
+	if err != nil && !isNoSuchKey(err) {
+		return 0, err
+	}
+	// 依次删除本次与之前中断的快照
+	snapshots, err := client.SMembers(ctx, pendingKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, snapshot := range snapshots {
+		n, err := r.drainCacheTagSnapshot(ctx, snapshot)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		if err := client.SRem(ctx, pendingKey, snapshot).Err(); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// drainCacheTagSnapshot 分批删除快照中的 key, 完成后删除快照
+func (r *ModelRedisHandler) drainCacheTagSnapshot(ctx context.Context, snapshot string) (int64, error) {
+	client := r.universalClient()
+	var deleted int64
+	for start := int64(0); ; start += cacheTagBatch {
+		keys, err := client.ZRange(ctx, snapshot, start, start+cacheTagBatch-1).Result()
+		if err != nil {
+			return deleted, err
+		}
+		if len(keys) == 0 {
+			break
+		}
+		// 缓存 key 分布在不同槽位, 逐个 UNLINK, 由 Pipeline 按节点合并发送;
+		// 开启分片时与 deleteValue 一致, 先取回值再删除其分片 (不是字符串的 key GET 返回 WRONGTYPE, 忽略即可)
+		cmds, _ := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				if r.MaxValueSize > 0 {
+					pipe.Get(ctx, key)
+				}
+				pipe.Unlink(ctx, key)
+			}
+			return nil
+		})
+		var chunks []string
+		for _, cmd := range cmds {
+			switch cmd := cmd.(type) {
+			case *redis.StringCmd:
+				chunks = append(chunks, envelopeChunkKeys(fmt.Sprint(cmd.Args()[1]), cmd.Val())...)
+			case *redis.IntCmd:
+				if err := cmd.Err(); err != nil {
+					return deleted, err
+				}
+				deleted += cmd.Val()
+			}
+		}
+		r.deleteChunks(ctx, "InvalidateTags", chunks)
+	}
+	return deleted, client.Del(ctx, snapshot).Err()
+}
+
+// pexpireIf 带条件 (NX/XX/GT/LT) 的 PEXPIRE, 客户端只提供按秒的条件版本, 这里保留毫秒精度
+func pexpireIf(ctx context.Context, pipe redis.Pipeliner, key string, ttl time.Duration, condition string) {
+	pipe.Do(ctx, "PEXPIRE", key, ttl.Milliseconds(), condition)
+}
+
+// isNoSuchKey RENAME 的源 key 不存在
+func isNoSuchKey(err error) bool {
+	return err != nil && err.Error() == "ERR no such key"
+}
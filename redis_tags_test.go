@@ -0,0 +1,223 @@
+package go_toolbox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisCacheTags(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+	client := redisHandler.RedisClient
+
+	redisHandler.SetWithTags("q:orders:t1", "r1", time.Hour, "tenant:1", "product:9")
+	redisHandler.SetWithTags("q:stock:p9", "r2", 0, "product:9")
+	redisHandler.SetWithTags("q:orders:t2", "r3", time.Minute, "tenant:2")
+	if ttl := client.TTL(ctx, cacheTagKey("tenant:1")).Val(); ttl < 59*time.Minute {
+		t.Fatalf("tag set should live as long as its members, TTL %v", ttl)
+	}
+	if ttl := client.TTL(ctx, cacheTagPersistKey("product:9")).Val(); ttl != -1 {
+		t.Fatalf("a tag with a non-expiring member should not expire, TTL %v", ttl)
+	}
+	// 较短的 TTL 不会缩短标签集合的过期时间
+	redisHandler.SetWithTags("q:short:t1", "r4", time.Second, "tenant:1")
+	if ttl := client.TTL(ctx, cacheTagKey("tenant:1")).Val(); ttl < 59*time.Minute {
+		t.Fatalf("tag TTL should never shrink, got %v", ttl)
+	}
+
+	deleted, ok := redisHandler.InvalidateTags("product:9")
+	if !ok || deleted != 2 {
+		t.Fatalf("unexpected deleted count %d", deleted)
+	}
+	for key, want := range map[string]int64{"q:orders:t1": 0, "q:stock:p9": 0, "q:orders:t2": 1} {
+		if n := client.Exists(ctx, key).Val(); n != want {
+			t.Fatalf("%s: exists=%d, want %d", key, n, want)
+		}
+	}
+	if n := client.Exists(ctx, cacheTagKey("product:9"), cacheTagPersistKey("product:9"), cacheTagPendingKey("product:9")).Val(); n != 0 {
+		t.Fatal("invalidated tag sets should be removed")
+	}
+	if deleted, ok := redisHandler.InvalidateTags("unknown"); !ok || deleted != 0 {
+		t.Fatalf("invalidating an unknown tag should be a no-op, got %d %v", deleted, ok)
+	}
+	for _, key := range redisHandler.Keys() {
+		if strings.HasPrefix(key, CacheTagPrefix) && key != cacheTagKey("tenant:1") && key != cacheTagKey("tenant:2") &&
+			!strings.HasSuffix(key, ":gen") {
+			t.Fatalf("leftover tag key %s", key)
+		}
+	}
+}
+
+func TestRedisCacheTagsPruneExpired(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	redisHandler.SetWithTags("old", "v", 20*time.Millisecond, "t")
+	time.Sleep(40 * time.Millisecond)
+	redisHandler.SetWithTags("new", "v", time.Hour, "t")
+	members := redisHandler.RedisClient.ZRange(context.Background(), cacheTagKey("t"), 0, -1).Val()
+	if len(members) != 1 || members[0] != "new" {
+		t.Fatalf("expired members should be pruned on write, got %v", members)
+	}
+}
+
+func TestRedisCacheTagsRing(t *testing.T) {
+	ring, err := NewFakeRedisRing(RingHashRendezvous, 0, "a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ring.ShutdownRedisHandler()
+
+	for i := 0; i < 50; i++ {
+		if !ring.SetWithTags(fmt.Sprintf("page:%d", i), i, time.Hour, "tenant:7") {
+			t.Fatal("SetWithTags failed")
+		}
+	}
+	if deleted, ok := ring.InvalidateTags("tenant:7"); !ok || deleted != 50 {
+		t.Fatalf("keys on every shard should be deleted, got %d", deleted)
+	}
+	for name, shard := range ring.Shards {
+		for _, key := range shard.Keys() {
+			if key != cacheTagGenKey("tenant:7") {
+				t.Fatalf("shard %s still holds %s", name, key)
+			}
+		}
+	}
+}
+
+// invalidateOnSet 在 SET 指定 key 之后立即失效标签, 模拟写入值与登记标签之间发生的失效
+type invalidateOnSet struct {
+	r   *ModelRedisHandler
+	key string
+	tag string
+}
+
+func (h *invalidateOnSet) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *invalidateOnSet) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		if cmd.Name() == "set" && cmd.Args()[1] == h.key {
+			h.r.InvalidateTags(h.tag)
+		}
+		return err
+	}
+}
+
+func (h *invalidateOnSet) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestRedisCacheTagsInvalidatedDuringSet(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	for _, ttl := range []time.Duration{time.Hour, 0} {
+		redisHandler.addHook(&invalidateOnSet{r: redisHandler.ModelRedisHandler, key: "racy", tag: "t"})
+		if !redisHandler.SetWithTags("racy", "stale", ttl, "t") {
+			t.Fatal("SetWithTags should succeed when the value is dropped")
+		}
+		if value, _ := redisHandler.Get("racy"); value != "" {
+			t.Fatalf("ttl %v: value written during invalidation should be deleted, got %q", ttl, value)
+		}
+	}
+}
+
+func TestRedisCacheTagsResumeSnapshot(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+
+	redisHandler.SetWithTags("a", "v", 0, "t")
+	redisHandler.SetWithTags("b", "v", time.Hour, "t")
+	redisHandler.FailNext("UNLINK", 1, "ERR boom")
+	if _, ok := redisHandler.InvalidateTags("t"); ok {
+		t.Fatal("a failed delete should be reported")
+	}
+	snapshots := redisHandler.RedisClient.SMembers(ctx, cacheTagPendingKey("t")).Val()
+	if len(snapshots) != 2 {
+		t.Fatalf("interrupted snapshots should stay pending, got %v", snapshots)
+	}
+	for _, snapshot := range snapshots {
+		if ttl := redisHandler.RedisClient.PTTL(ctx, snapshot).Val(); ttl <= 0 {
+			t.Fatalf("snapshot %s should expire, TTL %v", snapshot, ttl)
+		}
+	}
+	redisHandler.SetWithTags("c", "v", time.Hour, "t")
+	if deleted, ok := redisHandler.InvalidateTags("t"); !ok || deleted < 2 {
+		t.Fatalf("leftover snapshots should be drained, got %d %v", deleted, ok)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if n := redisHandler.RedisClient.Exists(ctx, key).Val(); n != 0 {
+			t.Fatalf("%s should be invalidated", key)
+		}
+	}
+}
+
+func TestRedisCacheTagsHotTag(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+
+	var wg sync.WaitGroup
+	var failed int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if !redisHandler.SetWithTags(fmt.Sprintf("page:%d:%d", i, j), j, time.Hour, "tenant:1") {
+					atomic.AddInt32(&failed, 1)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if failed != 0 {
+		t.Fatalf("%d concurrent writes to one tag failed", failed)
+	}
+	if deleted, ok := redisHandler.InvalidateTags("tenant:1"); !ok || deleted != 200 {
+		t.Fatalf("unexpected deleted count %d", deleted)
+	}
+}
+
+func TestRedisCacheTagsChunkedValues(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	redisHandler.MaxValueSize = 64
+	ctx := context.Background()
+
+	if !redisHandler.SetWithTags("q:big", strings.Repeat("x", 500), 0, "report") ||
+		!redisHandler.SetWithTags("q:small", "r1", time.Hour, "report") {
+		t.Fatal("SetWithTags failed")
+	}
+	// 标签下也可能登记了不是字符串的 key
+	redisHandler.HashSet("q:hash", "f", "v")
+	if _, err := redisHandler.addCacheTag(ctx, "report", "q:hash", 0); err != nil {
+		t.Fatal(err)
+	}
+	chunked := false
+	for _, key := range redisHandler.Keys() {
+		chunked = chunked || strings.Contains(key, envelopeChunkToken)
+	}
+	if !chunked {
+		t.Fatal("the large value should be chunked")
+	}
+	if deleted, ok := redisHandler.InvalidateTags("report"); !ok || deleted != 3 {
+		t.Fatalf("unexpected deleted count %d %v", deleted, ok)
+	}
+	for _, key := range redisHandler.Keys() {
+		if strings.Contains(key, envelopeChunkToken) {
+			t.Fatalf("chunk %s should be deleted with its value", key)
+		}
+	}
+}
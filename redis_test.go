@@ -1,25 +1,188 @@
 package go_toolbox
 
 import (
+	"context"
+	"errors"
+	"os"
 	"testing"
 	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 )
 
-var config = RedisConf{
-	Host:      ":6379",
-	Password:  "",
-	Database:  0,
-	IsCluster: true,
-	Enable:    true,
+func TestMain(m *testing.M) {
+	Logger = zap.NewNop()
+	os.Exit(m.Run())
 }
 
 func TestGSet(t *testing.T) {
-	redisHandler := NewRedisHandler(&config)
-	redisHandler.Set("tests", "a", time.Second)
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	if !redisHandler.Set("tests", "a", time.Second) {
+		t.Fatal("set failed")
+	}
 	value, success := redisHandler.Get("tests")
-	if !success {
-		println("fail")
+	if !success || value != "a" {
+		t.Fatalf("expected a, got %q %v", value, success)
+	}
+	redisHandler.FastForward(2 * time.Second)
+	if value, success = redisHandler.Get("tests"); !success || value != "" {
+		t.Fatalf("expected expired key to miss, got %q %v", value, success)
+	}
+}
+
+func TestHash(t *testing.T) {
+	var redisHandler RedisStore = NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	if !redisHandler.HashSet("user:1", "name", "elvis", "age", 18) {
+		t.Fatal("hset failed")
+	}
+	if name, _ := redisHandler.HashGet("user:1", "name"); name != "elvis" {
+		t.Fatalf("expected elvis, got %q", name)
+	}
+	values, _ := redisHandler.HashMGET("user:1", "age", "missing")
+	if len(values) != 2 || values[0] != "18" || values[1] != nil {
+		t.Fatalf("unexpected hmget result: %v", values)
+	}
+	redisHandler.HashDel("user:1", "age")
+	if n := redisHandler.HashLen("user:1"); n != 1 {
+		t.Fatalf("expected 1 field, got %d", n)
+	}
+}
+
+func TestList(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	redisHandler.AppendList("events", "a")
+	redisHandler.AppendList("events", "b")
+	if values, _ := redisHandler.GetList("events", 0, -1); len(values) != 2 || values[0] != "b" {
+		t.Fatalf("unexpected list: %v", values)
+	}
+	redisHandler.EmptyList("events")
+	if values, _ := redisHandler.GetList("events", 0, -1); len(values) != 0 {
+		t.Fatalf("expected empty list, got %v", values)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	if inserted, ok := redisHandler.BFAdd("seen", "a"); !ok || !inserted {
+		t.Fatalf("expected first insert, got %v %v", inserted, ok)
+	}
+	if inserted, _ := redisHandler.BFAdd("seen", "a"); inserted {
+		t.Fatal("expected duplicate insert to report false")
+	}
+	if !redisHandler.BFExists("seen", "a") || redisHandler.BFExists("seen", "b") {
+		t.Fatal("unexpected BF.EXISTS result")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	pipe, ctx := redisHandler.Pipeline()
+	for i := 0; i < 1000; i++ {
+		pipe.Incr(ctx, "counter")
+	}
+	cmds, err := redisHandler.PipelineExecute(pipe, ctx)
+	if err != nil || len(cmds) != 1000 {
+		t.Fatalf("pipeline failed: %v", err)
+	}
+	if value, _ := redisHandler.Get("counter"); value != "1000" {
+		t.Fatalf("expected 1000, got %s", value)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := newCircuitBreaker(2, 50*time.Millisecond)
+	failure := errors.New("dial tcp: connection refused")
+
+	for i := 0; i < 2; i++ {
+		if err := breaker.Allow(); err != nil {
+			t.Fatalf("closed breaker rejected request: %v", err)
+		}
+		breaker.ReportResult(failure)
+	}
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("expected open, got %s", breaker.State())
+	}
+	if err := breaker.Allow(); err != ErrRedisCircuitOpen {
+		t.Fatalf("expected fail fast, got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected probe in half-open state, got %v", err)
+	}
+	if breaker.State() != BreakerHalfOpen {
+		t.Fatalf("expected half-open, got %s", breaker.State())
+	}
+	if err := breaker.Allow(); err != ErrRedisCircuitOpen {
+		t.Fatalf("expected only one probe, got %v", err)
+	}
+	breaker.ReportResult(redis.Nil)
+	if breaker.State() != BreakerClosed {
+		t.Fatalf("expected closed after successful probe, got %s", breaker.State())
+	}
+}
+
+func TestNodeBreakers(t *testing.T) {
+	redisHandler := &ModelRedisHandler{breakers: newNodeBreakers(1, time.Minute)}
+	a, b := redisHandler.limiter("a:6379"), redisHandler.limiter("b:6379")
+	if a == b || redisHandler.limiter("a:6379") != a {
+		t.Fatal("each node address should get its own breaker")
+	}
+	if err := a.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	a.ReportResult(errors.New("dial tcp: connection refused"))
+	if err := b.Allow(); err != nil {
+		t.Fatalf("a failing node should not open other nodes' breakers: %v", err)
 	}
-	println(value)
+	states := redisHandler.NodeBreakerStates()
+	if states["a:6379"] != BreakerOpen || states["b:6379"] != BreakerClosed || redisHandler.BreakerState() != BreakerOpen {
+		t.Fatalf("unexpected breaker states %v", states)
+	}
+}
+
+func TestDisabledRedisHandler(t *testing.T) {
+	redisHandler := NewRedisHandler(&RedisConf{Host: ":6379", Enable: false})
+	if !redisHandler.Set("tests", "a", time.Second) {
+		t.Fatal("disabled Set should be a no-op success")
+	}
+	if value, success := redisHandler.Get("tests"); !success || value != "" {
+		t.Fatalf("disabled Get should be a cache miss, got %q %v", value, success)
+	}
+	pipe, ctx := redisHandler.Pipeline()
+	pipe.Get(ctx, "tests")
+	if _, err := redisHandler.PipelineExecute(pipe, ctx); err != redis.Nil {
+		t.Fatalf("disabled pipeline should return redis.Nil, got %v", err)
+	}
+}
 
+func TestOpenRedisHandlerUnavailable(t *testing.T) {
+	unavailable := RedisConf{Host: "127.0.0.1:1", Enable: true}
+	if _, err := OpenRedisHandler(&unavailable, WithPingTimeout(200*time.Millisecond)); err == nil {
+		t.Fatal("expected error for unavailable redis")
+	}
+
+	redisHandler, err := OpenRedisHandler(&unavailable, WithBackgroundConnect(),
+		WithConnectBackoff(10*time.Millisecond, 50*time.Millisecond), WithPingTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("background connect should not fail: %v", err)
+	}
+	if redisHandler.Ready() || redisHandler.ConnState() != ConnConnecting {
+		t.Fatalf("expected connecting state, got %s", redisHandler.ConnState())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := redisHandler.WaitReady(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	_ = redisHandler.ShutdownRedisHandler()
+	if redisHandler.ConnState() != ConnClosed {
+		t.Fatalf("expected closed state, got %s", redisHandler.ConnState())
+	}
 }
@@ -0,0 +1,112 @@
+package go_toolbox
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultTxMaxRetries int = 10
+	DefaultTxMinBackoff     = 2 * time.Millisecond
+	DefaultTxMaxBackoff     = 100 * time.Millisecond
+)
+
+type txOptions struct {
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// TxOption Transaction 的可选参数
+type TxOption func(*txOptions)
+
+// WithTxRetries 设置 WATCH 冲突后的最大重试次数
+func WithTxRetries(maxRetries int) TxOption {
+	return func(o *txOptions) {
+		o.maxRetries = maxRetries
+	}
+}
+
+// WithTxBackoff 设置重试的最小与最大退避时间, min 不大于 0 时使用默认值, max 小于 min 时按 min
+func WithTxBackoff(min, max time.Duration) TxOption {
+	return func(o *txOptions) {
+		o.minBackoff = min
+		o.maxBackoff = max
+	}
+}
+
+func newTxOptions(opts []TxOption) txOptions {
+	o := txOptions{
+		maxRetries: DefaultTxMaxRetries,
+		minBackoff: DefaultTxMinBackoff,
+		maxBackoff: DefaultTxMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.maxRetries < 0 {
+		o.maxRetries = 0
+	}
+	if o.minBackoff <= 0 {
+		o.minBackoff = DefaultTxMinBackoff
+	}
+	if o.maxBackoff < o.minBackoff {
+		o.maxBackoff = o.minBackoff
+	}
+	return o
+}
+
+// Transaction 乐观事务: WATCH keys 后执行 fn, fn 通过 tx 读取当前值并把写命令加入 pipe,
+// 返回后以 MULTI/EXEC 提交; 若 keys 在此期间被修改则按退避时间重试
+// 集群模式下 keys 必须位于同一槽位, 否则直接返回 *CrossSlotError
+//
+//	err := handler.Transaction(ctx, []string{"balance:1"}, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+//		balance, err := tx.Get(ctx, "balance:1").Int64()
+//		if err != nil && err != redis.Nil {
+//			return err
+//		}
+//		pipe.Set(ctx, "balance:1", balance+10, 0)
+//		return nil
+//	})
+func (r *ModelRedisHandler) Transaction(ctx context.Context, keys []string, fn func(tx *redis.Tx, pipe redis.Pipeliner) error, opts ...TxOption) error {
+	if !r.Enable {
+		return nil
+	}
+	if err := r.checkSameSlot(keys...); err != nil {
+		return err
+	}
+	o := newTxOptions(opts)
+	txf := func(tx *redis.Tx) error {
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return fn(tx, pipe)
+		})
+		return err
+	}
+	backoff := o.minBackoff
+	for attempt := 0; ; attempt++ {
+		err := r.universalClient().Watch(ctx, txf, keys...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+		if attempt >= o.maxRetries {
+			Logger.Warn(GetLogPrefix("") + fmt.Sprintf("Redis 事务重试 %d 次后仍然冲突! keys: %v", o.maxRetries, keys))
+			return err
+		}
+		// 随机抖动避免多个冲突方同时重试
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > o.maxBackoff {
+			backoff = o.maxBackoff
+		}
+	}
+}
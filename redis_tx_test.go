@@ -0,0 +1,75 @@
+package go_toolbox
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestKeySlot(t *testing.T) {
+	if slot := KeySlot("foo"); slot != 12182 {
+		t.Fatalf("expected 12182, got %d", slot)
+	}
+	if KeySlot("{user1000}.following") != KeySlot("{user1000}.followers") {
+		t.Fatal("keys with the same hashtag should share a slot")
+	}
+	if KeySlot("{}foo") != KeySlot("{}foo") || KeySlot("{}foo") == KeySlot("") {
+		t.Fatal("empty hashtag should hash the whole key")
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	redisHandler := NewFakeRedis()
+	defer redisHandler.ShutdownRedisHandler()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				err := redisHandler.Transaction(ctx, []string{"balance"}, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+					balance, err := tx.Get(ctx, "balance").Int64()
+					if err != nil && err != redis.Nil {
+						return err
+					}
+					pipe.Set(ctx, "balance", balance+1, 0)
+					return nil
+				}, WithTxRetries(1000))
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := redisHandler.Get("balance"); value != "100" {
+		t.Fatalf("expected 100, got %s", value)
+	}
+}
+
+func TestTransactionCrossSlot(t *testing.T) {
+	redisHandler := &ModelRedisHandler{RedisConf: RedisConf{IsCluster: true, Enable: true}}
+	err := redisHandler.Transaction(context.Background(), []string{"a", "b"}, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		t.Fatal("fn should not run for cross-slot keys")
+		return nil
+	})
+	if _, ok := err.(*CrossSlotError); !ok {
+		t.Fatalf("expected CrossSlotError, got %v", err)
+	}
+}
+
+func TestTxOptions(t *testing.T) {
+	o := newTxOptions([]TxOption{WithTxBackoff(-time.Millisecond, 0), WithTxRetries(-1)})
+	if o.minBackoff != DefaultTxMinBackoff || o.maxBackoff != DefaultTxMinBackoff || o.maxRetries != 0 {
+		t.Fatalf("invalid options should be corrected, got %+v", o)
+	}
+	o = newTxOptions([]TxOption{WithTxBackoff(50*time.Millisecond, 10*time.Millisecond)})
+	if o.minBackoff != 50*time.Millisecond || o.maxBackoff != 50*time.Millisecond {
+		t.Fatalf("max backoff should not be below min, got %+v", o)
+	}
+}
@@ -0,0 +1,109 @@
+package redistest
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fakeDumpPrefix FakeRedis 的 DUMP 格式, 只能在 Server 之间 RESTORE
+const fakeDumpPrefix = "FAKEDUMP1"
+
+type fakeDump struct {
+	Kind string             `json:"kind"`
+	Str  string             `json:"str,omitempty"`
+	Hash map[string]string  `json:"hash,omitempty"`
+	List []string           `json:"list,omitempty"`
+	Set  []string           `json:"set,omitempty"`
+	ZSet map[string]float64 `json:"zset,omitempty"`
+	JSON string             `json:"json,omitempty"`
+}
+
+func fakeDumpEntry(c *fakeRedisConn, args []string) interface{} {
+	entry := c.server.lookup(args[1])
+	if entry == nil {
+		return nil
+	}
+	dump := fakeDump{Kind: entry.kind, Str: entry.str, Hash: entry.hash, List: entry.list, ZSet: entry.zset}
+	for item := range entry.set {
+		dump.Set = append(dump.Set, item)
+	}
+	if entry.kind == fakeKindJSON {
+		dump.JSON = encodeFakeJSON(entry.doc)
+	}
+	data, err := json.Marshal(dump)
+	if err != nil {
+		return err
+	}
+	return fakeDumpPrefix + string(data)
+}
+
+// fakeMemoryOverhead MEMORY USAGE 估算中每个 key 的固定开销
+const fakeMemoryOverhead = 56
+
+// fakeMemory 只支持 MEMORY USAGE key [SAMPLES n], 以 DUMP 序列化后的长度加上 key 长度与固定开销估算内存占用
+func fakeMemory(c *fakeRedisConn, args []string) interface{} {
+	if strings.ToUpper(args[1]) != "USAGE" {
+		return errors.New("ERR unknown subcommand '" + args[1] + "'")
+	}
+	if len(args) != 3 && (len(args) != 5 || strings.ToUpper(args[3]) != "SAMPLES") {
+		return errFakeSyntax
+	}
+	dump, ok := fakeDumpEntry(c, []string{"DUMP", args[2]}).(string)
+	if !ok {
+		return nil
+	}
+	return int64(len(args[2]) + len(dump) - len(fakeDumpPrefix) + fakeMemoryOverhead)
+}
+
+func fakeRestore(c *fakeRedisConn, args []string) interface{} {
+	ttl, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil || ttl < 0 {
+		return errors.New("ERR Invalid TTL value, must be >= 0")
+	}
+	var replace, absTTL bool
+	for i := 4; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		case "IDLETIME", "FREQ":
+			i++
+		default:
+			return errFakeSyntax
+		}
+	}
+	var dump fakeDump
+	if !strings.HasPrefix(args[3], fakeDumpPrefix) || json.Unmarshal([]byte(args[3][len(fakeDumpPrefix):]), &dump) != nil {
+		return errors.New("ERR DUMP payload version or checksum are wrong")
+	}
+	key := args[1]
+	if c.server.lookup(key) != nil && !replace {
+		return errors.New("BUSYKEY Target key name already exists.")
+	}
+	entry := &fakeRedisEntry{kind: dump.Kind, str: dump.Str, hash: dump.Hash, list: dump.List, zset: dump.ZSet}
+	if dump.Set != nil || dump.Kind == fakeKindBloom {
+		entry.set = make(map[string]struct{}, len(dump.Set))
+		for _, item := range dump.Set {
+			entry.set[item] = struct{}{}
+		}
+	}
+	if dump.Kind == fakeKindJSON {
+		if entry.doc, err = decodeFakeJSON(dump.JSON); err != nil {
+			return err
+		}
+	}
+	if ttl > 0 {
+		if absTTL {
+			entry.expireAt = time.UnixMilli(ttl)
+		} else {
+			entry.expireAt = c.server.now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+	}
+	c.server.data[key] = entry
+	c.server.touch(key)
+	return fakeStatus("OK")
+}
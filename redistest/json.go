@@ -0,0 +1,464 @@
+package redistest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const fakeKindJSON = "ReJSON-RL"
+
+var errFakeJSONPath = errors.New("ERR JSONPath syntax error")
+
+// fakeJSONSegment JSONPath 的一段: 对象字段, 数组下标或通配符
+type fakeJSONSegment struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// fakeJSONRef 路径匹配到的一个位置, 通过 parent 修改或删除
+type fakeJSONRef struct {
+	value  interface{}
+	set    func(v interface{})
+	delete func()
+}
+
+// parseFakeJSONPath 仅支持 $, .name, ['name'], [index], .* 与 [*], 不支持递归下降与过滤表达式
+func parseFakeJSONPath(path string) ([]fakeJSONSegment, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, errFakeJSONPath
+	}
+	var segments []fakeJSONSegment
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			return nil, errFakeJSONPath
+		case strings.HasPrefix(rest, ".*"):
+			segments = append(segments, fakeJSONSegment{wildcard: true})
+			rest = rest[2:]
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, errFakeJSONPath
+			}
+			segments = append(segments, fakeJSONSegment{name: rest[1 : end+1]})
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, errFakeJSONPath
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				segments = append(segments, fakeJSONSegment{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segments = append(segments, fakeJSONSegment{name: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, errFakeJSONPath
+				}
+				segments = append(segments, fakeJSONSegment{index: index, isIndex: true})
+			}
+		default:
+			return nil, errFakeJSONPath
+		}
+	}
+	return segments, nil
+}
+
+// fakeJSONMatch 按路径查找全部匹配的位置
+func fakeJSONMatch(entry *fakeRedisEntry, segments []fakeJSONSegment) []fakeJSONRef {
+	refs := []fakeJSONRef{{
+		value: entry.doc,
+		set:   func(v interface{}) { entry.doc = v },
+	}}
+	for _, segment := range segments {
+		var next []fakeJSONRef
+		for _, ref := range refs {
+			next = append(next, fakeJSONChildren(ref.value, segment)...)
+		}
+		refs = next
+	}
+	return refs
+}
+
+func fakeJSONChildren(value interface{}, segment fakeJSONSegment) []fakeJSONRef {
+	var refs []fakeJSONRef
+	switch container := value.(type) {
+	case map[string]interface{}:
+		if segment.isIndex {
+			return nil
+		}
+		names := []string{segment.name}
+		if segment.wildcard {
+			names = make([]string, 0, len(container))
+			for name := range container {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		for _, name := range names {
+			child, ok := container[name]
+			if !ok {
+				continue
+			}
+			name := name
+			refs = append(refs, fakeJSONRef{
+				value:  child,
+				set:    func(v interface{}) { container[name] = v },
+				delete: func() { delete(container, name) },
+			})
+		}
+	case *[]interface{}:
+		if !segment.isIndex && !segment.wildcard {
+			return nil
+		}
+		for i := range *container {
+			if segment.isIndex {
+				index := segment.index
+				if index < 0 {
+					index += len(*container)
+				}
+				if i != index {
+					continue
+				}
+			}
+			i := i
+			refs = append(refs, fakeJSONRef{
+				value: (*container)[i],
+				set:   func(v interface{}) { (*container)[i] = v },
+				// 删除时先置为删除标记, 由 compactFakeJSON 统一移除, 避免下标错位
+				delete: func() { (*container)[i] = fakeJSONDeleted{} },
+			})
+		}
+	}
+	return refs
+}
+
+type fakeJSONDeleted struct{}
+
+// decodeFakeJSON 解析 JSON, 数组使用 *[]interface{} 以便原地追加, 数字保留原始文本
+func decodeFakeJSON(data string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, errors.New("ERR expected value")
+	}
+	return wrapFakeJSON(value), nil
+}
+
+func wrapFakeJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = wrapFakeJSON(child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = wrapFakeJSON(child)
+		}
+		return &v
+	default:
+		return v
+	}
+}
+
+func unwrapFakeJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			out[key] = unwrapFakeJSON(child)
+		}
+		return out
+	case *[]interface{}:
+		out := make([]interface{}, 0, len(*v))
+		for _, child := range *v {
+			if _, deleted := child.(fakeJSONDeleted); !deleted {
+				out = append(out, unwrapFakeJSON(child))
+			}
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func compactFakeJSON(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, child := range v {
+			compactFakeJSON(child)
+		}
+	case *[]interface{}:
+		kept := (*v)[:0]
+		for _, child := range *v {
+			if _, deleted := child.(fakeJSONDeleted); !deleted {
+				compactFakeJSON(child)
+				kept = append(kept, child)
+			}
+		}
+		*v = kept
+	}
+}
+
+func encodeFakeJSON(value interface{}) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(unwrapFakeJSON(value))
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func fakeJSONLookup(c *fakeRedisConn, key, path string) (*fakeRedisEntry, []fakeJSONSegment, error) {
+	segments, err := parseFakeJSONPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry, err := c.server.lookupKind(key, fakeKindJSON)
+	return entry, segments, err
+}
+
+func fakeJSONSet(c *fakeRedisConn, args []string) interface{} {
+	var nx, xx bool
+	for _, arg := range args[4:] {
+		switch strings.ToUpper(arg) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			return errFakeSyntax
+		}
+	}
+	entry, segments, err := fakeJSONLookup(c, args[1], args[2])
+	if err != nil {
+		return err
+	}
+	value, err := decodeFakeJSON(args[3])
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		if len(segments) > 0 {
+			return errors.New("ERR new objects must be created at the root")
+		}
+		if xx {
+			return nil
+		}
+		c.server.data[args[1]] = &fakeRedisEntry{kind: fakeKindJSON, doc: value}
+		c.server.touch(args[1])
+		return fakeStatus("OK")
+	}
+	refs := fakeJSONMatch(entry, segments)
+	if len(refs) == 0 && len(segments) > 0 && !segments[len(segments)-1].isIndex && !segments[len(segments)-1].wildcard {
+		// 最后一段为不存在的对象字段时在父对象上创建
+		if xx {
+			return nil
+		}
+		last := segments[len(segments)-1]
+		for _, parent := range fakeJSONMatch(entry, segments[:len(segments)-1]) {
+			if object, ok := parent.value.(map[string]interface{}); ok {
+				object[last.name] = value
+				refs = append(refs, fakeJSONRef{})
+			}
+		}
+		if len(refs) == 0 {
+			return nil
+		}
+	} else {
+		if len(refs) == 0 || nx {
+			return nil
+		}
+		for i, ref := range refs {
+			if i > 0 {
+				value, _ = decodeFakeJSON(args[3])
+			}
+			ref.set(value)
+		}
+	}
+	c.server.touch(args[1])
+	return fakeStatus("OK")
+}
+
+func fakeJSONGet(c *fakeRedisConn, args []string) interface{} {
+	path := "$"
+	if len(args) > 2 {
+		path = args[2]
+	}
+	entry, segments, err := fakeJSONLookup(c, args[1], path)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+	return fakeJSONMatches(entry, segments)
+}
+
+func fakeJSONMatches(entry *fakeRedisEntry, segments []fakeJSONSegment) string {
+	refs := fakeJSONMatch(entry, segments)
+	values := make([]interface{}, len(refs))
+	for i, ref := range refs {
+		values[i] = ref.value
+	}
+	return encodeFakeJSON(&values)
+}
+
+func fakeJSONMGet(c *fakeRedisConn, args []string) interface{} {
+	segments, err := parseFakeJSONPath(args[len(args)-1])
+	if err != nil {
+		return err
+	}
+	results := make([]interface{}, 0, len(args)-2)
+	for _, key := range args[1 : len(args)-1] {
+		entry := c.server.lookup(key)
+		if entry == nil || entry.kind != fakeKindJSON {
+			results = append(results, nil)
+			continue
+		}
+		results = append(results, fakeJSONMatches(entry, segments))
+	}
+	return results
+}
+
+func fakeJSONDel(c *fakeRedisConn, args []string) interface{} {
+	path := "$"
+	if len(args) > 2 {
+		path = args[2]
+	}
+	entry, segments, err := fakeJSONLookup(c, args[1], path)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	if len(segments) == 0 {
+		c.server.remove(args[1])
+		return int64(1)
+	}
+	refs := fakeJSONMatch(entry, segments)
+	for _, ref := range refs {
+		ref.delete()
+	}
+	compactFakeJSON(entry.doc)
+	if len(refs) > 0 {
+		c.server.touch(args[1])
+	}
+	return int64(len(refs))
+}
+
+func fakeJSONNumIncrBy(c *fakeRedisConn, args []string) interface{} {
+	entry, segments, err := fakeJSONLookup(c, args[1], args[2])
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return errors.New("ERR could not perform this operation on a key that doesn't exist")
+	}
+	delta := json.Number(args[3])
+	deltaFloat, err := delta.Float64()
+	if err != nil {
+		return errFakeNotFloat
+	}
+	refs := fakeJSONMatch(entry, segments)
+	results := make([]interface{}, len(refs))
+	for i, ref := range refs {
+		number, ok := ref.value.(json.Number)
+		if !ok {
+			results[i] = nil
+			continue
+		}
+		current, _ := number.Float64()
+		next := current + deltaFloat
+		var updated json.Number
+		_, intErr := number.Int64()
+		_, deltaIntErr := delta.Int64()
+		if intErr == nil && deltaIntErr == nil && math.Abs(next) < 1<<53 {
+			updated = json.Number(strconv.FormatInt(int64(next), 10))
+		} else {
+			updated = json.Number(strconv.FormatFloat(next, 'f', -1, 64))
+		}
+		ref.set(updated)
+		results[i] = updated
+	}
+	c.server.touch(args[1])
+	return encodeFakeJSON(&results)
+}
+
+func fakeJSONArrAppend(c *fakeRedisConn, args []string) interface{} {
+	entry, segments, err := fakeJSONLookup(c, args[1], args[2])
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return errors.New("ERR could not perform this operation on a key that doesn't exist")
+	}
+	values := make([]interface{}, 0, len(args)-3)
+	for _, arg := range args[3:] {
+		value, err := decodeFakeJSON(arg)
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+	refs := fakeJSONMatch(entry, segments)
+	results := make([]interface{}, len(refs))
+	for i, ref := range refs {
+		array, ok := ref.value.(*[]interface{})
+		if !ok {
+			results[i] = nil
+			continue
+		}
+		*array = append(*array, values...)
+		results[i] = int64(len(*array))
+	}
+	c.server.touch(args[1])
+	return results
+}
+
+func fakeJSONObjKeys(c *fakeRedisConn, args []string) interface{} {
+	path := "$"
+	if len(args) > 2 {
+		path = args[2]
+	}
+	entry, segments, err := fakeJSONLookup(c, args[1], path)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+	refs := fakeJSONMatch(entry, segments)
+	results := make([]interface{}, len(refs))
+	for i, ref := range refs {
+		object, ok := ref.value.(map[string]interface{})
+		if !ok {
+			results[i] = nil
+			continue
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		results[i] = names
+	}
+	return results
+}
@@ -0,0 +1,215 @@
+package redistest
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fakeBlock 阻塞命令暂时无法完成, 由 serve 等待数据变化后重新执行, timeout 为 0 时一直等待
+type fakeBlock struct {
+	timeout time.Duration
+}
+
+// fakeBlockPollInterval 阻塞命令重新检查数据的间隔
+const fakeBlockPollInterval = 2 * time.Millisecond
+
+func fakeLRem(c *fakeRedisConn, args []string) interface{} {
+	count, err := strconv.Atoi(args[2])
+	if err != nil {
+		return errFakeNotInt
+	}
+	entry, err := c.server.lookupKind(args[1], fakeKindList)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	removed := make(map[int]bool)
+	for i := range entry.list {
+		index := i
+		if count < 0 {
+			index = len(entry.list) - 1 - i
+		}
+		if entry.list[index] == args[3] {
+			removed[index] = true
+			if limit > 0 && len(removed) == limit {
+				break
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return int64(0)
+	}
+	kept := make([]string, 0, len(entry.list)-len(removed))
+	for i, value := range entry.list {
+		if !removed[i] {
+			kept = append(kept, value)
+		}
+	}
+	entry.list = kept
+	c.server.touch(args[1])
+	c.server.removeIfEmpty(args[1], entry)
+	return int64(len(removed))
+}
+
+func fakeLInsert(c *fakeRedisConn, args []string) interface{} {
+	where := strings.ToUpper(args[2])
+	if where != "BEFORE" && where != "AFTER" {
+		return errFakeSyntax
+	}
+	entry, err := c.server.lookupKind(args[1], fakeKindList)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	for i, value := range entry.list {
+		if value != args[3] {
+			continue
+		}
+		if where == "AFTER" {
+			i++
+		}
+		entry.list = append(entry.list[:i], append([]string{args[4]}, entry.list[i:]...)...)
+		c.server.touch(args[1])
+		return int64(len(entry.list))
+	}
+	return int64(-1)
+}
+
+func fakeLPos(c *fakeRedisConn, args []string) interface{} {
+	rank, count, maxLen, withCount := 1, 1, 0, false
+	for i := 3; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return errFakeSyntax
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return errFakeNotInt
+		}
+		switch strings.ToUpper(args[i]) {
+		case "RANK":
+			if n == 0 {
+				return errors.New("ERR RANK can't be zero")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return errors.New("ERR COUNT can't be negative")
+			}
+			count, withCount = n, true
+		case "MAXLEN":
+			if n < 0 {
+				return errors.New("ERR MAXLEN can't be negative")
+			}
+			maxLen = n
+		default:
+			return errFakeSyntax
+		}
+	}
+	entry, err := c.server.lookupKind(args[1], fakeKindList)
+	if err != nil {
+		return err
+	}
+	var list []string
+	if entry != nil {
+		list = entry.list
+	}
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
+	}
+	var matches []interface{}
+	for i := range list {
+		if maxLen > 0 && i >= maxLen {
+			break
+		}
+		index := i
+		if rank < 0 {
+			index = len(list) - 1 - i
+		}
+		if list[index] != args[2] {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		matches = append(matches, int64(index))
+		if count > 0 && len(matches) == count {
+			break
+		}
+	}
+	if withCount {
+		if matches == nil {
+			return []interface{}{}
+		}
+		return matches
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches[0]
+}
+
+// fakeBPop BLPOP/BRPOP, 所有列表均为空时返回 fakeBlock, 在 MULTI 中与 Redis 一致直接按超时处理
+func fakeBPop(c *fakeRedisConn, args []string) interface{} {
+	seconds, err := strconv.ParseFloat(args[len(args)-1], 64)
+	if err != nil || seconds < 0 {
+		return errors.New("ERR timeout is not a float or out of range")
+	}
+	pop := "LPOP"
+	if strings.ToUpper(args[0]) == "BRPOP" {
+		pop = "RPOP"
+	}
+	for _, key := range args[1 : len(args)-1] {
+		entry, err := c.server.lookupKind(key, fakeKindList)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+		return []string{key, fakePop(c, []string{pop, key}).(string)}
+	}
+	return fakeBlock{timeout: time.Duration(seconds * float64(time.Second))}
+}
+
+// block 等待阻塞命令完成: 定期在服务端锁内重新执行, 超时返回空数组, 客户端断开时不再执行 (与 Redis 一致, 不会弹出元素)
+// 等待借助读超时实现, 同时可以发现客户端已断开连接
+func (c *fakeRedisConn) block(conn net.Conn, peek func() error, args []string, timeout time.Duration) interface{} {
+	spec := fakeCommands[strings.ToUpper(args[0])]
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return fakeNilArray{}
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(fakeBlockPollInterval))
+		err := peek()
+		_ = conn.SetReadDeadline(time.Time{})
+		var netErr net.Error
+		if err == nil {
+			time.Sleep(fakeBlockPollInterval)
+		} else if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return fakeDropConnection{}
+		}
+		c.server.mu.Lock()
+		reply := spec.fn(c, args)
+		c.server.mu.Unlock()
+		if _, blocked := reply.(fakeBlock); !blocked {
+			return reply
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package redistest
+
+import (
+	"sort"
+	"strings"
+)
+
+// fakeNotifyAllClasses notify-keyspace-events 中 A 代表的事件类型
+const fakeNotifyAllClasses = "g$lshzxet"
+
+// notify 按 notify-keyspace-events 配置发送 keyspace/keyevent 通知, class 为事件所属的类型字符
+func (s *Server) notify(class byte, event, key string) {
+	flags := s.config["notify-keyspace-events"]
+	if !strings.ContainsRune(flags, rune(class)) &&
+		!(strings.ContainsRune(flags, 'A') && strings.IndexByte(fakeNotifyAllClasses, class) >= 0) {
+		return
+	}
+	if strings.ContainsRune(flags, 'E') {
+		s.publish("__keyevent@0__:"+event, key)
+	}
+	if strings.ContainsRune(flags, 'K') {
+		s.publish("__keyspace@0__:"+key, event)
+	}
+}
+
+func (s *Server) publish(channel, message string) int64 {
+	var n int64
+	for c := range s.subscribers {
+		if _, ok := c.channels[channel]; ok {
+			c.push([]string{"message", channel, message})
+			n++
+		}
+		for pattern := range c.patterns {
+			if matchRedisPattern(pattern, channel) {
+				c.push([]string{"pmessage", pattern, channel, message})
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func fakeConfig(c *fakeRedisConn, args []string) interface{} {
+	switch strings.ToUpper(args[1]) {
+	case "GET":
+		var names []string
+		for name := range c.server.config {
+			if matchRedisPattern(strings.ToLower(args[2]), name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		reply := make([]string, 0, len(names)*2)
+		for _, name := range names {
+			reply = append(reply, name, c.server.config[name])
+		}
+		return reply
+	case "SET":
+		if len(args)%2 != 0 {
+			return errFakeArgs("config|set")
+		}
+		for i := 2; i < len(args); i += 2 {
+			c.server.config[strings.ToLower(args[i])] = args[i+1]
+		}
+		return fakeStatus("OK")
+	}
+	return fakeStatus("OK")
+}
+
+func fakePublish(c *fakeRedisConn, args []string) interface{} {
+	return c.server.publish(args[1], args[2])
+}
+
+func (c *fakeRedisConn) subscriptions() int64 {
+	return int64(len(c.channels) + len(c.patterns))
+}
+
+func fakeSubscribe(c *fakeRedisConn, args []string) interface{} {
+	kind, targets := "subscribe", &c.channels
+	if strings.ToUpper(args[0]) == "PSUBSCRIBE" {
+		kind, targets = "psubscribe", &c.patterns
+	}
+	if *targets == nil {
+		*targets = make(map[string]struct{})
+	}
+	replies := make(fakeMultiReply, 0, len(args)-1)
+	for _, name := range args[1:] {
+		(*targets)[name] = struct{}{}
+		replies = append(replies, []interface{}{kind, name, c.subscriptions()})
+	}
+	c.server.subscribers[c] = struct{}{}
+	return replies
+}
+
+func fakeUnsubscribe(c *fakeRedisConn, args []string) interface{} {
+	kind, targets := "unsubscribe", c.channels
+	if strings.ToUpper(args[0]) == "PUNSUBSCRIBE" {
+		kind, targets = "punsubscribe", c.patterns
+	}
+	names := args[1:]
+	if len(names) == 0 {
+		for name := range targets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		return []interface{}{kind, nil, c.subscriptions()}
+	}
+	replies := make(fakeMultiReply, 0, len(names))
+	for _, name := range names {
+		delete(targets, name)
+		replies = append(replies, []interface{}{kind, name, c.subscriptions()})
+	}
+	if c.subscriptions() == 0 {
+		delete(c.server.subscribers, c)
+	}
+	return replies
+}
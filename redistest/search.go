@@ -0,0 +1,826 @@
+package redistest
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// RediSearch 字段类型
+const (
+	searchFieldText    = "TEXT"
+	searchFieldTag     = "TAG"
+	searchFieldNumeric = "NUMERIC"
+	searchFieldGeo     = "GEO"
+)
+
+var (
+	errFakeUnknownIndex = errors.New("Unknown Index name")
+	errFakeIndexExists  = errors.New("Index already exists")
+)
+
+type fakeSearchField struct {
+	name      string
+	kind      string
+	separator string
+	weight    float64
+	sortable  bool
+	noIndex   bool
+}
+
+type fakeSearchIndex struct {
+	name     string
+	prefixes []string
+	fields   []fakeSearchField
+}
+
+func (idx *fakeSearchIndex) field(name string) (fakeSearchField, bool) {
+	for _, field := range idx.fields {
+		if field.name == name {
+			return field, true
+		}
+	}
+	return fakeSearchField{}, false
+}
+
+// searchDocuments 按 key 排序返回索引覆盖的全部哈希, Server 不维护倒排索引, 每次查询时扫描
+func (s *Server) searchDocuments(idx *fakeSearchIndex) ([]string, []map[string]string) {
+	var ids []string
+	var docs []map[string]string
+	for _, key := range s.keys("*") {
+		entry := s.data[key]
+		if entry.kind != fakeKindHash {
+			continue
+		}
+		matched := len(idx.prefixes) == 0
+		for _, prefix := range idx.prefixes {
+			if strings.HasPrefix(key, prefix) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			ids = append(ids, key)
+			docs = append(docs, entry.hash)
+		}
+	}
+	return ids, docs
+}
+
+func fakeFTCreate(c *fakeRedisConn, args []string) interface{} {
+	name := args[1]
+	if _, exists := c.server.indexes[name]; exists {
+		return errFakeIndexExists
+	}
+	idx := &fakeSearchIndex{name: name}
+	i := 2
+	for ; i < len(args) && !strings.EqualFold(args[i], "SCHEMA"); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "ON":
+			if i+1 >= len(args) || !strings.EqualFold(args[i+1], "HASH") {
+				return errors.New("ERR FakeRedis only supports ON HASH")
+			}
+			i++
+		case "PREFIX", "STOPWORDS":
+			if i+1 >= len(args) {
+				return errFakeSyntax
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 0 || i+1+n >= len(args) {
+				return errFakeSyntax
+			}
+			if strings.EqualFold(args[i], "PREFIX") {
+				idx.prefixes = append([]string(nil), args[i+2:i+2+n]...)
+			}
+			i += 1 + n
+		case "FILTER", "LANGUAGE", "LANGUAGE_FIELD", "SCORE", "SCORE_FIELD", "PAYLOAD_FIELD":
+			i++
+		}
+	}
+	if i >= len(args) {
+		return errFakeSyntax
+	}
+	for i++; i < len(args); {
+		if i+1 >= len(args) {
+			return errFakeSyntax
+		}
+		field := fakeSearchField{name: args[i], kind: strings.ToUpper(args[i+1]), separator: ",", weight: 1}
+		switch field.kind {
+		case searchFieldText, searchFieldTag, searchFieldNumeric, searchFieldGeo:
+		default:
+			return errors.New("ERR Invalid field type for field `" + field.name + "`")
+		}
+		for i += 2; i < len(args); i++ {
+			option := strings.ToUpper(args[i])
+			if option == "SORTABLE" {
+				field.sortable = true
+			} else if option == "NOINDEX" {
+				field.noIndex = true
+			} else if option == "NOSTEM" || option == "CASESENSITIVE" || option == "UNF" {
+			} else if (option == "WEIGHT" || option == "SEPARATOR") && i+1 < len(args) {
+				if option == "WEIGHT" {
+					weight, err := strconv.ParseFloat(args[i+1], 64)
+					if err != nil {
+						return errFakeSyntax
+					}
+					field.weight = weight
+				} else {
+					field.separator = args[i+1]
+				}
+				i++
+			} else {
+				break
+			}
+		}
+		idx.fields = append(idx.fields, field)
+	}
+	if len(idx.fields) == 0 {
+		return errFakeSyntax
+	}
+	c.server.indexes[name] = idx
+	return fakeStatus("OK")
+}
+
+func fakeFTDropIndex(c *fakeRedisConn, args []string) interface{} {
+	idx, ok := c.server.indexes[args[1]]
+	if !ok {
+		return errFakeUnknownIndex
+	}
+	if len(args) > 2 {
+		if !strings.EqualFold(args[2], "DD") {
+			return errFakeSyntax
+		}
+		ids, _ := c.server.searchDocuments(idx)
+		for _, id := range ids {
+			c.server.remove(id)
+		}
+	}
+	delete(c.server.indexes, args[1])
+	return fakeStatus("OK")
+}
+
+func fakeFTInfo(c *fakeRedisConn, args []string) interface{} {
+	idx, ok := c.server.indexes[args[1]]
+	if !ok {
+		return errFakeUnknownIndex
+	}
+	prefixes := make([]interface{}, len(idx.prefixes))
+	for i, prefix := range idx.prefixes {
+		prefixes[i] = prefix
+	}
+	attributes := make([]interface{}, 0, len(idx.fields))
+	for _, field := range idx.fields {
+		attribute := []interface{}{"identifier", field.name, "attribute", field.name, "type", field.kind}
+		switch field.kind {
+		case searchFieldText:
+			attribute = append(attribute, "WEIGHT", strconv.FormatFloat(field.weight, 'f', -1, 64))
+		case searchFieldTag:
+			attribute = append(attribute, "SEPARATOR", field.separator)
+		}
+		if field.sortable {
+			attribute = append(attribute, "SORTABLE")
+		}
+		if field.noIndex {
+			attribute = append(attribute, "NOINDEX")
+		}
+		attributes = append(attributes, attribute)
+	}
+	ids, _ := c.server.searchDocuments(idx)
+	return []interface{}{
+		"index_name", idx.name,
+		"index_definition", []interface{}{"key_type", "HASH", "prefixes", prefixes},
+		"attributes", attributes,
+		"num_docs", strconv.Itoa(len(ids)),
+	}
+}
+
+// fakeFTSearch 支持 RETURN, SORTBY, LIMIT, NOCONTENT 与 VERBATIM, 没有相关度打分, 未指定 SORTBY 时按 key 排序
+func fakeFTSearch(c *fakeRedisConn, args []string) interface{} {
+	idx, ok := c.server.indexes[args[1]]
+	if !ok {
+		return errFakeUnknownIndex
+	}
+	match, err := parseFakeSearchQuery(idx, args[2])
+	if err != nil {
+		return err
+	}
+	var returned []string
+	var sortBy string
+	var sortDesc, noContent bool
+	offset, num := 0, 10
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NOCONTENT":
+			noContent = true
+		case "VERBATIM", "NOSTOPWORDS", "WITHSCORES":
+		case "RETURN":
+			if i+1 >= len(args) {
+				return errFakeSyntax
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 0 || i+1+n >= len(args) {
+				return errFakeSyntax
+			}
+			returned = args[i+2 : i+2+n]
+			i += 1 + n
+		case "SORTBY":
+			if i+1 >= len(args) {
+				return errFakeSyntax
+			}
+			sortBy = args[i+1]
+			i++
+			if i+1 < len(args) && (strings.EqualFold(args[i+1], "ASC") || strings.EqualFold(args[i+1], "DESC")) {
+				sortDesc = strings.EqualFold(args[i+1], "DESC")
+				i++
+			}
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return errFakeSyntax
+			}
+			var err1, err2 error
+			offset, err1 = strconv.Atoi(args[i+1])
+			num, err2 = strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil || offset < 0 || num < 0 {
+				return errFakeSyntax
+			}
+			i += 2
+		default:
+			return errFakeSyntax
+		}
+	}
+	if sortBy != "" {
+		if field, ok := idx.field(sortBy); !ok || !field.sortable {
+			return errors.New("Property `" + sortBy + "` not loaded nor in schema")
+		}
+	}
+	ids, docs := c.server.searchDocuments(idx)
+	var hits []int
+	for i, doc := range docs {
+		if match(doc) {
+			hits = append(hits, i)
+		}
+	}
+	if sortBy != "" {
+		sort.SliceStable(hits, func(a, b int) bool {
+			cmp := compareFakeSearchValues(docs[hits[a]][sortBy], docs[hits[b]][sortBy])
+			if sortDesc {
+				return cmp > 0
+			}
+			return cmp < 0
+		})
+	}
+	reply := []interface{}{int64(len(hits))}
+	for n, i := range hits {
+		if n < offset {
+			continue
+		}
+		if n >= offset+num {
+			break
+		}
+		reply = append(reply, ids[i])
+		if noContent {
+			continue
+		}
+		fields := []interface{}{}
+		if returned != nil {
+			for _, name := range returned {
+				if value, ok := docs[i][name]; ok {
+					fields = append(fields, name, value)
+				}
+			}
+		} else {
+			names := make([]string, 0, len(docs[i]))
+			for name := range docs[i] {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fields = append(fields, name, docs[i][name])
+			}
+		}
+		reply = append(reply, fields)
+	}
+	return reply
+}
+
+// fakeFTAggregate 支持 LOAD, GROUPBY + REDUCE (COUNT, COUNT_DISTINCT, SUM, AVG, MIN, MAX), SORTBY 与 LIMIT,
+// 不支持 APPLY 与 FILTER 表达式; 每行初始包含文档的全部字段
+func fakeFTAggregate(c *fakeRedisConn, args []string) interface{} {
+	idx, ok := c.server.indexes[args[1]]
+	if !ok {
+		return errFakeUnknownIndex
+	}
+	match, err := parseFakeSearchQuery(idx, args[2])
+	if err != nil {
+		return err
+	}
+	_, docs := c.server.searchDocuments(idx)
+	var rows []map[string]string
+	for _, doc := range docs {
+		if match(doc) {
+			row := make(map[string]string, len(doc))
+			for name, value := range doc {
+				row[name] = value
+			}
+			rows = append(rows, row)
+		}
+	}
+	count := func(i int) (int, error) {
+		if i >= len(args) {
+			return 0, errFakeSyntax
+		}
+		n, err := strconv.Atoi(args[i])
+		if err != nil || n < 0 || i+n >= len(args) {
+			return 0, errFakeSyntax
+		}
+		return n, nil
+	}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "LOAD":
+			n, err := count(i + 1)
+			if err != nil {
+				return err
+			}
+			i += 1 + n
+		case "GROUPBY":
+			n, err := count(i + 1)
+			if err != nil {
+				return err
+			}
+			groupBy := make([]string, n)
+			for j := range groupBy {
+				groupBy[j] = strings.TrimPrefix(args[i+2+j], "@")
+			}
+			i += 1 + n
+			var reducers []fakeSearchReducer
+			for i+1 < len(args) && strings.EqualFold(args[i+1], "REDUCE") {
+				if i+3 >= len(args) {
+					return errFakeSyntax
+				}
+				reducer := fakeSearchReducer{function: strings.ToUpper(args[i+2])}
+				n, err := count(i + 3)
+				if err != nil {
+					return err
+				}
+				for _, arg := range args[i+4 : i+4+n] {
+					reducer.args = append(reducer.args, strings.TrimPrefix(arg, "@"))
+				}
+				i += 3 + n
+				reducer.as = "__generated_alias" + strings.ToLower(reducer.function) + strings.Join(reducer.args, ",")
+				if i+2 < len(args) && strings.EqualFold(args[i+1], "AS") {
+					reducer.as = args[i+2]
+					i += 2
+				}
+				reducers = append(reducers, reducer)
+			}
+			if rows, err = groupFakeSearchRows(rows, groupBy, reducers); err != nil {
+				return err
+			}
+		case "SORTBY":
+			n, err := count(i + 1)
+			if err != nil {
+				return err
+			}
+			var keys []string
+			var desc []bool
+			for _, arg := range args[i+2 : i+2+n] {
+				switch strings.ToUpper(arg) {
+				case "ASC":
+				case "DESC":
+					if len(desc) > 0 {
+						desc[len(desc)-1] = true
+					}
+				default:
+					keys = append(keys, strings.TrimPrefix(arg, "@"))
+					desc = append(desc, false)
+				}
+			}
+			i += 1 + n
+			if i+2 < len(args) && strings.EqualFold(args[i+1], "MAX") {
+				i += 2
+			}
+			sort.SliceStable(rows, func(a, b int) bool {
+				for k, key := range keys {
+					if cmp := compareFakeSearchValues(rows[a][key], rows[b][key]); cmp != 0 {
+						return (cmp < 0) != desc[k]
+					}
+				}
+				return false
+			})
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return errFakeSyntax
+			}
+			offset, err1 := strconv.Atoi(args[i+1])
+			num, err2 := strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil || offset < 0 || num < 0 {
+				return errFakeSyntax
+			}
+			i += 2
+			if offset > len(rows) {
+				offset = len(rows)
+			}
+			if offset+num < len(rows) {
+				rows = rows[offset : offset+num]
+			} else {
+				rows = rows[offset:]
+			}
+		default:
+			return errors.New("ERR FakeRedis does not support FT.AGGREGATE step " + args[i])
+		}
+	}
+	reply := []interface{}{int64(len(rows))}
+	for _, row := range rows {
+		names := make([]string, 0, len(row))
+		for name := range row {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fields := make([]interface{}, 0, len(row)*2)
+		for _, name := range names {
+			fields = append(fields, name, row[name])
+		}
+		reply = append(reply, fields)
+	}
+	return reply
+}
+
+type fakeSearchReducer struct {
+	function string
+	args     []string
+	as       string
+}
+
+func groupFakeSearchRows(rows []map[string]string, groupBy []string, reducers []fakeSearchReducer) ([]map[string]string, error) {
+	var order []string
+	groups := make(map[string][]map[string]string)
+	for _, row := range rows {
+		parts := make([]string, len(groupBy))
+		for i, name := range groupBy {
+			parts[i] = row[name]
+		}
+		group := strings.Join(parts, "\x00")
+		if _, ok := groups[group]; !ok {
+			order = append(order, group)
+		}
+		groups[group] = append(groups[group], row)
+	}
+	result := make([]map[string]string, 0, len(order))
+	for _, group := range order {
+		members := groups[group]
+		out := make(map[string]string, len(groupBy)+len(reducers))
+		for _, name := range groupBy {
+			out[name] = members[0][name]
+		}
+		for _, reducer := range reducers {
+			value, err := reduceFakeSearchRows(members, reducer)
+			if err != nil {
+				return nil, err
+			}
+			out[reducer.as] = value
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
+
+func reduceFakeSearchRows(rows []map[string]string, reducer fakeSearchReducer) (string, error) {
+	if reducer.function == "COUNT" {
+		return strconv.Itoa(len(rows)), nil
+	}
+	if len(reducer.args) != 1 {
+		return "", errors.New("ERR Bad arguments for " + reducer.function)
+	}
+	field := reducer.args[0]
+	if reducer.function == "COUNT_DISTINCT" {
+		seen := make(map[string]struct{})
+		for _, row := range rows {
+			if value, ok := row[field]; ok {
+				seen[value] = struct{}{}
+			}
+		}
+		return strconv.Itoa(len(seen)), nil
+	}
+	var sum float64
+	min, max := math.Inf(1), math.Inf(-1)
+	n := 0
+	for _, row := range rows {
+		value, err := strconv.ParseFloat(row[field], 64)
+		if err != nil {
+			continue
+		}
+		sum += value
+		min = math.Min(min, value)
+		max = math.Max(max, value)
+		n++
+	}
+	var result float64
+	switch reducer.function {
+	case "SUM":
+		result = sum
+	case "AVG":
+		if n > 0 {
+			result = sum / float64(n)
+		}
+	case "MIN":
+		result = min
+	case "MAX":
+		result = max
+	default:
+		return "", errors.New("ERR FakeRedis does not support reducer " + reducer.function)
+	}
+	return formatFakeFloat(result), nil
+}
+
+// compareFakeSearchValues 两个值都是数字时按数值比较, 否则按字符串比较
+func compareFakeSearchValues(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+type fakeSearchMatcher func(doc map[string]string) bool
+
+// parseFakeSearchQuery 支持的查询语法: *, 词, (词 词), @text:(词 词), @tag:{a | b}, @num:[min max], @geo:[lon lat radius unit] 与 -(子查询),
+// 多个条件之间为 AND; 文本匹配不区分大小写, 不做词干提取与停用词过滤
+func parseFakeSearchQuery(idx *fakeSearchIndex, query string) (fakeSearchMatcher, error) {
+	var clauses []fakeSearchMatcher
+	rest := strings.TrimSpace(query)
+	if rest == "*" {
+		rest = ""
+	}
+	for rest != "" {
+		var clause fakeSearchMatcher
+		var err error
+		switch {
+		case strings.HasPrefix(rest, "-("):
+			end := fakeSearchClose(rest, 1, '(', ')')
+			if end < 0 {
+				return nil, errFakeSyntax
+			}
+			inner, err := parseFakeSearchQuery(idx, rest[2:end])
+			if err != nil {
+				return nil, err
+			}
+			clause = func(doc map[string]string) bool { return !inner(doc) }
+			rest = rest[end+1:]
+		case rest[0] == '(':
+			end := fakeSearchClose(rest, 0, '(', ')')
+			if end < 0 {
+				return nil, errFakeSyntax
+			}
+			clause = fakeSearchText(idx, "", rest[1:end])
+			rest = rest[end+1:]
+		case rest[0] == '@':
+			colon := strings.IndexByte(rest, ':')
+			if colon < 0 {
+				return nil, errFakeSyntax
+			}
+			name := rest[1:colon]
+			field, ok := idx.field(name)
+			if !ok {
+				return nil, errors.New("Unknown field `" + name + "`")
+			}
+			rest = rest[colon+1:]
+			clause, rest, err = parseFakeSearchField(idx, field, rest)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			clause = fakeSearchText(idx, "", rest[:end])
+			rest = rest[end:]
+		}
+		clauses = append(clauses, clause)
+		rest = strings.TrimSpace(rest)
+	}
+	return func(doc map[string]string) bool {
+		for _, clause := range clauses {
+			if !clause(doc) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func parseFakeSearchField(idx *fakeSearchIndex, field fakeSearchField, rest string) (fakeSearchMatcher, string, error) {
+	if rest == "" {
+		return nil, "", errFakeSyntax
+	}
+	if field.noIndex {
+		return func(map[string]string) bool { return false }, fakeSearchSkip(rest), nil
+	}
+	switch {
+	case rest[0] == '(' && field.kind == searchFieldText:
+		end := fakeSearchClose(rest, 0, '(', ')')
+		if end < 0 {
+			return nil, "", errFakeSyntax
+		}
+		return fakeSearchText(idx, field.name, rest[1:end]), rest[end+1:], nil
+	case rest[0] == '{' && field.kind == searchFieldTag:
+		end := fakeSearchClose(rest, 0, '{', '}')
+		if end < 0 {
+			return nil, "", errFakeSyntax
+		}
+		wanted := make(map[string]struct{})
+		for _, value := range fakeSearchSplitTags(rest[1:end]) {
+			wanted[strings.ToLower(value)] = struct{}{}
+		}
+		return func(doc map[string]string) bool {
+			for _, value := range strings.Split(doc[field.name], field.separator) {
+				if _, ok := wanted[strings.ToLower(strings.TrimSpace(value))]; ok {
+					return true
+				}
+			}
+			return false
+		}, rest[end+1:], nil
+	case rest[0] == '[' && (field.kind == searchFieldNumeric || field.kind == searchFieldGeo):
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return nil, "", errFakeSyntax
+		}
+		parts := strings.Fields(rest[1:end])
+		if field.kind == searchFieldNumeric {
+			matcher, err := fakeSearchNumeric(field.name, parts)
+			return matcher, rest[end+1:], err
+		}
+		matcher, err := fakeSearchGeo(field.name, parts)
+		return matcher, rest[end+1:], err
+	case field.kind == searchFieldText:
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		return fakeSearchText(idx, field.name, rest[:end]), rest[end:], nil
+	}
+	return nil, "", errFakeSyntax
+}
+
+func fakeSearchNumeric(name string, parts []string) (fakeSearchMatcher, error) {
+	if len(parts) != 2 {
+		return nil, errFakeSyntax
+	}
+	parse := func(s string) (float64, bool, error) {
+		exclusive := strings.HasPrefix(s, "(")
+		s = strings.TrimPrefix(s, "(")
+		switch strings.ToLower(s) {
+		case "inf", "+inf":
+			return math.Inf(1), exclusive, nil
+		case "-inf":
+			return math.Inf(-1), exclusive, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, false, errFakeSyntax
+		}
+		return f, exclusive, nil
+	}
+	min, minExclusive, err := parse(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	max, maxExclusive, err := parse(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return func(doc map[string]string) bool {
+		value, err := strconv.ParseFloat(doc[name], 64)
+		if err != nil {
+			return false
+		}
+		return (value > min || (!minExclusive && value == min)) && (value < max || (!maxExclusive && value == max))
+	}, nil
+}
+
+// fakeSearchGeo 文档中的 GEO 字段格式为 "经度,纬度"
+func fakeSearchGeo(name string, parts []string) (fakeSearchMatcher, error) {
+	if len(parts) != 4 {
+		return nil, errFakeSyntax
+	}
+	var numbers [3]float64
+	for i := range numbers {
+		f, err := strconv.ParseFloat(parts[i], 64)
+		if err != nil {
+			return nil, errFakeSyntax
+		}
+		numbers[i] = f
+	}
+	unit, err := fakeGeoUnit(parts[3])
+	if err != nil {
+		return nil, err
+	}
+	lon, lat, radius := numbers[0], numbers[1], numbers[2]*unit
+	return func(doc map[string]string) bool {
+		lonText, latText, ok := strings.Cut(doc[name], ",")
+		if !ok {
+			return false
+		}
+		docLon, err1 := strconv.ParseFloat(strings.TrimSpace(lonText), 64)
+		docLat, err2 := strconv.ParseFloat(strings.TrimSpace(latText), 64)
+		return err1 == nil && err2 == nil && fakeGeoDistance(lon, lat, docLon, docLat) <= radius
+	}, nil
+}
+
+// fakeSearchText field 为空时匹配任意 TEXT 字段, 全部词都出现才算匹配
+func fakeSearchText(idx *fakeSearchIndex, field, words string) fakeSearchMatcher {
+	terms := fakeSearchTokens(words)
+	return func(doc map[string]string) bool {
+		tokens := make(map[string]struct{})
+		for _, f := range idx.fields {
+			if f.kind != searchFieldText || f.noIndex || (field != "" && f.name != field) {
+				continue
+			}
+			for _, token := range fakeSearchTokens(doc[f.name]) {
+				tokens[token] = struct{}{}
+			}
+		}
+		for _, term := range terms {
+			if _, ok := tokens[term]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func fakeSearchTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_'
+	})
+}
+
+// fakeSearchClose 返回与 s[open] 配对的未转义的 closer 下标
+func fakeSearchClose(s string, open int, opener, closer byte) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case opener:
+			depth++
+		case closer:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// fakeSearchSplitTags 按未转义的 | 拆分并去掉转义
+func fakeSearchSplitTags(s string) []string {
+	var tags []string
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case s[i] == '|':
+			tags = append(tags, strings.TrimSpace(b.String()))
+			b.Reset()
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return append(tags, strings.TrimSpace(b.String()))
+}
+
+func fakeSearchSkip(rest string) string {
+	switch rest[0] {
+	case '(':
+		if end := fakeSearchClose(rest, 0, '(', ')'); end >= 0 {
+			return rest[end+1:]
+		}
+	case '{':
+		if end := fakeSearchClose(rest, 0, '{', '}'); end >= 0 {
+			return rest[end+1:]
+		}
+	case '[':
+		if end := strings.IndexByte(rest, ']'); end >= 0 {
+			return rest[end+1:]
+		}
+	}
+	if end := strings.IndexAny(rest, " \t"); end >= 0 {
+		return rest[end:]
+	}
+	return ""
+}
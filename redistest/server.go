@@ -0,0 +1,1492 @@
+package redistest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Server 进程内的 Redis 替身, 用于不依赖真实 Redis 的单元测试
+// 是一个通过 net.Pipe 接入 go-redis 客户端的内存 RESP2 服务, 将 Dial 设为 redis.Options.Dialer 即可使用, 包括 Pipeline 与事务
+// 支持字符串, 哈希, 列表 (含 BLPOP/BRPOP 阻塞弹出), 集合, 有序集合, GEO, RedisJSON (JSONPath 仅支持 $ 开头的字段, 下标与通配符), 过期时间, 布隆过滤器 (以精确集合实现, 不会误判), MULTI/EXEC/WATCH
+// 以及 Pub/Sub 与 keyspace 通知 (expired/del/set/expire), DUMP/RESTORE (私有格式, 只能在 Server 之间迁移),
+// RediSearch 的哈希索引 (查询时扫描, 不做词干提取与相关度打分, 忽略 FILTER 表达式)
+type Server struct {
+	mu          sync.Mutex
+	data        map[string]*fakeRedisEntry
+	versions    map[string]uint64
+	offset      time.Duration
+	config      map[string]string
+	subscribers map[*fakeRedisConn]struct{}
+	conns       map[net.Conn]struct{}
+	indexes     map[string]*fakeSearchIndex
+	failures    map[string][]string
+	down        bool
+}
+
+// NewServer 创建 Server
+func NewServer() *Server {
+	return &Server{
+		data:        make(map[string]*fakeRedisEntry),
+		versions:    make(map[string]uint64),
+		config:      map[string]string{"notify-keyspace-events": ""},
+		subscribers: make(map[*fakeRedisConn]struct{}),
+		conns:       make(map[net.Conn]struct{}),
+		indexes:     make(map[string]*fakeSearchIndex),
+		failures:    make(map[string][]string),
+	}
+}
+
+// NewClient 创建连接到 s 的客户端, addr 只用于标识节点, 不会真正建立网络连接
+func (s *Server) NewClient(addr string) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:   addr,
+		Dialer: s.Dial,
+	})
+}
+
+// FastForward 将 Server 的时钟向前推进 d, 用于测试过期逻辑, 到期的 key 会立即删除并发送 expired 通知
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+	for key := range s.data {
+		s.lookup(key)
+	}
+}
+
+// DropConnections 断开全部客户端连接 (数据保留) 并等待服务端连接退出, 用于测试断线重连
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	dropped := make([]net.Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		_ = conn.Close()
+		dropped = append(dropped, conn)
+	}
+	s.mu.Unlock()
+	for _, conn := range dropped {
+		for {
+			s.mu.Lock()
+			_, alive := s.conns[conn]
+			s.mu.Unlock()
+			if !alive {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+// SetDown 模拟节点宕机与恢复: 宕机时断开全部连接且拒绝新连接, 数据保留
+func (s *Server) SetDown(down bool) {
+	s.mu.Lock()
+	s.down = down
+	s.mu.Unlock()
+	if down {
+		s.DropConnections()
+	}
+}
+
+// FailNext 让接下来的 n 次 command 命令失败, 用于测试重试: errReply 不为空时返回该错误且不执行命令 (如 "LOADING ..."),
+// 为空时正常执行命令后断开连接而不回复, 模拟请求已执行但客户端未收到回复
+func (s *Server) FailNext(command string, n int, errReply string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	command = strings.ToUpper(command)
+	for i := 0; i < n; i++ {
+		s.failures[command] = append(s.failures[command], errReply)
+	}
+}
+
+// Keys 当前未过期的全部 key, 按字典序排列
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys("*")
+}
+
+// FlushAll 清空全部数据
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+}
+
+type fakeStatus string
+
+type fakeNilArray struct{}
+
+// fakeDropConnection 不回复并断开连接, 见 FailNext
+type fakeDropConnection struct{}
+
+// fakeMultiReply 依次写出多条回复, 用于 SUBSCRIBE 等一条命令对应多条回复的场景
+type fakeMultiReply []interface{}
+
+const (
+	fakeKindString = "string"
+	fakeKindHash   = "hash"
+	fakeKindList   = "list"
+	fakeKindZSet   = "zset"
+	fakeKindBloom  = "MBbloom--"
+)
+
+var (
+	errFakeWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errFakeNotInt    = errors.New("ERR value is not an integer or out of range")
+	errFakeSyntax    = errors.New("ERR syntax error")
+)
+
+func errFakeArgs(cmd string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd))
+}
+
+type fakeRedisEntry struct {
+	kind     string
+	str      string
+	hash     map[string]string
+	list     []string
+	set      map[string]struct{}
+	zset     map[string]float64
+	doc      interface{}
+	expireAt time.Time
+}
+
+type fakeRedisConn struct {
+	server  *Server
+	multi   bool
+	dirty   bool
+	queued  [][]string
+	watched map[string]uint64
+	// push 异步写出一条回复, 用于 Pub/Sub 推送消息
+	push     func(reply interface{})
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+type fakeCommand func(c *fakeRedisConn, args []string) interface{}
+
+// fakeCommandSpec arity 与 Redis COMMAND 的定义一致: 正数为精确参数个数, 负数为最少参数个数 (均包含命令名)
+type fakeCommandSpec struct {
+	arity int
+	fn    fakeCommand
+}
+
+var fakeCommands map[string]fakeCommandSpec
+
+func init() {
+	fakeCommands = map[string]fakeCommandSpec{
+		"PING":             {-1, fakePing},
+		"COMMAND":          {-1, fakeCommandInfo},
+		"ECHO":             {2, func(c *fakeRedisConn, args []string) interface{} { return args[1] }},
+		"SELECT":           {2, fakeOK},
+		"CLIENT":           {-2, fakeOK},
+		"CONFIG":           {-3, fakeConfig},
+		"PUBLISH":          {3, fakePublish},
+		"SUBSCRIBE":        {-2, fakeSubscribe},
+		"PSUBSCRIBE":       {-2, fakeSubscribe},
+		"UNSUBSCRIBE":      {-1, fakeUnsubscribe},
+		"PUNSUBSCRIBE":     {-1, fakeUnsubscribe},
+		"INFO":             {-1, fakeInfo},
+		"DBSIZE":           {1, fakeDBSize},
+		"FLUSHALL":         {-1, fakeFlush},
+		"FLUSHDB":          {-1, fakeFlush},
+		"KEYS":             {2, fakeKeys},
+		"SCAN":             {-2, fakeScan},
+		"EXISTS":           {-2, fakeExists},
+		"DEL":              {-2, fakeDel},
+		"UNLINK":           {-2, fakeDel},
+		"TYPE":             {2, fakeType},
+		"EXPIRE":           {-3, fakeExpire},
+		"PEXPIRE":          {-3, fakeExpire},
+		"TTL":              {2, fakeTTL},
+		"PTTL":             {2, fakeTTL},
+		"PERSIST":          {2, fakePersist},
+		"DUMP":             {2, fakeDumpEntry},
+		"RESTORE":          {-4, fakeRestore},
+		"MEMORY":           {-3, fakeMemory},
+		"RENAME":           {3, fakeRename},
+		"GET":              {2, fakeGet},
+		"GETDEL":           {2, fakeGetDel},
+		"SET":              {-3, fakeSet},
+		"SETNX":            {3, fakeSetNX},
+		"MGET":             {-2, fakeMGet},
+		"MSET":             {-3, fakeMSet},
+		"STRLEN":           {2, fakeStrlen},
+		"INCR":             {2, fakeIncr},
+		"DECR":             {2, fakeIncr},
+		"INCRBY":           {3, fakeIncr},
+		"DECRBY":           {3, fakeIncr},
+		"HSET":             {-4, fakeHSet},
+		"HMSET":            {-4, fakeHSet},
+		"HSETNX":           {4, fakeHSetNX},
+		"HGET":             {3, fakeHGet},
+		"HMGET":            {-3, fakeHMGet},
+		"HDEL":             {-3, fakeHDel},
+		"HLEN":             {2, fakeHLen},
+		"HEXISTS":          {3, fakeHExists},
+		"HGETALL":          {2, fakeHGetAll},
+		"HKEYS":            {2, fakeHKeys},
+		"HVALS":            {2, fakeHVals},
+		"HINCRBY":          {4, fakeHIncrBy},
+		"LPUSH":            {-3, fakePush},
+		"RPUSH":            {-3, fakePush},
+		"LPOP":             {-2, fakePop},
+		"RPOP":             {-2, fakePop},
+		"LLEN":             {2, fakeLLen},
+		"LINDEX":           {3, fakeLIndex},
+		"LRANGE":           {4, fakeLRange},
+		"LTRIM":            {4, fakeLTrim},
+		"LREM":             {4, fakeLRem},
+		"LINSERT":          {5, fakeLInsert},
+		"LPOS":             {-3, fakeLPos},
+		"BLPOP":            {-3, fakeBPop},
+		"BRPOP":            {-3, fakeBPop},
+		"SADD":             {-3, fakeSAdd},
+		"SREM":             {-3, fakeSRem},
+		"SMEMBERS":         {2, fakeSMembers},
+		"SCARD":            {2, fakeSCard},
+		"SISMEMBER":        {3, fakeSIsMember},
+		"SMISMEMBER":       {-3, fakeSMIsMember},
+		"SRANDMEMBER":      {-2, fakeSRandMember},
+		"SPOP":             {-2, fakeSRandMember},
+		"SINTER":           {-2, fakeSetAlgebra},
+		"SUNION":           {-2, fakeSetAlgebra},
+		"SDIFF":            {-2, fakeSetAlgebra},
+		"SINTERSTORE":      {-3, fakeSetAlgebra},
+		"SUNIONSTORE":      {-3, fakeSetAlgebra},
+		"SDIFFSTORE":       {-3, fakeSetAlgebra},
+		"SSCAN":            {-3, fakeSScan},
+		"ZADD":             {-4, fakeZAdd},
+		"ZSCORE":           {3, fakeZScore},
+		"ZCARD":            {2, fakeZCard},
+		"ZREM":             {-3, fakeZRem},
+		"ZCOUNT":           {4, fakeZCount},
+		"ZREMRANGEBYSCORE": {4, fakeZRemRangeByScore},
+		"ZRANGE":           {-4, fakeZRange},
+		"GEOADD":           {-5, fakeGeoAdd},
+		"GEOPOS":           {-2, fakeGeoPos},
+		"GEODIST":          {-4, fakeGeoDist},
+		"GEOSEARCH":        {-7, fakeGeoSearch},
+		"GEOSEARCHSTORE":   {-8, fakeGeoSearch},
+		"JSON.SET":         {-4, fakeJSONSet},
+		"JSON.GET":         {-2, fakeJSONGet},
+		"JSON.MGET":        {-3, fakeJSONMGet},
+		"JSON.DEL":         {-2, fakeJSONDel},
+		"JSON.NUMINCRBY":   {4, fakeJSONNumIncrBy},
+		"JSON.ARRAPPEND":   {-4, fakeJSONArrAppend},
+		"JSON.OBJKEYS":     {-2, fakeJSONObjKeys},
+		"FT.CREATE":        {-5, fakeFTCreate},
+		"FT.DROPINDEX":     {-2, fakeFTDropIndex},
+		"FT.INFO":          {2, fakeFTInfo},
+		"FT.SEARCH":        {-3, fakeFTSearch},
+		"FT.AGGREGATE":     {-3, fakeFTAggregate},
+		"BF.RESERVE":       {-4, fakeBFReserve},
+		"BF.ADD":           {3, fakeBFAdd},
+		"BF.MADD":          {-3, fakeBFAdd},
+		"BF.EXISTS":        {3, fakeBFExists},
+		"BF.MEXISTS":       {-3, fakeBFExists},
+	}
+}
+
+// Dial 作为 redis.Options.Dialer, 每个连接由独立的 goroutine 处理
+func (s *Server) Dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	s.mu.Lock()
+	down := s.down
+	s.mu.Unlock()
+	if down {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("connection refused")}
+	}
+	client, server := net.Pipe()
+	go s.serve(server)
+	return client, nil
+}
+
+// serve 读取命令并把回复写入内存缓冲, 由单独的 goroutine 写回客户端,
+// 避免客户端在 Pipeline 中持续写入时与服务端的同步写入互相阻塞
+func (s *Server) serve(conn net.Conn) {
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+	defer conn.Close()
+	var (
+		outMu  sync.Mutex
+		outBuf bytes.Buffer
+		closed bool
+	)
+	outCond := sync.NewCond(&outMu)
+	go func() {
+		for {
+			outMu.Lock()
+			for outBuf.Len() == 0 && !closed {
+				outCond.Wait()
+			}
+			if outBuf.Len() == 0 && closed {
+				outMu.Unlock()
+				return
+			}
+			data := append([]byte(nil), outBuf.Bytes()...)
+			outBuf.Reset()
+			outMu.Unlock()
+			if _, err := conn.Write(data); err != nil {
+				_ = conn.Close()
+				return
+			}
+		}
+	}()
+	c := &fakeRedisConn{server: s}
+	c.push = func(reply interface{}) {
+		outMu.Lock()
+		writeFakeReply(&outBuf, reply)
+		outCond.Signal()
+		outMu.Unlock()
+	}
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, c)
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		outMu.Lock()
+		closed = true
+		outCond.Broadcast()
+		outMu.Unlock()
+	}()
+
+	rd := bufio.NewReader(conn)
+	for {
+		args, err := readFakeCommand(rd)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		reply := c.execute(args)
+		if block, ok := reply.(fakeBlock); ok {
+			reply = c.block(conn, func() error { _, err := rd.Peek(1); return err }, args, block.timeout)
+		}
+		if _, drop := reply.(fakeDropConnection); drop {
+			return
+		}
+		c.push(reply)
+	}
+}
+
+func (c *fakeRedisConn) execute(args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	switch name {
+	case "MULTI":
+		if c.multi {
+			return errors.New("ERR MULTI calls can not be nested")
+		}
+		c.multi = true
+		return fakeStatus("OK")
+	case "EXEC":
+		return c.exec()
+	case "DISCARD":
+		if !c.multi {
+			return errors.New("ERR DISCARD without MULTI")
+		}
+		c.reset()
+		return fakeStatus("OK")
+	case "WATCH":
+		if c.multi {
+			return errors.New("ERR WATCH inside MULTI is not allowed")
+		}
+		c.server.mu.Lock()
+		defer c.server.mu.Unlock()
+		if c.watched == nil {
+			c.watched = make(map[string]uint64)
+		}
+		for _, key := range args[1:] {
+			c.server.lookup(key)
+			c.watched[key] = c.server.versions[key]
+		}
+		return fakeStatus("OK")
+	case "UNWATCH":
+		c.watched = nil
+		return fakeStatus("OK")
+	}
+	spec, ok := fakeCommands[name]
+	if !ok {
+		if c.multi {
+			c.dirty = true
+		}
+		return fmt.Errorf("ERR unknown command '%s'", args[0])
+	}
+	if (spec.arity > 0 && len(args) != spec.arity) || (spec.arity < 0 && len(args) < -spec.arity) {
+		if c.multi {
+			c.dirty = true
+		}
+		return errFakeArgs(name)
+	}
+	if c.multi {
+		c.queued = append(c.queued, args)
+		return fakeStatus("QUEUED")
+	}
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if failures := c.server.failures[name]; len(failures) > 0 {
+		c.server.failures[name] = failures[1:]
+		if failures[0] != "" {
+			return errors.New(failures[0])
+		}
+		spec.fn(c, args)
+		return fakeDropConnection{}
+	}
+	return spec.fn(c, args)
+}
+
+func (c *fakeRedisConn) exec() interface{} {
+	if !c.multi {
+		return errors.New("ERR EXEC without MULTI")
+	}
+	defer c.reset()
+	if c.dirty {
+		return errors.New("EXECABORT Transaction discarded because of previous errors.")
+	}
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	for key, version := range c.watched {
+		c.server.lookup(key)
+		if c.server.versions[key] != version {
+			return fakeNilArray{}
+		}
+	}
+	replies := make([]interface{}, 0, len(c.queued))
+	for _, args := range c.queued {
+		reply := fakeCommands[strings.ToUpper(args[0])].fn(c, args)
+		if _, blocked := reply.(fakeBlock); blocked {
+			reply = fakeNilArray{}
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+func (c *fakeRedisConn) reset() {
+	c.multi = false
+	c.dirty = false
+	c.queued = nil
+	c.watched = nil
+}
+
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+// lookup 获取未过期的 key, 已过期的 key 会被惰性删除
+func (s *Server) lookup(key string) *fakeRedisEntry {
+	entry, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if !entry.expireAt.IsZero() && !s.now().Before(entry.expireAt) {
+		delete(s.data, key)
+		s.touch(key)
+		s.notify('x', "expired", key)
+		return nil
+	}
+	return entry
+}
+
+// lookupKind 获取指定类型的 key, 类型不符时返回 WRONGTYPE
+func (s *Server) lookupKind(key, kind string) (*fakeRedisEntry, error) {
+	entry := s.lookup(key)
+	if entry != nil && entry.kind != kind {
+		return nil, errFakeWrongType
+	}
+	return entry, nil
+}
+
+// create 获取指定类型的 key, 不存在时创建
+func (s *Server) create(key, kind string) (*fakeRedisEntry, error) {
+	entry, err := s.lookupKind(key, kind)
+	if err != nil || entry != nil {
+		return entry, err
+	}
+	entry = &fakeRedisEntry{kind: kind}
+	switch kind {
+	case fakeKindHash:
+		entry.hash = make(map[string]string)
+	case fakeKindBloom, fakeKindSet:
+		entry.set = make(map[string]struct{})
+	case fakeKindZSet:
+		entry.zset = make(map[string]float64)
+	}
+	s.data[key] = entry
+	return entry, nil
+}
+
+// touch 记录 key 被修改, 用于 WATCH
+func (s *Server) touch(key string) {
+	s.versions[key]++
+}
+
+func (s *Server) remove(key string) bool {
+	if s.lookup(key) == nil {
+		return false
+	}
+	delete(s.data, key)
+	s.touch(key)
+	return true
+}
+
+// removeIfEmpty 容器类型的 key 为空时删除, 与 Redis 行为一致
+func (s *Server) removeIfEmpty(key string, entry *fakeRedisEntry) {
+	if (entry.kind == fakeKindHash && len(entry.hash) == 0) || (entry.kind == fakeKindList && len(entry.list) == 0) ||
+		(entry.kind == fakeKindZSet && len(entry.zset) == 0) || (entry.kind == fakeKindSet && len(entry.set) == 0) {
+		delete(s.data, key)
+	}
+}
+
+func (s *Server) keys(pattern string) []string {
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		if s.lookup(key) != nil && matchRedisPattern(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) flush() {
+	for key := range s.data {
+		s.touch(key)
+	}
+	s.data = make(map[string]*fakeRedisEntry)
+}
+
+func fakeOK(c *fakeRedisConn, args []string) interface{} {
+	return fakeStatus("OK")
+}
+
+// fakeKeylessCommands 不带 key 的命令, COMMAND 中第一个 key 的位置为 0
+var fakeKeylessCommands = map[string]bool{
+	"PING": true, "COMMAND": true, "ECHO": true, "SELECT": true, "CLIENT": true, "CONFIG": true,
+	"SUBSCRIBE": true, "PSUBSCRIBE": true, "UNSUBSCRIBE": true, "PUNSUBSCRIBE": true,
+	"INFO": true, "DBSIZE": true, "FLUSHALL": true, "FLUSHDB": true, "KEYS": true, "SCAN": true, "MEMORY": true,
+	"FT.CREATE": true, "FT.DROPINDEX": true, "FT.INFO": true, "FT.SEARCH": true, "FT.AGGREGATE": true,
+}
+
+// fakeCommandInfo COMMAND 的 Redis 5 格式回复, 供分片客户端按第一个 key 路由; 其余 key 的位置不做区分
+func fakeCommandInfo(c *fakeRedisConn, args []string) interface{} {
+	infos := make([]interface{}, 0, len(fakeCommands))
+	for _, name := range sortedKeys(fakeCommands) {
+		firstKey := int64(1)
+		if fakeKeylessCommands[name] {
+			firstKey = 0
+		}
+		infos = append(infos, []interface{}{strings.ToLower(name), int64(fakeCommands[name].arity), []string{}, firstKey, firstKey, firstKey})
+	}
+	return infos
+}
+
+func fakePing(c *fakeRedisConn, args []string) interface{} {
+	// 订阅模式下 PING 的回复为数组
+	if len(c.channels)+len(c.patterns) > 0 {
+		payload := ""
+		if len(args) > 1 {
+			payload = args[1]
+		}
+		return []string{"pong", payload}
+	}
+	if len(args) > 1 {
+		return args[1]
+	}
+	return fakeStatus("PONG")
+}
+
+func fakeInfo(c *fakeRedisConn, args []string) interface{} {
+	var info strings.Builder
+	info.WriteString("# Server\r\nredis_version:7.0.0\r\nredis_mode:standalone\r\n\r\n")
+	info.WriteString("# Clients\r\nconnected_clients:1\r\n\r\n")
+	info.WriteString("# Replication\r\nrole:master\r\nconnected_slaves:0\r\n\r\n")
+	info.WriteString("# Keyspace\r\n")
+	if keys := c.server.keys("*"); len(keys) > 0 {
+		expires := 0
+		for _, key := range keys {
+			if !c.server.data[key].expireAt.IsZero() {
+				expires++
+			}
+		}
+		info.WriteString(fmt.Sprintf("db0:keys=%d,expires=%d,avg_ttl=0\r\n", len(keys), expires))
+	}
+	return info.String()
+}
+
+func fakeDBSize(c *fakeRedisConn, args []string) interface{} {
+	return int64(len(c.server.keys("*")))
+}
+
+func fakeFlush(c *fakeRedisConn, args []string) interface{} {
+	c.server.flush()
+	return fakeStatus("OK")
+}
+
+func fakeKeys(c *fakeRedisConn, args []string) interface{} {
+	return c.server.keys(args[1])
+}
+
+func fakeScan(c *fakeRedisConn, args []string) interface{} {
+	cursor, err := strconv.Atoi(args[1])
+	if err != nil || cursor < 0 {
+		return errors.New("ERR invalid cursor")
+	}
+	pattern, count, kind := "*", 10, ""
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return errFakeSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count <= 0 {
+				return errFakeSyntax
+			}
+		case "TYPE":
+			kind = args[i+1]
+		default:
+			return errFakeSyntax
+		}
+	}
+	all := c.server.keys("*")
+	end := cursor + count
+	if end > len(all) {
+		end = len(all)
+	}
+	var matched []string
+	if cursor < len(all) {
+		for _, key := range all[cursor:end] {
+			if !matchRedisPattern(pattern, key) {
+				continue
+			}
+			if kind != "" && fakeTypeName(c.server.data[key]) != kind {
+				continue
+			}
+			matched = append(matched, key)
+		}
+	}
+	next := end
+	if next >= len(all) {
+		next = 0
+	}
+	return []interface{}{strconv.Itoa(next), matched}
+}
+
+func fakeExists(c *fakeRedisConn, args []string) interface{} {
+	var n int64
+	for _, key := range args[1:] {
+		if c.server.lookup(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func fakeDel(c *fakeRedisConn, args []string) interface{} {
+	var n int64
+	for _, key := range args[1:] {
+		if c.server.remove(key) {
+			c.server.notify('g', "del", key)
+			n++
+		}
+	}
+	return n
+}
+
+func fakeTypeName(entry *fakeRedisEntry) string {
+	if entry == nil {
+		return "none"
+	}
+	return entry.kind
+}
+
+func fakeType(c *fakeRedisConn, args []string) interface{} {
+	return fakeStatus(fakeTypeName(c.server.lookup(args[1])))
+}
+
+func fakeExpire(c *fakeRedisConn, args []string) interface{} {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return errFakeNotInt
+	}
+	entry := c.server.lookup(args[1])
+	if entry == nil {
+		return int64(0)
+	}
+	unit := time.Second
+	if strings.ToUpper(args[0]) == "PEXPIRE" {
+		unit = time.Millisecond
+	}
+	if len(args) > 3 {
+		hasTTL := !entry.expireAt.IsZero()
+		switch strings.ToUpper(args[3]) {
+		case "NX":
+			if hasTTL {
+				return int64(0)
+			}
+		case "XX":
+			if !hasTTL {
+				return int64(0)
+			}
+		case "GT":
+			// 没有过期时间按无穷大处理
+			if !hasTTL || !c.server.now().Add(time.Duration(n)*unit).After(entry.expireAt) {
+				return int64(0)
+			}
+		case "LT":
+			if hasTTL && !c.server.now().Add(time.Duration(n)*unit).Before(entry.expireAt) {
+				return int64(0)
+			}
+		default:
+			return errFakeSyntax
+		}
+	}
+	entry.expireAt = c.server.now().Add(time.Duration(n) * unit)
+	c.server.touch(args[1])
+	c.server.notify('g', "expire", args[1])
+	c.server.lookup(args[1])
+	return int64(1)
+}
+
+func fakeTTL(c *fakeRedisConn, args []string) interface{} {
+	entry := c.server.lookup(args[1])
+	if entry == nil {
+		return int64(-2)
+	}
+	if entry.expireAt.IsZero() {
+		return int64(-1)
+	}
+	left := entry.expireAt.Sub(c.server.now())
+	if strings.ToUpper(args[0]) == "PTTL" {
+		return int64(left / time.Millisecond)
+	}
+	return int64((left + time.Second/2) / time.Second)
+}
+
+func fakePersist(c *fakeRedisConn, args []string) interface{} {
+	entry := c.server.lookup(args[1])
+	if entry == nil || entry.expireAt.IsZero() {
+		return int64(0)
+	}
+	entry.expireAt = time.Time{}
+	c.server.touch(args[1])
+	return int64(1)
+}
+
+func fakeRename(c *fakeRedisConn, args []string) interface{} {
+	entry := c.server.lookup(args[1])
+	if entry == nil {
+		return errors.New("ERR no such key")
+	}
+	delete(c.server.data, args[1])
+	c.server.data[args[2]] = entry
+	c.server.touch(args[1])
+	c.server.touch(args[2])
+	return fakeStatus("OK")
+}
+
+func fakeGet(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindString)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+	return entry.str
+}
+
+func fakeGetDel(c *fakeRedisConn, args []string) interface{} {
+	value := fakeGet(c, args)
+	if s, ok := value.(string); ok {
+		c.server.remove(args[1])
+		return s
+	}
+	return value
+}
+
+func fakeSet(c *fakeRedisConn, args []string) interface{} {
+	key, value := args[1], args[2]
+	var (
+		expireAt          time.Time
+		nx, xx, keep, get bool
+	)
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keep = true
+		case "GET":
+			get = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errFakeSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return errors.New("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			expireAt = c.server.now().Add(time.Duration(n) * unit)
+			i++
+		default:
+			return errFakeSyntax
+		}
+	}
+	if nx && xx {
+		return errFakeSyntax
+	}
+	old := c.server.lookup(key)
+	var prev interface{}
+	if get {
+		if old != nil && old.kind != fakeKindString {
+			return errFakeWrongType
+		}
+		if old != nil {
+			prev = old.str
+		}
+	}
+	if (nx && old != nil) || (xx && old == nil) {
+		if get {
+			return prev
+		}
+		return nil
+	}
+	entry := &fakeRedisEntry{kind: fakeKindString, str: value, expireAt: expireAt}
+	if keep && old != nil {
+		entry.expireAt = old.expireAt
+	}
+	c.server.data[key] = entry
+	c.server.touch(key)
+	c.server.notify('$', "set", key)
+	if get {
+		return prev
+	}
+	return fakeStatus("OK")
+}
+
+func fakeSetNX(c *fakeRedisConn, args []string) interface{} {
+	if c.server.lookup(args[1]) != nil {
+		return int64(0)
+	}
+	c.server.data[args[1]] = &fakeRedisEntry{kind: fakeKindString, str: args[2]}
+	c.server.touch(args[1])
+	return int64(1)
+}
+
+func fakeMGet(c *fakeRedisConn, args []string) interface{} {
+	values := make([]interface{}, 0, len(args)-1)
+	for _, key := range args[1:] {
+		entry := c.server.lookup(key)
+		if entry == nil || entry.kind != fakeKindString {
+			values = append(values, nil)
+			continue
+		}
+		values = append(values, entry.str)
+	}
+	return values
+}
+
+func fakeMSet(c *fakeRedisConn, args []string) interface{} {
+	if len(args)%2 != 1 {
+		return errFakeArgs(args[0])
+	}
+	for i := 1; i < len(args); i += 2 {
+		c.server.data[args[i]] = &fakeRedisEntry{kind: fakeKindString, str: args[i+1]}
+		c.server.touch(args[i])
+	}
+	return fakeStatus("OK")
+}
+
+func fakeStrlen(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindString)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	return int64(len(entry.str))
+}
+
+func fakeIncr(c *fakeRedisConn, args []string) interface{} {
+	delta := int64(1)
+	if len(args) > 2 {
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return errFakeNotInt
+		}
+		delta = n
+	}
+	if name := strings.ToUpper(args[0]); name == "DECR" || name == "DECRBY" {
+		delta = -delta
+	}
+	entry, err := c.server.create(args[1], fakeKindString)
+	if err != nil {
+		return err
+	}
+	current := int64(0)
+	if entry.str != "" {
+		if current, err = strconv.ParseInt(entry.str, 10, 64); err != nil {
+			return errFakeNotInt
+		}
+	}
+	current += delta
+	entry.str = strconv.FormatInt(current, 10)
+	c.server.touch(args[1])
+	return current
+}
+
+func fakeHSet(c *fakeRedisConn, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return errFakeArgs(args[0])
+	}
+	entry, err := c.server.create(args[1], fakeKindHash)
+	if err != nil {
+		return err
+	}
+	var added int64
+	for i := 2; i < len(args); i += 2 {
+		if _, ok := entry.hash[args[i]]; !ok {
+			added++
+		}
+		entry.hash[args[i]] = args[i+1]
+	}
+	c.server.touch(args[1])
+	if strings.ToUpper(args[0]) == "HMSET" {
+		return fakeStatus("OK")
+	}
+	return added
+}
+
+func fakeHSetNX(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.create(args[1], fakeKindHash)
+	if err != nil {
+		return err
+	}
+	if _, ok := entry.hash[args[2]]; ok {
+		return int64(0)
+	}
+	entry.hash[args[2]] = args[3]
+	c.server.touch(args[1])
+	return int64(1)
+}
+
+func fakeHGet(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindHash)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+	if value, ok := entry.hash[args[2]]; ok {
+		return value
+	}
+	return nil
+}
+
+func fakeHMGet(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindHash)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, 0, len(args)-2)
+	for _, field := range args[2:] {
+		if entry == nil {
+			values = append(values, nil)
+			continue
+		}
+		if value, ok := entry.hash[field]; ok {
+			values = append(values, value)
+		} else {
+			values = append(values, nil)
+		}
+	}
+	return values
+}
+
+func fakeHDel(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindHash)
+	if err != nil || entry == nil {
+		if err != nil {
+			return err
+		}
+		return int64(0)
+	}
+	var n int64
+	for _, field := range args[2:] {
+		if _, ok := entry.hash[field]; ok {
+			delete(entry.hash, field)
+			n++
+		}
+	}
+	if n > 0 {
+		c.server.touch(args[1])
+		c.server.removeIfEmpty(args[1], entry)
+	}
+	return n
+}
+
+func fakeHLen(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindHash)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	return int64(len(entry.hash))
+}
+
+func fakeHExists(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindHash)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	if _, ok := entry.hash[args[2]]; ok {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func sortedFakeFields(entry *fakeRedisEntry) []string {
+	if entry == nil {
+		return nil
+	}
+	fields := make([]string, 0, len(entry.hash))
+	for field := range entry.hash {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func fakeHGetAll(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindHash)
+	if err != nil {
+		return err
+	}
+	values := make([]string, 0)
+	for _, field := range sortedFakeFields(entry) {
+		values = append(values, field, entry.hash[field])
+	}
+	return values
+}
+
+func fakeHKeys(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindHash)
+	if err != nil {
+		return err
+	}
+	fields := sortedFakeFields(entry)
+	if fields == nil {
+		fields = []string{}
+	}
+	return fields
+}
+
+func fakeHVals(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindHash)
+	if err != nil {
+		return err
+	}
+	values := make([]string, 0)
+	for _, field := range sortedFakeFields(entry) {
+		values = append(values, entry.hash[field])
+	}
+	return values
+}
+
+func fakeHIncrBy(c *fakeRedisConn, args []string) interface{} {
+	delta, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return errFakeNotInt
+	}
+	entry, err := c.server.create(args[1], fakeKindHash)
+	if err != nil {
+		return err
+	}
+	current := int64(0)
+	if value, ok := entry.hash[args[2]]; ok {
+		if current, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return errors.New("ERR hash value is not an integer")
+		}
+	}
+	current += delta
+	entry.hash[args[2]] = strconv.FormatInt(current, 10)
+	c.server.touch(args[1])
+	return current
+}
+
+func fakePush(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.create(args[1], fakeKindList)
+	if err != nil {
+		return err
+	}
+	for _, value := range args[2:] {
+		if strings.ToUpper(args[0]) == "LPUSH" {
+			entry.list = append([]string{value}, entry.list...)
+		} else {
+			entry.list = append(entry.list, value)
+		}
+	}
+	c.server.touch(args[1])
+	return int64(len(entry.list))
+}
+
+func fakePop(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindList)
+	if err != nil {
+		return err
+	}
+	count, withCount := 1, len(args) > 2
+	if withCount {
+		if count, err = strconv.Atoi(args[2]); err != nil || count < 0 {
+			return errors.New("ERR value is out of range, must be positive")
+		}
+	}
+	if entry == nil {
+		if withCount {
+			return fakeNilArray{}
+		}
+		return nil
+	}
+	if count > len(entry.list) {
+		count = len(entry.list)
+	}
+	var popped []string
+	if strings.ToUpper(args[0]) == "LPOP" {
+		popped = append(popped, entry.list[:count]...)
+		entry.list = entry.list[count:]
+	} else {
+		for i := 0; i < count; i++ {
+			popped = append(popped, entry.list[len(entry.list)-1-i])
+		}
+		entry.list = entry.list[:len(entry.list)-count]
+	}
+	c.server.touch(args[1])
+	c.server.removeIfEmpty(args[1], entry)
+	if withCount {
+		return popped
+	}
+	return popped[0]
+}
+
+func fakeLLen(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindList)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	return int64(len(entry.list))
+}
+
+// fakeListRange 将 Redis 风格的 start/stop (支持负数) 转换为切片下标, 结果为空时 ok 为 false
+func fakeListRange(length int, startArg, stopArg string) (start, stop int, ok bool, err error) {
+	s, err1 := strconv.Atoi(startArg)
+	e, err2 := strconv.Atoi(stopArg)
+	if err1 != nil || err2 != nil {
+		return 0, 0, false, errFakeNotInt
+	}
+	if s < 0 {
+		s += length
+	}
+	if e < 0 {
+		e += length
+	}
+	if s < 0 {
+		s = 0
+	}
+	if e >= length {
+		e = length - 1
+	}
+	if s > e || s >= length {
+		return 0, 0, false, nil
+	}
+	return s, e + 1, true, nil
+}
+
+func fakeLIndex(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindList)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+	start, _, ok, err := fakeListRange(len(entry.list), args[2], args[2])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return entry.list[start]
+}
+
+func fakeLRange(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindList)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return []string{}
+	}
+	start, stop, ok, err := fakeListRange(len(entry.list), args[2], args[3])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return []string{}
+	}
+	return append([]string{}, entry.list[start:stop]...)
+}
+
+func fakeLTrim(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindList)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return fakeStatus("OK")
+	}
+	start, stop, ok, err := fakeListRange(len(entry.list), args[2], args[3])
+	if err != nil {
+		return err
+	}
+	if ok {
+		entry.list = append([]string{}, entry.list[start:stop]...)
+	} else {
+		entry.list = nil
+	}
+	c.server.touch(args[1])
+	c.server.removeIfEmpty(args[1], entry)
+	return fakeStatus("OK")
+}
+
+func fakeBFReserve(c *fakeRedisConn, args []string) interface{} {
+	if c.server.lookup(args[1]) != nil {
+		return errors.New("ERR item exists")
+	}
+	if _, err := c.server.create(args[1], fakeKindBloom); err != nil {
+		return err
+	}
+	c.server.touch(args[1])
+	return fakeStatus("OK")
+}
+
+func fakeBFAdd(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.create(args[1], fakeKindBloom)
+	if err != nil {
+		return err
+	}
+	results := make([]interface{}, 0, len(args)-2)
+	for _, item := range args[2:] {
+		if _, ok := entry.set[item]; ok {
+			results = append(results, int64(0))
+			continue
+		}
+		entry.set[item] = struct{}{}
+		results = append(results, int64(1))
+	}
+	c.server.touch(args[1])
+	if strings.ToUpper(args[0]) == "BF.ADD" {
+		return results[0]
+	}
+	return results
+}
+
+func fakeBFExists(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindBloom)
+	if err != nil {
+		return err
+	}
+	results := make([]interface{}, 0, len(args)-2)
+	for _, item := range args[2:] {
+		exists := int64(0)
+		if entry != nil {
+			if _, ok := entry.set[item]; ok {
+				exists = 1
+			}
+		}
+		results = append(results, exists)
+	}
+	if strings.ToUpper(args[0]) == "BF.EXISTS" {
+		return results[0]
+	}
+	return results
+}
+
+// readFakeCommand 读取一条 RESP 数组形式的命令, 同时兼容 inline 命令
+func readFakeCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := readFakeLine(rd)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err = readFakeLine(rd)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("unexpected %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readFakeLine(rd *bufio.Reader) (string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeFakeReply(buf *bytes.Buffer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		buf.WriteString("$-1\r\n")
+	case fakeNilArray:
+		buf.WriteString("*-1\r\n")
+	case fakeMultiReply:
+		for _, item := range v {
+			writeFakeReply(buf, item)
+		}
+	case fakeStatus:
+		buf.WriteString("+" + string(v) + "\r\n")
+	case error:
+		buf.WriteString("-" + strings.ReplaceAll(v.Error(), "\r\n", " ") + "\r\n")
+	case int64:
+		buf.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case int:
+		buf.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case string:
+		buf.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case []string:
+		buf.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeFakeReply(buf, item)
+		}
+	case []interface{}:
+		buf.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeFakeReply(buf, item)
+		}
+	default:
+		writeFakeReply(buf, fmt.Sprint(v))
+	}
+}
+
+// matchRedisPattern 按 Redis 的 glob 规则匹配 key, 支持 * ? [abc] [^a] [a-z] 与 \ 转义
+func matchRedisPattern(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchRedisPattern(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				return pattern == s
+			}
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if s[0] >= class[i] && s[0] <= class[i+2] {
+						matched = true
+					}
+					i += 2
+					continue
+				}
+				if class[i] == s[0] {
+					matched = true
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[end+2:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
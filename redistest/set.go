@@ -0,0 +1,281 @@
+package redistest
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const fakeKindSet = "set"
+
+func fakeSAdd(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.create(args[1], fakeKindSet)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, member := range args[2:] {
+		if _, ok := entry.set[member]; !ok {
+			entry.set[member] = struct{}{}
+			n++
+		}
+	}
+	c.server.touch(args[1])
+	return n
+}
+
+func fakeSRem(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindSet)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	var n int64
+	for _, member := range args[2:] {
+		if _, ok := entry.set[member]; ok {
+			delete(entry.set, member)
+			n++
+		}
+	}
+	if n > 0 {
+		c.server.touch(args[1])
+		c.server.removeIfEmpty(args[1], entry)
+	}
+	return n
+}
+
+// fakeSMembers 按字典序返回, 便于测试断言
+func fakeSMembers(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindSet)
+	if err != nil {
+		return err
+	}
+	members := []string{}
+	if entry != nil {
+		for member := range entry.set {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+	}
+	return members
+}
+
+func fakeSCard(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindSet)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	return int64(len(entry.set))
+}
+
+func fakeSIsMember(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindSet)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	if _, ok := entry.set[args[2]]; ok {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func fakeSMIsMember(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindSet)
+	if err != nil {
+		return err
+	}
+	replies := make([]interface{}, 0, len(args)-2)
+	for _, member := range args[2:] {
+		found := int64(0)
+		if entry != nil {
+			if _, ok := entry.set[member]; ok {
+				found = 1
+			}
+		}
+		replies = append(replies, found)
+	}
+	return replies
+}
+
+// fakeSetMembers 集合的成员按字典序排列, 使随机类命令的结果只取决于 math/rand
+func fakeSetMembers(entry *fakeRedisEntry) []string {
+	if entry == nil {
+		return nil
+	}
+	members := make([]string, 0, len(entry.set))
+	for member := range entry.set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// fakeSRandMember 与 SPOP 共用: count 为负数时 (仅 SRANDMEMBER) 允许重复
+func fakeSRandMember(c *fakeRedisConn, args []string) interface{} {
+	pop := strings.ToUpper(args[0]) == "SPOP"
+	if len(args) > 3 {
+		return errFakeSyntax
+	}
+	count, withCount := 1, len(args) == 3
+	if withCount {
+		n, err := strconv.Atoi(args[2])
+		if err != nil || (pop && n < 0) {
+			return errors.New("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	entry, err := c.server.lookupKind(args[1], fakeKindSet)
+	if err != nil {
+		return err
+	}
+	members := fakeSetMembers(entry)
+	if len(members) == 0 {
+		if withCount {
+			return []string{}
+		}
+		return nil
+	}
+	var picked []string
+	if count < 0 {
+		for i := 0; i < -count; i++ {
+			picked = append(picked, members[rand.Intn(len(members))])
+		}
+	} else {
+		rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+		if count > len(members) {
+			count = len(members)
+		}
+		picked = members[:count]
+	}
+	if pop && len(picked) > 0 {
+		for _, member := range picked {
+			delete(entry.set, member)
+		}
+		c.server.touch(args[1])
+		c.server.removeIfEmpty(args[1], entry)
+	}
+	if withCount {
+		return picked
+	}
+	return picked[0]
+}
+
+// fakeSetAlgebra SINTER/SUNION/SDIFF 及对应的 STORE 命令
+func fakeSetAlgebra(c *fakeRedisConn, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	store := strings.HasSuffix(name, "STORE")
+	keys := args[1:]
+	if store {
+		keys = args[2:]
+	}
+	sets := make([]*fakeRedisEntry, len(keys))
+	for i, key := range keys {
+		entry, err := c.server.lookupKind(key, fakeKindSet)
+		if err != nil {
+			return err
+		}
+		sets[i] = entry
+	}
+	result := make(map[string]struct{})
+	for _, member := range fakeSetMembers(sets[0]) {
+		result[member] = struct{}{}
+	}
+	for _, entry := range sets[1:] {
+		switch strings.TrimSuffix(name, "STORE") {
+		case "SINTER":
+			for member := range result {
+				if entry == nil {
+					delete(result, member)
+				} else if _, ok := entry.set[member]; !ok {
+					delete(result, member)
+				}
+			}
+		case "SUNION":
+			for _, member := range fakeSetMembers(entry) {
+				result[member] = struct{}{}
+			}
+		case "SDIFF":
+			for _, member := range fakeSetMembers(entry) {
+				delete(result, member)
+			}
+		}
+	}
+	if !store {
+		return sortedKeys(result)
+	}
+	c.server.remove(args[1])
+	if len(result) > 0 {
+		entry, err := c.server.create(args[1], fakeKindSet)
+		if err != nil {
+			return err
+		}
+		entry.set = result
+	}
+	c.server.touch(args[1])
+	return int64(len(result))
+}
+
+// fakeSScan 按字典序分页, 游标为下一页的起始下标
+func fakeSScan(c *fakeRedisConn, args []string) interface{} {
+	cursor, err := strconv.Atoi(args[2])
+	if err != nil || cursor < 0 {
+		return errors.New("ERR invalid cursor")
+	}
+	pattern, count := "*", 10
+	for i := 3; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return errFakeSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count <= 0 {
+				return errFakeSyntax
+			}
+		default:
+			return errFakeSyntax
+		}
+	}
+	entry, err := c.server.lookupKind(args[1], fakeKindSet)
+	if err != nil {
+		return err
+	}
+	members := fakeSetMembers(entry)
+	end := cursor + count
+	if end > len(members) {
+		end = len(members)
+	}
+	matched := []string{}
+	if cursor < len(members) {
+		for _, member := range members[cursor:end] {
+			if matchRedisPattern(pattern, member) {
+				matched = append(matched, member)
+			}
+		}
+	}
+	next := end
+	if next >= len(members) {
+		next = 0
+	}
+	return []interface{}{strconv.Itoa(next), matched}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,612 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errFakeNotFloat = errors.New("ERR value is not a valid float")
+
+type fakeZMember struct {
+	member string
+	score  float64
+}
+
+// sortedZSet 按 score, member 升序排列, 与 Redis 一致
+func sortedZSet(zset map[string]float64) []fakeZMember {
+	members := make([]fakeZMember, 0, len(zset))
+	for member, score := range zset {
+		members = append(members, fakeZMember{member: member, score: score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].member < members[j].member
+	})
+	return members
+}
+
+func formatFakeFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// parseFakeZAddFlags 解析 ZADD/GEOADD 的 NX/XX/CH 选项, 返回第一个非选项参数的下标
+func parseFakeZAddFlags(args []string) (nx, xx, ch bool, next int) {
+	next = 2
+	for ; next < len(args); next++ {
+		switch strings.ToUpper(args[next]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "CH":
+			ch = true
+		default:
+			return
+		}
+	}
+	return
+}
+
+// zadd 写入成员并返回新增 (ch 为 true 时为新增与修改) 的数量
+func (s *Server) zadd(key string, members []fakeZMember, nx, xx, ch bool) interface{} {
+	if nx && xx {
+		return errors.New("ERR XX and NX options at the same time are not compatible")
+	}
+	entry, err := s.create(key, fakeKindZSet)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, item := range members {
+		old, exists := entry.zset[item.member]
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+		entry.zset[item.member] = item.score
+		if !exists || (ch && old != item.score) {
+			n++
+		}
+	}
+	s.touch(key)
+	s.removeIfEmpty(key, entry)
+	return n
+}
+
+func fakeZAdd(c *fakeRedisConn, args []string) interface{} {
+	nx, xx, ch, next := parseFakeZAddFlags(args)
+	if next >= len(args) || (len(args)-next)%2 != 0 {
+		return errFakeSyntax
+	}
+	members := make([]fakeZMember, 0, (len(args)-next)/2)
+	for i := next; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			return errFakeNotFloat
+		}
+		members = append(members, fakeZMember{member: args[i+1], score: score})
+	}
+	return c.server.zadd(args[1], members, nx, xx, ch)
+}
+
+func fakeZScore(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindZSet)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+	score, ok := entry.zset[args[2]]
+	if !ok {
+		return nil
+	}
+	return formatFakeFloat(score)
+}
+
+func fakeZCard(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindZSet)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	return int64(len(entry.zset))
+}
+
+func fakeZRem(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindZSet)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	var n int64
+	for _, member := range args[2:] {
+		if _, ok := entry.zset[member]; ok {
+			delete(entry.zset, member)
+			n++
+		}
+	}
+	if n > 0 {
+		c.server.touch(args[1])
+		c.server.removeIfEmpty(args[1], entry)
+	}
+	return n
+}
+
+// parseFakeScoreBound 解析 ZCOUNT 等命令的分数区间端点, 支持 -inf/+inf 与 "(" 开区间
+func parseFakeScoreBound(arg string) (score float64, exclusive bool, err error) {
+	if strings.HasPrefix(arg, "(") {
+		exclusive = true
+		arg = arg[1:]
+	}
+	switch strings.ToLower(arg) {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	score, err = strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, false, errors.New("ERR min or max is not a float")
+	}
+	return score, exclusive, nil
+}
+
+func fakeZCount(c *fakeRedisConn, args []string) interface{} {
+	min, minExclusive, err := parseFakeScoreBound(args[2])
+	if err != nil {
+		return err
+	}
+	max, maxExclusive, err := parseFakeScoreBound(args[3])
+	if err != nil {
+		return err
+	}
+	entry, err := c.server.lookupKind(args[1], fakeKindZSet)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	var n int64
+	for _, score := range entry.zset {
+		if (score > min || (!minExclusive && score == min)) && (score < max || (!maxExclusive && score == max)) {
+			n++
+		}
+	}
+	return n
+}
+
+func fakeZRemRangeByScore(c *fakeRedisConn, args []string) interface{} {
+	min, minExclusive, err := parseFakeScoreBound(args[2])
+	if err != nil {
+		return err
+	}
+	max, maxExclusive, err := parseFakeScoreBound(args[3])
+	if err != nil {
+		return err
+	}
+	entry, err := c.server.lookupKind(args[1], fakeKindZSet)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return int64(0)
+	}
+	var n int64
+	for member, score := range entry.zset {
+		if (score > min || (!minExclusive && score == min)) && (score < max || (!maxExclusive && score == max)) {
+			delete(entry.zset, member)
+			n++
+		}
+	}
+	if n > 0 {
+		c.server.touch(args[1])
+		c.server.removeIfEmpty(args[1], entry)
+	}
+	return n
+}
+
+// fakeZRange 仅支持按排名的 ZRANGE key start stop [REV] [WITHSCORES]
+func fakeZRange(c *fakeRedisConn, args []string) interface{} {
+	var rev, withScores bool
+	for _, arg := range args[4:] {
+		switch strings.ToUpper(arg) {
+		case "REV":
+			rev = true
+		case "WITHSCORES":
+			withScores = true
+		default:
+			return errFakeSyntax
+		}
+	}
+	entry, err := c.server.lookupKind(args[1], fakeKindZSet)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return []string{}
+	}
+	members := sortedZSet(entry.zset)
+	if rev {
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+	}
+	start, stop, ok, err := fakeListRange(len(members), args[2], args[3])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return []string{}
+	}
+	var reply []string
+	for _, item := range members[start:stop] {
+		reply = append(reply, item.member)
+		if withScores {
+			reply = append(reply, formatFakeFloat(item.score))
+		}
+	}
+	return reply
+}
+
+// 以下为 GEO 命令, 编码方式与 Redis 一致: 经纬度各 26 位交织为 52 位整数作为有序集合的 score
+const (
+	fakeGeoStep        = 26
+	fakeGeoEarthRadius = 6372797.560856
+)
+
+// Redis GEO 支持的坐标范围与距离单位, 与 go_toolbox 中的定义一致
+const (
+	geoMinLongitude = -180.0
+	geoMaxLongitude = 180.0
+	geoMinLatitude  = -85.05112878
+	geoMaxLatitude  = 85.05112878
+
+	geoUnitMeters     = "m"
+	geoUnitKilometers = "km"
+	geoUnitMiles      = "mi"
+	geoUnitFeet       = "ft"
+)
+
+func validGeoCoordinate(longitude, latitude float64) bool {
+	return longitude >= geoMinLongitude && longitude <= geoMaxLongitude &&
+		latitude >= geoMinLatitude && latitude <= geoMaxLatitude
+}
+
+func fakeGeoInterleave(lat, lon uint64) uint64 {
+	var hash uint64
+	for i := 0; i < fakeGeoStep; i++ {
+		hash |= (lat>>i&1)<<(2*i) | (lon>>i&1)<<(2*i+1)
+	}
+	return hash
+}
+
+func fakeGeoEncode(lon, lat float64) float64 {
+	cells := float64(uint64(1) << fakeGeoStep)
+	latBits := uint64((lat - geoMinLatitude) / (geoMaxLatitude - geoMinLatitude) * cells)
+	lonBits := uint64((lon - geoMinLongitude) / (geoMaxLongitude - geoMinLongitude) * cells)
+	// 坐标恰好位于上边界时落在最后一个格子
+	if latBits >= 1<<fakeGeoStep {
+		latBits = 1<<fakeGeoStep - 1
+	}
+	if lonBits >= 1<<fakeGeoStep {
+		lonBits = 1<<fakeGeoStep - 1
+	}
+	return float64(fakeGeoInterleave(latBits, lonBits))
+}
+
+// fakeGeoDecode 返回 score 对应格子的中心点
+func fakeGeoDecode(score float64) (lon, lat float64) {
+	hash := uint64(score)
+	var latBits, lonBits uint64
+	for i := 0; i < fakeGeoStep; i++ {
+		latBits |= (hash >> (2 * i) & 1) << i
+		lonBits |= (hash >> (2*i + 1) & 1) << i
+	}
+	cells := float64(uint64(1) << fakeGeoStep)
+	latCell := (geoMaxLatitude - geoMinLatitude) / cells
+	lonCell := (geoMaxLongitude - geoMinLongitude) / cells
+	lat = geoMinLatitude + (float64(latBits)+0.5)*latCell
+	lon = geoMinLongitude + (float64(lonBits)+0.5)*lonCell
+	return lon, lat
+}
+
+func fakeGeoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lat2r := lat1*math.Pi/180, lat2*math.Pi/180
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2 - lon1) * math.Pi / 180 / 2)
+	return 2 * fakeGeoEarthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+func fakeGeoUnit(unit string) (float64, error) {
+	switch strings.ToLower(unit) {
+	case geoUnitMeters:
+		return 1, nil
+	case geoUnitKilometers:
+		return 1000, nil
+	case geoUnitMiles:
+		return 1609.34, nil
+	case geoUnitFeet:
+		return 0.3048, nil
+	}
+	return 0, errors.New("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+func formatFakeGeoDist(d float64) string {
+	return strconv.FormatFloat(d, 'f', 4, 64)
+}
+
+func fakeGeoAdd(c *fakeRedisConn, args []string) interface{} {
+	nx, xx, ch, next := parseFakeZAddFlags(args)
+	if next >= len(args) || (len(args)-next)%3 != 0 {
+		return errFakeSyntax
+	}
+	members := make([]fakeZMember, 0, (len(args)-next)/3)
+	for i := next; i < len(args); i += 3 {
+		lon, err1 := strconv.ParseFloat(args[i], 64)
+		lat, err2 := strconv.ParseFloat(args[i+1], 64)
+		if err1 != nil || err2 != nil {
+			return errFakeNotFloat
+		}
+		if !validGeoCoordinate(lon, lat) {
+			return fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", lon, lat)
+		}
+		members = append(members, fakeZMember{member: args[i+2], score: fakeGeoEncode(lon, lat)})
+	}
+	return c.server.zadd(args[1], members, nx, xx, ch)
+}
+
+func fakeGeoPos(c *fakeRedisConn, args []string) interface{} {
+	entry, err := c.server.lookupKind(args[1], fakeKindZSet)
+	if err != nil {
+		return err
+	}
+	reply := make([]interface{}, 0, len(args)-2)
+	for _, member := range args[2:] {
+		score, ok := 0.0, false
+		if entry != nil {
+			score, ok = entry.zset[member]
+		}
+		if !ok {
+			reply = append(reply, fakeNilArray{})
+			continue
+		}
+		lon, lat := fakeGeoDecode(score)
+		reply = append(reply, []string{formatFakeFloat(lon), formatFakeFloat(lat)})
+	}
+	return reply
+}
+
+func fakeGeoDist(c *fakeRedisConn, args []string) interface{} {
+	if len(args) > 5 {
+		return errFakeSyntax
+	}
+	unit := 1.0
+	if len(args) == 5 {
+		var err error
+		if unit, err = fakeGeoUnit(args[4]); err != nil {
+			return err
+		}
+	}
+	entry, err := c.server.lookupKind(args[1], fakeKindZSet)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+	score1, ok1 := entry.zset[args[2]]
+	score2, ok2 := entry.zset[args[3]]
+	if !ok1 || !ok2 {
+		return nil
+	}
+	lon1, lat1 := fakeGeoDecode(score1)
+	lon2, lat2 := fakeGeoDecode(score2)
+	return formatFakeGeoDist(fakeGeoDistance(lon1, lat1, lon2, lat2) / unit)
+}
+
+type fakeGeoHit struct {
+	member string
+	score  float64
+	dist   float64
+}
+
+// fakeGeoSearch 实现 GEOSEARCH key ... 与 GEOSEARCHSTORE dst key ... [STOREDIST]
+func fakeGeoSearch(c *fakeRedisConn, args []string) interface{} {
+	store := strings.ToUpper(args[0]) == "GEOSEARCHSTORE"
+	dst, key, i := "", args[1], 2
+	if store {
+		dst, key, i = args[1], args[2], 3
+	}
+	var (
+		fromMember                  string
+		hasMember, hasLonLat        bool
+		lon, lat                    float64
+		radius, width, height, unit float64
+		byRadius, byBox             bool
+		sortOrder                   string
+		count                       int
+		countAny                    bool
+		withCoord, withDist         bool
+		withHash, storeDist         bool
+	)
+	parseFloats := func(n int) ([]float64, error) {
+		if i+n >= len(args) {
+			return nil, errFakeSyntax
+		}
+		values := make([]float64, n)
+		for j := range values {
+			v, err := strconv.ParseFloat(args[i+1+j], 64)
+			if err != nil {
+				return nil, errFakeNotFloat
+			}
+			values[j] = v
+		}
+		return values, nil
+	}
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "FROMMEMBER":
+			if i+1 >= len(args) {
+				return errFakeSyntax
+			}
+			fromMember, hasMember = args[i+1], true
+			i++
+		case "FROMLONLAT":
+			values, err := parseFloats(2)
+			if err != nil {
+				return err
+			}
+			lon, lat, hasLonLat = values[0], values[1], true
+			i += 2
+		case "BYRADIUS":
+			values, err := parseFloats(1)
+			if err != nil || i+2 >= len(args) {
+				return errFakeSyntax
+			}
+			if unit, err = fakeGeoUnit(args[i+2]); err != nil {
+				return err
+			}
+			radius, byRadius = values[0]*unit, true
+			i += 2
+		case "BYBOX":
+			values, err := parseFloats(2)
+			if err != nil || i+3 >= len(args) {
+				return errFakeSyntax
+			}
+			if unit, err = fakeGeoUnit(args[i+3]); err != nil {
+				return err
+			}
+			width, height, byBox = values[0]*unit, values[1]*unit, true
+			i += 3
+		case "ASC", "DESC":
+			sortOrder = strings.ToUpper(args[i])
+		case "COUNT":
+			if i+1 >= len(args) {
+				return errFakeSyntax
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return errors.New("ERR COUNT must be > 0")
+			}
+			count = n
+			i++
+		case "ANY":
+			countAny = true
+		case "WITHCOORD":
+			withCoord = !store
+		case "WITHDIST":
+			withDist = !store
+		case "WITHHASH":
+			withHash = !store
+		case "STOREDIST":
+			if !store {
+				return errFakeSyntax
+			}
+			storeDist = true
+		default:
+			return errFakeSyntax
+		}
+	}
+	if hasMember == hasLonLat || byRadius == byBox {
+		return errFakeSyntax
+	}
+	if countAny && count == 0 {
+		return errors.New("ERR the ANY argument requires COUNT argument")
+	}
+	if count > 0 && sortOrder == "" && !countAny {
+		sortOrder = "ASC"
+	}
+
+	entry, err := c.server.lookupKind(key, fakeKindZSet)
+	if err != nil {
+		return err
+	}
+	var hits []fakeGeoHit
+	if entry != nil {
+		if hasMember {
+			score, ok := entry.zset[fromMember]
+			if !ok {
+				return errors.New("ERR could not decode requested zset member")
+			}
+			lon, lat = fakeGeoDecode(score)
+		}
+		for _, item := range sortedZSet(entry.zset) {
+			mlon, mlat := fakeGeoDecode(item.score)
+			dist := fakeGeoDistance(lon, lat, mlon, mlat)
+			if byRadius && dist > radius {
+				continue
+			}
+			if byBox && (fakeGeoEarthRadius*math.Abs(mlat-lat)*math.Pi/180 > height/2 ||
+				fakeGeoDistance(lon, mlat, mlon, mlat) > width/2) {
+				continue
+			}
+			hits = append(hits, fakeGeoHit{member: item.member, score: item.score, dist: dist / unit})
+			if countAny && len(hits) == count {
+				break
+			}
+		}
+	}
+	switch sortOrder {
+	case "ASC":
+		sort.SliceStable(hits, func(a, b int) bool { return hits[a].dist < hits[b].dist })
+	case "DESC":
+		sort.SliceStable(hits, func(a, b int) bool { return hits[a].dist > hits[b].dist })
+	}
+	if count > 0 && len(hits) > count {
+		hits = hits[:count]
+	}
+
+	if store {
+		c.server.remove(dst)
+		if len(hits) == 0 {
+			return int64(0)
+		}
+		members := make([]fakeZMember, 0, len(hits))
+		for _, hit := range hits {
+			score := hit.score
+			if storeDist {
+				score = hit.dist
+			}
+			members = append(members, fakeZMember{member: hit.member, score: score})
+		}
+		return c.server.zadd(dst, members, false, false, false)
+	}
+
+	reply := make([]interface{}, 0, len(hits))
+	for _, hit := range hits {
+		if !withCoord && !withDist && !withHash {
+			reply = append(reply, hit.member)
+			continue
+		}
+		item := []interface{}{hit.member}
+		if withDist {
+			item = append(item, formatFakeGeoDist(hit.dist))
+		}
+		if withHash {
+			item = append(item, int64(hit.score))
+		}
+		if withCoord {
+			mlon, mlat := fakeGeoDecode(hit.score)
+			item = append(item, []string{formatFakeFloat(mlon), formatFakeFloat(mlat)})
+		}
+		reply = append(reply, item)
+	}
+	return reply
+}
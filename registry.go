@@ -0,0 +1,360 @@
+package go_toolbox
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	registryKindRedis      = "redis"
+	registryKindClickHouse = "clickhouse"
+)
+
+// ErrRegistryNotFound 配置中不存在该名称
+var ErrRegistryNotFound = errors.New("未配置该实例")
+
+// RegistryRedisConf 具名 Redis 实例配置
+// DependsOn 为该实例依赖的其他实例, 格式为 "redis:名称" 或 "clickhouse:名称",
+// 依赖会先于该实例初始化, 并在该实例关闭之后关闭
+type RegistryRedisConf struct {
+	RedisConf
+	DependsOn []string `json:"DependsOn"`
+}
+
+// RegistryClickHouseConf 具名 ClickHouse 实例配置, DependsOn 同 RegistryRedisConf
+type RegistryClickHouseConf struct {
+	ClickhouseConf
+	DependsOn []string `json:"DependsOn"`
+}
+
+// RegistryConf 多实例配置, key 为实例名称
+type RegistryConf struct {
+	Redis      map[string]RegistryRedisConf      `json:"Redis"`
+	ClickHouse map[string]RegistryClickHouseConf `json:"ClickHouse"`
+}
+
+type registryCloser struct {
+	name  string
+	close func() error
+}
+
+// Registry 具名 Redis / ClickHouse 实例注册表
+// 实例在第一次 Redis(name)/ClickHouse(name) 时按配置创建, 创建失败不会缓存, 下次调用时重试
+// 已创建的实例只需读锁; 创建 (包含网络初始化) 期间不持有注册表的锁, 同一实例的并发调用等待同一次创建, 不同实例互不阻塞
+// Close 按初始化的逆序关闭全部实例, 后初始化的实例 (依赖方) 先关闭
+type Registry struct {
+	mu         sync.RWMutex
+	conf       RegistryConf
+	opts       []ConnectOption
+	redis      map[string]RedisStore
+	clickHouse map[string]ClickHouseStore
+	pending    map[string]*registryInit
+	closers    []registryCloser
+	closed     bool
+}
+
+// registryInit 一次进行中的实例创建, 完成后关闭 done
+type registryInit struct {
+	done chan struct{}
+	err  error
+}
+
+// NewRegistry 创建注册表, opts 用于创建每个实例
+func NewRegistry(conf RegistryConf, opts ...ConnectOption) *Registry {
+	return &Registry{
+		conf:       conf,
+		opts:       opts,
+		redis:      make(map[string]RedisStore),
+		clickHouse: make(map[string]ClickHouseStore),
+		pending:    make(map[string]*registryInit),
+	}
+}
+
+// Redis 获取具名 Redis 实例, 未初始化时按配置创建; 返回 RedisStore, 测试中可通过 RegisterRedis 注册 FakeRedis 替换
+func (g *Registry) Redis(name string) (RedisStore, error) {
+	g.mu.RLock()
+	handler, ok := g.redis[name]
+	closed := g.closed
+	g.mu.RUnlock()
+	if closed {
+		return nil, ErrHandlerClosed
+	}
+	if ok {
+		return handler, nil
+	}
+	if err := g.init(registryKindRedis, name); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.redis[name], nil
+}
+
+// RedisHandler 获取具名 Redis 实例的 ModelRedisHandler, 用于 RedisStore 之外的方法;
+// 注册的实例不是 ModelRedisHandler (或嵌入它的 FakeRedis) 时返回错误
+func (g *Registry) RedisHandler(name string) (*ModelRedisHandler, error) {
+	store, err := g.Redis(name)
+	if err != nil {
+		return nil, err
+	}
+	if handler, ok := store.(interface{ modelRedisHandler() *ModelRedisHandler }); ok {
+		return handler.modelRedisHandler(), nil
+	}
+	return nil, fmt.Errorf("Redis 实例 %s 的类型 %T 不是 ModelRedisHandler", name, store)
+}
+
+// modelRedisHandler 供 RedisHandler 取回具体类型, 嵌入 ModelRedisHandler 的类型同样具有该方法
+func (r *ModelRedisHandler) modelRedisHandler() *ModelRedisHandler {
+	return r
+}
+
+// ClickHouse 获取具名 ClickHouse 实例, 未初始化时按配置创建
+func (g *Registry) ClickHouse(name string) (ClickHouseStore, error) {
+	g.mu.RLock()
+	handler, ok := g.clickHouse[name]
+	closed := g.closed
+	g.mu.RUnlock()
+	if closed {
+		return nil, ErrHandlerClosed
+	}
+	if ok {
+		return handler, nil
+	}
+	if err := g.init(registryKindClickHouse, name); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.clickHouse[name], nil
+}
+
+// RegisterRedis 注册已创建的 Redis 实例 (例如测试中的 FakeRedis), 关闭注册表时一并关闭
+func (g *Registry) RegisterRedis(name string, handler RedisStore) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.checkRegister(registryKindRedis, name, g.redis[name] != nil); err != nil {
+		return err
+	}
+	g.redis[name] = handler
+	g.closers = append(g.closers, registryCloser{name: registryKindRedis + ":" + name, close: handler.ShutdownRedisHandler})
+	return nil
+}
+
+// RegisterClickHouse 注册已创建的 ClickHouse 实例 (例如测试中的 FakeClickHouse), 关闭注册表时一并关闭
+func (g *Registry) RegisterClickHouse(name string, handler ClickHouseStore) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.checkRegister(registryKindClickHouse, name, g.clickHouse[name] != nil); err != nil {
+		return err
+	}
+	g.clickHouse[name] = handler
+	g.closers = append(g.closers, registryCloser{name: registryKindClickHouse + ":" + name, close: handler.ShutdownCKHandler})
+	return nil
+}
+
+// Defer 注册随注册表关闭的其他组件 (如 Batcher, 监听器), 会在此前已初始化的实例之前关闭
+func (g *Registry) Defer(name string, fn func() error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closers = append(g.closers, registryCloser{name: name, close: fn})
+}
+
+// InitAll 初始化配置中的全部实例, 用于启动时检查配置, 遇到第一个错误即返回
+func (g *Registry) InitAll() error {
+	for _, name := range sortedKeys(g.conf.Redis) {
+		if _, err := g.Redis(name); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(g.conf.ClickHouse) {
+		if _, err := g.ClickHouse(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 按初始化的逆序关闭全部实例与 Defer 注册的组件, 返回第一个错误, 其余错误记录日志
+// 进行中的创建在完成后发现注册表已关闭, 会直接关闭新建的实例
+func (g *Registry) Close() error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return nil
+	}
+	g.closed = true
+	closers := g.closers
+	g.closers = nil
+	g.mu.Unlock()
+
+	var firstErr error
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].close(); err != nil {
+			Logger.Error(GetLogPrefix("") + "注册表关闭 " + closers[i].name + " 失败! 错误原因: " + err.Error())
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", closers[i].name, err)
+			}
+		}
+	}
+	return firstErr
+}
+
+func (g *Registry) checkRegister(kind, name string, exists bool) error {
+	if g.closed {
+		return ErrHandlerClosed
+	}
+	if exists {
+		return fmt.Errorf("%s:%s 已存在", kind, name)
+	}
+	return nil
+}
+
+// exists 实例是否已创建, 调用方持有 mu
+func (g *Registry) exists(kind, name string) bool {
+	if kind == registryKindRedis {
+		return g.redis[name] != nil
+	}
+	return g.clickHouse[name] != nil
+}
+
+// init 创建实例: 先检查依赖关系, 同一实例同时只有一个调用方执行创建, 其余调用方等待并共享结果 (失败不缓存)
+func (g *Registry) init(kind, name string) error {
+	id := kind + ":" + name
+	if err := g.checkDependencies(id, nil); err != nil {
+		return err
+	}
+	for {
+		g.mu.Lock()
+		if g.closed {
+			g.mu.Unlock()
+			return ErrHandlerClosed
+		}
+		if g.exists(kind, name) {
+			g.mu.Unlock()
+			return nil
+		}
+		if call, ok := g.pending[id]; ok {
+			g.mu.Unlock()
+			<-call.done
+			if call.err != nil {
+				return call.err
+			}
+			continue
+		}
+		call := &registryInit{done: make(chan struct{})}
+		g.pending[id] = call
+		g.mu.Unlock()
+
+		call.err = g.open(kind, name)
+		g.mu.Lock()
+		delete(g.pending, id)
+		g.mu.Unlock()
+		close(call.done)
+		return call.err
+	}
+}
+
+// open 初始化依赖后按配置创建实例, 不持有注册表的锁
+func (g *Registry) open(kind, name string) error {
+	id := kind + ":" + name
+	var dependsOn []string
+	if kind == registryKindRedis {
+		conf, ok := g.conf.Redis[name]
+		if !ok {
+			return fmt.Errorf("%s %w", id, ErrRegistryNotFound)
+		}
+		dependsOn = conf.DependsOn
+	} else {
+		conf, ok := g.conf.ClickHouse[name]
+		if !ok {
+			return fmt.Errorf("%s %w", id, ErrRegistryNotFound)
+		}
+		dependsOn = conf.DependsOn
+	}
+	for _, dep := range dependsOn {
+		depKind, depName, _ := strings.Cut(dep, ":")
+		if err := g.init(strings.ToLower(depKind), depName); err != nil {
+			return err
+		}
+	}
+
+	var (
+		redisHandler *ModelRedisHandler
+		ckHandler    ClickHouseStore
+		closer       func() error
+		err          error
+	)
+	if kind == registryKindRedis {
+		conf := g.conf.Redis[name]
+		if redisHandler, err = OpenRedisHandler(&conf.RedisConf, g.opts...); err == nil {
+			closer = redisHandler.ShutdownRedisHandler
+		}
+	} else {
+		conf := g.conf.ClickHouse[name]
+		if ckHandler, err = OpenCKHandler(&conf.ClickhouseConf, g.opts...); err == nil {
+			closer = ckHandler.ShutdownCKHandler
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s 初始化失败: %w", id, err)
+	}
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		_ = closer()
+		return ErrHandlerClosed
+	}
+	if redisHandler != nil {
+		g.redis[name] = redisHandler
+	} else {
+		g.clickHouse[name] = ckHandler
+	}
+	g.closers = append(g.closers, registryCloser{name: id, close: closer})
+	g.mu.Unlock()
+	Logger.Info(GetLogPrefix("") + "注册表初始化 " + id)
+	return nil
+}
+
+// checkDependencies 按配置检查 id 的依赖格式与循环依赖, 配置创建后不再修改, 无需加锁
+// 创建前统一检查, 保证等待其他调用方创建依赖时不会因循环依赖互相等待
+func (g *Registry) checkDependencies(id string, chain []string) error {
+	for _, seen := range chain {
+		if seen == id {
+			return fmt.Errorf("%s 存在循环依赖", id)
+		}
+	}
+	kind, name, _ := strings.Cut(id, ":")
+	var dependsOn []string
+	if kind == registryKindRedis {
+		dependsOn = g.conf.Redis[name].DependsOn
+	} else {
+		dependsOn = g.conf.ClickHouse[name].DependsOn
+	}
+	chain = append(chain, id)
+	for _, dep := range dependsOn {
+		depKind, depName, ok := strings.Cut(dep, ":")
+		if !ok {
+			return fmt.Errorf("%s 的依赖 %q 格式错误, 应为 redis:名称 或 clickhouse:名称", id, dep)
+		}
+		depKind = strings.ToLower(depKind)
+		if depKind != registryKindRedis && depKind != registryKindClickHouse {
+			return fmt.Errorf("%s 的依赖 %q 类型未知", id, dep)
+		}
+		if err := g.checkDependencies(depKind+":"+depName, chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
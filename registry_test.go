@@ -0,0 +1,145 @@
+package go_toolbox
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry(RegistryConf{
+		Redis: map[string]RegistryRedisConf{
+			"sessions": {RedisConf: RedisConf{Host: "127.0.0.1:6379", Compression: CompressionZstd}, DependsOn: []string{"redis:cache"}},
+			"cache":    {RedisConf: RedisConf{Host: "127.0.0.1:6380"}},
+			"loop":     {DependsOn: []string{"redis:loop"}},
+		},
+	})
+	events := NewFakeClickHouse()
+	if err := registry.RegisterClickHouse("events", events); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.RegisterClickHouse("events", events); err == nil {
+		t.Fatal("duplicate names should be rejected")
+	}
+
+	// Enable=false 时不连接 Redis, 可以直接初始化
+	sessions, err := registry.RedisHandler("sessions")
+	if err != nil || sessions.Compression != CompressionZstd {
+		t.Fatalf("unexpected handler: %+v %v", sessions, err)
+	}
+	if again, _ := registry.Redis("sessions"); again != RedisStore(sessions) {
+		t.Fatal("handlers should be created once")
+	}
+	if ck, err := registry.ClickHouse("events"); err != nil || ck != events {
+		t.Fatal("registered handler should be returned")
+	}
+	if _, err := registry.Redis("missing"); !errors.Is(err, ErrRegistryNotFound) {
+		t.Fatalf("expected ErrRegistryNotFound, got %v", err)
+	}
+	if _, err := registry.Redis("loop"); err == nil || !strings.Contains(err.Error(), "循环依赖") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+
+	var names []string
+	for _, closer := range registry.closers {
+		names = append(names, closer.name)
+	}
+	if strings.Join(names, ",") != "clickhouse:events,redis:cache,redis:sessions" {
+		t.Fatalf("dependencies should be initialized first: %v", names)
+	}
+
+	var order []string
+	registry.Defer("batcher", func() error {
+		order = append(order, "batcher")
+		return nil
+	})
+	registry.Defer("broken", func() error { return errors.New("boom") })
+	if err := registry.Close(); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("close error should be reported, got %v", err)
+	}
+	if len(order) != 1 || sessions.Ready() || !events.closed {
+		t.Fatal("everything should be closed")
+	}
+	if _, err := registry.Redis("cache"); !errors.Is(err, ErrHandlerClosed) {
+		t.Fatal("lookups after Close should fail")
+	}
+}
+
+func TestRegistryInitDoesNotBlockOthers(t *testing.T) {
+	// 接受连接但不回复, 300 毫秒后断开, 初始化在此期间阻塞后失败
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				time.Sleep(300 * time.Millisecond)
+				conn.Close()
+			}()
+		}
+	}()
+	registry := NewRegistry(RegistryConf{
+		Redis: map[string]RegistryRedisConf{
+			"slow":  {RedisConf: RedisConf{Host: listener.Addr().String(), Enable: true, BreakerThreshold: -1}},
+			"cache": {RedisConf: RedisConf{Host: "127.0.0.1:6380"}},
+		},
+	})
+	defer registry.Close()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = registry.Redis("slow")
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	if _, err := registry.Redis("cache"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("an instance being initialized should not block other lookups, took %v", elapsed)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err == nil || !strings.Contains(err.Error(), "redis:slow") {
+			t.Fatalf("waiting callers should share the failed initialization, got %v", err)
+		}
+	}
+}
+
+func TestRegistryRedisStore(t *testing.T) {
+	registry := NewRegistry(RegistryConf{})
+	defer registry.Close()
+
+	// Redis 实例与 ClickHouse 一样可以替换为 FakeRedis
+	fake := NewFakeRedis()
+	if err := registry.RegisterRedis("fake", fake); err != nil {
+		t.Fatal(err)
+	}
+	if store, err := registry.Redis("fake"); err != nil || store != RedisStore(fake) {
+		t.Fatal("registered fake should be returned")
+	}
+	if handler, err := registry.RedisHandler("fake"); err != nil || handler != fake.ModelRedisHandler {
+		t.Fatalf("RedisHandler should unwrap FakeRedis: %v", err)
+	}
+	other := NewFakeRedis()
+	if err := registry.RegisterRedis("dual", NewRedisMigrator(other.ModelRedisHandler, other.ModelRedisHandler, MigrationOptions{}).DualWriter()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.RedisHandler("dual"); err == nil {
+		t.Fatal("RedisHandler should reject other RedisStore implementations")
+	}
+}
@@ -0,0 +1,47 @@
+package go_toolbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore ModelRedisHandler 的方法集, 业务代码依赖该接口即可在测试中替换为 FakeRedis
+type RedisStore interface {
+	Set(key string, value interface{}, ex time.Duration) bool
+	Get(key string) (string, bool)
+	HashSet(key string, values ...interface{}) bool
+	HashGet(key, field string) (string, bool)
+	HashMSet(key string, values ...interface{}) bool
+	HashMGET(key string, fields ...string) ([]interface{}, bool)
+	HashDel(key string, fields ...string) bool
+	HashLen(key string) int64
+	GetList(key string, start, stop int64) ([]string, bool)
+	EmptyList(key string) bool
+	AppendList(key string, value interface{}) bool
+	BFAdd(key string, value string) (bool, bool)
+	BFExists(key string, value string) bool
+	Pipeline() (redis.Pipeliner, context.Context)
+	PipelineExecute(pipe redis.Pipeliner, ctx context.Context) ([]redis.Cmder, error)
+	Ready() bool
+	WaitReady(ctx context.Context) error
+	ShutdownRedisHandler() error
+}
+
+// ClickHouseStore CKHandler 的方法集, 业务代码依赖该接口即可在测试中替换为 FakeClickHouse
+type ClickHouseStore interface {
+	QueryData(items interface{}, query string) error
+	InsertData(query string, data ...interface{}) (bool, error)
+	BatchInsertData(query string, dataArrays [][]interface{}) (bool, error)
+	Ready() bool
+	WaitReady(ctx context.Context) error
+	ShutdownCKHandler() error
+}
+
+var (
+	_ RedisStore      = (*ModelRedisHandler)(nil)
+	_ RedisStore      = (*FakeRedis)(nil)
+	_ ClickHouseStore = (*CKHandler)(nil)
+	_ ClickHouseStore = (*FakeClickHouse)(nil)
+)